@@ -0,0 +1,35 @@
+// Command alertreceiver runs the fake alert webhook from service/alerttest on
+// a local port and logs every low-stock alert it receives:
+//
+//	go run ./cmd/alertreceiver -secret dev-secret
+//	APP_ALERTS_NOTIFIERS=log,webhook APP_ALERTS_WEBHOOK_URL=http://localhost:8091/alerts \
+//	APP_ALERTS_WEBHOOK_SECRET=dev-secret go run .
+//	curl http://localhost:8091/alerts
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"order-api-stat/models"
+	"order-api-stat/service/alerttest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8091", "listen address")
+	secret := flag.String("secret", "", "secret alerts must be signed with; empty accepts unsigned alerts")
+	fail := flag.Int("fail", 0, "number of alerts to reject with 503 before accepting, to exercise retries")
+	flag.Parse()
+
+	receiver := alerttest.NewReceiver(*secret)
+	receiver.FailNext(*fail)
+	receiver.OnAlert = func(alert models.LowStockEvent) {
+		log.Printf("Alert %d: product %d (%s) has %d units, reorder threshold %d",
+			alert.AlertID, alert.ProductID, alert.SKU, alert.Quantity, alert.ReorderThreshold)
+	}
+
+	log.Printf("Alert receiver listening on %s", *addr)
+	log.Printf("  APP_ALERTS_WEBHOOK_URL=http://localhost%s%s", *addr, alerttest.WebhookPath)
+	log.Fatal(http.ListenAndServe(*addr, receiver))
+}
@@ -5,14 +5,21 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
+	Server       ServerConfig
+	Database     DatabaseConfig
+	Auth         AuthConfig
+	Pagination   PaginationConfig
+	Storage      StorageConfig
+	Alerts       AlertsConfig
+	Reservations ReservationsConfig
 }
 
 // ServerConfig holds server configuration
@@ -30,6 +37,58 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// AuthConfig holds token verification configuration. Write endpoints are
+// protected only when JWKSURL or JWKSFile is set.
+type AuthConfig struct {
+	JWKSURL      string
+	JWKSFile     string
+	JWKSCacheTTL time.Duration
+}
+
+// Enabled reports whether a key source for token verification is configured
+func (a *AuthConfig) Enabled() bool {
+	return a.JWKSURL != "" || a.JWKSFile != ""
+}
+
+// PaginationConfig holds list pagination configuration. CursorSecret signs
+// pagination cursors; when empty a random secret is generated at startup.
+type PaginationConfig struct {
+	CursorSecret string
+}
+
+// StorageConfig holds configuration for uploaded product images. Images are
+// stored below ImageDir, uploads are limited to MaxImageSize bytes and
+// thumbnails fit within ThumbnailSize pixels.
+type StorageConfig struct {
+	ImageDir      string
+	MaxImageSize  int64
+	ThumbnailSize int
+}
+
+// AlertsConfig controls low-stock alerts. Notifiers lists the enabled
+// notifiers ("log", "webhook"); alerts are off when it is empty. Products are
+// checked every CheckInterval and up to BatchSize pending notifications are
+// sent per check.
+type AlertsConfig struct {
+	Notifiers      []string
+	CheckInterval  time.Duration
+	BatchSize      int
+	WebhookURL     string
+	WebhookSecret  string
+	WebhookTimeout time.Duration
+}
+
+// ReservationsConfig controls stock reservations. A reservation is held for
+// DefaultTTL unless the request asks for another TTL, which is capped at MaxTTL.
+// Every SweepInterval up to BatchSize expired reservations are released at a
+// time.
+type ReservationsConfig struct {
+	DefaultTTL    time.Duration
+	MaxTTL        time.Duration
+	SweepInterval time.Duration
+	BatchSize     int
+}
+
 // GetDSN returns database connection string
 func (d *DatabaseConfig) GetDSN() string {
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
@@ -54,6 +113,29 @@ func getEnvIntWithDefault(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvDurationWithDefault gets an environment variable as duration with a default value
+func getEnvDurationWithDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// getEnvListWithDefault gets a comma-separated environment variable as a list
+// of lower-case names. "none" yields an empty list.
+func getEnvListWithDefault(key, defaultValue string) []string {
+	var names []string
+	for _, name := range strings.Split(getEnvWithDefault(key, defaultValue), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && name != "none" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig(path string) (*Config, error) {
 	// Load .env file if it exists
@@ -75,6 +157,33 @@ func LoadConfig(path string) (*Config, error) {
 			DBName:   getEnvWithDefault("APP_DB_NAME", "order_api"),
 			SSLMode:  getEnvWithDefault("APP_DB_SSLMODE", "disable"),
 		},
+		Auth: AuthConfig{
+			JWKSURL:      getEnvWithDefault("APP_AUTH_JWKS_URL", ""),
+			JWKSFile:     getEnvWithDefault("APP_AUTH_JWKS_FILE", ""),
+			JWKSCacheTTL: getEnvDurationWithDefault("APP_AUTH_JWKS_CACHE_TTL", 5*time.Minute),
+		},
+		Pagination: PaginationConfig{
+			CursorSecret: getEnvWithDefault("APP_PAGINATION_CURSOR_SECRET", ""),
+		},
+		Storage: StorageConfig{
+			ImageDir:      getEnvWithDefault("APP_STORAGE_IMAGE_DIR", "./data/images"),
+			MaxImageSize:  int64(getEnvIntWithDefault("APP_STORAGE_MAX_IMAGE_SIZE", 10<<20)),
+			ThumbnailSize: getEnvIntWithDefault("APP_STORAGE_THUMBNAIL_SIZE", 256),
+		},
+		Alerts: AlertsConfig{
+			Notifiers:      getEnvListWithDefault("APP_ALERTS_NOTIFIERS", "log"),
+			CheckInterval:  getEnvDurationWithDefault("APP_ALERTS_CHECK_INTERVAL", time.Minute),
+			BatchSize:      getEnvIntWithDefault("APP_ALERTS_BATCH_SIZE", 100),
+			WebhookURL:     getEnvWithDefault("APP_ALERTS_WEBHOOK_URL", ""),
+			WebhookSecret:  getEnvWithDefault("APP_ALERTS_WEBHOOK_SECRET", ""),
+			WebhookTimeout: getEnvDurationWithDefault("APP_ALERTS_WEBHOOK_TIMEOUT", 10*time.Second),
+		},
+		Reservations: ReservationsConfig{
+			DefaultTTL:    getEnvDurationWithDefault("APP_RESERVATIONS_DEFAULT_TTL", 15*time.Minute),
+			MaxTTL:        getEnvDurationWithDefault("APP_RESERVATIONS_MAX_TTL", 24*time.Hour),
+			SweepInterval: getEnvDurationWithDefault("APP_RESERVATIONS_SWEEP_INTERVAL", 30*time.Second),
+			BatchSize:     getEnvIntWithDefault("APP_RESERVATIONS_BATCH_SIZE", 100),
+		},
 	}
 
 	return config, nil
@@ -2,6 +2,7 @@ package database
 
 import (
 	"log"
+	"strings"
 
 	"gorm.io/gorm"
 
@@ -14,7 +15,14 @@ func RunMigrations(db *gorm.DB) error {
 
 	// Add all models to migrate here
 	err := db.AutoMigrate(
+		&models.Category{},
 		&models.Product{},
+		&models.StockAdjustment{},
+		&models.ProductImage{},
+		&models.ProductAudit{},
+		&models.StockAlert{},
+		&models.Reservation{},
+		&models.ReservationItem{},
 	)
 
 	if err != nil {
@@ -22,6 +30,124 @@ func RunMigrations(db *gorm.DB) error {
 		return err
 	}
 
+	if err := createProductSearchIndex(db); err != nil {
+		log.Printf("Error creating product search index: %v", err)
+		return err
+	}
+
+	// At most one open alert per product, see service.StockAlertService
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_alerts_open
+		ON stock_alerts (product_id) WHERE resolved_at IS NULL`).Error; err != nil {
+		log.Printf("Error creating stock alert index: %v", err)
+		return err
+	}
+
+	if err := backfillCategories(db); err != nil {
+		log.Printf("Error backfilling product categories: %v", err)
+		return err
+	}
+
+	if err := backfillAdjustmentReasons(db); err != nil {
+		log.Printf("Error backfilling stock adjustment reasons: %v", err)
+		return err
+	}
+
+	if err := backfillAdjustmentPrices(db); err != nil {
+		log.Printf("Error backfilling stock adjustment prices: %v", err)
+		return err
+	}
+
 	log.Println("Migrations completed successfully")
 	return nil
 }
+
+// backfillCategories links products that only have a free-text category to a
+// row in the categories table. Category strings that differ only in case or
+// punctuation share a slug and so end up in one top-level category, named after
+// the first spelling seen; the product's category name is normalised to it.
+// Products that are already linked are left alone, so this is a no-op once the
+// backfill has run.
+func backfillCategories(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var names []string
+		if err := tx.Model(&models.Product{}).Unscoped().
+			Where("category_id IS NULL AND trim(category) <> ''").
+			Distinct("category").Order("category").Pluck("category", &names).Error; err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			slug := models.Slugify(name)
+			if slug == "" {
+				log.Printf("Skipping product category %q: no letters or digits", name)
+				continue
+			}
+
+			category := models.Category{Name: strings.TrimSpace(name), Slug: slug}
+			if err := tx.Where(models.Category{Slug: slug}).FirstOrCreate(&category).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Product{}).Unscoped().
+				Where("category_id IS NULL AND category = ?", name).
+				Updates(map[string]interface{}{"category_id": category.ID, "category": category.Name}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// backfillAdjustmentReasons classifies stock adjustments recorded before
+// reasons were, by the idempotency key prefixes the order service used for its
+// inventory commands. Those restocks were valued at the product's price when
+// they were applied, so they are repriced at their decrement's price where
+// there is one. New adjustments always have a reason, so this is a no-op once
+// the backfill has run.
+func backfillAdjustmentReasons(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE stock_adjustments AS restock SET unit_price = sale.unit_price
+			FROM stock_adjustments AS sale
+			WHERE restock.reason IS NULL AND restock.idempotency_key LIKE 'inventory.restock:%'
+			AND sale.idempotency_key = 'inventory.decrement:' || substr(restock.idempotency_key, length('inventory.restock:') + 1)
+			AND sale.product_id = restock.product_id AND sale.unit_price IS NOT NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE stock_adjustments SET reason = CASE
+				WHEN idempotency_key LIKE 'inventory.decrement:%' AND change < 0 THEN ?
+				WHEN idempotency_key LIKE 'inventory.restock:%' AND change > 0 THEN ?
+				ELSE ? END
+			WHERE reason IS NULL`,
+			models.AdjustmentReasonSale, models.AdjustmentReasonReturn, models.AdjustmentReasonManual).Error
+	})
+}
+
+// backfillAdjustmentPrices sets the unit price of stock adjustments recorded
+// before prices were captured to the product's current price, the best
+// estimate available for the sales statistics. Adjustments whose product is
+// gone entirely keep a NULL price and count as zero revenue.
+func backfillAdjustmentPrices(db *gorm.DB) error {
+	return db.Exec(`UPDATE stock_adjustments SET unit_price = products.price
+		FROM products WHERE products.id = stock_adjustments.product_id
+		AND stock_adjustments.unit_price IS NULL`).Error
+}
+
+// createProductSearchIndex adds the full-text search column used by
+// GET /products?q=. It is a generated column, so PostgreSQL keeps it in sync
+// with name, SKU and description; matches in the name and SKU rank higher.
+func createProductSearchIndex(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+				setweight(to_tsvector('english', coalesce(sku, '')), 'A') ||
+				setweight(to_tsvector('english', coalesce(description, '')), 'B')
+			) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"order-api-stat/models"
+	"order-api-stat/service"
+	"order-api-stat/validation"
+)
+
+// CategoryHandler handles HTTP requests for product categories
+type CategoryHandler struct {
+	categoryService *service.CategoryService
+	validator       *validation.Validator
+}
+
+// NewCategoryHandler creates a new category handler
+func NewCategoryHandler(db *gorm.DB) *CategoryHandler {
+	return &CategoryHandler{
+		categoryService: service.NewCategoryService(db),
+		validator:       validation.New(),
+	}
+}
+
+// CreateCategory handles POST /categories
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB
+	var req models.CreateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", nil)
+		return
+	}
+
+	// Validate request
+	if errors := h.validator.Validate(&req); errors != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Validation failed", errors)
+		return
+	}
+
+	category, err := h.categoryService.CreateCategory(&req)
+	if err != nil {
+		h.sendServiceError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusCreated, category)
+}
+
+// ListCategories handles GET /categories
+func (h *CategoryHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	categories, err := h.categoryService.ListCategories()
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{"categories": categories})
+}
+
+// GetCategory handles GET /categories/{id}
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := h.extractIDFromPath(r.URL.Path)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid category ID", nil)
+		return
+	}
+
+	category, err := h.categoryService.GetCategory(id)
+	if err != nil {
+		h.sendServiceError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, category)
+}
+
+// UpdateCategory handles PUT /categories/{id}
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := h.extractIDFromPath(r.URL.Path)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid category ID", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB
+	var req models.UpdateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", nil)
+		return
+	}
+
+	// Validate request
+	if errors := h.validator.Validate(&req); errors != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Validation failed", errors)
+		return
+	}
+
+	category, err := h.categoryService.UpdateCategory(id, &req, requestActor(r))
+	if err != nil {
+		h.sendServiceError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, category)
+}
+
+// DeleteCategory handles DELETE /categories/{id}
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := h.extractIDFromPath(r.URL.Path)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid category ID", nil)
+		return
+	}
+
+	if err := h.categoryService.DeleteCategory(id); err != nil {
+		h.sendServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCategories handles /categories
+func (h *CategoryHandler) HandleCategories(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.CreateCategory(w, r)
+	case http.MethodGet:
+		h.ListCategories(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleCategoryByID handles /categories/{id}
+func (h *CategoryHandler) HandleCategoryByID(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetCategory(w, r)
+	case http.MethodPut:
+		h.UpdateCategory(w, r)
+	case http.MethodDelete:
+		h.DeleteCategory(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// sendServiceError maps a category service error to its HTTP status
+func (h *CategoryHandler) sendServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case strings.Contains(err.Error(), "invalid"):
+		writeErrorResponse(w, http.StatusBadRequest, err.Error(), nil)
+	case strings.Contains(err.Error(), "not found"):
+		writeErrorResponse(w, http.StatusNotFound, err.Error(), nil)
+	case strings.Contains(err.Error(), "already exists"), strings.Contains(err.Error(), "still has"):
+		writeErrorResponse(w, http.StatusConflict, err.Error(), nil)
+	default:
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+	}
+}
+
+// extractIDFromPath extracts ID from URL path like /categories/12
+func (h *CategoryHandler) extractIDFromPath(path string) (uint, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[0] != "categories" {
+		return 0, fmt.Errorf("invalid path format")
+	}
+
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID format")
+	}
+
+	return uint(id), nil
+}
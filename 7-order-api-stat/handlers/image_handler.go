@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"order-api-stat/models"
+	"order-api-stat/service"
+	"order-api-stat/storage"
+)
+
+// maxImagesPerUpload is the most files accepted by one POST /products/{id}/images
+const maxImagesPerUpload = 10
+
+// ImageHandler handles product image uploads and serves stored images
+type ImageHandler struct {
+	imageService *service.ImageService
+}
+
+// NewImageHandler creates a new image handler
+func NewImageHandler(imageService *service.ImageService) *ImageHandler {
+	return &ImageHandler{imageService: imageService}
+}
+
+// UploadImages handles POST /products/{id}/images. The request is
+// multipart/form-data with one or more files in the "image" field; parts are
+// streamed, so only one image is held in memory at a time.
+func (h *ImageHandler) UploadImages(w http.ResponseWriter, r *http.Request, productID uint) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.imageService.MaxSize()*maxImagesPerUpload+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Expected a multipart/form-data request", nil)
+		return
+	}
+
+	images := make([]models.ProductImageResponse, 0)
+	created := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeErrorResponse(w, http.StatusRequestEntityTooLarge, "Request body too large", nil)
+				return
+			}
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid multipart payload", nil)
+			return
+		}
+		if part.FormName() != "image" {
+			part.Close()
+			continue
+		}
+		if len(images) == maxImagesPerUpload {
+			part.Close()
+			writeErrorResponse(w, http.StatusBadRequest,
+				fmt.Sprintf("At most %d images can be uploaded at once", maxImagesPerUpload), nil)
+			return
+		}
+
+		image, isNew, err := h.imageService.AddImage(r.Context(), productID, part, requestActor(r))
+		part.Close()
+		if err != nil {
+			h.sendUploadError(w, err, part.FileName())
+			return
+		}
+		created = created || isNew
+		images = append(images, service.ToProductImageResponse(image))
+	}
+
+	if len(images) == 0 {
+		writeErrorResponse(w, http.StatusBadRequest, "No file found in the \"image\" field", nil)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSONResponse(w, status, map[string]interface{}{"images": images})
+}
+
+// ListImages handles GET /products/{id}/images
+func (h *ImageHandler) ListImages(w http.ResponseWriter, r *http.Request, productID uint) {
+	images, err := h.imageService.ListImages(productID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeErrorResponse(w, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	responses := make([]models.ProductImageResponse, len(images))
+	for i := range images {
+		responses[i] = service.ToProductImageResponse(&images[i])
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{"images": responses})
+}
+
+// ServeImage handles GET /images/{key}. Stored images are content-addressed
+// and never change, so they may be cached indefinitely; the content hash in the
+// key doubles as the ETag.
+func (h *ImageHandler) ServeImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, service.ImageURLPrefix)
+	if storage.ValidateKey(key) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	blob, info, err := h.imageService.OpenImage(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("failed to open image %s: %v", key, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+strings.TrimSuffix(path.Base(key), path.Ext(key))+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent answers If-None-Match and Range requests
+	if seeker, ok := blob.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", info.ModTime, seeker)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("failed to write image %s: %v", key, err)
+	}
+}
+
+// sendUploadError maps an image service error to its HTTP status
+func (h *ImageHandler) sendUploadError(w http.ResponseWriter, err error, fileName string) {
+	var details map[string]string
+	if fileName != "" {
+		details = map[string]string{"file": fileName}
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr), strings.Contains(err.Error(), "too large"):
+		writeErrorResponse(w, http.StatusRequestEntityTooLarge, err.Error(), details)
+	case strings.Contains(err.Error(), "unsupported image type"):
+		writeErrorResponse(w, http.StatusUnsupportedMediaType, err.Error(), details)
+	case strings.Contains(err.Error(), "invalid image"):
+		writeErrorResponse(w, http.StatusBadRequest, err.Error(), details)
+	case strings.Contains(err.Error(), "not found"):
+		writeErrorResponse(w, http.StatusNotFound, err.Error(), nil)
+	default:
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+	}
+}
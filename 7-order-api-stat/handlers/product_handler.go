@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,19 +15,29 @@ import (
 
 	"order-api-stat/models"
 	"order-api-stat/service"
+	"order-api-stat/utils"
 	"order-api-stat/validation"
 )
 
+// maxBatchIDs is the most product IDs accepted by GET /products?ids=...
+const maxBatchIDs = 100
+
+// maxImportSize is the largest accepted POST /products/import body
+const maxImportSize = 100 << 20 // 100 MB
+
 // ProductHandler handles HTTP requests for product operations
 type ProductHandler struct {
 	productService *service.ProductService
+	images         *ImageHandler
 	validator      *validation.Validator
 }
 
-// NewProductHandler creates a new product handler
-func NewProductHandler(db *gorm.DB) *ProductHandler {
+// NewProductHandler creates a new product handler. cursorSecret signs the
+// pagination cursors of GET /products; images serves /products/{id}/images.
+func NewProductHandler(db *gorm.DB, cursorSecret string, images *ImageHandler) *ProductHandler {
 	return &ProductHandler{
-		productService: service.NewProductService(db),
+		productService: service.NewProductService(db, cursorSecret),
+		images:         images,
 		validator:      validation.New(),
 	}
 }
@@ -50,8 +63,12 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create product
-	product, err := h.productService.CreateProduct(&req)
+	product, err := h.productService.CreateProduct(&req, requestActor(r))
 	if err != nil {
+		if strings.Contains(err.Error(), "invalid category") {
+			h.sendErrorResponse(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
 		if strings.Contains(err.Error(), "already exists") {
 			h.sendErrorResponse(w, http.StatusConflict, err.Error(), nil)
 			return
@@ -62,18 +79,22 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 
 	// Convert to response format
 	response := models.ProductResponse{
-		ID:          product.ID,
-		Name:        product.Name,
-		Description: product.Description,
-		Price:       product.Price,
-		Quantity:    product.Quantity,
-		Category:    product.Category,
-		SKU:         product.SKU,
-		Images:      product.Images,
-		CreatedAt:   product.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   product.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ID:               product.ID,
+		Name:             product.Name,
+		Description:      product.Description,
+		Price:            product.Price,
+		Quantity:         product.Quantity,
+		ReorderThreshold: product.ReorderThreshold,
+		Category:         product.Category,
+		CategoryID:       product.CategoryID,
+		SKU:              product.SKU,
+		Images:           product.Images,
+		Version:          product.Version,
+		CreatedAt:        product.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:        product.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
 
+	w.Header().Set("ETag", productETag(product.Version))
 	h.sendJSONResponse(w, http.StatusCreated, response)
 }
 
@@ -102,53 +123,177 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	etag := productETag(product.Version)
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	// Convert to response format
 	response := models.ProductResponse{
-		ID:          product.ID,
-		Name:        product.Name,
-		Description: product.Description,
-		Price:       product.Price,
-		Quantity:    product.Quantity,
-		Category:    product.Category,
-		SKU:         product.SKU,
-		Images:      product.Images,
-		CreatedAt:   product.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   product.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ID:               product.ID,
+		Name:             product.Name,
+		Description:      product.Description,
+		Price:            product.Price,
+		Quantity:         product.Quantity,
+		ReorderThreshold: product.ReorderThreshold,
+		Category:         product.Category,
+		CategoryID:       product.CategoryID,
+		SKU:              product.SKU,
+		Images:           product.Images,
+		Version:          product.Version,
+		CreatedAt:        product.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:        product.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
 
 	h.sendJSONResponse(w, http.StatusOK, response)
 }
 
-// ListProducts handles GET /products
+// ListProducts handles GET /products. With ids=1,2,3 it returns just those
+// products in one response instead of a page of the catalog.
 func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse query parameters
-	page := 1
-	limit := 10
-	category := ""
+	if r.URL.Query().Has("ids") {
+		h.getProductsByIDs(w, r.URL.Query().Get("ids"))
+		return
+	}
+
+	params, details := parseProductListQuery(r)
+	if details == nil {
+		details = h.validator.Validate(params)
+	}
+	if details == nil && params.MinPrice != nil && params.MaxPrice != nil && *params.MinPrice > *params.MaxPrice {
+		details = map[string]string{"min_price": "min_price must not be greater than max_price"}
+	}
+	if details == nil && params.CursorMode && params.Sort != "" && params.Sort != "created_at" && params.Sort != "-created_at" {
+		details = map[string]string{"sort": "cursor pagination only supports sort=created_at or sort=-created_at"}
+	}
+	if details != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid query parameters", details)
+		return
+	}
+	if params.Deleted && !isAdmin(r) {
+		h.sendErrorResponse(w, http.StatusForbidden, "Listing deleted products requires the admin role", nil)
+		return
+	}
 
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
+	// List products
+	response, err := h.productService.ListProducts(params)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			h.sendErrorResponse(w, http.StatusBadRequest, err.Error(), nil)
+			return
 		}
+		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// parseProductListQuery reads the GET /products query parameters. Invalid page
+// and limit values fall back to the defaults; malformed filters are reported
+// per parameter. category may be repeated or comma-separated. The presence of
+// cursor (empty for the first page) switches to cursor pagination, and
+// deleted=true lists soft-deleted products instead.
+func parseProductListQuery(r *http.Request) (*models.ProductListQuery, map[string]string) {
+	values := r.URL.Query()
+	params := &models.ProductListQuery{
+		Page:       1,
+		Limit:      10,
+		Query:      strings.TrimSpace(values.Get("q")),
+		Sort:       values.Get("sort"),
+		CursorMode: values.Has("cursor"),
+		Cursor:     values.Get("cursor"),
+	}
+	details := make(map[string]string)
+
+	if p, err := strconv.Atoi(values.Get("page")); err == nil && p > 0 {
+		params.Page = p
+	}
+	if l, err := strconv.Atoi(values.Get("limit")); err == nil && l > 0 && l <= 100 {
+		params.Limit = l
 	}
 
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
-			limit = l
+	for _, value := range values["category"] {
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				params.Categories = append(params.Categories, category)
+			}
 		}
 	}
 
-	if cat := r.URL.Query().Get("category"); cat != "" {
-		category = cat
+	for name, target := range map[string]**float64{"min_price": &params.MinPrice, "max_price": &params.MaxPrice} {
+		if value := values.Get(name); value != "" {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(price) || math.IsInf(price, 0) {
+				details[name] = name + " must be a number"
+				continue
+			}
+			*target = &price
+		}
 	}
 
-	// List products
-	response, err := h.productService.ListProducts(page, limit, category)
+	if value := values.Get("in_stock"); value != "" {
+		inStock, err := strconv.ParseBool(value)
+		if err != nil {
+			details["in_stock"] = "in_stock must be true or false"
+		} else {
+			params.InStock = &inStock
+		}
+	}
+
+	if value := values.Get("deleted"); value != "" {
+		deleted, err := strconv.ParseBool(value)
+		if err != nil {
+			details["deleted"] = "deleted must be true or false"
+		} else {
+			params.Deleted = deleted
+		}
+	}
+
+	if len(details) > 0 {
+		return nil, details
+	}
+	return params, nil
+}
+
+// getProductsByIDs serves the batch form of GET /products
+func (h *ProductHandler) getProductsByIDs(w http.ResponseWriter, idsParam string) {
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, part := range strings.Split(idsParam, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			h.sendErrorResponse(w, http.StatusBadRequest, "Invalid product ID", map[string]string{"ids": part})
+			return
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+
+	if len(ids) == 0 {
+		h.sendErrorResponse(w, http.StatusBadRequest, "At least one product ID is required", nil)
+		return
+	}
+	if len(ids) > maxBatchIDs {
+		h.sendErrorResponse(w, http.StatusBadRequest,
+			fmt.Sprintf("At most %d product IDs can be requested at once", maxBatchIDs), nil)
+		return
+	}
+
+	response, err := h.productService.GetProductsByIDs(ids)
 	if err != nil {
 		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
 		return
@@ -185,8 +330,16 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update product
-	product, err := h.productService.UpdateProduct(id, &req)
+	product, err := h.productService.UpdateProduct(id, &req, ifMatchVersions(r.Header.Get("If-Match")), requestActor(r))
 	if err != nil {
+		if errors.Is(err, service.ErrVersionMismatch) {
+			h.sendErrorResponse(w, http.StatusPreconditionFailed, err.Error(), nil)
+			return
+		}
+		if strings.Contains(err.Error(), "invalid category") {
+			h.sendErrorResponse(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			h.sendErrorResponse(w, http.StatusNotFound, err.Error(), nil)
 			return
@@ -201,18 +354,22 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 
 	// Convert to response format
 	response := models.ProductResponse{
-		ID:          product.ID,
-		Name:        product.Name,
-		Description: product.Description,
-		Price:       product.Price,
-		Quantity:    product.Quantity,
-		Category:    product.Category,
-		SKU:         product.SKU,
-		Images:      product.Images,
-		CreatedAt:   product.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:   product.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ID:               product.ID,
+		Name:             product.Name,
+		Description:      product.Description,
+		Price:            product.Price,
+		Quantity:         product.Quantity,
+		ReorderThreshold: product.ReorderThreshold,
+		Category:         product.Category,
+		CategoryID:       product.CategoryID,
+		SKU:              product.SKU,
+		Images:           product.Images,
+		Version:          product.Version,
+		CreatedAt:        product.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:        product.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
 
+	w.Header().Set("ETag", productETag(product.Version))
 	h.sendJSONResponse(w, http.StatusOK, response)
 }
 
@@ -231,7 +388,11 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete product
-	if err := h.productService.DeleteProduct(id); err != nil {
+	if err := h.productService.DeleteProduct(id, ifMatchVersions(r.Header.Get("If-Match")), requestActor(r)); err != nil {
+		if errors.Is(err, service.ErrVersionMismatch) {
+			h.sendErrorResponse(w, http.StatusPreconditionFailed, err.Error(), nil)
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			h.sendErrorResponse(w, http.StatusNotFound, err.Error(), nil)
 			return
@@ -243,6 +404,305 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RestoreProduct handles POST /products/{id}/restore, undoing a soft delete
+func (h *ProductHandler) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract ID from URL path
+	id, err := h.extractIDFromPath(r.URL.Path)
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid product ID", nil)
+		return
+	}
+
+	product, err := h.productService.RestoreProduct(id, ifMatchVersions(r.Header.Get("If-Match")), requestActor(r))
+	if err != nil {
+		if errors.Is(err, service.ErrVersionMismatch) {
+			h.sendErrorResponse(w, http.StatusPreconditionFailed, err.Error(), nil)
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			h.sendErrorResponse(w, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		if strings.Contains(err.Error(), "is not deleted") {
+			h.sendErrorResponse(w, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	// Convert to response format
+	response := models.ProductResponse{
+		ID:               product.ID,
+		Name:             product.Name,
+		Description:      product.Description,
+		Price:            product.Price,
+		Quantity:         product.Quantity,
+		ReorderThreshold: product.ReorderThreshold,
+		Category:         product.Category,
+		CategoryID:       product.CategoryID,
+		SKU:              product.SKU,
+		Images:           product.Images,
+		Version:          product.Version,
+		CreatedAt:        product.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:        product.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+
+	w.Header().Set("ETag", productETag(product.Version))
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// GetProductHistory handles GET /products/{id}/history. It accepts page and
+// limit like GET /products, with a default limit of 20. Only admins may read
+// the history.
+func (h *ProductHandler) GetProductHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(r) {
+		h.sendErrorResponse(w, http.StatusForbidden, "Product history requires the admin role", nil)
+		return
+	}
+
+	// Extract ID from URL path
+	id, err := h.extractIDFromPath(r.URL.Path)
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid product ID", nil)
+		return
+	}
+
+	page, limit := 1, 20
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	response, err := h.productService.GetProductHistory(id, page, limit)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			h.sendErrorResponse(w, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// UpdateProductQuantity handles PATCH /products/{id}/quantity. Only the order
+// service and admins may adjust stock, and only the order service may record
+// the change as a sale or return.
+func (h *ProductHandler) UpdateProductQuantity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !canManageStock(r) {
+		h.sendErrorResponse(w, http.StatusForbidden, "Adjusting stock requires the service or admin role", nil)
+		return
+	}
+
+	// Extract ID from URL path
+	id, err := h.extractIDFromPath(r.URL.Path)
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid product ID", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB
+	var req models.UpdateQuantityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", nil)
+		return
+	}
+
+	// Validate request
+	if errors := h.validator.Validate(&req); errors != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Validation failed", errors)
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > 255 {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters", nil)
+		return
+	}
+
+	if req.Reason == models.AdjustmentReasonSale || req.Reason == models.AdjustmentReasonReturn {
+		if requestActor(r) != "" && requestRole(r) != roleService {
+			h.sendErrorResponse(w, http.StatusForbidden, "Recording sales and returns requires the service role", nil)
+			return
+		}
+		if details := saleAdjustmentErrors(&req, idempotencyKey); details != nil {
+			h.sendErrorResponse(w, http.StatusBadRequest, "Validation failed", details)
+			return
+		}
+	} else if req.UnitPrice != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Validation failed",
+			map[string]string{"unit_price": "unit_price is only allowed for sales and returns"})
+		return
+	}
+
+	// Apply the stock change
+	product, err := h.productService.AdjustQuantity(id, &req, idempotencyKey, requestActor(r))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			h.sendErrorResponse(w, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		if strings.Contains(err.Error(), "idempotency key") {
+			h.sendErrorResponse(w, http.StatusUnprocessableEntity, err.Error(), nil)
+			return
+		}
+		if strings.Contains(err.Error(), "insufficient stock") {
+			h.sendErrorResponse(w, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response := models.QuantityResponse{
+		ID:       product.ID,
+		Quantity: product.Quantity,
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// saleAdjustmentErrors checks a sale or return: a sale takes stock and a
+// return puts it back, and both need an Idempotency-Key, since only keyed
+// adjustments are recorded
+func saleAdjustmentErrors(req *models.UpdateQuantityRequest, idempotencyKey string) map[string]string {
+	switch {
+	case req.Reason == models.AdjustmentReasonSale && req.Change > 0:
+		return map[string]string{"change": "change must be negative for a sale"}
+	case req.Reason == models.AdjustmentReasonReturn && req.Change < 0:
+		return map[string]string{"change": "change must be positive for a return"}
+	case idempotencyKey == "":
+		return map[string]string{"Idempotency-Key": "Idempotency-Key is required for sales and returns"}
+	}
+	return nil
+}
+
+// ImportProducts handles POST /products/import. The format is taken from the
+// format parameter or the Content-Type; dry_run=true validates the file and
+// reports what would change without writing anything.
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatFromMediaType(r.Header.Get("Content-Type"))
+	}
+	if format != service.FormatCSV && format != service.FormatNDJSON {
+		h.sendErrorResponse(w, http.StatusUnsupportedMediaType,
+			"Import format must be csv (text/csv) or ndjson (application/x-ndjson)", nil)
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			h.sendErrorResponse(w, http.StatusBadRequest, "Invalid query parameters",
+				map[string]string{"dry_run": "dry_run must be true or false"})
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	result, err := h.productService.ImportProducts(r.Body, format, dryRun, requestActor(r))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			h.sendErrorResponse(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Import file must be at most %d bytes", maxImportSize), nil)
+		case strings.Contains(err.Error(), "invalid"):
+			h.sendErrorResponse(w, http.StatusBadRequest, err.Error(), nil)
+		default:
+			h.sendErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		}
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, result)
+}
+
+// ExportProducts handles GET /products/export. It accepts the filters of
+// GET /products and streams every matching product as CSV (the default) or
+// NDJSON with format=ndjson.
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = service.FormatCSV
+	}
+	if format != service.FormatCSV && format != service.FormatNDJSON {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid query parameters",
+			map[string]string{"format": "format must be csv or ndjson"})
+		return
+	}
+
+	params, details := parseProductListQuery(r)
+	if details == nil {
+		details = h.validator.Validate(params)
+	}
+	if details != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid query parameters", details)
+		return
+	}
+	if params.Deleted && !isAdmin(r) {
+		h.sendErrorResponse(w, http.StatusForbidden, "Listing deleted products requires the admin role", nil)
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == service.FormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="products.%s"`, format))
+
+	// The status is sent with the first batch, so a later failure can only
+	// be logged and the response cut short
+	if err := h.productService.ExportProducts(w, format, params); err != nil {
+		log.Printf("product export failed: %v", err)
+	}
+}
+
+// formatFromMediaType maps an import Content-Type to its format, or ""
+func formatFromMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "text/csv":
+		return service.FormatCSV
+	case "application/x-ndjson", "application/jsonl", "application/jsonlines":
+		return service.FormatNDJSON
+	}
+	return ""
+}
+
 // Helper methods
 
 // extractIDFromPath extracts ID from URL path like /products/123
@@ -260,28 +720,93 @@ func (h *ProductHandler) extractIDFromPath(path string) (uint, error) {
 	return uint(id), nil
 }
 
-// sendJSONResponse sends a JSON response
-func (h *ProductHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
-	body, err := json.Marshal(data)
-	if err != nil {
-		log.Printf("failed to marshal response: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+// requestActor returns the ID of the user making the request, taken from the
+// token checked by utils.AuthMiddleware, or "" when the request is anonymous
+func requestActor(r *http.Request) string {
+	userID, _ := r.Context().Value(utils.UserIDKey).(string)
+	return userID
+}
+
+// isAdmin reports whether the request carries the admin role. When auth is
+// disabled there is no user and every request may do what an admin may.
+func isAdmin(r *http.Request) bool {
+	return requestActor(r) == "" || requestRole(r) == roleAdmin
+}
+
+// IsPrivateRead reports whether a read needs a token when auth is enabled:
+// reservations, statistics, and the admin-only product history and deleted
+// product listings (including their export)
+func IsPrivateRead(r *http.Request) bool {
+	path := r.URL.Path
+	switch {
+	case utils.IsUnderPath(path, "/reservations"), utils.IsUnderPath(path, "/stats"):
+		return true
+	case strings.HasPrefix(path, "/products/") && strings.HasSuffix(strings.TrimSuffix(path, "/"), "/history"):
+		return true
+	case path == "/products" || path == "/products/export":
+		return r.URL.Query().Has("deleted")
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	if _, err := w.Write(body); err != nil {
-		log.Printf("failed to write response: %v", err)
+	return false
+}
+
+// productETag returns the entity tag of a product version
+func productETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersions returns the product versions listed in an If-Match header,
+// or nil if the header is absent or "*" (any current version). Weak and
+// malformed tags can never match; if only such tags are given, version 0,
+// which no product has, is returned so the precondition fails.
+func ifMatchVersions(header string) []int {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	versions := []int{0}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if version, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// ifNoneMatch reports whether an If-None-Match header matches etag, using the
+// weak comparison GET requests call for
+func ifNoneMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// extractSubresource returns the path segment following the product ID, e.g.
+// "quantity" for /products/123/quantity, or "" for /products/123
+func (h *ProductHandler) extractSubresource(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 {
+		return ""
 	}
+	return strings.Join(parts[2:], "/")
+}
+
+// sendJSONResponse sends a JSON response
+func (h *ProductHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	writeJSONResponse(w, statusCode, data)
 }
 
 // sendErrorResponse sends an error response
 func (h *ProductHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string, details map[string]string) {
-	response := models.ErrorResponse{
-		Error:   message,
-		Details: details,
-	}
-	h.sendJSONResponse(w, statusCode, response)
+	writeErrorResponse(w, statusCode, message, details)
 }
 
 // HandleProducts handles all product-related routes
@@ -296,16 +821,51 @@ func (h *ProductHandler) HandleProducts(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// HandleProductByID handles product routes with ID parameter
+// HandleProductByID handles product routes with ID parameter, as well as
+// /products/import and /products/export
 func (h *ProductHandler) HandleProductByID(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		h.GetProduct(w, r)
-	case http.MethodPut:
-		h.UpdateProduct(w, r)
-	case http.MethodDelete:
-		h.DeleteProduct(w, r)
+	switch strings.Trim(r.URL.Path, "/") {
+	case "products/import":
+		h.ImportProducts(w, r)
+		return
+	case "products/export":
+		h.ExportProducts(w, r)
+		return
+	}
+
+	switch h.extractSubresource(r.URL.Path) {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			h.GetProduct(w, r)
+		case http.MethodPut:
+			h.UpdateProduct(w, r)
+		case http.MethodDelete:
+			h.DeleteProduct(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "quantity":
+		h.UpdateProductQuantity(w, r)
+	case "restore":
+		h.RestoreProduct(w, r)
+	case "history":
+		h.GetProductHistory(w, r)
+	case "images":
+		id, err := h.extractIDFromPath(r.URL.Path)
+		if err != nil {
+			h.sendErrorResponse(w, http.StatusBadRequest, "Invalid product ID", nil)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h.images.ListImages(w, r, id)
+		case http.MethodPost:
+			h.images.UploadImages(w, r, id)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.sendErrorResponse(w, http.StatusNotFound, "Resource not found", nil)
 	}
 }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"order-api-stat/models"
+	"order-api-stat/service"
+	"order-api-stat/utils"
+	"order-api-stat/validation"
+)
+
+// ReservationHandler handles HTTP requests for stock reservations
+type ReservationHandler struct {
+	reservationService *service.ReservationService
+	validator          *validation.Validator
+}
+
+// NewReservationHandler creates a new reservation handler
+func NewReservationHandler(reservationService *service.ReservationService) *ReservationHandler {
+	return &ReservationHandler{
+		reservationService: reservationService,
+		validator:          validation.New(),
+	}
+}
+
+// CreateReservation handles POST /reservations. With an Idempotency-Key
+// header, a retried request returns the reservation made by the first one.
+// Only the order service and admins may hold stock.
+func (h *ReservationHandler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !canManageStock(r) {
+		writeErrorResponse(w, http.StatusForbidden, "Reserving stock requires the service or admin role", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB
+	var req models.CreateReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON payload", nil)
+		return
+	}
+
+	// Validate request
+	if errors := h.validator.Validate(&req); errors != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Validation failed", errors)
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > 255 {
+		writeErrorResponse(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters", nil)
+		return
+	}
+
+	reservation, created, err := h.reservationService.CreateReservation(&req, idempotencyKey, requestActor(r))
+	if err != nil {
+		h.sendServiceError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSONResponse(w, status, reservation)
+}
+
+// GetReservation handles GET /reservations/{id}. Admins can read any
+// reservation, everyone else only their own.
+func (h *ReservationHandler) GetReservation(w http.ResponseWriter, r *http.Request, id uint) {
+	owner := requestActor(r)
+	if requestRole(r) == roleAdmin {
+		owner = ""
+	}
+	reservation, err := h.reservationService.GetReservation(id, owner)
+	if err != nil {
+		h.sendServiceError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, reservation)
+}
+
+// ConfirmReservation handles POST /reservations/{id}/confirm
+func (h *ReservationHandler) ConfirmReservation(w http.ResponseWriter, r *http.Request, id uint) {
+	if !canManageStock(r) {
+		writeErrorResponse(w, http.StatusForbidden, "Confirming a reservation requires the service or admin role", nil)
+		return
+	}
+	reservation, err := h.reservationService.ConfirmReservation(id, requestActor(r))
+	if err != nil {
+		h.sendServiceError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, reservation)
+}
+
+// ReleaseReservation handles POST /reservations/{id}/release
+func (h *ReservationHandler) ReleaseReservation(w http.ResponseWriter, r *http.Request, id uint) {
+	if !canManageStock(r) {
+		writeErrorResponse(w, http.StatusForbidden, "Releasing a reservation requires the service or admin role", nil)
+		return
+	}
+	reservation, err := h.reservationService.ReleaseReservation(id, requestActor(r))
+	if err != nil {
+		h.sendServiceError(w, err)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, reservation)
+}
+
+// HandleReservations handles /reservations
+func (h *ReservationHandler) HandleReservations(w http.ResponseWriter, r *http.Request) {
+	h.CreateReservation(w, r)
+}
+
+// HandleReservationByID handles /reservations/{id}, /reservations/{id}/confirm
+// and /reservations/{id}/release
+func (h *ReservationHandler) HandleReservationByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "reservations" {
+		writeErrorResponse(w, http.StatusNotFound, "Resource not found", nil)
+		return
+	}
+
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid reservation ID", nil)
+		return
+	}
+
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetReservation(w, r, uint(id))
+	case action == "confirm" && r.Method == http.MethodPost:
+		h.ConfirmReservation(w, r, uint(id))
+	case action == "release" && r.Method == http.MethodPost:
+		h.ReleaseReservation(w, r, uint(id))
+	case action == "" || action == "confirm" || action == "release":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		writeErrorResponse(w, http.StatusNotFound, "Resource not found", nil)
+	}
+}
+
+// sendServiceError maps a reservation service error to its HTTP status
+func (h *ReservationHandler) sendServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		writeErrorResponse(w, http.StatusNotFound, err.Error(), nil)
+	case strings.Contains(err.Error(), "idempotency key"):
+		writeErrorResponse(w, http.StatusUnprocessableEntity, err.Error(), nil)
+	case strings.Contains(err.Error(), "insufficient stock"), errors.Is(err, service.ErrReservationClosed):
+		writeErrorResponse(w, http.StatusConflict, err.Error(), nil)
+	default:
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+	}
+}
+
+// Roles from the token's role claim that may change stock directly, through
+// reservations or quantity adjustments: the order service, calling with its
+// service token, and admins
+const (
+	roleService = "service"
+	roleAdmin   = "admin"
+)
+
+// canManageStock reports whether the request may create, confirm or release
+// reservations and adjust product quantities. When auth is disabled there is
+// no user and every request may.
+func canManageStock(r *http.Request) bool {
+	if requestActor(r) == "" {
+		return true
+	}
+	role := requestRole(r)
+	return role == roleService || role == roleAdmin
+}
+
+// requestRole returns the role claim of the token checked by
+// utils.AuthMiddleware, or "" when the request is anonymous
+func requestRole(r *http.Request) string {
+	role, _ := r.Context().Value(utils.RoleKey).(string)
+	return role
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"order-api-stat/models"
+)
+
+// writeJSONResponse sends data as a JSON response
+func writeJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("failed to marshal response: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+// writeErrorResponse sends an error response
+func writeErrorResponse(w http.ResponseWriter, statusCode int, message string, details map[string]string) {
+	response := models.ErrorResponse{
+		Error:   message,
+		Details: details,
+	}
+	writeJSONResponse(w, statusCode, response)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"order-api-stat/models"
+	"order-api-stat/service"
+	"order-api-stat/validation"
+)
+
+// defaultLowStockThreshold is the stock level at or below which GET
+// /stats/products lists a product when no threshold is given
+const defaultLowStockThreshold = 5
+
+// defaultSalesDays is the number of days GET /stats/sales reports by default,
+// ending today
+const defaultSalesDays = 30
+
+// StatsHandler handles HTTP requests for catalog and sales statistics
+type StatsHandler struct {
+	statsService *service.StatsService
+	validator    *validation.Validator
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(db *gorm.DB) *StatsHandler {
+	return &StatsHandler{
+		statsService: service.NewStatsService(db),
+		validator:    validation.New(),
+	}
+}
+
+// ProductStats handles GET /stats/products?low_stock=5
+func (h *StatsHandler) ProductStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	threshold := defaultLowStockThreshold
+	if value := r.URL.Query().Get("low_stock"); value != "" {
+		t, err := strconv.Atoi(value)
+		if err != nil || t < 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid query parameters",
+				map[string]string{"low_stock": "low_stock must be a non-negative integer"})
+			return
+		}
+		threshold = t
+	}
+
+	response, err := h.statsService.ProductStats(threshold)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// SalesStats handles GET /stats/sales?from=2024-01-01&to=2024-03-31&interval=week&top=10.
+// from and to are inclusive UTC dates; by default the last 30 days are
+// reported by day.
+func (h *StatsHandler) SalesStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, details := parseSalesStatsQuery(r)
+	if details == nil {
+		details = h.validator.Validate(query)
+	}
+	if details == nil && !query.From.Before(query.To) {
+		details = map[string]string{"from": "from must not be after to"}
+	}
+	if details != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid query parameters", details)
+		return
+	}
+
+	response, err := h.statsService.SalesStats(query)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeErrorResponse(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// parseSalesStatsQuery reads the GET /stats/sales query parameters, reporting
+// malformed values per parameter
+func parseSalesStatsQuery(r *http.Request) (*models.SalesStatsQuery, map[string]string) {
+	values := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	query := &models.SalesStatsQuery{
+		From:     today.AddDate(0, 0, 1-defaultSalesDays),
+		To:       today.AddDate(0, 0, 1),
+		Interval: models.IntervalDay,
+		Top:      10,
+	}
+	details := make(map[string]string)
+
+	for name, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := values.Get(name); value != "" {
+			date, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				details[name] = name + " must be a date (YYYY-MM-DD)"
+				continue
+			}
+			*target = date
+		}
+	}
+	if values.Get("to") != "" {
+		// to names the last day reported
+		query.To = query.To.AddDate(0, 0, 1)
+	}
+
+	if value := values.Get("interval"); value != "" {
+		query.Interval = value
+	}
+	if value := values.Get("top"); value != "" {
+		top, err := strconv.Atoi(value)
+		if err != nil {
+			details["top"] = "top must be an integer"
+		} else {
+			query.Top = top
+		}
+	}
+
+	if len(details) > 0 {
+		return nil, details
+	}
+	return query, nil
+}
+
+// HandleStats routes /stats/products and /stats/sales. Statistics are only
+// available to admins.
+func (h *StatsHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		writeErrorResponse(w, http.StatusForbidden, "Statistics require the admin role", nil)
+		return
+	}
+
+	switch strings.Trim(r.URL.Path, "/") {
+	case "stats/products":
+		h.ProductStats(w, r)
+	case "stats/sales":
+		h.SalesStats(w, r)
+	default:
+		writeErrorResponse(w, http.StatusNotFound, "Resource not found", nil)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"order-api-stat/config"
 	"order-api-stat/database"
 	"order-api-stat/handlers"
+	"order-api-stat/service"
+	"order-api-stat/storage"
 	"order-api-stat/utils"
 
 	"github.com/sirupsen/logrus"
@@ -39,8 +41,39 @@ func main() {
 		logrus.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Background workers run until shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Start the low-stock alert checker
+	notifier, err := service.NewStockAlertNotifier(cfg.Alerts)
+	if err != nil {
+		logrus.Fatalf("Failed to configure stock alerts: %v", err)
+	}
+	if notifier != nil {
+		go service.NewStockAlertService(db, notifier, cfg.Alerts).Run(workerCtx)
+	} else {
+		logrus.Info("APP_ALERTS_NOTIFIERS is none, low-stock alerts are disabled")
+	}
+
+	// Start the reservation expiry sweeper
+	reservationService := service.NewReservationService(db, cfg.Reservations)
+	go reservationService.Run(workerCtx)
+
 	// Initialize handlers
-	productHandler := handlers.NewProductHandler(db)
+	if cfg.Pagination.CursorSecret == "" {
+		logrus.Warn("APP_PAGINATION_CURSOR_SECRET is not set, pagination cursors are only valid until restart")
+	}
+	imageStore, err := storage.NewLocalBlobStore(cfg.Storage.ImageDir)
+	if err != nil {
+		logrus.Fatalf("Failed to open image storage: %v", err)
+	}
+	imageHandler := handlers.NewImageHandler(service.NewImageService(db, imageStore,
+		cfg.Storage.MaxImageSize, cfg.Storage.ThumbnailSize))
+	productHandler := handlers.NewProductHandler(db, cfg.Pagination.CursorSecret, imageHandler)
+	categoryHandler := handlers.NewCategoryHandler(db)
+	reservationHandler := handlers.NewReservationHandler(reservationService)
+	statsHandler := handlers.NewStatsHandler(db)
 	healthHandler := handlers.NewHealthHandler()
 
 	// Setup routes
@@ -49,12 +82,34 @@ func main() {
 	// Product routes
 	mux.HandleFunc("/products", productHandler.HandleProducts)
 	mux.HandleFunc("/products/", productHandler.HandleProductByID)
+	mux.HandleFunc(service.ImageURLPrefix, imageHandler.ServeImage)
+
+	// Category routes
+	mux.HandleFunc("/categories", categoryHandler.HandleCategories)
+	mux.HandleFunc("/categories/", categoryHandler.HandleCategoryByID)
+
+	// Reservation routes
+	mux.HandleFunc("/reservations", reservationHandler.HandleReservations)
+	mux.HandleFunc("/reservations/", reservationHandler.HandleReservationByID)
+
+	// Statistics routes
+	mux.HandleFunc("/stats/", statsHandler.HandleStats)
 
 	// Health check endpoint
 	mux.HandleFunc("/health", healthHandler.HandleHealth)
 
-	// Add middleware chain: logging -> CORS
-	handler := utils.LoggingMiddleware(utils.CORSMiddleware(mux))
+	// Write operations, and reads of reservations, statistics, product history
+	// and deleted products, require a token from the auth service when a key
+	// source is configured
+	var jwks *utils.JWKSCache
+	if cfg.Auth.Enabled() {
+		jwks = utils.NewJWKSCache(cfg.Auth.JWKSURL, cfg.Auth.JWKSFile, cfg.Auth.JWKSCacheTTL)
+	} else {
+		logrus.Warn("APP_AUTH_JWKS_URL and APP_AUTH_JWKS_FILE are not set, write endpoints and reservations are unauthenticated")
+	}
+
+	// Add middleware chain: logging -> CORS -> auth
+	handler := utils.LoggingMiddleware(utils.CORSMiddleware(utils.AuthMiddleware(jwks, handlers.IsPrivateRead, mux)))
 
 	// Create HTTP server with timeouts
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
@@ -75,6 +130,15 @@ func main() {
 		logrus.Info("  GET    /products/{id} - Get a specific product")
 		logrus.Info("  PUT    /products/{id} - Update a product")
 		logrus.Info("  DELETE /products/{id} - Delete a product")
+		logrus.Info("  PATCH  /products/{id}/quantity - Adjust product stock")
+		logrus.Info("  GET    /products/{id}/history  - List product changes")
+		logrus.Info("  POST   /products/{id}/restore  - Restore a deleted product")
+		logrus.Info("  POST   /reservations   - Reserve stock")
+		logrus.Info("  GET    /reservations/{id} - Get a reservation")
+		logrus.Info("  POST   /reservations/{id}/confirm - Confirm a reservation")
+		logrus.Info("  POST   /reservations/{id}/release - Release a reservation")
+		logrus.Info("  GET    /stats/products - Catalog statistics")
+		logrus.Info("  GET    /stats/sales    - Sales statistics")
 		logrus.Info("  GET    /health        - Health check")
 
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -87,6 +151,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logrus.Info("Server shutting down...")
+	stopWorkers()
 
 	// Create a deadline to wait for
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// LowStockEventType is the event type of low-stock notifications
+const LowStockEventType = "product.low_stock"
+
+// StockAlert is a low-stock alert for a product. An alert is open until the
+// product is restocked above its reorder threshold (or alerts are disabled for
+// it), and a product has at most one open alert, so it is notified about once
+// per shortage. NotifiedAt is set once the notification was delivered; until
+// then delivery is retried at NextAttemptAt.
+type StockAlert struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	ProductID     uint       `json:"product_id" gorm:"not null;index"`
+	Quantity      int        `json:"quantity" gorm:"not null"`  // stock when the alert was raised
+	Threshold     int        `json:"threshold" gorm:"not null"` // reorder threshold when the alert was raised
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index"`
+	LastError     string     `json:"last_error,omitempty" gorm:"type:text"`
+	NotifiedAt    *time.Time `json:"notified_at,omitempty"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for StockAlert model
+func (StockAlert) TableName() string {
+	return "stock_alerts"
+}
+
+// LowStockEvent is the notification sent for a low-stock alert. Quantity and
+// ReorderThreshold are the product's values when the notification is sent.
+type LowStockEvent struct {
+	Type             string    `json:"type"`
+	AlertID          uint      `json:"alert_id"`
+	ProductID        uint      `json:"product_id"`
+	SKU              string    `json:"sku"`
+	Name             string    `json:"name"`
+	Quantity         int       `json:"quantity"`
+	ReorderThreshold int       `json:"reorder_threshold"`
+	DetectedAt       time.Time `json:"detected_at"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Product audit actions
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+)
+
+// AuditFields holds product fields by their JSON name. It is stored as a
+// jsonb column.
+type AuditFields map[string]interface{}
+
+// Value implements driver.Valuer
+func (f AuditFields) Value() (driver.Value, error) {
+	if f == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (f *AuditFields) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into AuditFields", src)
+	}
+	return json.Unmarshal(data, f)
+}
+
+// ProductAudit records one change to a product: who made it, the version it
+// produced and the affected fields before and after. A create has no Before
+// and a delete no After; both hold the full product. Updates and restores only
+// hold the fields that changed.
+type ProductAudit struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	ProductID uint        `json:"product_id" gorm:"not null;index"`
+	Action    string      `json:"action" gorm:"size:20;not null"`
+	Actor     string      `json:"actor" gorm:"size:255"` // user ID from the request token, empty when auth is disabled
+	Version   int         `json:"version" gorm:"not null"`
+	Before    AuditFields `json:"before" gorm:"type:jsonb"`
+	After     AuditFields `json:"after" gorm:"type:jsonb"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// TableName specifies the table name for ProductAudit model
+func (ProductAudit) TableName() string {
+	return "product_audits"
+}
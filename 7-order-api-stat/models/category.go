@@ -0,0 +1,43 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Category is a node in the product category tree. Slugs are unique across
+// the whole tree and are what GET /products?category= matches against.
+type Category struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:100;not null"`
+	Slug      string    `json:"slug" gorm:"size:100;not null;uniqueIndex"`
+	ParentID  *uint     `json:"parent_id" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for Category model
+func (Category) TableName() string {
+	return "categories"
+}
+
+// Slugify derives a category slug from a name: lower case ASCII letters and
+// digits, with every other run of characters replaced by a single hyphen, so
+// "Home & Garden" becomes "home-garden". It returns "" if the name has no
+// letters or digits.
+func Slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
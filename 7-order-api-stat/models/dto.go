@@ -2,46 +2,176 @@ package models
 
 // CreateProductRequest represents the request payload for creating a product
 type CreateProductRequest struct {
-	Name        string   `json:"name" validate:"required,min=3,max=255"`
-	Description string   `json:"description" validate:"omitempty,max=1000"`
-	Price       float64  `json:"price" validate:"required,gt=0"`
-	Quantity    int      `json:"quantity" validate:"min=0"`
-	Category    string   `json:"category" validate:"omitempty,max=100"`
-	SKU         string   `json:"sku" validate:"required,min=3,max=50"`
-	Images      []string `json:"images"`
+	Name             string   `json:"name" validate:"required,min=3,max=255"`
+	Description      string   `json:"description" validate:"omitempty,max=1000"`
+	Price            float64  `json:"price" validate:"required,gt=0"`
+	Quantity         int      `json:"quantity" validate:"min=0"`
+	ReorderThreshold int      `json:"reorder_threshold" validate:"min=0"`
+	Category         string   `json:"category" validate:"omitempty,max=100"`
+	CategoryID       *uint    `json:"category_id,omitempty"`
+	SKU              string   `json:"sku" validate:"required,min=3,max=50"`
+	Images           []string `json:"images"`
 }
 
 // UpdateProductRequest represents the request payload for updating a product
 type UpdateProductRequest struct {
-	Name        *string  `json:"name,omitempty" validate:"omitempty,min=3,max=255"`
-	Description *string  `json:"description,omitempty" validate:"omitempty,max=1000"`
-	Price       *float64 `json:"price,omitempty" validate:"omitempty,gt=0"`
-	Quantity    *int     `json:"quantity,omitempty" validate:"omitempty,min=0"`
-	Category    *string  `json:"category,omitempty" validate:"omitempty,max=100"`
-	SKU         *string  `json:"sku,omitempty" validate:"omitempty,min=3,max=50"`
-	Images      []string `json:"images,omitempty"`
+	Name             *string  `json:"name,omitempty" validate:"omitempty,min=3,max=255"`
+	Description      *string  `json:"description,omitempty" validate:"omitempty,max=1000"`
+	Price            *float64 `json:"price,omitempty" validate:"omitempty,gt=0"`
+	Quantity         *int     `json:"quantity,omitempty" validate:"omitempty,min=0"`
+	ReorderThreshold *int     `json:"reorder_threshold,omitempty" validate:"omitempty,min=0"` // 0 disables low-stock alerts
+	Category         *string  `json:"category,omitempty" validate:"omitempty,max=100"`
+	CategoryID       *uint    `json:"category_id,omitempty"` // 0 removes the category
+	SKU              *string  `json:"sku,omitempty" validate:"omitempty,min=3,max=50"`
+	Images           []string `json:"images,omitempty"`
+}
+
+// UpdateQuantityRequest represents the request payload for a relative stock
+// adjustment. The order service sets Reason to sale or return, with the price
+// the item was sold at.
+type UpdateQuantityRequest struct {
+	Change    int      `json:"change" validate:"ne=0"`
+	Reason    string   `json:"reason" validate:"omitempty,oneof=manual sale return"`
+	UnitPrice *float64 `json:"unit_price,omitempty" validate:"omitempty,gte=0"`
+}
+
+// QuantityResponse represents the response payload for a stock adjustment
+type QuantityResponse struct {
+	ID       uint `json:"id"`
+	Quantity int  `json:"quantity"`
 }
 
 // ProductResponse represents the response payload for product operations
 type ProductResponse struct {
-	ID          uint     `json:"id"`
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Price       float64  `json:"price"`
-	Quantity    int      `json:"quantity"`
-	Category    string   `json:"category"`
-	SKU         string   `json:"sku"`
-	Images      []string `json:"images"`
-	CreatedAt   string   `json:"created_at"`
-	UpdatedAt   string   `json:"updated_at"`
-}
-
-// ProductListResponse represents the response for listing products
+	ID               uint     `json:"id"`
+	Name             string   `json:"name"`
+	Description      string   `json:"description"`
+	Price            float64  `json:"price"`
+	Quantity         int      `json:"quantity"`
+	ReorderThreshold int      `json:"reorder_threshold"`
+	Category         string   `json:"category"`
+	CategoryID       *uint    `json:"category_id,omitempty"`
+	SKU              string   `json:"sku"`
+	Images           []string `json:"images"`
+	Version          int      `json:"version"`
+	CreatedAt        string   `json:"created_at"`
+	UpdatedAt        string   `json:"updated_at"`
+	DeletedAt        string   `json:"deleted_at,omitempty"`
+}
+
+// ProductAuditResponse represents one entry of a product's change history
+type ProductAuditResponse struct {
+	ID        uint                   `json:"id"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor,omitempty"`
+	Version   int                    `json:"version"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	CreatedAt string                 `json:"created_at"`
+}
+
+// ProductHistoryResponse represents a page of a product's change history,
+// newest first
+type ProductHistoryResponse struct {
+	ProductID uint                   `json:"product_id"`
+	Entries   []ProductAuditResponse `json:"entries"`
+	Total     int64                  `json:"total"`
+	Page      int                    `json:"page"`
+	Limit     int                    `json:"limit"`
+}
+
+// CreateCategoryRequest represents the request payload for creating a category.
+// The slug is derived from the name when omitted.
+type CreateCategoryRequest struct {
+	Name     string `json:"name" validate:"required,min=1,max=100"`
+	Slug     string `json:"slug" validate:"omitempty,max=100"`
+	ParentID *uint  `json:"parent_id,omitempty"`
+}
+
+// UpdateCategoryRequest represents the request payload for updating a category
+type UpdateCategoryRequest struct {
+	Name     *string `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
+	Slug     *string `json:"slug,omitempty" validate:"omitempty,max=100"`
+	ParentID *uint   `json:"parent_id,omitempty"` // 0 moves the category to the top level
+}
+
+// CategoryResponse represents a category together with its subcategories
+type CategoryResponse struct {
+	ID        uint               `json:"id"`
+	Name      string             `json:"name"`
+	Slug      string             `json:"slug"`
+	ParentID  *uint              `json:"parent_id"`
+	Children  []CategoryResponse `json:"children"`
+	CreatedAt string             `json:"created_at"`
+	UpdatedAt string             `json:"updated_at"`
+}
+
+// ProductImageResponse represents an uploaded product image
+type ProductImageResponse struct {
+	ID           uint   `json:"id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// ProductListQuery holds the filters, sort order and page of GET /products
+type ProductListQuery struct {
+	Page       int      `json:"page" validate:"min=1"`
+	Limit      int      `json:"limit" validate:"min=1,max=100"`
+	Query      string   `json:"q" validate:"max=200"`
+	Categories []string `json:"category" validate:"max=20,dive,min=1,max=100"` // slugs or names; subcategories are included
+	MinPrice   *float64 `json:"min_price" validate:"omitempty,gte=0"`
+	MaxPrice   *float64 `json:"max_price" validate:"omitempty,gte=0"`
+	InStock    *bool    `json:"in_stock"`
+	Sort       string   `json:"sort" validate:"omitempty,oneof=price -price name -name created_at -created_at"`
+	Deleted    bool     `json:"deleted"` // list soft-deleted products instead of live ones
+
+	// CursorMode selects keyset pagination; Cursor is empty for the first page
+	CursorMode bool   `json:"-"`
+	Cursor     string `json:"cursor" validate:"max=512"`
+}
+
+// ProductListResponse represents the response for listing products. The
+// filters and sort order that were applied are echoed back.
+// In cursor mode total and page are omitted and next_cursor/prev_cursor are set
+// when there are more products in that direction.
 type ProductListResponse struct {
-	Products []ProductResponse `json:"products"`
-	Total    int64             `json:"total"`
-	Page     int               `json:"page"`
-	Limit    int               `json:"limit"`
+	Products   []ProductResponse `json:"products"`
+	Total      *int64            `json:"total,omitempty"`
+	Page       int               `json:"page,omitempty"`
+	Limit      int               `json:"limit"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	PrevCursor string            `json:"prev_cursor,omitempty"`
+	Query      string            `json:"q,omitempty"`
+	Categories []string          `json:"categories,omitempty"`
+	MinPrice   *float64          `json:"min_price,omitempty"`
+	MaxPrice   *float64          `json:"max_price,omitempty"`
+	InStock    *bool             `json:"in_stock,omitempty"`
+	Sort       string            `json:"sort,omitempty"`
+	Deleted    bool              `json:"deleted,omitempty"`
+}
+
+// ImportRowError lists the problems with one row of a product import
+type ImportRowError struct {
+	Row    int               `json:"row"`
+	SKU    string            `json:"sku,omitempty"`
+	Errors map[string]string `json:"errors"`
+}
+
+// ImportResult summarises a product import. In a dry run nothing is written
+// and created/updated report what the import would have done.
+type ImportResult struct {
+	DryRun          bool             `json:"dry_run"`
+	Processed       int              `json:"processed"`
+	Created         int              `json:"created"`
+	Updated         int              `json:"updated"`
+	Failed          int              `json:"failed"`
+	Errors          []ImportRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
 }
 
 // ErrorResponse represents an error response
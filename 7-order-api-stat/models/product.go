@@ -9,20 +9,72 @@ import (
 
 // Product represents a product in the system
 type Product struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name" gorm:"size:255;not null" validate:"required,min=3,max=255"`
-	Description string         `json:"description" gorm:"type:text" validate:"omitempty,max=1000"`
-	Price       float64        `json:"price" gorm:"type:decimal(10,2);not null" validate:"required,gt=0"`
-	Quantity    int            `json:"quantity" gorm:"not null;default:0" validate:"min=0"`
-	Category    string         `json:"category" gorm:"size:100" validate:"omitempty,max=100"`
-	SKU         string         `json:"sku" gorm:"size:50;uniqueIndex" validate:"required,min=3,max=50"`
-	Images      pq.StringArray `json:"images" gorm:"type:text[]"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	Name             string         `json:"name" gorm:"size:255;not null" validate:"required,min=3,max=255"`
+	Description      string         `json:"description" gorm:"type:text" validate:"omitempty,max=1000"`
+	Price            float64        `json:"price" gorm:"type:decimal(10,2);not null" validate:"required,gt=0"`
+	Quantity         int            `json:"quantity" gorm:"not null;default:0" validate:"min=0"`
+	ReorderThreshold int            `json:"reorder_threshold" gorm:"not null;default:0" validate:"min=0"` // low-stock alert level, 0 disables alerts
+	Category         string         `json:"category" gorm:"size:100" validate:"omitempty,max=100"`        // name of the category, kept in sync with CategoryID
+	CategoryID       *uint          `json:"category_id" gorm:"index"`
+	SKU              string         `json:"sku" gorm:"size:50;uniqueIndex" validate:"required,min=3,max=50"`
+	Images           pq.StringArray `json:"images" gorm:"type:text[]"`
+	Version          int            `json:"version" gorm:"not null;default:1"` // incremented on every change, exposed as the ETag
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 // TableName specifies the table name for Product model
 func (Product) TableName() string {
 	return "products"
 }
+
+// Stock adjustment reasons. Only the order service may record sales and
+// returns (the service role); every other adjustment is manual.
+const (
+	AdjustmentReasonManual = "manual"
+	AdjustmentReasonSale   = "sale"
+	AdjustmentReasonReturn = "return"
+)
+
+// StockAdjustment records a stock change applied with an idempotency key, so
+// that a retried request with the same key is not applied twice. Sales and
+// returns reported by the order service are recorded here too, which makes
+// this table a source of the sales statistics; UnitPrice is the price the item
+// was sold at, or the product's price when the change was applied.
+type StockAdjustment struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	IdempotencyKey string    `json:"idempotency_key" gorm:"size:255;not null;uniqueIndex"`
+	ProductID      uint      `json:"product_id" gorm:"not null;index"`
+	Change         int       `json:"change" gorm:"not null"`
+	Reason         string    `json:"reason" gorm:"size:20"` // see AdjustmentReason* constants
+	UnitPrice      *float64  `json:"unit_price" gorm:"type:decimal(10,2)"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
+
+// TableName specifies the table name for StockAdjustment model
+func (StockAdjustment) TableName() string {
+	return "stock_adjustments"
+}
+
+// ProductImage is an image uploaded for a product. The original and its
+// thumbnail are stored in the blob store under keys derived from the content
+// hash, so identical uploads share a record and stored images never change.
+type ProductImage struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ProductID    uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_product_images_product_hash"`
+	Hash         string    `json:"hash" gorm:"size:64;not null;uniqueIndex:idx_product_images_product_hash"`
+	Key          string    `json:"key" gorm:"size:255;not null"`
+	ThumbnailKey string    `json:"thumbnail_key" gorm:"size:255;not null"`
+	ContentType  string    `json:"content_type" gorm:"size:50;not null"`
+	Size         int64     `json:"size" gorm:"not null"`
+	Width        int       `json:"width" gorm:"not null"`
+	Height       int       `json:"height" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for ProductImage model
+func (ProductImage) TableName() string {
+	return "product_images"
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Reservation statuses. A reservation is held until it is confirmed, released
+// or it expires; the other statuses are final.
+const (
+	ReservationStatusHeld      = "held"
+	ReservationStatusConfirmed = "confirmed"
+	ReservationStatusReleased  = "released"
+	ReservationStatusExpired   = "expired"
+)
+
+// Reservation holds stock for an order that is not confirmed yet. Reserving
+// takes the items out of the products' stock right away, so they cannot be
+// sold twice; releasing the reservation, or letting it expire at ExpiresAt,
+// puts them back, while confirming it makes the sale final.
+type Reservation struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	Owner          string            `json:"owner,omitempty" gorm:"size:255;index"` // user ID from the request token, empty when auth is disabled
+	IdempotencyKey *string           `json:"idempotency_key,omitempty" gorm:"size:255;uniqueIndex"`
+	Status         string            `json:"status" gorm:"size:20;not null;index:idx_reservations_due,priority:1"`
+	ExpiresAt      time.Time         `json:"expires_at" gorm:"not null;index:idx_reservations_due,priority:2"`
+	ConfirmedAt    *time.Time        `json:"confirmed_at,omitempty"`
+	ReleasedAt     *time.Time        `json:"released_at,omitempty"` // when it was released or expired
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	Items          []ReservationItem `json:"items" gorm:"foreignKey:ReservationID"`
+}
+
+// TableName specifies the table name for Reservation model
+func (Reservation) TableName() string {
+	return "reservations"
+}
+
+// ReservationItem is the quantity of one product held by a reservation.
+// UnitPrice is the product's price when it was reserved.
+type ReservationItem struct {
+	ID            uint    `json:"-" gorm:"primaryKey"`
+	ReservationID uint    `json:"-" gorm:"not null;index"`
+	ProductID     uint    `json:"product_id" gorm:"not null;index"`
+	Quantity      int     `json:"quantity" gorm:"not null"`
+	UnitPrice     float64 `json:"unit_price" gorm:"type:decimal(10,2);not null"`
+}
+
+// TableName specifies the table name for ReservationItem model
+func (ReservationItem) TableName() string {
+	return "reservation_items"
+}
+
+// CreateReservationRequest represents the request body for reserving stock.
+// TTLSeconds defaults to the configured reservation TTL and is capped at the
+// configured maximum.
+type CreateReservationRequest struct {
+	Items      []ReservationItemRequest `json:"items" validate:"required,min=1,max=100,dive"`
+	TTLSeconds int                      `json:"ttl_seconds" validate:"omitempty,min=1"`
+}
+
+// ReservationItemRequest is one product to reserve
+type ReservationItemRequest struct {
+	ProductID uint `json:"product_id" validate:"required"`
+	Quantity  int  `json:"quantity" validate:"required,min=1"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import "time"
+
+// Sales report intervals
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// ProductStatsResponse summarises the live catalog: totals, a breakdown by
+// category, the products running low on stock and the price distribution
+type ProductStatsResponse struct {
+	TotalProducts int64           `json:"total_products"`
+	OutOfStock    int64           `json:"out_of_stock"`
+	TotalUnits    int64           `json:"total_units"`
+	StockValue    float64         `json:"stock_value"` // sum of price * quantity
+	Categories    []CategoryStats `json:"categories"`
+	LowStock      LowStockStats   `json:"low_stock"`
+	Prices        PriceStats      `json:"prices"`
+}
+
+// CategoryStats holds the totals of the products directly in one category.
+// Products without a category are reported with a null category_id.
+type CategoryStats struct {
+	CategoryID *uint   `json:"category_id"`
+	Category   string  `json:"category"`
+	Products   int64   `json:"products"`
+	Units      int64   `json:"units"`
+	StockValue float64 `json:"stock_value"`
+}
+
+// LowStockStats lists the products with at most Threshold units in stock,
+// lowest stock first
+type LowStockStats struct {
+	Threshold int               `json:"threshold"`
+	Count     int64             `json:"count"`
+	Products  []LowStockProduct `json:"products"`
+}
+
+// LowStockProduct is a product in the low-stock list
+type LowStockProduct struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+// PriceStats describes the distribution of product prices. The histogram
+// splits the range from Min to Max into equal-width buckets; each bucket
+// includes its lower bound, and the last one its upper bound too.
+type PriceStats struct {
+	Min       float64       `json:"min"`
+	Max       float64       `json:"max"`
+	Average   float64       `json:"average"`
+	Median    float64       `json:"median"`
+	Histogram []PriceBucket `json:"histogram"`
+}
+
+// PriceBucket is one bucket of the price histogram
+type PriceBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+// SalesStatsQuery holds the parameters of GET /stats/sales. From and To are
+// UTC midnights; To is the start of the day after the last day reported.
+type SalesStatsQuery struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Interval string    `json:"interval" validate:"oneof=day week month"`
+	Top      int       `json:"top" validate:"min=1,max=100"`
+}
+
+// SalesStatsResponse reports revenue and units sold over a date range,
+// bucketed by Interval, together with the best-selling products
+type SalesStatsResponse struct {
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	Interval    string           `json:"interval"`
+	Revenue     float64          `json:"revenue"`
+	UnitsSold   int64            `json:"units_sold"`
+	Buckets     []SalesBucket    `json:"buckets"`
+	TopProducts []TopSoldProduct `json:"top_products"`
+}
+
+// SalesBucket holds the sales of the day, week (starting Monday) or month
+// starting at Start
+type SalesBucket struct {
+	Start     string  `json:"start"`
+	Revenue   float64 `json:"revenue"`
+	UnitsSold int64   `json:"units_sold"`
+}
+
+// TopSoldProduct is a product in the best-sellers list. Name and SKU are empty
+// if the product no longer exists.
+type TopSoldProduct struct {
+	ProductID uint    `json:"product_id"`
+	Name      string  `json:"name"`
+	SKU       string  `json:"sku"`
+	UnitsSold int64   `json:"units_sold"`
+	Revenue   float64 `json:"revenue"`
+}
@@ -0,0 +1,148 @@
+// Package alerttest provides a local receiver for low-stock alert webhooks, for
+// tests and local development. It checks signatures, records every alert and
+// can be told to fail, so notification delivery and retries can be observed
+// without a real alerting system.
+package alerttest
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"order-api-stat/models"
+	"order-api-stat/service"
+)
+
+// WebhookPath is the endpoint alerts are posted to
+const WebhookPath = "/alerts"
+
+// maxAlertSize limits the size of a posted alert
+const maxAlertSize = 64 << 10
+
+// Receiver is a fake alert webhook. It serves:
+//
+//	POST /alerts  receive an alert (signed with X-Signature when Secret is set)
+//	GET  /alerts  all alerts received, oldest first
+type Receiver struct {
+	Secret string
+
+	// OnAlert, if set, is called with every alert accepted
+	OnAlert func(alert models.LowStockEvent)
+
+	mu       sync.Mutex
+	alerts   []models.LowStockEvent
+	failures int
+	requests int
+}
+
+// NewReceiver creates a receiver that accepts alerts signed with secret, or
+// unsigned alerts if secret is empty
+func NewReceiver(secret string) *Receiver {
+	return &Receiver{Secret: secret}
+}
+
+// Server is a receiver running on a local httptest server
+type Server struct {
+	*Receiver
+	*httptest.Server
+}
+
+// NewServer starts a receiver on a random local port. Close it when done.
+func NewServer(secret string) *Server {
+	receiver := NewReceiver(secret)
+	return &Server{Receiver: receiver, Server: httptest.NewServer(receiver)}
+}
+
+// WebhookURL returns the URL to configure as APP_ALERTS_WEBHOOK_URL
+func (s *Server) WebhookURL() string {
+	return s.URL + WebhookPath
+}
+
+// ServeHTTP implements http.Handler
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != WebhookPath {
+		http.NotFound(w, req)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodPost:
+		r.handleAlert(w, req)
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Alerts())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Receiver) handleAlert(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxAlertSize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if r.Secret != "" {
+		expected := service.AlertSignature(r.Secret, body)
+		if !hmac.Equal([]byte(req.Header.Get("X-Signature")), []byte(expected)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var alert models.LowStockEvent
+	if err := json.Unmarshal(body, &alert); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	r.requests++
+	if r.failures > 0 {
+		r.failures--
+		r.mu.Unlock()
+		http.Error(w, "simulated failure", http.StatusServiceUnavailable)
+		return
+	}
+	r.alerts = append(r.alerts, alert)
+	r.mu.Unlock()
+
+	if r.OnAlert != nil {
+		r.OnAlert(alert)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Alerts returns the alerts received so far, oldest first
+func (r *Receiver) Alerts() []models.LowStockEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.LowStockEvent(nil), r.alerts...)
+}
+
+// Requests returns the number of valid requests received, including those
+// failed on purpose
+func (r *Receiver) Requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+// FailNext makes the next n alerts fail with 503 Service Unavailable
+func (r *Receiver) FailNext(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = n
+}
+
+// Reset discards the recorded alerts
+func (r *Receiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = nil
+	r.requests = 0
+	r.failures = 0
+}
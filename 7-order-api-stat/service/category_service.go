@@ -0,0 +1,314 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"order-api-stat/models"
+)
+
+// CategoryService handles the product category tree
+type CategoryService struct {
+	db *gorm.DB
+}
+
+// NewCategoryService creates a new category service
+func NewCategoryService(db *gorm.DB) *CategoryService {
+	return &CategoryService{db: db}
+}
+
+// CreateCategory creates a new category, under req.ParentID if set
+func (s *CategoryService) CreateCategory(req *models.CreateCategoryRequest) (*models.CategoryResponse, error) {
+	slug, err := categorySlug(req.Name, req.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	category := &models.Category{Name: strings.TrimSpace(req.Name), Slug: slug}
+	if req.ParentID != nil && *req.ParentID != 0 {
+		if err := s.checkParent(s.db, 0, *req.ParentID); err != nil {
+			return nil, err
+		}
+		category.ParentID = req.ParentID
+	}
+
+	if err := s.db.Create(category).Error; err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, fmt.Errorf("category with slug '%s' already exists", slug)
+		}
+		return nil, fmt.Errorf("failed to create category: %w", err)
+	}
+
+	return toCategoryResponse(category), nil
+}
+
+// GetCategory retrieves a category with its subcategories
+func (s *CategoryService) GetCategory(id uint) (*models.CategoryResponse, error) {
+	tree, err := s.categoryTree()
+	if err != nil {
+		return nil, err
+	}
+
+	category, ok := tree[id]
+	if !ok {
+		return nil, fmt.Errorf("category with ID %d not found", id)
+	}
+	return category, nil
+}
+
+// ListCategories returns the category tree: the top-level categories with
+// their subcategories nested under them, ordered by name
+func (s *CategoryService) ListCategories() ([]models.CategoryResponse, error) {
+	tree, err := s.categoryTree()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make([]models.CategoryResponse, 0)
+	for _, category := range tree {
+		if category.ParentID == nil {
+			roots = append(roots, *category)
+		}
+	}
+	sortCategories(roots)
+	return roots, nil
+}
+
+// categoryTree loads all categories and links them into a tree, keyed by ID
+func (s *CategoryService) categoryTree() (map[uint]*models.CategoryResponse, error) {
+	var categories []models.Category
+	if err := s.db.Find(&categories).Error; err != nil {
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+
+	byID := make(map[uint]*models.Category, len(categories))
+	childIDs := make(map[uint][]uint)
+	for i := range categories {
+		byID[categories[i].ID] = &categories[i]
+		if parentID := categories[i].ParentID; parentID != nil {
+			childIDs[*parentID] = append(childIDs[*parentID], categories[i].ID)
+		}
+	}
+
+	// Subtrees are built before they are copied into their parent
+	nodes := make(map[uint]*models.CategoryResponse, len(categories))
+	var build func(id uint) *models.CategoryResponse
+	build = func(id uint) *models.CategoryResponse {
+		if node, ok := nodes[id]; ok {
+			return node
+		}
+		node := toCategoryResponse(byID[id])
+		for _, childID := range childIDs[id] {
+			node.Children = append(node.Children, *build(childID))
+		}
+		sortCategories(node.Children)
+		nodes[id] = node
+		return node
+	}
+	for id := range byID {
+		build(id)
+	}
+
+	return nodes, nil
+}
+
+// UpdateCategory renames or moves a category. Renaming also updates the
+// category name stored on its products, recording the change in their history
+// with actor.
+func (s *CategoryService) UpdateCategory(id uint, req *models.UpdateCategoryRequest, actor string) (*models.CategoryResponse, error) {
+	var category models.Category
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&category, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("category with ID %d not found", id)
+			}
+			return fmt.Errorf("failed to get category: %w", err)
+		}
+
+		updates := make(map[string]interface{})
+		name := category.Name
+		if req.Name != nil {
+			name = strings.TrimSpace(*req.Name)
+			if models.Slugify(name) == "" {
+				return fmt.Errorf("invalid category name: must contain letters or digits")
+			}
+			updates["name"] = name
+		}
+		if req.Slug != nil {
+			slug, err := categorySlug(name, *req.Slug)
+			if err != nil {
+				return err
+			}
+			updates["slug"] = slug
+		}
+		if req.ParentID != nil {
+			if *req.ParentID == 0 {
+				updates["parent_id"] = nil
+			} else {
+				// Block concurrent moves so two of them cannot form a cycle
+				// that checkParent would not see
+				if err := tx.Exec("LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+					return fmt.Errorf("failed to lock categories: %w", err)
+				}
+				if err := s.checkParent(tx, id, *req.ParentID); err != nil {
+					return err
+				}
+				updates["parent_id"] = *req.ParentID
+			}
+		}
+
+		if err := tx.Model(&category).Updates(updates).Error; err != nil {
+			if req.Slug != nil && isUniqueConstraintError(err) {
+				return fmt.Errorf("category with slug '%s' already exists", updates["slug"])
+			}
+			return fmt.Errorf("failed to update category: %w", err)
+		}
+
+		if name, ok := updates["name"]; ok {
+			if err := tx.Exec(`INSERT INTO product_audits (product_id, action, actor, version, before, after, created_at)
+				SELECT id, ?, ?, version + 1, jsonb_build_object('category', category), jsonb_build_object('category', ?::text), now()
+				FROM products WHERE category_id = ?`, models.AuditActionUpdate, actor, name, id).Error; err != nil {
+				return fmt.Errorf("failed to record product history: %w", err)
+			}
+			if err := tx.Model(&models.Product{}).Unscoped().Where("category_id = ?", id).
+				Updates(map[string]interface{}{"category": name, "version": gorm.Expr("version + 1")}).Error; err != nil {
+				return fmt.Errorf("failed to rename category on products: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCategory(id)
+}
+
+// DeleteCategory deletes a category. Categories that still have subcategories
+// or products cannot be deleted.
+func (s *CategoryService) DeleteCategory(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		if err := tx.First(&category, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("category with ID %d not found", id)
+			}
+			return fmt.Errorf("failed to get category: %w", err)
+		}
+
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return fmt.Errorf("failed to count subcategories: %w", err)
+		}
+		if children > 0 {
+			return fmt.Errorf("category with ID %d still has subcategories", id)
+		}
+
+		var products int64
+		if err := tx.Model(&models.Product{}).Where("category_id = ?", id).Count(&products).Error; err != nil {
+			return fmt.Errorf("failed to count products: %w", err)
+		}
+		if products > 0 {
+			return fmt.Errorf("category with ID %d still has %d products", id, products)
+		}
+
+		// Soft-deleted products keep their category name but lose the link
+		if err := tx.Model(&models.Product{}).Unscoped().Where("category_id = ?", id).
+			Update("category_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to unlink deleted products: %w", err)
+		}
+
+		if err := tx.Delete(&category).Error; err != nil {
+			return fmt.Errorf("failed to delete category: %w", err)
+		}
+		return nil
+	})
+}
+
+// checkParent verifies that parentID exists and that making it the parent of
+// category id (0 for a new category) would not create a cycle
+func (s *CategoryService) checkParent(tx *gorm.DB, id, parentID uint) error {
+	for current := &parentID; current != nil; {
+		if *current == id {
+			return fmt.Errorf("invalid parent: category %d cannot be moved under itself or a subcategory", id)
+		}
+		var parent models.Category
+		if err := tx.First(&parent, *current).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("invalid parent: category with ID %d does not exist", *current)
+			}
+			return fmt.Errorf("failed to get parent category: %w", err)
+		}
+		current = parent.ParentID
+	}
+	return nil
+}
+
+// resolveCategory returns the category for a product's category name, matched
+// by slug so differences in case and punctuation do not create duplicates. A
+// top-level category is created for names that have none yet.
+func resolveCategory(tx *gorm.DB, name string) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	slug := models.Slugify(name)
+	if slug == "" {
+		return nil, fmt.Errorf("invalid category: '%s' must contain letters or digits", name)
+	}
+
+	category := models.Category{Name: name, Slug: slug}
+	err := tx.Where(models.Category{Slug: slug}).FirstOrCreate(&category).Error
+	if err != nil && isUniqueConstraintError(err) {
+		// Created concurrently by another request
+		err = tx.Where(models.Category{Slug: slug}).First(&category).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve category: %w", err)
+	}
+	return &category, nil
+}
+
+// categorySlug returns slug if given, or the slug derived from name. A given
+// slug must already be in canonical form.
+func categorySlug(name, slug string) (string, error) {
+	if slug == "" {
+		if slug = models.Slugify(name); slug == "" {
+			return "", fmt.Errorf("invalid category name: must contain letters or digits")
+		}
+		return slug, nil
+	}
+	if models.Slugify(slug) != slug {
+		return "", fmt.Errorf("invalid category slug: must be lower case letters and digits separated by single hyphens")
+	}
+	return slug, nil
+}
+
+// categoryDescendantsSQL selects the IDs of the categories with the given
+// slugs and of all their subcategories
+const categoryDescendantsSQL = `WITH RECURSIVE tree AS (
+	SELECT id FROM categories WHERE slug IN ?
+	UNION
+	SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+) SELECT id FROM tree`
+
+// toCategoryResponse converts a category to its response format, without children
+func toCategoryResponse(category *models.Category) *models.CategoryResponse {
+	return &models.CategoryResponse{
+		ID:        category.ID,
+		Name:      category.Name,
+		Slug:      category.Slug,
+		ParentID:  category.ParentID,
+		CreatedAt: category.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: category.UpdatedAt.Format(time.RFC3339),
+		Children:  make([]models.CategoryResponse, 0),
+	}
+}
+
+// sortCategories orders categories by name
+func sortCategories(categories []models.CategoryResponse) {
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"order-api-stat/models"
+	"order-api-stat/storage"
+)
+
+// ImageURLPrefix is the path stored images are served under
+const ImageURLPrefix = "/images/"
+
+// maxImagePixels bounds the decoded size of an upload, so a small file that
+// decodes to a huge bitmap cannot exhaust memory
+const maxImagePixels = 40_000_000
+
+// imageExtensions lists the accepted image types, detected from the content
+// rather than the client's Content-Type, with the extension they are stored under
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ImageService handles product image uploads
+type ImageService struct {
+	db            *gorm.DB
+	store         storage.BlobStore
+	maxSize       int64
+	thumbnailSize int
+}
+
+// NewImageService creates a new image service. Uploads larger than maxSize
+// bytes are rejected and thumbnails fit within thumbnailSize pixels.
+func NewImageService(db *gorm.DB, store storage.BlobStore, maxSize int64, thumbnailSize int) *ImageService {
+	return &ImageService{db: db, store: store, maxSize: maxSize, thumbnailSize: thumbnailSize}
+}
+
+// MaxSize returns the largest accepted upload in bytes
+func (s *ImageService) MaxSize() int64 {
+	return s.maxSize
+}
+
+// AddImage validates the image read from r, stores it with a JPEG thumbnail
+// and adds its URL to the product's images. Uploading an image the product
+// already has returns the existing record, with created set to false. actor is
+// recorded in the product's history.
+func (s *ImageService) AddImage(ctx context.Context, productID uint, r io.Reader, actor string) (*models.ProductImage, bool, error) {
+	if err := s.db.Select("id").First(&models.Product{}, productID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, false, fmt.Errorf("product with ID %d not found", productID)
+		}
+		return nil, false, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, s.maxSize+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read image: %w", err)
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, false, fmt.Errorf("image too large: at most %d bytes are allowed", s.maxSize)
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, false, fmt.Errorf("unsupported image type %s: use JPEG, PNG or GIF", contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid image: %v", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, false, fmt.Errorf("invalid image: %dx%d pixels exceeds the limit of %d", config.Width, config.Height, maxImagePixels)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if existing, err := s.findImage(productID, hash); err != nil || existing != nil {
+		return existing, false, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid image: %v", err)
+	}
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, thumbnail(img, s.thumbnailSize), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, false, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	record := &models.ProductImage{
+		ProductID:    productID,
+		Hash:         hash,
+		Key:          fmt.Sprintf("products/%d/%s%s", productID, hash, extension),
+		ThumbnailKey: fmt.Sprintf("products/%d/%s_thumb.jpg", productID, hash),
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		Width:        config.Width,
+		Height:       config.Height,
+	}
+
+	// Blobs are written first; keys are content-addressed, so a concurrent or
+	// failed upload of the same image leaves identical blobs behind at worst
+	if err := s.store.Put(ctx, record.Key, bytes.NewReader(data), contentType); err != nil {
+		return nil, false, fmt.Errorf("failed to store image: %w", err)
+	}
+	if err := s.store.Put(ctx, record.ThumbnailKey, &thumb, "image/jpeg"); err != nil {
+		return nil, false, fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("product with ID %d not found", productID)
+			}
+			return err
+		}
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		before := product
+		if err := tx.Model(&product).Updates(map[string]interface{}{
+			"images":  gorm.Expr("array_append(coalesce(images, '{}'), ?)", ImageURL(record.Key)),
+			"version": gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		_, err := recordUpdatedProduct(tx, models.AuditActionUpdate, actor, &before, productID)
+		return err
+	})
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			// The same image was uploaded concurrently
+			existing, findErr := s.findImage(productID, hash)
+			if findErr == nil && existing != nil {
+				return existing, false, nil
+			}
+		}
+		return nil, false, fmt.Errorf("failed to save image: %w", err)
+	}
+
+	return record, true, nil
+}
+
+// findImage returns the product's image with the given content hash, or nil
+func (s *ImageService) findImage(productID uint, hash string) (*models.ProductImage, error) {
+	var existing models.ProductImage
+	err := s.db.Where("product_id = ? AND hash = ?", productID, hash).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up image: %w", err)
+	}
+	return &existing, nil
+}
+
+// ListImages returns the images uploaded for a product, oldest first
+func (s *ImageService) ListImages(productID uint) ([]models.ProductImage, error) {
+	if err := s.db.Select("id").First(&models.Product{}, productID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("product with ID %d not found", productID)
+		}
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	var images []models.ProductImage
+	if err := s.db.Where("product_id = ?", productID).Order("id").Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	return images, nil
+}
+
+// OpenImage opens a stored image or thumbnail by its key
+func (s *ImageService) OpenImage(ctx context.Context, key string) (io.ReadCloser, *storage.BlobInfo, error) {
+	return s.store.Get(ctx, key)
+}
+
+// ImageURL returns the URL a stored image is served at
+func ImageURL(key string) string {
+	return ImageURLPrefix + key
+}
+
+// ToProductImageResponse converts a product image to its response format
+func ToProductImageResponse(image *models.ProductImage) models.ProductImageResponse {
+	return models.ProductImageResponse{
+		ID:           image.ID,
+		URL:          ImageURL(image.Key),
+		ThumbnailURL: ImageURL(image.ThumbnailKey),
+		ContentType:  image.ContentType,
+		Size:         image.Size,
+		Width:        image.Width,
+		Height:       image.Height,
+		CreatedAt:    image.CreatedAt.Format(time.RFC3339),
+	}
+}
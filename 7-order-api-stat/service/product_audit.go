@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+
+	"order-api-stat/models"
+)
+
+// recordProductChange writes the audit entry for a change to a product.
+// before is the product as it was (nil for a create) and after as it is now
+// (nil for a delete). Creates and deletes store the whole product; other
+// changes store only the fields that differ.
+func recordProductChange(tx *gorm.DB, action, actor string, before, after *models.Product) error {
+	entry := &models.ProductAudit{Action: action, Actor: actor}
+	switch {
+	case before == nil:
+		entry.ProductID, entry.Version = after.ID, after.Version
+		entry.After = productAuditFields(after)
+	case after == nil:
+		entry.ProductID, entry.Version = before.ID, before.Version
+		entry.Before = productAuditFields(before)
+	default:
+		entry.ProductID, entry.Version = after.ID, after.Version
+		entry.Before, entry.After = models.AuditFields{}, models.AuditFields{}
+		old, current := productAuditFields(before), productAuditFields(after)
+		for field, value := range current {
+			if !reflect.DeepEqual(old[field], value) {
+				entry.Before[field], entry.After[field] = old[field], value
+			}
+		}
+	}
+
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record product history: %w", err)
+	}
+	return nil
+}
+
+// recordUpdatedProduct reloads product id after an update in tx and records
+// the change from before
+func recordUpdatedProduct(tx *gorm.DB, action, actor string, before *models.Product, id uint) (*models.Product, error) {
+	var after models.Product
+	if err := tx.Unscoped().First(&after, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to get updated product: %w", err)
+	}
+	if err := recordProductChange(tx, action, actor, before, &after); err != nil {
+		return nil, err
+	}
+	return &after, nil
+}
+
+// productAuditFields returns the audited fields of a product
+func productAuditFields(product *models.Product) models.AuditFields {
+	images := []string(product.Images)
+	if images == nil {
+		images = []string{}
+	}
+	var deletedAt interface{}
+	if product.DeletedAt.Valid {
+		deletedAt = product.DeletedAt.Time.UTC().Format(time.RFC3339)
+	}
+	var categoryID interface{}
+	if product.CategoryID != nil {
+		categoryID = *product.CategoryID
+	}
+
+	return models.AuditFields{
+		"name":              product.Name,
+		"description":       product.Description,
+		"price":             product.Price,
+		"quantity":          product.Quantity,
+		"reorder_threshold": product.ReorderThreshold,
+		"category":          product.Category,
+		"category_id":       categoryID,
+		"sku":               product.SKU,
+		"images":            images,
+		"deleted_at":        deletedAt,
+	}
+}
+
+// GetProductHistory returns a page of a product's change history, newest
+// first. The history of deleted products remains available.
+func (s *ProductService) GetProductHistory(id uint, page, limit int) (*models.ProductHistoryResponse, error) {
+	if err := s.db.Unscoped().Select("id").First(&models.Product{}, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("product with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	query := s.db.Model(&models.ProductAudit{}).Where("product_id = ?", id)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count product history: %w", err)
+	}
+
+	var entries []models.ProductAudit
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to get product history: %w", err)
+	}
+
+	response := &models.ProductHistoryResponse{
+		ProductID: id,
+		Entries:   make([]models.ProductAuditResponse, len(entries)),
+		Total:     total,
+		Page:      page,
+		Limit:     limit,
+	}
+	for i, entry := range entries {
+		response.Entries[i] = models.ProductAuditResponse{
+			ID:        entry.ID,
+			Action:    entry.Action,
+			Actor:     entry.Actor,
+			Version:   entry.Version,
+			Before:    entry.Before,
+			After:     entry.After,
+			CreatedAt: entry.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	return response, nil
+}
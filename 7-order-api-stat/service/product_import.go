@@ -0,0 +1,512 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"order-api-stat/models"
+)
+
+// Product import and export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+const (
+	// importBatchSize is the number of rows written per transaction
+	importBatchSize = 100
+
+	// maxReportedImportErrors bounds the row errors returned for one import
+	maxReportedImportErrors = 100
+
+	// maxNDJSONLineSize is the longest accepted NDJSON record
+	maxNDJSONLineSize = 1 << 20
+
+	// imageSeparator separates image URLs within a CSV cell
+	imageSeparator = "|"
+)
+
+// productColumns are the CSV columns written by ExportProducts. Import reads
+// the same columns; id, created_at and updated_at are ignored there.
+var productColumns = []string{"id", "sku", "name", "description", "price", "quantity", "reorder_threshold", "category", "images", "created_at", "updated_at"}
+
+// importRow is one parsed product record. fields holds the columns or keys
+// that were present, so an update leaves the others unchanged.
+type importRow struct {
+	line    int
+	request models.CreateProductRequest
+	fields  map[string]bool
+	errors  map[string]string
+}
+
+// importReader yields the rows of an import file. It returns io.EOF when the
+// input is exhausted; any other error aborts the import.
+type importReader interface {
+	next() (*importRow, error)
+}
+
+// ImportProducts reads products from r in the given format and upserts them
+// by SKU. Each row is validated like a POST /products request; invalid rows
+// are reported and skipped without affecting the others. Rows are written in
+// batches, each in its own transaction, so a large file is never held in
+// memory. With dryRun nothing is written. actor is recorded in the history of
+// each product written.
+func (s *ProductService) ImportProducts(r io.Reader, format string, dryRun bool, actor string) (*models.ImportResult, error) {
+	var rows importReader
+	switch format {
+	case FormatCSV:
+		csvRows, err := newCSVImportReader(r)
+		if err != nil {
+			return nil, err
+		}
+		rows = csvRows
+	case FormatNDJSON:
+		rows = newNDJSONImportReader(r)
+	default:
+		return nil, fmt.Errorf("invalid import format '%s'", format)
+	}
+
+	result := &models.ImportResult{DryRun: dryRun, Errors: make([]models.ImportRowError, 0)}
+	// SKUs seen so far in a dry run, so repeated SKUs count as updates
+	seen := make(map[string]bool)
+	var batch []*importRow
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var err error
+		if dryRun {
+			err = s.planImportBatch(batch, seen, result)
+		} else {
+			err = s.applyImportBatch(batch, result, actor)
+		}
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result.Processed++
+		if row.errors == nil {
+			row.errors = s.validator.Validate(&row.request)
+		}
+		if row.errors == nil && row.fields["category"] && strings.TrimSpace(row.request.Category) != "" &&
+			models.Slugify(row.request.Category) == "" {
+			row.errors = map[string]string{"category": "category must contain letters or digits"}
+		}
+		if row.errors != nil {
+			recordImportError(result, row, row.errors)
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// planImportBatch counts how a batch would be applied, without writing
+func (s *ProductService) planImportBatch(batch []*importRow, seen map[string]bool, result *models.ImportResult) error {
+	skus := make([]string, len(batch))
+	for i, row := range batch {
+		skus[i] = row.request.SKU
+	}
+
+	var existing []string
+	if err := s.db.Unscoped().Model(&models.Product{}).Where("sku IN ?", skus).Pluck("sku", &existing).Error; err != nil {
+		return fmt.Errorf("failed to look up products: %w", err)
+	}
+	for _, sku := range existing {
+		seen[sku] = true
+	}
+
+	for _, row := range batch {
+		if seen[row.request.SKU] {
+			result.Updated++
+		} else {
+			result.Created++
+			seen[row.request.SKU] = true
+		}
+	}
+	return nil
+}
+
+// applyImportBatch upserts a batch in one transaction. Each row runs under a
+// savepoint, so a row rejected by the database is reported without losing the
+// rest of the batch.
+func (s *ProductService) applyImportBatch(batch []*importRow, result *models.ImportResult, actor string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range batch {
+			if err := tx.SavePoint("import_row").Error; err != nil {
+				return fmt.Errorf("failed to import products: %w", err)
+			}
+
+			created, err := upsertImportRow(tx, row, actor)
+			if err != nil {
+				if rollbackErr := tx.RollbackTo("import_row").Error; rollbackErr != nil {
+					return fmt.Errorf("failed to import products: %w", rollbackErr)
+				}
+				recordImportError(result, row, map[string]string{"row": err.Error()})
+				continue
+			}
+
+			if created {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+		}
+		return nil
+	})
+}
+
+// upsertImportRow creates the row's product, or updates the product with the
+// same SKU. A soft-deleted product with that SKU is restored.
+func upsertImportRow(tx *gorm.DB, row *importRow, actor string) (bool, error) {
+	req := &row.request
+
+	var category *models.Category
+	if row.fields["category"] {
+		var err error
+		if category, err = productCategory(tx, nil, req.Category); err != nil {
+			return false, err
+		}
+	}
+
+	var product models.Product
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("sku = ?", req.SKU).First(&product).Error
+	if err == gorm.ErrRecordNotFound {
+		product = models.Product{
+			Name:             req.Name,
+			Description:      req.Description,
+			Price:            req.Price,
+			Quantity:         req.Quantity,
+			ReorderThreshold: req.ReorderThreshold,
+			SKU:              req.SKU,
+			Images:           req.Images,
+		}
+		if category != nil {
+			product.CategoryID = &category.ID
+			product.Category = category.Name
+		}
+		if err := tx.Create(&product).Error; err != nil {
+			return false, fmt.Errorf("failed to create product: %w", err)
+		}
+		return true, recordProductChange(tx, models.AuditActionCreate, actor, nil, &product)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	updates := map[string]interface{}{
+		"name":       req.Name,
+		"price":      req.Price,
+		"deleted_at": nil,
+		"version":    gorm.Expr("version + 1"),
+	}
+	if row.fields["description"] {
+		updates["description"] = req.Description
+	}
+	if row.fields["quantity"] {
+		updates["quantity"] = req.Quantity
+	}
+	if row.fields["reorder_threshold"] {
+		updates["reorder_threshold"] = req.ReorderThreshold
+	}
+	if row.fields["images"] {
+		updates["images"] = req.Images
+	}
+	if row.fields["category"] {
+		updates["category_id"], updates["category"] = nil, ""
+		if category != nil {
+			updates["category_id"], updates["category"] = category.ID, category.Name
+		}
+	}
+	before := product
+	if err := tx.Unscoped().Model(&product).Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("failed to update product: %w", err)
+	}
+	action := models.AuditActionUpdate
+	if before.DeletedAt.Valid {
+		action = models.AuditActionRestore
+	}
+	_, err = recordUpdatedProduct(tx, action, actor, &before, product.ID)
+	return false, err
+}
+
+// recordImportError counts a failed row and reports it, up to the limit
+func recordImportError(result *models.ImportResult, row *importRow, errs map[string]string) {
+	result.Failed++
+	if len(result.Errors) == maxReportedImportErrors {
+		result.ErrorsTruncated = true
+		return
+	}
+	result.Errors = append(result.Errors, models.ImportRowError{Row: row.line, SKU: row.request.SKU, Errors: errs})
+}
+
+// csvImportReader reads products from CSV with a header row naming the columns
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // checked per row, so a short row is a row error
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("invalid CSV: missing header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %v", err)
+	}
+
+	known := make(map[string]bool, len(productColumns))
+	for _, column := range productColumns {
+		known[column] = true
+	}
+	present := make(map[string]bool, len(header))
+	for i, column := range header {
+		// Spreadsheet exports often start with a byte order mark
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !known[column] {
+			return nil, fmt.Errorf("invalid CSV header: unknown column '%s'", column)
+		}
+		if present[column] {
+			return nil, fmt.Errorf("invalid CSV header: duplicate column '%s'", column)
+		}
+		present[column] = true
+		header[i] = column
+	}
+	for _, column := range []string{"sku", "name", "price"} {
+		if !present[column] {
+			return nil, fmt.Errorf("invalid CSV header: missing column '%s'", column)
+		}
+	}
+
+	return &csvImportReader{reader: reader, columns: header}, nil
+}
+
+func (c *csvImportReader) next() (*importRow, error) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		// The reader resumes at the next record, so only this row is lost
+		return &importRow{line: parseErr.StartLine, errors: map[string]string{"row": parseErr.Err.Error()}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	row := &importRow{line: line, fields: make(map[string]bool, len(c.columns))}
+	if len(record) != len(c.columns) {
+		row.errors = map[string]string{"row": fmt.Sprintf("expected %d fields, got %d", len(c.columns), len(record))}
+		return row, nil
+	}
+
+	errs := make(map[string]string)
+	req := &row.request
+	for i, column := range c.columns {
+		value := strings.TrimSpace(record[i])
+		row.fields[column] = true
+		switch column {
+		case "sku":
+			req.SKU = value
+		case "name":
+			req.Name = value
+		case "description":
+			req.Description = value
+		case "category":
+			req.Category = value
+		case "price":
+			if value == "" {
+				continue
+			}
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs["price"] = "price must be a number"
+			}
+			req.Price = price
+		case "quantity":
+			if value == "" {
+				continue
+			}
+			quantity, err := strconv.Atoi(value)
+			if err != nil {
+				errs["quantity"] = "quantity must be a whole number"
+			}
+			req.Quantity = quantity
+		case "reorder_threshold":
+			if value == "" {
+				continue
+			}
+			threshold, err := strconv.Atoi(value)
+			if err != nil {
+				errs["reorder_threshold"] = "reorder_threshold must be a whole number"
+			}
+			req.ReorderThreshold = threshold
+		case "images":
+			req.Images = make([]string, 0)
+			for _, image := range strings.Split(value, imageSeparator) {
+				if image = strings.TrimSpace(image); image != "" {
+					req.Images = append(req.Images, image)
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		row.errors = errs
+	}
+	return row, nil
+}
+
+// ndjsonImportReader reads products from JSON Lines, one object per line with
+// the fields of a POST /products request. Blank lines are skipped and other
+// keys, such as those in an export, are ignored.
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONImportReader(r io.Reader) *ndjsonImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxNDJSONLineSize)
+	return &ndjsonImportReader{scanner: scanner}
+}
+
+func (n *ndjsonImportReader) next() (*importRow, error) {
+	for n.scanner.Scan() {
+		n.line++
+		data := bytes.TrimSpace(n.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := &importRow{line: n.line, fields: make(map[string]bool)}
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(data, &keys); err != nil {
+			row.errors = map[string]string{"row": "invalid JSON object"}
+			return row, nil
+		}
+		if err := json.Unmarshal(data, &row.request); err != nil {
+			row.errors = map[string]string{"row": "invalid field type: " + err.Error()}
+			return row, nil
+		}
+		for key := range keys {
+			row.fields[key] = true
+		}
+		return row, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("invalid NDJSON: line %d is longer than %d bytes", n.line+1, maxNDJSONLineSize)
+		}
+		return nil, fmt.Errorf("failed to read NDJSON: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// ExportProducts writes the products matching the listing filters in params
+// to w, ordered by ID. Products are read in batches, so the catalog is
+// streamed rather than loaded at once; pagination parameters are ignored.
+func (s *ProductService) ExportProducts(w io.Writer, format string, params *models.ProductListQuery) error {
+	var write func(products []models.Product) error
+	var finish func() error
+
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(productColumns); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+		write = func(products []models.Product) error {
+			for _, product := range products {
+				if err := writer.Write(productCSVRecord(&product)); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		write = func(products []models.Product) error {
+			for _, response := range toProductResponses(products) {
+				if err := encoder.Encode(response); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		finish = func() error { return nil }
+	default:
+		return fmt.Errorf("invalid export format '%s'", format)
+	}
+
+	var products []models.Product
+	err := s.filterProducts(params).Order("id").FindInBatches(&products, 500, func(tx *gorm.DB, batch int) error {
+		return write(products)
+	}).Error
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export products: %w", err)
+	}
+	return nil
+}
+
+// productCSVRecord returns a product's fields in productColumns order
+func productCSVRecord(product *models.Product) []string {
+	return []string{
+		strconv.FormatUint(uint64(product.ID), 10),
+		product.SKU,
+		product.Name,
+		product.Description,
+		strconv.FormatFloat(product.Price, 'f', -1, 64),
+		strconv.Itoa(product.Quantity),
+		strconv.Itoa(product.ReorderThreshold),
+		product.Category,
+		strings.Join(product.Images, imageSeparator),
+		product.CreatedAt.Format(time.RFC3339),
+		product.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -1,47 +1,102 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"order-api-stat/models"
+	"order-api-stat/validation"
 )
 
+// ErrVersionMismatch is returned when a conditional update or delete names a
+// version other than the product's current one
+var ErrVersionMismatch = errors.New("product version does not match")
+
 // ProductService handles product-related business logic
 type ProductService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	cursors   *CursorCodec
+	validator *validation.Validator
+}
+
+// NewProductService creates a new product service. cursorSecret signs
+// pagination cursors (see NewCursorCodec).
+func NewProductService(db *gorm.DB, cursorSecret string) *ProductService {
+	return &ProductService{db: db, cursors: NewCursorCodec(cursorSecret), validator: validation.New()}
 }
 
-// NewProductService creates a new product service
-func NewProductService(db *gorm.DB) *ProductService {
-	return &ProductService{db: db}
+// productCursor is the position a product cursor resumes from
+type productCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"i"`
+	Before    bool      `json:"b,omitempty"` // the page preceding the position
+	Ascending bool      `json:"a,omitempty"` // listing sorted by created_at ascending
 }
 
-// CreateProduct creates a new product
-func (s *ProductService) CreateProduct(req *models.CreateProductRequest) (*models.Product, error) {
+// CreateProduct creates a new product. The category is given either by ID or
+// by name; see productCategory. actor is recorded in the product's history.
+func (s *ProductService) CreateProduct(req *models.CreateProductRequest, actor string) (*models.Product, error) {
 	product := &models.Product{
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       req.Price,
-		Quantity:    req.Quantity,
-		Category:    req.Category,
-		SKU:         req.SKU,
-		Images:      req.Images,
+		Name:             req.Name,
+		Description:      req.Description,
+		Price:            req.Price,
+		Quantity:         req.Quantity,
+		ReorderThreshold: req.ReorderThreshold,
+		SKU:              req.SKU,
+		Images:           req.Images,
 	}
 
-	if err := s.db.Create(product).Error; err != nil {
-		if isUniqueConstraintError(err) {
-			return nil, fmt.Errorf("product with SKU '%s' already exists", req.SKU)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		category, err := productCategory(tx, req.CategoryID, req.Category)
+		if err != nil {
+			return err
+		}
+		if category != nil {
+			product.CategoryID = &category.ID
+			product.Category = category.Name
+		}
+
+		if err := tx.Create(product).Error; err != nil {
+			if isUniqueConstraintError(err) {
+				return fmt.Errorf("product with SKU '%s' already exists", req.SKU)
+			}
+			return fmt.Errorf("failed to create product: %w", err)
 		}
-		return nil, fmt.Errorf("failed to create product: %w", err)
+		return recordProductChange(tx, models.AuditActionCreate, actor, nil, product)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return product, nil
 }
 
+// productCategory returns the category a product is assigned to: the category
+// with categoryID if set, otherwise the one matching name (created if needed,
+// see resolveCategory). It returns nil if neither is set, i.e. the product has
+// no category.
+func productCategory(tx *gorm.DB, categoryID *uint, name string) (*models.Category, error) {
+	if categoryID != nil && *categoryID != 0 {
+		var category models.Category
+		if err := tx.First(&category, *categoryID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, fmt.Errorf("invalid category: category with ID %d does not exist", *categoryID)
+			}
+			return nil, fmt.Errorf("failed to get category: %w", err)
+		}
+		return &category, nil
+	}
+	if categoryID != nil || strings.TrimSpace(name) == "" {
+		return nil, nil
+	}
+	return resolveCategory(tx, name)
+}
+
 // GetProduct retrieves a product by ID
 func (s *ProductService) GetProduct(id uint) (*models.Product, error) {
 	var product models.Product
@@ -55,66 +110,285 @@ func (s *ProductService) GetProduct(id uint) (*models.Product, error) {
 	return &product, nil
 }
 
-// ListProducts retrieves a list of products with pagination
-func (s *ProductService) ListProducts(page, limit int, category string) (*models.ProductListResponse, error) {
+// productSortColumns maps the sort parameter to its ORDER BY clause. The ID is
+// added as a tie-breaker so pages are stable when sort values repeat.
+var productSortColumns = map[string]string{
+	"price":       "price ASC, id ASC",
+	"-price":      "price DESC, id DESC",
+	"name":        "name ASC, id ASC",
+	"-name":       "name DESC, id DESC",
+	"created_at":  "created_at ASC, id ASC",
+	"-created_at": "created_at DESC, id DESC",
+}
+
+// ListProducts retrieves a filtered, sorted page of products.
+//
+// The q parameter is matched against the search_vector column (name, SKU and
+// description, see database.RunMigrations) using websearch syntax, so quoted
+// phrases, OR and -exclusions work. Without an explicit sort, search results
+// are ordered by relevance and other listings by ID.
+func (s *ProductService) ListProducts(params *models.ProductListQuery) (*models.ProductListResponse, error) {
+	if params.CursorMode {
+		return s.listProductsByCursor(params)
+	}
+
 	var products []models.Product
 	var total int64
 
-	query := s.db.Model(&models.Product{})
-
-	// Filter by category if provided
-	if category != "" {
-		query = query.Where("category = ?", category)
-	}
+	query := s.filterProducts(params)
 
 	// Count total records
 	if err := query.Count(&total).Error; err != nil {
 		return nil, fmt.Errorf("failed to count products: %w", err)
 	}
 
+	switch {
+	case params.Sort != "":
+		query = query.Order(productSortColumns[params.Sort])
+	case params.Query != "":
+		query = query.Order(clause.Expr{
+			SQL:  "ts_rank(search_vector, websearch_to_tsquery('english', ?)) DESC, id ASC",
+			Vars: []interface{}{params.Query},
+		})
+	default:
+		query = query.Order("id ASC")
+	}
+
 	// Apply pagination
-	offset := (page - 1) * limit
-	if err := query.Offset(offset).Limit(limit).Find(&products).Error; err != nil {
+	offset := (params.Page - 1) * params.Limit
+	if err := query.Offset(offset).Limit(params.Limit).Find(&products).Error; err != nil {
 		return nil, fmt.Errorf("failed to list products: %w", err)
 	}
 
-	// Convert to response format
-	productResponses := make([]models.ProductResponse, len(products))
-	for i, product := range products {
-		productResponses[i] = models.ProductResponse{
-			ID:          product.ID,
-			Name:        product.Name,
-			Description: product.Description,
-			Price:       product.Price,
-			Quantity:    product.Quantity,
-			Category:    product.Category,
-			SKU:         product.SKU,
-			Images:      product.Images,
-			CreatedAt:   product.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:   product.UpdatedAt.Format(time.RFC3339),
+	response := productListResponse(products, params)
+	response.Total = &total
+	response.Page = params.Page
+	return response, nil
+}
+
+// listProductsByCursor returns the page of products after (or, for a
+// previous-page cursor, before) the cursor's (created_at, id) position. The
+// row comparison is served by an index range scan, so neither OFFSET nor COUNT
+// is needed, and rows inserted meanwhile cannot shift the page boundaries.
+func (s *ProductService) listProductsByCursor(params *models.ProductListQuery) (*models.ProductListResponse, error) {
+	position := productCursor{Ascending: params.Sort == "created_at"}
+	if params.Cursor != "" {
+		if err := s.cursors.Decode(params.Cursor, &position); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fetching the previous page walks the listing backwards; the rows are
+	// reversed into listing order below
+	op, direction := ">", "ASC"
+	if position.Ascending == position.Before {
+		op, direction = "<", "DESC"
+	}
+
+	query := s.filterProducts(params)
+	if params.Cursor != "" {
+		query = query.Where("(created_at, id) "+op+" (?, ?)", position.CreatedAt, position.ID)
+	}
+
+	var products []models.Product
+	if err := query.Order("created_at " + direction + ", id " + direction).
+		Limit(params.Limit + 1).Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+
+	hasMore := len(products) > params.Limit
+	if hasMore {
+		products = products[:params.Limit]
+	}
+	if position.Before {
+		for i, j := 0, len(products)-1; i < j; i, j = i+1, j-1 {
+			products[i], products[j] = products[j], products[i]
+		}
+	}
+
+	response := productListResponse(products, params)
+	response.Sort = "-created_at"
+	if position.Ascending {
+		response.Sort = "created_at"
+	}
+	if len(products) == 0 {
+		return response, nil
+	}
+
+	// Going forward there is a next page if more rows were found and a previous
+	// one if we started from a cursor; going backward it is the other way round
+	hasNext, hasPrev := hasMore, params.Cursor != ""
+	if position.Before {
+		hasNext, hasPrev = true, hasMore
+	}
+	first, last := products[0], products[len(products)-1]
+	if hasNext {
+		cursor, err := s.cursors.Encode(productCursor{CreatedAt: last.CreatedAt, ID: last.ID, Ascending: position.Ascending})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		response.NextCursor = cursor
+	}
+	if hasPrev {
+		cursor, err := s.cursors.Encode(productCursor{CreatedAt: first.CreatedAt, ID: first.ID, Before: true, Ascending: position.Ascending})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %w", err)
 		}
+		response.PrevCursor = cursor
+	}
+
+	return response, nil
+}
+
+// filterProducts builds the product query with the listing filters applied
+func (s *ProductService) filterProducts(params *models.ProductListQuery) *gorm.DB {
+	query := s.db.Model(&models.Product{})
+	if params.Deleted {
+		query = s.db.Unscoped().Model(&models.Product{}).Where("deleted_at IS NOT NULL")
+	}
+
+	if params.Query != "" {
+		query = query.Where("search_vector @@ websearch_to_tsquery('english', ?)", params.Query)
+	}
+	if len(params.Categories) > 0 {
+		slugs := make([]string, len(params.Categories))
+		for i, category := range params.Categories {
+			slugs[i] = models.Slugify(category)
+		}
+		query = query.Where("category_id IN ("+categoryDescendantsSQL+")", slugs)
+	}
+	if params.MinPrice != nil {
+		query = query.Where("price >= ?", *params.MinPrice)
+	}
+	if params.MaxPrice != nil {
+		query = query.Where("price <= ?", *params.MaxPrice)
+	}
+	if params.InStock != nil {
+		if *params.InStock {
+			query = query.Where("quantity > 0")
+		} else {
+			query = query.Where("quantity = 0")
+		}
+	}
+
+	return query
+}
+
+// productListResponse builds a list response echoing the applied filters
+func productListResponse(products []models.Product, params *models.ProductListQuery) *models.ProductListResponse {
+	return &models.ProductListResponse{
+		Products:   toProductResponses(products),
+		Limit:      params.Limit,
+		Query:      params.Query,
+		Categories: params.Categories,
+		MinPrice:   params.MinPrice,
+		MaxPrice:   params.MaxPrice,
+		InStock:    params.InStock,
+		Sort:       params.Sort,
+		Deleted:    params.Deleted,
+	}
+}
+
+// GetProductsByIDs retrieves the products with the given IDs in a single query.
+// IDs that do not exist (or were deleted) are left out of the result.
+func (s *ProductService) GetProductsByIDs(ids []uint) (*models.ProductListResponse, error) {
+	var products []models.Product
+	if err := s.db.Where("id IN ?", ids).Order("id").Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to get products: %w", err)
 	}
 
+	total := int64(len(products))
 	return &models.ProductListResponse{
-		Products: productResponses,
-		Total:    total,
-		Page:     page,
-		Limit:    limit,
+		Products: toProductResponses(products),
+		Total:    &total,
+		Page:     1,
+		Limit:    len(ids),
 	}, nil
 }
 
-// UpdateProduct updates an existing product
-func (s *ProductService) UpdateProduct(id uint, req *models.UpdateProductRequest) (*models.Product, error) {
-	var product models.Product
-	if err := s.db.First(&product, id).Error; err != nil {
+// toProductResponses converts products to their response format
+func toProductResponses(products []models.Product) []models.ProductResponse {
+	responses := make([]models.ProductResponse, len(products))
+	for i, product := range products {
+		responses[i] = models.ProductResponse{
+			ID:               product.ID,
+			Name:             product.Name,
+			Description:      product.Description,
+			Price:            product.Price,
+			Quantity:         product.Quantity,
+			ReorderThreshold: product.ReorderThreshold,
+			Category:         product.Category,
+			CategoryID:       product.CategoryID,
+			SKU:              product.SKU,
+			Images:           product.Images,
+			Version:          product.Version,
+			CreatedAt:        product.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:        product.UpdatedAt.Format(time.RFC3339),
+		}
+		if product.DeletedAt.Valid {
+			responses[i].DeletedAt = product.DeletedAt.Time.Format(time.RFC3339)
+		}
+	}
+	return responses
+}
+
+// UpdateProduct updates an existing product. If ifMatch is not empty the
+// update is only applied when the product's current version is one of the
+// listed versions; otherwise ErrVersionMismatch is returned. The check and the
+// update happen under a row lock, so of two concurrent updates made against
+// the same version only the first succeeds.
+func (s *ProductService) UpdateProduct(id uint, req *models.UpdateProductRequest, ifMatch []int, actor string) (*models.Product, error) {
+	var updated *models.Product
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := lockProductVersion(tx, &product, id, ifMatch); err != nil {
+			return err
+		}
+		before := product
+		if err := s.applyProductUpdate(tx, &product, req); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = recordUpdatedProduct(tx, models.AuditActionUpdate, actor, &before, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// lockProductVersion loads product id with a row lock and checks its version
+// against ifMatch, as described for UpdateProduct
+func lockProductVersion(tx *gorm.DB, product *models.Product, id uint, ifMatch []int) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(product, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("product with ID %d not found", id)
+			return fmt.Errorf("product with ID %d not found", id)
 		}
-		return nil, fmt.Errorf("failed to get product: %w", err)
+		return fmt.Errorf("failed to get product: %w", err)
 	}
+	return checkProductVersion(product, ifMatch)
+}
 
+// checkProductVersion checks a locked product's version against ifMatch
+func checkProductVersion(product *models.Product, ifMatch []int) error {
+	if len(ifMatch) == 0 {
+		return nil
+	}
+	for _, version := range ifMatch {
+		if version == product.Version {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: product %d is at version %d", ErrVersionMismatch, product.ID, product.Version)
+}
+
+// applyProductUpdate writes the fields set in req and increments the version
+func (s *ProductService) applyProductUpdate(tx *gorm.DB, product *models.Product, req *models.UpdateProductRequest) error {
 	// Update fields if provided
-	updates := make(map[string]interface{})
+	updates := map[string]interface{}{"version": gorm.Expr("version + 1")}
 	if req.Name != nil {
 		updates["name"] = *req.Name
 	}
@@ -127,8 +401,22 @@ func (s *ProductService) UpdateProduct(id uint, req *models.UpdateProductRequest
 	if req.Quantity != nil {
 		updates["quantity"] = *req.Quantity
 	}
-	if req.Category != nil {
-		updates["category"] = *req.Category
+	if req.ReorderThreshold != nil {
+		updates["reorder_threshold"] = *req.ReorderThreshold
+	}
+	if req.CategoryID != nil || req.Category != nil {
+		name := ""
+		if req.Category != nil {
+			name = *req.Category
+		}
+		category, err := productCategory(tx, req.CategoryID, name)
+		if err != nil {
+			return err
+		}
+		updates["category_id"], updates["category"] = nil, ""
+		if category != nil {
+			updates["category_id"], updates["category"] = category.ID, category.Name
+		}
 	}
 	if req.SKU != nil {
 		updates["sku"] = *req.SKU
@@ -137,16 +425,89 @@ func (s *ProductService) UpdateProduct(id uint, req *models.UpdateProductRequest
 		updates["images"] = req.Images
 	}
 
-	if err := s.db.Model(&product).Updates(updates).Error; err != nil {
+	if err := tx.Model(product).Updates(updates).Error; err != nil {
 		if req.SKU != nil && isUniqueConstraintError(err) {
-			return nil, fmt.Errorf("product with SKU '%s' already exists", *req.SKU)
+			return fmt.Errorf("product with SKU '%s' already exists", *req.SKU)
 		}
-		return nil, fmt.Errorf("failed to update product: %w", err)
+		return fmt.Errorf("failed to update product: %w", err)
 	}
+	return nil
+}
 
-	// Fetch updated product
-	if err := s.db.First(&product, id).Error; err != nil {
-		return nil, fmt.Errorf("failed to get updated product: %w", err)
+// AdjustQuantity applies a relative stock change to a product and returns the
+// updated product. The row is locked with SELECT ... FOR UPDATE so concurrent
+// adjustments are serialised, and a change that would take the stock below zero
+// is rejected without modifying the row.
+//
+// If idempotencyKey is set, the change is recorded under that key in the same
+// transaction, with its reason (manual when not given) and unit price (the
+// product's current price when not given). A repeated call with the same key
+// returns the product without changing it again; reusing the key for a
+// different change is an error.
+func (s *ProductService) AdjustQuantity(id uint, req *models.UpdateQuantityRequest, idempotencyKey, actor string) (*models.Product, error) {
+	change, reason := req.Change, req.Reason
+	if reason == "" {
+		reason = models.AdjustmentReasonManual
+	}
+	var product models.Product
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("product with ID %d not found", id)
+			}
+			return fmt.Errorf("failed to get product: %w", err)
+		}
+
+		if idempotencyKey != "" {
+			// The product row lock serialises retries of the same key, so a
+			// concurrent duplicate sees the first attempt's record here
+			var applied models.StockAdjustment
+			err := tx.Where("idempotency_key = ?", idempotencyKey).First(&applied).Error
+			if err == nil {
+				if applied.ProductID != id || applied.Change != change || applied.Reason != reason {
+					return fmt.Errorf("idempotency key '%s' was already used for a different adjustment", idempotencyKey)
+				}
+				return nil
+			}
+			if err != gorm.ErrRecordNotFound {
+				return fmt.Errorf("failed to check idempotency key: %w", err)
+			}
+
+			unitPrice := req.UnitPrice
+			if unitPrice == nil {
+				unitPrice = &product.Price
+			}
+			adjustment := &models.StockAdjustment{
+				IdempotencyKey: idempotencyKey,
+				ProductID:      id,
+				Change:         change,
+				Reason:         reason,
+				UnitPrice:      unitPrice,
+			}
+			if err := tx.Create(adjustment).Error; err != nil {
+				return fmt.Errorf("failed to record stock adjustment: %w", err)
+			}
+		}
+
+		newQuantity := product.Quantity + change
+		if newQuantity < 0 {
+			return fmt.Errorf("insufficient stock for product %d: available %d, requested %d",
+				id, product.Quantity, -change)
+		}
+
+		before := product
+		if err := tx.Model(&product).Updates(map[string]interface{}{
+			"quantity": newQuantity,
+			"version":  gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update product quantity: %w", err)
+		}
+		product.Quantity = newQuantity
+		product.Version++
+		return recordProductChange(tx, models.AuditActionUpdate, actor, &before, &product)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &product, nil
@@ -160,19 +521,56 @@ func isUniqueConstraintError(err error) bool {
 		strings.Contains(msg, "unique constraint")
 }
 
-// DeleteProduct soft deletes a product
-func (s *ProductService) DeleteProduct(id uint) error {
-	var product models.Product
-	if err := s.db.First(&product, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("product with ID %d not found", id)
+// DeleteProduct soft deletes a product. ifMatch is checked as in UpdateProduct.
+func (s *ProductService) DeleteProduct(id uint, ifMatch []int, actor string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := lockProductVersion(tx, &product, id, ifMatch); err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to get product: %w", err)
-	}
 
-	if err := s.db.Delete(&product).Error; err != nil {
-		return fmt.Errorf("failed to delete product: %w", err)
+		if err := tx.Delete(&product).Error; err != nil {
+			return fmt.Errorf("failed to delete product: %w", err)
+		}
+		return recordProductChange(tx, models.AuditActionDelete, actor, &product, nil)
+	})
+}
+
+// RestoreProduct undoes the soft delete of a product and returns it. ifMatch
+// is checked as in UpdateProduct, against the version the product was deleted
+// at; restoring increments the version.
+func (s *ProductService) RestoreProduct(id uint, ifMatch []int, actor string) (*models.Product, error) {
+	var restored *models.Product
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("product with ID %d not found", id)
+			}
+			return fmt.Errorf("failed to get product: %w", err)
+		}
+		if !product.DeletedAt.Valid {
+			return fmt.Errorf("product with ID %d is not deleted", id)
+		}
+		if err := checkProductVersion(&product, ifMatch); err != nil {
+			return err
+		}
+
+		before := product
+		if err := tx.Unscoped().Model(&product).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to restore product: %w", err)
+		}
+
+		var err error
+		restored, err = recordUpdatedProduct(tx, models.AuditActionRestore, actor, &before, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return restored, nil
 }
@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"order-api-stat/config"
+	"order-api-stat/models"
+)
+
+// ErrReservationClosed is returned when a reservation that is no longer held
+// is confirmed, or a confirmed one is released
+var ErrReservationClosed = errors.New("reservation is no longer held")
+
+// reservationSweeperActor is recorded in the history of products restocked by
+// an expired reservation
+const reservationSweeperActor = "system:reservation-expiry"
+
+// ReservationService holds stock for orders between their creation and their
+// confirmation.
+//
+// Reserving locks the products' rows and takes the items out of their stock in
+// one transaction, failing if any product is short, so two orders can never be
+// promised the same units. Releasing a reservation, or the sweeper expiring it
+// once its TTL has passed, returns the items to stock; confirming it keeps them
+// out for good. Product rows are always locked in ID order so concurrent
+// reservations cannot deadlock.
+type ReservationService struct {
+	db  *gorm.DB
+	cfg config.ReservationsConfig
+}
+
+// NewReservationService creates a new reservation service
+func NewReservationService(db *gorm.DB, cfg config.ReservationsConfig) *ReservationService {
+	return &ReservationService{db: db, cfg: cfg}
+}
+
+// CreateReservation reserves the requested items for actor, who owns the
+// reservation, and returns it. Items for the same product are merged.
+//
+// If idempotencyKey is set, a repeated call with the same key returns the
+// existing reservation, whatever its status, with created false; reusing the
+// key for different items, or another owner's key, is an error.
+func (s *ReservationService) CreateReservation(req *models.CreateReservationRequest, idempotencyKey, actor string) (*models.Reservation, bool, error) {
+	quantities := make(map[uint]int, len(req.Items))
+	for _, item := range req.Items {
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	if idempotencyKey != "" {
+		existing, err := s.reservationByKey(idempotencyKey, actor, quantities)
+		if err != nil || existing != nil {
+			return existing, false, err
+		}
+	}
+
+	ttl := s.cfg.DefaultTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	ttl = min(ttl, s.cfg.MaxTTL)
+
+	reservation := &models.Reservation{Owner: actor, Status: models.ReservationStatusHeld}
+	if idempotencyKey != "" {
+		reservation.IdempotencyKey = &idempotencyKey
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		products, err := lockReservedProducts(tx, quantities, false)
+		if err != nil {
+			return err
+		}
+		for i := range products {
+			product := &products[i]
+			if product.Quantity < quantities[product.ID] {
+				return fmt.Errorf("insufficient stock for product %d: available %d, requested %d",
+					product.ID, product.Quantity, quantities[product.ID])
+			}
+		}
+
+		for i := range products {
+			product := &products[i]
+			if err := changeReservedStock(tx, product, -quantities[product.ID], actor); err != nil {
+				return err
+			}
+			reservation.Items = append(reservation.Items, models.ReservationItem{
+				ProductID: product.ID,
+				Quantity:  quantities[product.ID],
+				UnitPrice: product.Price,
+			})
+		}
+
+		reservation.ExpiresAt = time.Now().Add(ttl)
+		if err := tx.Create(reservation).Error; err != nil {
+			return fmt.Errorf("failed to create reservation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		// A concurrent request with the same key got there first; its stock
+		// changes stand and ours were rolled back
+		if idempotencyKey != "" && isUniqueConstraintError(err) {
+			existing, lookupErr := s.reservationByKey(idempotencyKey, actor, quantities)
+			if lookupErr != nil || existing != nil {
+				return existing, false, lookupErr
+			}
+		}
+		return nil, false, err
+	}
+
+	return reservation, true, nil
+}
+
+// reservationByKey returns the reservation created with idempotencyKey, or nil
+// if there is none. It fails if that reservation has another owner or holds
+// other quantities.
+func (s *ReservationService) reservationByKey(idempotencyKey, owner string, quantities map[uint]int) (*models.Reservation, error) {
+	var reservation models.Reservation
+	err := s.db.Preload("Items").Where("idempotency_key = ?", idempotencyKey).First(&reservation).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check idempotency key: %w", err)
+	}
+
+	same := reservation.Owner == owner && len(reservation.Items) == len(quantities)
+	for _, item := range reservation.Items {
+		same = same && quantities[item.ProductID] == item.Quantity
+	}
+	if !same {
+		return nil, fmt.Errorf("idempotency key '%s' was already used for a different reservation", idempotencyKey)
+	}
+	return &reservation, nil
+}
+
+// GetReservation retrieves a reservation by ID. Unless owner is empty, another
+// owner's reservation is not found.
+func (s *ReservationService) GetReservation(id uint, owner string) (*models.Reservation, error) {
+	query := s.db.Preload("Items")
+	if owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+	var reservation models.Reservation
+	if err := query.First(&reservation, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("reservation with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get reservation: %w", err)
+	}
+	return &reservation, nil
+}
+
+// ConfirmReservation makes a held reservation's sale final. Confirming a
+// confirmed reservation returns it unchanged. A reservation whose TTL has
+// passed is expired on the spot, even if the sweeper has not reached it yet,
+// and cannot be confirmed any more than a released one.
+func (s *ReservationService) ConfirmReservation(id uint, actor string) (*models.Reservation, error) {
+	var reservation *models.Reservation
+	expired := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if reservation, err = lockReservation(tx, id); err != nil {
+			return err
+		}
+
+		switch reservation.Status {
+		case models.ReservationStatusConfirmed:
+			return nil
+		case models.ReservationStatusHeld:
+		default:
+			return fmt.Errorf("%w: reservation %d is %s", ErrReservationClosed, id, reservation.Status)
+		}
+
+		now := time.Now()
+		if !now.Before(reservation.ExpiresAt) {
+			expired = true
+			return closeReservation(tx, reservation, models.ReservationStatusExpired, reservationSweeperActor)
+		}
+
+		reservation.Status = models.ReservationStatusConfirmed
+		reservation.ConfirmedAt = &now
+		if err := tx.Model(reservation).Updates(map[string]interface{}{
+			"status":       reservation.Status,
+			"confirmed_at": now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to confirm reservation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, fmt.Errorf("%w: reservation %d has expired", ErrReservationClosed, id)
+	}
+
+	return reservation, nil
+}
+
+// ReleaseReservation gives a held reservation's items back to stock.
+// Releasing a reservation that was already released or has expired returns it
+// unchanged; a confirmed reservation cannot be released.
+func (s *ReservationService) ReleaseReservation(id uint, actor string) (*models.Reservation, error) {
+	var reservation *models.Reservation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if reservation, err = lockReservation(tx, id); err != nil {
+			return err
+		}
+
+		switch reservation.Status {
+		case models.ReservationStatusReleased, models.ReservationStatusExpired:
+			return nil
+		case models.ReservationStatusConfirmed:
+			return fmt.Errorf("%w: reservation %d is confirmed", ErrReservationClosed, id)
+		}
+		return closeReservation(tx, reservation, models.ReservationStatusReleased, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// Run expires due reservations every sweep interval until ctx is cancelled
+func (s *ReservationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		// Work through the backlog before waiting for the next tick
+		for ctx.Err() == nil {
+			n, err := s.ExpireDue()
+			if err != nil {
+				logrus.WithError(err).Warn("Reservation expiry failed")
+			}
+			if err != nil || n < s.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireDue expires one batch of held reservations whose TTL has passed,
+// returning their items to stock, and returns how many it expired. Rows are
+// claimed with SKIP LOCKED, so several instances can sweep side by side.
+func (s *ReservationService) ExpireDue() (int, error) {
+	var reservations []models.Reservation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Preload("Items").
+			Where("status = ? AND expires_at <= ?", models.ReservationStatusHeld, time.Now()).
+			Order("expires_at, id").Limit(s.cfg.BatchSize).
+			Find(&reservations).Error; err != nil {
+			return fmt.Errorf("failed to claim expired reservations: %w", err)
+		}
+
+		for i := range reservations {
+			if err := closeReservation(tx, &reservations[i], models.ReservationStatusExpired, reservationSweeperActor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(reservations) > 0 {
+		logrus.WithField("count", len(reservations)).Info("Expired stock reservations")
+	}
+	return len(reservations), nil
+}
+
+// lockReservation locks a reservation for update and loads its items
+func lockReservation(tx *gorm.DB, id uint) (*models.Reservation, error) {
+	var reservation models.Reservation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&reservation, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("reservation with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get reservation: %w", err)
+	}
+	return &reservation, nil
+}
+
+// closeReservation moves a held reservation to status (released or expired)
+// and returns its items to stock
+func closeReservation(tx *gorm.DB, reservation *models.Reservation, status, actor string) error {
+	quantities := make(map[uint]int, len(reservation.Items))
+	for _, item := range reservation.Items {
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	// Products deleted since they were reserved get their stock back too, in
+	// case they are restored
+	products, err := lockReservedProducts(tx, quantities, true)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		if err := changeReservedStock(tx, &products[i], quantities[products[i].ID], actor); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	reservation.Status = status
+	reservation.ReleasedAt = &now
+	if err := tx.Model(reservation).Updates(map[string]interface{}{
+		"status":      status,
+		"released_at": now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to close reservation: %w", err)
+	}
+	return nil
+}
+
+// lockReservedProducts locks the products in quantities for update, in ID
+// order. Unless unscoped, a product that does not exist or was deleted is an
+// error.
+func lockReservedProducts(tx *gorm.DB, quantities map[uint]int, unscoped bool) ([]models.Product, error) {
+	ids := make([]uint, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	query := tx
+	if unscoped {
+		query = query.Unscoped()
+	}
+	var products []models.Product
+	if err := query.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).Order("id").Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+
+	if !unscoped && len(products) != len(ids) {
+		found := make(map[uint]bool, len(products))
+		for _, product := range products {
+			found[product.ID] = true
+		}
+		for _, id := range ids {
+			if !found[id] {
+				return nil, fmt.Errorf("product with ID %d not found", id)
+			}
+		}
+	}
+	return products, nil
+}
+
+// changeReservedStock applies change to a locked product's stock, bumping its
+// version and recording the change in its history like AdjustQuantity
+func changeReservedStock(tx *gorm.DB, product *models.Product, change int, actor string) error {
+	before := *product
+	if err := tx.Unscoped().Model(product).Updates(map[string]interface{}{
+		"quantity": gorm.Expr("quantity + ?", change),
+		"version":  gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update product quantity: %w", err)
+	}
+	product.Quantity += change
+	product.Version++
+	return recordProductChange(tx, models.AuditActionUpdate, actor, &before, product)
+}
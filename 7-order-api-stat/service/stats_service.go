@@ -0,0 +1,256 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+
+	"order-api-stat/models"
+)
+
+// maxSalesBuckets bounds the number of buckets in a sales report
+const maxSalesBuckets = 1000
+
+// priceHistogramBuckets is the number of buckets in the price histogram
+const priceHistogramBuckets = 10
+
+// lowStockListLimit is the most products listed in the low-stock report
+const lowStockListLimit = 50
+
+// StatsService computes catalog and sales statistics
+type StatsService struct {
+	db *gorm.DB
+}
+
+// NewStatsService creates a new stats service
+func NewStatsService(db *gorm.DB) *StatsService {
+	return &StatsService{db: db}
+}
+
+// ProductStats summarises the live (not deleted) catalog. Products with at
+// most lowStockThreshold units are listed as low on stock.
+func (s *StatsService) ProductStats(lowStockThreshold int) (*models.ProductStatsResponse, error) {
+	var totals struct {
+		TotalProducts int64
+		OutOfStock    int64
+		TotalUnits    int64
+		StockValue    float64
+	}
+	if err := s.db.Model(&models.Product{}).Select(`count(*) AS total_products,
+		count(*) FILTER (WHERE quantity = 0) AS out_of_stock,
+		coalesce(sum(quantity), 0) AS total_units,
+		coalesce(sum(price * quantity), 0) AS stock_value`).Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute product totals: %w", err)
+	}
+	response := &models.ProductStatsResponse{
+		TotalProducts: totals.TotalProducts,
+		OutOfStock:    totals.OutOfStock,
+		TotalUnits:    totals.TotalUnits,
+		StockValue:    roundCents(totals.StockValue),
+	}
+
+	response.Categories = make([]models.CategoryStats, 0)
+	if err := s.db.Model(&models.Product{}).Select(`category_id, max(category) AS category,
+		count(*) AS products, sum(quantity) AS units, sum(price * quantity) AS stock_value`).
+		Group("category_id").Order("stock_value DESC, category_id").
+		Scan(&response.Categories).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute category totals: %w", err)
+	}
+
+	response.LowStock = models.LowStockStats{Threshold: lowStockThreshold, Products: make([]models.LowStockProduct, 0)}
+	lowStock := s.db.Model(&models.Product{}).Where("quantity <= ?", lowStockThreshold)
+	if err := lowStock.Count(&response.LowStock.Count).Error; err != nil {
+		return nil, fmt.Errorf("failed to count low-stock products: %w", err)
+	}
+	if err := lowStock.Select("id, name, sku, quantity").Order("quantity, id").Limit(lowStockListLimit).
+		Scan(&response.LowStock.Products).Error; err != nil {
+		return nil, fmt.Errorf("failed to list low-stock products: %w", err)
+	}
+
+	prices, err := s.priceStats(response.TotalProducts)
+	if err != nil {
+		return nil, err
+	}
+	response.Prices = *prices
+
+	for i := range response.Categories {
+		response.Categories[i].StockValue = roundCents(response.Categories[i].StockValue)
+	}
+	return response, nil
+}
+
+// priceStats computes the price distribution of the live catalog, which has
+// total products
+func (s *StatsService) priceStats(total int64) (*models.PriceStats, error) {
+	stats := &models.PriceStats{Histogram: make([]models.PriceBucket, 0)}
+	if total == 0 {
+		return stats, nil
+	}
+
+	var summary struct {
+		Min, Max, Average, Median float64
+	}
+	if err := s.db.Model(&models.Product{}).Select(`min(price) AS min, max(price) AS max,
+		avg(price) AS average, percentile_cont(0.5) WITHIN GROUP (ORDER BY price) AS median`).
+		Scan(&summary).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute price statistics: %w", err)
+	}
+	stats.Min, stats.Max = summary.Min, summary.Max
+	stats.Average, stats.Median = roundCents(summary.Average), roundCents(summary.Median)
+
+	if stats.Min == stats.Max {
+		// width_bucket needs a non-empty range; every product is in one bucket
+		stats.Histogram = append(stats.Histogram, models.PriceBucket{Min: stats.Min, Max: stats.Max, Count: total})
+		return stats, nil
+	}
+
+	// width_bucket puts the maximum price into an overflow bucket, which is
+	// folded into the last one
+	var counts []struct {
+		Bucket int
+		Count  int64
+	}
+	if err := s.db.Model(&models.Product{}).
+		Select("least(width_bucket(price, ?, ?, ?), ?) AS bucket, count(*) AS count",
+			stats.Min, stats.Max, priceHistogramBuckets, priceHistogramBuckets).
+		Group("bucket").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute price histogram: %w", err)
+	}
+
+	width := (stats.Max - stats.Min) / priceHistogramBuckets
+	for i := 0; i < priceHistogramBuckets; i++ {
+		stats.Histogram = append(stats.Histogram, models.PriceBucket{
+			Min: roundCents(stats.Min + float64(i)*width),
+			Max: roundCents(stats.Min + float64(i+1)*width),
+		})
+	}
+	stats.Histogram[priceHistogramBuckets-1].Max = stats.Max
+	for _, count := range counts {
+		if count.Bucket >= 1 && count.Bucket <= priceHistogramBuckets {
+			stats.Histogram[count.Bucket-1].Count = count.Count
+		}
+	}
+	return stats, nil
+}
+
+// SalesStats reports revenue and units sold between query.From and query.To.
+//
+// Sales are derived from the stock adjustments the order service records as
+// sales and returns, at the price each item was sold at: a return for a
+// cancelled order takes the sale back in the bucket it happened in. A
+// confirmed reservation counts as a sale at the prices it was reserved at, in
+// the bucket it was confirmed in. Manual stock changes are not sales, whatever
+// their idempotency key.
+func (s *StatsService) SalesStats(query *models.SalesStatsQuery) (*models.SalesStatsResponse, error) {
+	starts := salesBucketStarts(query.From, query.To, query.Interval)
+	if len(starts) > maxSalesBuckets {
+		return nil, fmt.Errorf("invalid date range: at most %d %s buckets can be reported", maxSalesBuckets, query.Interval)
+	}
+
+	var rows []struct {
+		Bucket    time.Time
+		Revenue   float64
+		UnitsSold int64
+	}
+	if err := s.salesQuery(query).
+		Select(`date_trunc(?, created_at AT TIME ZONE 'UTC') AS bucket,
+			sum(-change * coalesce(unit_price, 0)) AS revenue, sum(-change) AS units_sold`, query.Interval).
+		Group("bucket").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute sales: %w", err)
+	}
+
+	response := &models.SalesStatsResponse{
+		From:        query.From.Format(time.DateOnly),
+		To:          query.To.AddDate(0, 0, -1).Format(time.DateOnly),
+		Interval:    query.Interval,
+		Buckets:     make([]models.SalesBucket, len(starts)),
+		TopProducts: make([]models.TopSoldProduct, 0),
+	}
+	index := make(map[string]int, len(starts))
+	for i, start := range starts {
+		response.Buckets[i].Start = start.Format(time.DateOnly)
+		index[response.Buckets[i].Start] = i
+	}
+	for _, row := range rows {
+		i, ok := index[row.Bucket.Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		response.Buckets[i].Revenue = roundCents(row.Revenue)
+		response.Buckets[i].UnitsSold = row.UnitsSold
+		response.Revenue += row.Revenue
+		response.UnitsSold += row.UnitsSold
+	}
+	response.Revenue = roundCents(response.Revenue)
+
+	if err := s.salesQuery(query).
+		Select(`sales.product_id, coalesce(products.name, '') AS name, coalesce(products.sku, '') AS sku,
+			sum(-change) AS units_sold, sum(-change * coalesce(unit_price, 0)) AS revenue`).
+		Joins("LEFT JOIN products ON products.id = sales.product_id").
+		Group("sales.product_id, products.name, products.sku").
+		Having("sum(-change) > 0").
+		Order("units_sold DESC, revenue DESC, sales.product_id").Limit(query.Top).
+		Scan(&response.TopProducts).Error; err != nil {
+		return nil, fmt.Errorf("failed to compute top products: %w", err)
+	}
+	for i := range response.TopProducts {
+		response.TopProducts[i].Revenue = roundCents(response.TopProducts[i].Revenue)
+	}
+
+	return response, nil
+}
+
+// salesQuery selects the sales in the query's range as rows of product_id,
+// change, unit_price and created_at: the sale and return adjustments and the
+// items of confirmed reservations, which count as sold when confirmed
+func (s *StatsService) salesQuery(query *models.SalesStatsQuery) *gorm.DB {
+	adjustments := s.db.Model(&models.StockAdjustment{}).
+		Select("product_id, change, unit_price, created_at").
+		Where("reason IN ?", []string{models.AdjustmentReasonSale, models.AdjustmentReasonReturn}).
+		Where("created_at >= ? AND created_at < ?", query.From, query.To)
+	reservations := s.db.Model(&models.ReservationItem{}).
+		Select(`reservation_items.product_id, -reservation_items.quantity AS change,
+			reservation_items.unit_price, reservations.confirmed_at AS created_at`).
+		Joins("JOIN reservations ON reservations.id = reservation_items.reservation_id").
+		Where("reservations.status = ?", models.ReservationStatusConfirmed).
+		Where("reservations.confirmed_at >= ? AND reservations.confirmed_at < ?", query.From, query.To)
+	return s.db.Table("(? UNION ALL ?) AS sales", adjustments, reservations)
+}
+
+// salesBucketStarts returns the start of every bucket overlapping [from, to),
+// truncated like PostgreSQL's date_trunc: weeks start on Monday. It stops
+// early once there are more than maxSalesBuckets.
+func salesBucketStarts(from, to time.Time, interval string) []time.Time {
+	start := from
+	switch interval {
+	case models.IntervalWeek:
+		start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	case models.IntervalMonth:
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	var starts []time.Time
+	for ; start.Before(to) && len(starts) <= maxSalesBuckets; start = nextBucket(start, interval) {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// nextBucket returns the start of the bucket following the one at start
+func nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case models.IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case models.IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// roundCents rounds an amount to two decimal places
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"order-api-stat/config"
+	"order-api-stat/models"
+)
+
+// Supported low-stock notifiers
+const (
+	NotifierLog     = "log"
+	NotifierWebhook = "webhook"
+)
+
+// StockAlertNotifier delivers low-stock notifications
+type StockAlertNotifier interface {
+	Notify(ctx context.Context, event *models.LowStockEvent) error
+}
+
+// NewStockAlertNotifier creates the notifiers listed in cfg.Notifiers. It
+// returns nil if none are configured, i.e. alerts are disabled.
+func NewStockAlertNotifier(cfg config.AlertsConfig) (StockAlertNotifier, error) {
+	var notifiers MultiNotifier
+	for _, name := range cfg.Notifiers {
+		switch name {
+		case NotifierLog:
+			notifiers = append(notifiers, LogNotifier{})
+		case NotifierWebhook:
+			if cfg.WebhookURL == "" {
+				return nil, errors.New("webhook notifier requires APP_ALERTS_WEBHOOK_URL")
+			}
+			notifiers = append(notifiers, NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookSecret, cfg.WebhookTimeout))
+		default:
+			return nil, fmt.Errorf("unsupported alert notifier %q", name)
+		}
+	}
+
+	switch len(notifiers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return notifiers[0], nil
+	default:
+		return notifiers, nil
+	}
+}
+
+// MultiNotifier sends each notification to all of its notifiers. It fails if
+// any of them fails, so the notification is retried for all of them.
+type MultiNotifier []StockAlertNotifier
+
+// Notify implements StockAlertNotifier
+func (m MultiNotifier) Notify(ctx context.Context, event *models.LowStockEvent) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogNotifier writes notifications to the application log
+type LogNotifier struct{}
+
+// Notify implements StockAlertNotifier
+func (LogNotifier) Notify(ctx context.Context, event *models.LowStockEvent) error {
+	logrus.WithFields(logrus.Fields{
+		"alert_id":          event.AlertID,
+		"product_id":        event.ProductID,
+		"sku":               event.SKU,
+		"quantity":          event.Quantity,
+		"reorder_threshold": event.ReorderThreshold,
+	}).Warn("Product stock is low")
+	return nil
+}
+
+// WebhookNotifier POSTs notifications as JSON to a URL. When a secret is set,
+// the X-Signature header carries the hex HMAC-SHA256 of the body (see
+// AlertSignature). X-Alert-ID identifies the alert, so the receiver can
+// discard the duplicates a retry may cause.
+type WebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a webhook notifier
+func NewWebhookNotifier(url, secret string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{url: url, secret: secret, client: &http.Client{Timeout: timeout}}
+}
+
+// Notify implements StockAlertNotifier. Any non-2xx response is an error.
+func (n *WebhookNotifier) Notify(ctx context.Context, event *models.LowStockEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Alert-ID", strconv.FormatUint(uint64(event.AlertID), 10))
+	if n.secret != "" {
+		req.Header.Set("X-Signature", AlertSignature(n.secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// AlertSignature returns the X-Signature of a webhook body signed with secret
+func AlertSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"order-api-stat/config"
+	"order-api-stat/models"
+)
+
+// alertLease is how long a claimed alert is hidden from other checkers while
+// its notification is sent. It must exceed the webhook timeout.
+const alertLease = time.Minute
+
+// maxAlertBackoff caps the delay between notification attempts
+const maxAlertBackoff = time.Hour
+
+// StockAlertService raises low-stock alerts and delivers their notifications.
+//
+// Each check compares every product's quantity with its reorder threshold:
+// products at or below it get an alert unless they already have an open one,
+// and open alerts of products that have been restocked are resolved. A product
+// is therefore notified once per shortage, however long it lasts and however
+// often its stock changes meanwhile. The checks are plain queries, so several
+// instances of the service can run them; pending notifications are claimed with
+// SELECT ... FOR UPDATE SKIP LOCKED and sent at least once.
+type StockAlertService struct {
+	db       *gorm.DB
+	notifier StockAlertNotifier
+	cfg      config.AlertsConfig
+}
+
+// NewStockAlertService creates a new stock alert service
+func NewStockAlertService(db *gorm.DB, notifier StockAlertNotifier, cfg config.AlertsConfig) *StockAlertService {
+	return &StockAlertService{db: db, notifier: notifier, cfg: cfg}
+}
+
+// Run checks stock every check interval until ctx is cancelled
+func (s *StockAlertService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Check(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warn("Stock alert check failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check resolves the alerts of restocked products, raises alerts for products
+// that have run low and sends the pending notifications
+func (s *StockAlertService) Check(ctx context.Context) error {
+	if err := s.resolveAlerts(); err != nil {
+		return err
+	}
+	if err := s.raiseAlerts(); err != nil {
+		return err
+	}
+
+	for {
+		n, err := s.notifyPending(ctx)
+		if err != nil {
+			return err
+		}
+		if n < s.cfg.BatchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// resolveAlerts closes the open alerts of products that are back above their
+// threshold, no longer have alerts enabled or were deleted
+func (s *StockAlertService) resolveAlerts() error {
+	err := s.db.Exec(`UPDATE stock_alerts SET resolved_at = now(), updated_at = now()
+		FROM products WHERE products.id = stock_alerts.product_id AND stock_alerts.resolved_at IS NULL
+		AND (products.deleted_at IS NOT NULL OR products.reorder_threshold = 0
+			OR products.quantity > products.reorder_threshold)`).Error
+	if err != nil {
+		return fmt.Errorf("failed to resolve stock alerts: %w", err)
+	}
+	return nil
+}
+
+// raiseAlerts opens an alert for every product at or below its reorder
+// threshold that has no open alert. The partial unique index on open alerts
+// (see database.RunMigrations) keeps concurrent checks from raising two.
+func (s *StockAlertService) raiseAlerts() error {
+	result := s.db.Exec(`INSERT INTO stock_alerts (product_id, quantity, threshold, attempts, next_attempt_at, created_at, updated_at)
+		SELECT id, quantity, reorder_threshold, 0, now(), now(), now() FROM products
+		WHERE deleted_at IS NULL AND reorder_threshold > 0 AND quantity <= reorder_threshold
+		ON CONFLICT (product_id) WHERE resolved_at IS NULL DO NOTHING`)
+	if result.Error != nil {
+		return fmt.Errorf("failed to raise stock alerts: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		logrus.WithField("count", result.RowsAffected).Info("Raised low-stock alerts")
+	}
+	return nil
+}
+
+// notifyPending sends one batch of due notifications and returns how many
+// were attempted
+func (s *StockAlertService) notifyPending(ctx context.Context) (int, error) {
+	alerts, err := s.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range alerts {
+		if ctx.Err() != nil {
+			break
+		}
+		s.notify(ctx, &alerts[i])
+	}
+	return len(alerts), nil
+}
+
+// claim locks a batch of open, unnotified alerts that are due, counts the
+// attempt and pushes their next attempt past the lease
+func (s *StockAlertService) claim() ([]models.StockAlert, error) {
+	var alerts []models.StockAlert
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("resolved_at IS NULL AND notified_at IS NULL AND next_attempt_at <= ?", now).
+			Order("next_attempt_at, id").Limit(s.cfg.BatchSize).
+			Find(&alerts).Error; err != nil {
+			return fmt.Errorf("failed to claim stock alerts: %w", err)
+		}
+		if len(alerts) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(alerts))
+		for i := range alerts {
+			ids[i] = alerts[i].ID
+			alerts[i].Attempts++
+		}
+		return tx.Model(&models.StockAlert{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(alertLease),
+		}).Error
+	})
+	return alerts, err
+}
+
+// notify sends a claimed alert's notification and records the outcome
+func (s *StockAlertService) notify(ctx context.Context, alert *models.StockAlert) {
+	var product models.Product
+	if err := s.db.First(&product, alert.ProductID).Error; err != nil {
+		// A deleted product's alert is resolved by the next check
+		if err != gorm.ErrRecordNotFound {
+			logrus.WithError(err).WithField("alert_id", alert.ID).Warn("Failed to load product for stock alert")
+		}
+		return
+	}
+
+	err := s.notifier.Notify(ctx, &models.LowStockEvent{
+		Type:             models.LowStockEventType,
+		AlertID:          alert.ID,
+		ProductID:        product.ID,
+		SKU:              product.SKU,
+		Name:             product.Name,
+		Quantity:         product.Quantity,
+		ReorderThreshold: product.ReorderThreshold,
+		DetectedAt:       alert.CreatedAt,
+	})
+
+	updates := map[string]interface{}{"notified_at": time.Now(), "last_error": ""}
+	if err != nil {
+		updates = map[string]interface{}{
+			"last_error":      err.Error(),
+			"next_attempt_at": time.Now().Add(s.backoff(alert.Attempts)),
+		}
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"alert_id":   alert.ID,
+			"product_id": alert.ProductID,
+			"attempts":   alert.Attempts,
+		}).Warn("Failed to send low-stock notification")
+	}
+
+	if err := s.db.Model(&models.StockAlert{}).Where("id = ?", alert.ID).Updates(updates).Error; err != nil {
+		logrus.WithError(err).WithField("alert_id", alert.ID).Warn("Failed to record stock alert delivery")
+	}
+}
+
+// backoff returns the delay before the next notification attempt: the check
+// interval, doubled for every failed attempt up to maxAlertBackoff
+func (s *StockAlertService) backoff(attempts int) time.Duration {
+	delay := s.cfg.CheckInterval
+	for i := 1; i < attempts && delay < maxAlertBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxAlertBackoff)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"image"
+	"image/draw"
+)
+
+// thumbnail scales img down to fit within size x size pixels, keeping its
+// aspect ratio, by averaging the source pixels covered by each target pixel.
+// Images that already fit are copied unscaled. Transparent areas are flattened
+// onto white, since thumbnails are encoded as JPEG.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if srcW > size || srcH > size {
+		if srcW >= srcH {
+			dstW, dstH = size, max(1, srcH*size/srcW)
+		} else {
+			dstW, dstH = max(1, srcW*size/srcH), size
+		}
+	}
+
+	// Convert once so the loop below can read the pixel slice directly
+	src := image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for dy := 0; dy < dstH; dy++ {
+		y0, y1 := dy*srcH/dstH, max((dy+1)*srcH/dstH, dy*srcH/dstH+1)
+		for dx := 0; dx < dstW; dx++ {
+			x0, x1 := dx*srcW/dstW, max((dx+1)*srcW/dstW, dx*srcW/dstW+1)
+
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			// Pixels are alpha-premultiplied, so adding the missing coverage
+			// in white flattens them onto a white background
+			white := 255 - a/n
+			p := dst.Pix[dy*dst.Stride+dx*4:]
+			p[0] = uint8(r/n + white)
+			p[1] = uint8(g/n + white)
+			p[2] = uint8(b/n + white)
+			p[3] = 255
+		}
+	}
+	return dst
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrBlobNotFound is returned when no blob is stored under a key
+var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are empty, absolute or contain "."
+// or ".." segments
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// BlobStore stores opaque blobs, such as product images, under slash-separated
+// keys like "products/1/abc.jpg". Implementations must be safe for concurrent
+// use; a Put is either fully visible to Get or not at all.
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+
+	// Get opens the blob stored under key. The caller must close the reader,
+	// which also implements io.Seeker if the store supports random access.
+	Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error)
+
+	// Delete removes the blob stored under key. Deleting a missing blob is not
+	// an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidateKey checks that key is a relative, clean slash-separated path
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"order-api-stat/handlers"
+	"order-api-stat/models"
+)
+
+// createCategory creates a category through POST /categories, under parentID
+// unless it is 0
+func createCategory(t *testing.T, handler *handlers.CategoryHandler, name string, parentID uint) models.CategoryResponse {
+	t.Helper()
+	body := map[string]interface{}{"name": name}
+	if parentID != 0 {
+		body["parent_id"] = parentID
+	}
+	rec := Serve(handler.HandleCategories, NewTestRequest(t, http.MethodPost, "/categories", body))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var category models.CategoryResponse
+	DecodeResponse(t, rec, &category)
+	return category
+}
+
+// moveCategory sends PUT /categories/{id} with parent_id set to parentID
+func moveCategory(t *testing.T, handler *handlers.CategoryHandler, id, parentID uint) int {
+	t.Helper()
+	rec := Serve(handler.HandleCategoryByID, NewTestRequest(t, http.MethodPut,
+		fmt.Sprintf("/categories/%d", id), map[string]uint{"parent_id": parentID}))
+	return rec.Code
+}
+
+func TestCategories_ParentAndChild(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := handlers.NewCategoryHandler(db)
+
+	electronics := createCategory(t, handler, "Electronics", 0)
+	computers := createCategory(t, handler, "Computers & Tablets", electronics.ID)
+	laptops := createCategory(t, handler, "Laptops", computers.ID)
+	createCategory(t, handler, "Home", 0)
+
+	assert.Nil(t, electronics.ParentID)
+	require.NotNil(t, computers.ParentID)
+	assert.Equal(t, electronics.ID, *computers.ParentID)
+	assert.Equal(t, "computers-tablets", computers.Slug)
+
+	t.Run("TreeIsNested", func(t *testing.T) {
+		rec := Serve(handler.HandleCategories, NewTestRequest(t, http.MethodGet, "/categories", nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var list struct {
+			Categories []models.CategoryResponse `json:"categories"`
+		}
+		DecodeResponse(t, rec, &list)
+		require.Len(t, list.Categories, 2, "only top-level categories are listed at the top")
+		assert.Equal(t, "Electronics", list.Categories[0].Name)
+		assert.Equal(t, "Home", list.Categories[1].Name)
+		require.Len(t, list.Categories[0].Children, 1)
+		assert.Equal(t, computers.ID, list.Categories[0].Children[0].ID)
+		require.Len(t, list.Categories[0].Children[0].Children, 1)
+		assert.Equal(t, laptops.ID, list.Categories[0].Children[0].Children[0].ID)
+	})
+
+	t.Run("GetIncludesSubcategories", func(t *testing.T) {
+		rec := Serve(handler.HandleCategoryByID,
+			NewTestRequest(t, http.MethodGet, fmt.Sprintf("/categories/%d", computers.ID), nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var category models.CategoryResponse
+		DecodeResponse(t, rec, &category)
+		require.Len(t, category.Children, 1)
+		assert.Equal(t, "laptops", category.Children[0].Slug)
+	})
+
+	t.Run("UnknownParent", func(t *testing.T) {
+		rec := Serve(handler.HandleCategories, NewTestRequest(t, http.MethodPost, "/categories",
+			map[string]interface{}{"name": "Phones", "parent_id": laptops.ID + 1000}))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("DuplicateSlug", func(t *testing.T) {
+		rec := Serve(handler.HandleCategories, NewTestRequest(t, http.MethodPost, "/categories",
+			map[string]interface{}{"name": "LAPTOPS", "parent_id": electronics.ID}))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("ParentWithSubcategoriesCannotBeDeleted", func(t *testing.T) {
+		rec := Serve(handler.HandleCategoryByID,
+			NewTestRequest(t, http.MethodDelete, fmt.Sprintf("/categories/%d", computers.ID), nil))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
+
+func TestCategories_RejectsCycles(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := handlers.NewCategoryHandler(db)
+
+	electronics := createCategory(t, handler, "Electronics", 0)
+	computers := createCategory(t, handler, "Computers", electronics.ID)
+	laptops := createCategory(t, handler, "Laptops", computers.ID)
+
+	assert.Equal(t, http.StatusBadRequest, moveCategory(t, handler, electronics.ID, electronics.ID), "under itself")
+	assert.Equal(t, http.StatusBadRequest, moveCategory(t, handler, electronics.ID, computers.ID), "under its child")
+	assert.Equal(t, http.StatusBadRequest, moveCategory(t, handler, electronics.ID, laptops.ID), "under a grandchild")
+
+	// The rejected moves left the tree as it was
+	rec := Serve(handler.HandleCategoryByID,
+		NewTestRequest(t, http.MethodGet, fmt.Sprintf("/categories/%d", electronics.ID), nil))
+	var category models.CategoryResponse
+	DecodeResponse(t, rec, &category)
+	assert.Nil(t, category.ParentID)
+	require.Len(t, category.Children, 1)
+	assert.Equal(t, computers.ID, category.Children[0].ID)
+
+	t.Run("MovingASubtreeElsewhere", func(t *testing.T) {
+		// Laptops may move to the top and Electronics below it afterwards
+		assert.Equal(t, http.StatusOK, moveCategory(t, handler, laptops.ID, 0))
+		assert.Equal(t, http.StatusOK, moveCategory(t, handler, electronics.ID, laptops.ID))
+		assert.Equal(t, http.StatusBadRequest, moveCategory(t, handler, laptops.ID, computers.ID))
+	})
+}
+
+func TestListProducts_CategoryIncludesDescendants(t *testing.T) {
+	db := SetupTestDB(t)
+	categories := handlers.NewCategoryHandler(db)
+	products := NewTestProductHandler(db)
+
+	electronics := createCategory(t, categories, "Electronics", 0)
+	computers := createCategory(t, categories, "Computers", electronics.ID)
+	laptops := createCategory(t, categories, "Laptops", computers.ID)
+	createCategory(t, categories, "Home", 0)
+
+	// Products are linked to existing categories by name
+	createCatalogProduct(t, db, "ELEC-001", "Headphones", "", "Electronics", 80, 1)
+	createCatalogProduct(t, db, "COMP-001", "Desktop Computer", "", "Computers", 900, 1)
+	createCatalogProduct(t, db, "LAPT-001", "Ultrabook", "", "laptops", 1200, 1)
+	createCatalogProduct(t, db, "HOME-001", "Desk Lamp", "", "Home", 40, 1)
+
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"/products?category=electronics&sort=price", []string{"ELEC-001", "COMP-001", "LAPT-001"}},
+		{"/products?category=Computers&sort=price", []string{"COMP-001", "LAPT-001"}},
+		{"/products?category=laptops", []string{"LAPT-001"}},
+		{"/products?category=laptops,home&sort=price", []string{"HOME-001", "LAPT-001"}},
+		{"/products?category=unknown", []string{}},
+	}
+	for _, tt := range tests {
+		_, skus := listSKUs(t, products.ListProducts, tt.target)
+		assert.Equal(t, tt.want, skus, "GET %s", tt.target)
+	}
+
+	t.Run("AfterMovingASubcategory", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, moveCategory(t, categories, laptops.ID, 0))
+
+		_, skus := listSKUs(t, products.ListProducts, "/products?category=electronics&sort=price")
+		assert.Equal(t, []string{"ELEC-001", "COMP-001"}, skus)
+	})
+}
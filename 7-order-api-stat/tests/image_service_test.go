@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"order-api-stat/service"
+	"order-api-stat/storage"
+)
+
+// encodeTestPNG encodes a width x height PNG filled with fill
+func encodeTestPNG(t *testing.T, width, height int, fill color.Color) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// pngClaimingSize returns a small PNG whose header claims width x height
+// pixels, like a decompression bomb
+func pngClaimingSize(t *testing.T, width, height uint32) []byte {
+	data := encodeTestPNG(t, 1, 1, color.White)
+	// The IHDR chunk follows the 8-byte signature: length, type, then width
+	// and height, with its CRC over type and data after them
+	binary.BigEndian.PutUint32(data[16:20], width)
+	binary.BigEndian.PutUint32(data[20:24], height)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+// newTestImageService creates an image service over db storing blobs in a
+// temporary directory, accepting uploads up to maxSize bytes with thumbnails of
+// thumbnailSize pixels
+func newTestImageService(t *testing.T, db *gorm.DB, maxSize int64, thumbnailSize int) (*service.ImageService, storage.BlobStore) {
+	t.Helper()
+	store, err := storage.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+	return service.NewImageService(db, store, maxSize, thumbnailSize), store
+}
+
+// readThumbnail decodes the stored thumbnail under key
+func readThumbnail(t *testing.T, store storage.BlobStore, key string) image.Image {
+	t.Helper()
+	r, info, err := store.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, "image/jpeg", info.ContentType)
+	img, err := jpeg.Decode(r)
+	require.NoError(t, err)
+	return img
+}
+
+func TestAddImage_RejectsUploadsOutsideLimits(t *testing.T) {
+	db := SetupTestDB(t)
+	images, _ := newTestImageService(t, db, 16<<10, 32)
+	product := CreateTestProduct(t, db, "IMG-001", 9.99, 1)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"larger than the size limit", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 16<<10)...), "image too large"},
+		{"plain text", []byte("not an image"), "unsupported image type text/plain"},
+		{"PDF", []byte("%PDF-1.4\n%âãÏÓ\n"), "unsupported image type application/pdf"},
+		{"truncated PNG", encodeTestPNG(t, 4, 4, color.White)[:20], "invalid image"},
+		{"too many pixels", pngClaimingSize(t, 10000, 5000), "exceeds the limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, created, err := images.AddImage(context.Background(), product.ID, bytes.NewReader(tt.data), "")
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.False(t, created)
+		})
+	}
+
+	_, _, err := images.AddImage(context.Background(), product.ID+1000, bytes.NewReader(encodeTestPNG(t, 4, 4, color.White)), "")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestAddImage_ThumbnailFitsWithinSize(t *testing.T) {
+	db := SetupTestDB(t)
+	images, store := newTestImageService(t, db, 1<<20, 32)
+	product := CreateTestProduct(t, db, "IMG-002", 9.99, 1)
+
+	tests := []struct {
+		name                    string
+		width, height           int
+		thumbWidth, thumbHeight int
+	}{
+		{"wide", 200, 100, 32, 16},
+		{"tall", 50, 300, 5, 32},
+		{"already small", 20, 10, 20, 10},
+		{"one pixel high", 400, 1, 32, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeTestPNG(t, tt.width, tt.height, color.NRGBA{R: 200, A: 255})
+			record, created, err := images.AddImage(context.Background(), product.ID, bytes.NewReader(data), "")
+			require.NoError(t, err)
+			require.True(t, created)
+			assert.Equal(t, "image/png", record.ContentType)
+			assert.Equal(t, tt.width, record.Width)
+			assert.Equal(t, tt.height, record.Height)
+
+			bounds := readThumbnail(t, store, record.ThumbnailKey).Bounds()
+			assert.Equal(t, tt.thumbWidth, bounds.Dx())
+			assert.Equal(t, tt.thumbHeight, bounds.Dy())
+		})
+	}
+
+	t.Run("transparency is flattened onto white", func(t *testing.T) {
+		data := encodeTestPNG(t, 64, 64, color.NRGBA{})
+		record, _, err := images.AddImage(context.Background(), product.ID, bytes.NewReader(data), "")
+		require.NoError(t, err)
+
+		r, g, b, _ := readThumbnail(t, store, record.ThumbnailKey).At(8, 8).RGBA()
+		for _, c := range []uint32{r, g, b} {
+			assert.Greater(t, c>>8, uint32(245))
+		}
+	})
+}
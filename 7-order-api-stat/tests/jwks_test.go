@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"order-api-stat/handlers"
+	"order-api-stat/utils"
+)
+
+// testSigningKey is a private key with the JWK that publishes its public half
+type testSigningKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+	jwk    map[string]string
+}
+
+func newEd25519TestKey(t *testing.T, kid string) *testSigningKey {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &testSigningKey{
+		kid:    kid,
+		method: jwt.SigningMethodEdDSA,
+		key:    priv,
+		jwk: map[string]string{
+			"kty": "OKP", "kid": kid, "use": "sig", "alg": "EdDSA", "crv": "Ed25519",
+			"x": base64.RawURLEncoding.EncodeToString(pub),
+		},
+	}
+}
+
+func newRSATestKey(t *testing.T, kid string) *testSigningKey {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return &testSigningKey{
+		kid:    kid,
+		method: jwt.SigningMethodRS256,
+		key:    priv,
+		jwk: map[string]string{
+			"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+		},
+	}
+}
+
+// sign issues a token for userID with role the way the auth service does
+func (k *testSigningKey) sign(t *testing.T, userID, role string) string {
+	token := jwt.NewWithClaims(k.method, jwt.MapClaims{
+		"user_id": userID,
+		"role":    role,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = k.kid
+	tokenString, err := token.SignedString(k.key)
+	require.NoError(t, err)
+	return tokenString
+}
+
+// jwksDocument renders keys as a JWKS document
+func jwksDocument(t *testing.T, keys ...*testSigningKey) []byte {
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	return data
+}
+
+// writeJWKSFile writes keys to a JWKS file in a temporary directory
+func writeJWKSFile(t *testing.T, keys ...*testSigningKey) string {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwksDocument(t, keys...), 0o600))
+	return path
+}
+
+// newJWKSProtectedHandler wraps a handler that echoes the authenticated user
+// ID and role
+func newJWKSProtectedHandler(jwks *utils.JWKSCache) http.Handler {
+	return utils.AuthMiddleware(jwks, handlers.IsPrivateRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(utils.UserIDKey).(string)
+		role, _ := r.Context().Value(utils.RoleKey).(string)
+		w.Write([]byte(userID + "/" + role))
+	}))
+}
+
+// doAuthRequest sends a request that modifies data, so it needs a token
+func doAuthRequest(handler http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/products/1/quantity", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthMiddleware_JWKSFile(t *testing.T) {
+	edKey := newEd25519TestKey(t, "ed-key")
+	rsaKey := newRSATestKey(t, "rsa-key")
+	handler := newJWKSProtectedHandler(utils.NewJWKSCache("", writeJWKSFile(t, edKey, rsaKey), time.Minute))
+
+	t.Run("EdDSA token", func(t *testing.T) {
+		rec := doAuthRequest(handler, edKey.sign(t, "user-1", "service"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user-1/service", rec.Body.String())
+	})
+
+	t.Run("RS256 token", func(t *testing.T) {
+		rec := doAuthRequest(handler, rsaKey.sign(t, "user-2", "admin"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user-2/admin", rec.Body.String())
+	})
+
+	t.Run("HS256 token is rejected", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": "user-1",
+			"exp":     time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte("test-secret-key"))
+		require.NoError(t, err)
+		rec := doAuthRequest(handler, token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("unknown key is rejected", func(t *testing.T) {
+		rec := doAuthRequest(handler, newEd25519TestKey(t, "other-key").sign(t, "user-1", "admin"))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("key used with the wrong kid is rejected", func(t *testing.T) {
+		forged := *edKey
+		forged.kid = rsaKey.kid
+		rec := doAuthRequest(handler, forged.sign(t, "user-1", "admin"))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("missing token is rejected", func(t *testing.T) {
+		rec := doAuthRequest(handler, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("reads need no token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products/1", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("reservation reads need a token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reservations/1", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req := httptest.NewRequest(http.MethodGet, "/reservations/1", nil)
+		req.Header.Set("Authorization", "Bearer "+edKey.sign(t, "user-1", "user"))
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user-1/user", rec.Body.String())
+	})
+
+	t.Run("history and deleted product reads need a token", func(t *testing.T) {
+		for _, target := range []string{"/products/1/history", "/products?deleted=true", "/products/export?deleted=true"} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, "GET %s", target)
+		}
+	})
+}
+
+func TestAuthMiddleware_JWKSURL(t *testing.T) {
+	oldKey := newEd25519TestKey(t, "old-key")
+	newKey := newEd25519TestKey(t, "new-key")
+
+	published := jwksDocument(t, oldKey)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(published)
+	}))
+	defer server.Close()
+
+	handler := newJWKSProtectedHandler(utils.NewJWKSCache(server.URL, "", time.Minute))
+
+	for i := 0; i < 3; i++ {
+		rec := doAuthRequest(handler, oldKey.sign(t, "user-1", "service"))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Equal(t, 1, fetches, "key set should be cached between requests")
+
+	// After a rotation the first token with the new kid triggers a refetch
+	published = jwksDocument(t, oldKey, newKey)
+	rec := doAuthRequest(handler, newKey.sign(t, "user-1", "service"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, fetches)
+}
+
+func TestAuthMiddleware_JWKSFileFallback(t *testing.T) {
+	key := newEd25519TestKey(t, "ed-key")
+
+	// Nothing listens on the URL, so keys come from the file
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	handler := newJWKSProtectedHandler(utils.NewJWKSCache(server.URL, writeJWKSFile(t, key), time.Minute))
+
+	rec := doAuthRequest(handler, key.sign(t, "user-1", "service"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"order-api-stat/handlers"
+	"order-api-stat/models"
+)
+
+const adminID = "6f0c3a52-8c1e-4b8e-9d43-2f1f0c6a9b10"
+
+// asAdmin returns req as sent with an admin's token
+func asAdmin(req *http.Request) *http.Request {
+	return WithActor(req, adminID, "admin")
+}
+
+// getHistory reads GET target as an admin
+func getHistory(t *testing.T, handler *handlers.ProductHandler, target string) models.ProductHistoryResponse {
+	t.Helper()
+	rec := Serve(handler.HandleProductByID, asAdmin(NewTestRequest(t, http.MethodGet, target, nil)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var history models.ProductHistoryResponse
+	DecodeResponse(t, rec, &history)
+	return history
+}
+
+func TestProductHistory_RecordsEveryChange(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := NewTestProductHandler(db)
+	product := CreateTestProduct(t, db, "HIST-001", 9.99, 10)
+	path := fmt.Sprintf("/products/%d", product.ID)
+
+	rec := Serve(handler.HandleProductByID, asAdmin(NewTestRequest(t, http.MethodPut, path, map[string]float64{"price": 12.5})))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = Serve(handler.HandleProductByID, asAdmin(NewTestRequest(t, http.MethodDelete, path, nil)))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = Serve(handler.HandleProductByID, asAdmin(NewTestRequest(t, http.MethodPost, path+"/restore", nil)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	history := getHistory(t, handler, path+"/history")
+	assert.Equal(t, product.ID, history.ProductID)
+	assert.Equal(t, int64(4), history.Total)
+	require.Len(t, history.Entries, 4)
+
+	actions := make([]string, len(history.Entries))
+	for i, entry := range history.Entries {
+		actions[i] = entry.Action
+	}
+	assert.Equal(t, []string{models.AuditActionRestore, models.AuditActionDelete, models.AuditActionUpdate, models.AuditActionCreate},
+		actions, "newest first")
+
+	restore, deletion, update, create := history.Entries[0], history.Entries[1], history.Entries[2], history.Entries[3]
+	assert.Nil(t, create.Before)
+	assert.Equal(t, "HIST-001", create.After["sku"])
+	assert.Empty(t, create.Actor, "created without a token")
+
+	assert.Equal(t, map[string]interface{}{"price": 9.99}, update.Before)
+	assert.Equal(t, map[string]interface{}{"price": 12.5}, update.After)
+	assert.Equal(t, adminID, update.Actor)
+	assert.Greater(t, update.Version, create.Version)
+
+	assert.Equal(t, 12.5, deletion.Before["price"], "a delete holds the whole product")
+	assert.Nil(t, deletion.After)
+
+	assert.Contains(t, restore.Before, "deleted_at")
+	assert.Nil(t, restore.After["deleted_at"])
+	assert.Greater(t, restore.Version, deletion.Version)
+
+	t.Run("Pagination", func(t *testing.T) {
+		history := getHistory(t, handler, path+"/history?page=2&limit=3")
+		assert.Equal(t, int64(4), history.Total)
+		assert.Equal(t, 2, history.Page)
+		assert.Equal(t, 3, history.Limit)
+		require.Len(t, history.Entries, 1)
+		assert.Equal(t, models.AuditActionCreate, history.Entries[0].Action)
+	})
+
+	t.Run("UnknownProduct", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID,
+			asAdmin(NewTestRequest(t, http.MethodGet, fmt.Sprintf("/products/%d/history", product.ID+1000), nil)))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestRestoreProduct(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := NewTestProductHandler(db)
+	kept := CreateTestProduct(t, db, "KEEP-001", 5, 1)
+	product := CreateTestProduct(t, db, "DEL-001", 9.99, 10)
+	path := fmt.Sprintf("/products/%d", product.ID)
+
+	rec := Serve(handler.HandleProductByID, asAdmin(NewTestRequest(t, http.MethodGet, path, nil)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	etag := rec.Header().Get("ETag")
+	rec = Serve(handler.HandleProductByID, asAdmin(NewTestRequest(t, http.MethodDelete, path, nil)))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	rec = Serve(handler.HandleProductByID, NewTestRequest(t, http.MethodGet, path, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "deleted products are not served")
+
+	t.Run("DeletedListing", func(t *testing.T) {
+		rec := Serve(handler.ListProducts, asAdmin(NewTestRequest(t, http.MethodGet, "/products?deleted=true", nil)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var list models.ProductListResponse
+		DecodeResponse(t, rec, &list)
+		require.Len(t, list.Products, 1)
+		assert.Equal(t, "DEL-001", list.Products[0].SKU)
+		assert.NotEmpty(t, list.Products[0].DeletedAt)
+		assert.True(t, list.Deleted)
+
+		_, skus := listSKUs(t, handler.ListProducts, "/products")
+		assert.Equal(t, []string{kept.SKU}, skus, "live listing leaves deleted products out")
+	})
+
+	t.Run("StaleIfMatch", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID,
+			conditionalRequest(NewTestRequest(t, http.MethodPost, path+"/restore", nil), `"999"`))
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	})
+
+	rec = Serve(handler.HandleProductByID, conditionalRequest(NewTestRequest(t, http.MethodPost, path+"/restore", nil), etag))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var restored models.ProductResponse
+	DecodeResponse(t, rec, &restored)
+	assert.Equal(t, product.ID, restored.ID)
+	assert.Empty(t, restored.DeletedAt)
+	assert.Equal(t, product.Version+1, restored.Version)
+	assert.Equal(t, fmt.Sprintf(`"%d"`, restored.Version), rec.Header().Get("ETag"))
+
+	rec = Serve(handler.HandleProductByID, NewTestRequest(t, http.MethodGet, path, nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "restored products are served again")
+
+	_, skus := listSKUs(t, handler.ListProducts, "/products?deleted=true")
+	assert.Empty(t, skus)
+
+	t.Run("NotDeleted", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID, asAdmin(NewTestRequest(t, http.MethodPost, path+"/restore", nil)))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("UnknownProduct", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID,
+			asAdmin(NewTestRequest(t, http.MethodPost, fmt.Sprintf("/products/%d/restore", product.ID+1000), nil)))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestProductHistoryAndDeletedListing_RequireAdminRole(t *testing.T) {
+	handler := NewTestProductHandler(nil)
+
+	targets := []struct {
+		target string
+		serve  http.HandlerFunc
+	}{
+		{"/products/1/history", handler.HandleProductByID},
+		{"/products?deleted=true", handler.HandleProducts},
+		{"/products/export?deleted=true", handler.HandleProductByID},
+	}
+	for _, role := range []string{"user", "support", "service"} {
+		for _, tt := range targets {
+			req := WithActor(NewTestRequest(t, http.MethodGet, tt.target, nil), "2b5c9f1e-7d3a-4f6b-8e21-9c0d4a7b3e58", role)
+			rec := Serve(tt.serve, req)
+			assert.Equal(t, http.StatusForbidden, rec.Code, "GET %s as %s", tt.target, role)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"order-api-stat/models"
+)
+
+// quantityRequest builds PATCH /products/{id}/quantity the way the order
+// service's outbox sends it: a decrement is a sale and a restock a return
+func quantityRequest(t *testing.T, productID string, change int, idempotencyKey string) *http.Request {
+	reason := models.AdjustmentReasonSale
+	if change > 0 {
+		reason = models.AdjustmentReasonReturn
+	}
+	req := NewTestRequest(t, http.MethodPatch, "/products/"+productID+"/quantity",
+		map[string]interface{}{"change": change, "reason": reason})
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	return WithActor(req, "6f0c3a52-8c1e-4b8e-9d43-2f1f0c6a9b10", "service")
+}
+
+func TestUpdateProductQuantity_OrderServiceRequests(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := NewTestProductHandler(db)
+	product := CreateTestProduct(t, db, "QTY-001", 9.99, 10)
+	productID := fmt.Sprint(product.ID)
+
+	rec := Serve(handler.HandleProductByID,
+		quantityRequest(t, productID, -2, "inventory.decrement:0b7d5e1e-5a0e-4c1c-a6a4-5b0f51c2a7d3"))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var quantity models.QuantityResponse
+	DecodeResponse(t, rec, &quantity)
+	assert.Equal(t, product.ID, quantity.ID)
+	assert.Equal(t, 8, quantity.Quantity)
+
+	t.Run("RetryIsAppliedOnce", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID,
+			quantityRequest(t, productID, -2, "inventory.decrement:0b7d5e1e-5a0e-4c1c-a6a4-5b0f51c2a7d3"))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		DecodeResponse(t, rec, &quantity)
+		assert.Equal(t, 8, quantity.Quantity)
+	})
+
+	t.Run("Restock", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID,
+			quantityRequest(t, productID, 2, "inventory.restock:0b7d5e1e-5a0e-4c1c-a6a4-5b0f51c2a7d3"))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		DecodeResponse(t, rec, &quantity)
+		assert.Equal(t, 10, quantity.Quantity)
+	})
+
+	t.Run("InsufficientStock", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID, quantityRequest(t, productID, -11, "inventory.decrement:too-many"))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("UnknownProduct", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID, quantityRequest(t, fmt.Sprint(product.ID+1000), -1, "inventory.decrement:unknown"))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestUpdateProductQuantity_RejectsNonNumericIDs(t *testing.T) {
+	handler := NewTestProductHandler(nil)
+
+	for _, id := range []string{"0b7d5e1e-5a0e-4c1c-a6a4-5b0f51c2a7d3", "abc", "-1", "4294967296"} {
+		rec := Serve(handler.HandleProductByID, quantityRequest(t, id, -1, "inventory.decrement:"+id))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "product ID %q", id)
+	}
+}
+
+func TestUpdateProductQuantity_RequiresServiceOrAdminRole(t *testing.T) {
+	handler := NewTestProductHandler(nil)
+
+	req := NewTestRequest(t, http.MethodPatch, "/products/1/quantity", map[string]int{"change": 100})
+	rec := Serve(handler.HandleProductByID, WithActor(req, "2b5c9f1e-7d3a-4f6b-8e21-9c0d4a7b3e58", "user"))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+// cartProduct mirrors the product model the order service decodes product
+// responses into
+type cartProduct struct {
+	ID       uint     `json:"id"`
+	Name     string   `json:"name"`
+	Price    float64  `json:"price"`
+	Quantity int      `json:"quantity"`
+	Category string   `json:"category"`
+	SKU      string   `json:"sku"`
+	Images   []string `json:"images"`
+}
+
+// batchTarget builds GET /products?ids=... the way the order service's
+// product client does
+func batchTarget(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return "/products?ids=" + strings.Join(parts, ",")
+}
+
+func TestListProducts_OrderServiceBatchLookup(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := NewTestProductHandler(db)
+	first := CreateTestProduct(t, db, "BATCH-001", 5, 3)
+	second := CreateTestProduct(t, db, "BATCH-002", 7.5, 0)
+
+	rec := Serve(handler.ListProducts,
+		NewTestRequest(t, http.MethodGet, batchTarget([]uint{second.ID, first.ID, second.ID + 1000}), nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var list struct {
+		Products []cartProduct `json:"products"`
+	}
+	DecodeResponse(t, rec, &list)
+	require.Len(t, list.Products, 2, "unknown IDs are omitted")
+	assert.Equal(t, first.ID, list.Products[0].ID)
+	assert.Equal(t, "BATCH-001", list.Products[0].SKU)
+	assert.Equal(t, 5.0, list.Products[0].Price)
+	assert.Equal(t, second.ID, list.Products[1].ID)
+	assert.Equal(t, 0, list.Products[1].Quantity)
+
+	t.Run("FullBatch", func(t *testing.T) {
+		// The order service sends up to 100 IDs per request
+		ids := make([]uint, 100)
+		for i := range ids {
+			ids[i] = first.ID + uint(i)
+		}
+		rec := Serve(handler.ListProducts, NewTestRequest(t, http.MethodGet, batchTarget(ids), nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		DecodeResponse(t, rec, &list)
+		assert.Len(t, list.Products, 2)
+	})
+}
+
+func TestListProducts_BatchLookupRejectsInvalidIDs(t *testing.T) {
+	handler := NewTestProductHandler(nil)
+
+	tooMany := make([]uint, 101)
+	for i := range tooMany {
+		tooMany[i] = uint(i + 1)
+	}
+	targets := []string{
+		"/products?ids=1,0b7d5e1e-5a0e-4c1c-a6a4-5b0f51c2a7d3",
+		"/products?ids=1,-2",
+		"/products?ids=",
+		batchTarget(tooMany),
+	}
+	for _, target := range targets {
+		rec := Serve(handler.ListProducts, NewTestRequest(t, http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "GET %s", target)
+	}
+}
+
+// conditionalRequest sets If-Match on req unless ifMatch is empty
+func conditionalRequest(req *http.Request, ifMatch string) *http.Request {
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return WithActor(req, "6f0c3a52-8c1e-4b8e-9d43-2f1f0c6a9b10", "admin")
+}
+
+func TestUpdateProduct_IfMatch(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := NewTestProductHandler(db)
+	product := CreateTestProduct(t, db, "ETAG-001", 9.99, 10)
+	path := fmt.Sprintf("/products/%d", product.ID)
+
+	rec := Serve(handler.HandleProductByID, NewTestRequest(t, http.MethodGet, path, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	update := func(ifMatch string, price float64) *httptest.ResponseRecorder {
+		return Serve(handler.HandleProductByID,
+			conditionalRequest(NewTestRequest(t, http.MethodPut, path, map[string]float64{"price": price}), ifMatch))
+	}
+
+	for _, ifMatch := range []string{`"999"`, "W/" + etag, strings.Trim(etag, `"`), `"abc"`} {
+		rec := update(ifMatch, 1)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code, "If-Match %s", ifMatch)
+	}
+
+	rec = update(`"999", `+etag, 12.5)
+	require.Equal(t, http.StatusOK, rec.Code, "any listed tag may match: %s", rec.Body.String())
+	newETag := rec.Header().Get("ETag")
+	assert.NotEqual(t, etag, newETag)
+
+	t.Run("StaleTagAfterUpdate", func(t *testing.T) {
+		rec := update(etag, 20)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+		var current models.ProductResponse
+		rec = Serve(handler.HandleProductByID, NewTestRequest(t, http.MethodGet, path, nil))
+		DecodeResponse(t, rec, &current)
+		assert.Equal(t, 12.5, current.Price, "the rejected update was not applied")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rec := Serve(handler.HandleProductByID,
+			conditionalRequest(NewTestRequest(t, http.MethodDelete, path, nil), etag))
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+		rec = Serve(handler.HandleProductByID,
+			conditionalRequest(NewTestRequest(t, http.MethodDelete, path, nil), newETag))
+		assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	})
+}
+
+func TestUpdateProduct_WithoutIfMatch(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := NewTestProductHandler(db)
+	product := CreateTestProduct(t, db, "ETAG-002", 9.99, 10)
+	path := fmt.Sprintf("/products/%d", product.ID)
+
+	// Without If-Match, or with "*", the update applies to the current version
+	for _, ifMatch := range []string{"", "*"} {
+		rec := Serve(handler.HandleProductByID,
+			conditionalRequest(NewTestRequest(t, http.MethodPut, path, map[string]float64{"price": 11}), ifMatch))
+		assert.Equal(t, http.StatusOK, rec.Code, "If-Match %q: %s", ifMatch, rec.Body.String())
+	}
+}
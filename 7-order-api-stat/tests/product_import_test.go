@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"order-api-stat/models"
+	"order-api-stat/service"
+)
+
+// importErrorFields returns the fields reported for each failed row, by row
+func importErrorFields(result *models.ImportResult) map[int][]string {
+	fields := make(map[int][]string, len(result.Errors))
+	for _, rowErr := range result.Errors {
+		for field := range rowErr.Errors {
+			fields[rowErr.Row] = append(fields[rowErr.Row], field)
+		}
+	}
+	return fields
+}
+
+// Rows that fail validation are reported before the database is used, so
+// these tests need none
+
+func TestImportProducts_CSVRowErrors(t *testing.T) {
+	products := service.NewProductService(nil, "")
+	csv := strings.Join([]string{
+		"sku,name,price,quantity,category",
+		"AB,Widget,9.99,1,Tools",
+		"CSV-002,Widget,abc,1,Tools",
+		"CSV-003,Widget,5,1.5,Tools",
+		"CSV-004,Widget,5",
+		"CSV-005,Widget,-1,2,Tools",
+		"CSV-006,Widget,5,1,!!!",
+		"CSV-007,,5,1,Tools",
+		`CSV-008,Wid"get,5,1,Tools`,
+	}, "\n")
+
+	result, err := products.ImportProducts(strings.NewReader(csv), service.FormatCSV, false, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, 8, result.Processed)
+	assert.Equal(t, 8, result.Failed)
+	assert.Zero(t, result.Created)
+	assert.Zero(t, result.Updated)
+	assert.False(t, result.ErrorsTruncated)
+	assert.Equal(t, map[int][]string{
+		2: {"sku"},
+		3: {"price"},
+		4: {"quantity"},
+		5: {"row"},
+		6: {"price"},
+		7: {"category"},
+		8: {"name"},
+		9: {"row"},
+	}, importErrorFields(result))
+
+	require.Len(t, result.Errors, 8)
+	assert.Equal(t, "AB", result.Errors[0].SKU)
+	assert.Equal(t, "price must be a number", result.Errors[1].Errors["price"])
+	assert.Equal(t, "expected 5 fields, got 3", result.Errors[3].Errors["row"])
+}
+
+func TestImportProducts_NDJSONRowErrors(t *testing.T) {
+	products := service.NewProductService(nil, "")
+	ndjson := strings.Join([]string{
+		`{"sku": "NDJ-001", "name": "Widget"}`,
+		``,
+		`{"sku": "NDJ-002", "name": "Widget", "price": "5"}`,
+		`not json`,
+		`{"sku": "NDJ-004", "name": "Widget", "price": 5, "quantity": -1}`,
+	}, "\n")
+
+	result, err := products.ImportProducts(strings.NewReader(ndjson), service.FormatNDJSON, false, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, result.Processed, "blank lines are skipped")
+	assert.Equal(t, 4, result.Failed)
+	assert.Equal(t, map[int][]string{
+		1: {"price"},
+		3: {"row"},
+		4: {"row"},
+		5: {"quantity"},
+	}, importErrorFields(result), "rows are numbered by line, blank lines included")
+	assert.Equal(t, "invalid JSON object", result.Errors[2].Errors["row"])
+}
+
+func TestImportProducts_ErrorReportIsBounded(t *testing.T) {
+	products := service.NewProductService(nil, "")
+	var csv strings.Builder
+	csv.WriteString("sku,name,price\n")
+	for i := 0; i < 105; i++ {
+		fmt.Fprintf(&csv, "BAD-%03d,Widget,free\n", i)
+	}
+
+	result, err := products.ImportProducts(strings.NewReader(csv.String()), service.FormatCSV, false, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, 105, result.Failed, "every failed row is counted")
+	assert.Len(t, result.Errors, 100, "only the first 100 are reported")
+	assert.True(t, result.ErrorsTruncated)
+	assert.Equal(t, "BAD-099", result.Errors[99].SKU)
+}
+
+func TestImportProducts_RejectsInvalidFiles(t *testing.T) {
+	products := service.NewProductService(nil, "")
+
+	for name, csv := range map[string]string{
+		"empty file":       "",
+		"unknown column":   "sku,name,price,colour\n",
+		"duplicate column": "sku,name,price,sku\n",
+		"missing column":   "sku,name\n",
+	} {
+		_, err := products.ImportProducts(strings.NewReader(csv), service.FormatCSV, false, "")
+		assert.Error(t, err, name)
+	}
+
+	_, err := products.ImportProducts(strings.NewReader(""), "xml", false, "")
+	assert.ErrorContains(t, err, "invalid import format")
+}
+
+func TestImportProducts_ValidRowsAreWrittenDespiteErrors(t *testing.T) {
+	db := SetupTestDB(t)
+	products := service.NewProductService(db, "")
+	CreateTestProduct(t, db, "IMP-001", 5, 1)
+	csv := "sku,name,price,quantity\nIMP-001,Widget,6,2\nIMP-002,Gadget,7,3\nIMP-003,Gizmo,free,1\n"
+
+	result, err := products.ImportProducts(strings.NewReader(csv), service.FormatCSV, true, "")
+	require.NoError(t, err)
+	assert.Equal(t, &models.ImportResult{
+		DryRun: true, Processed: 3, Created: 1, Updated: 1, Failed: 1, Errors: result.Errors,
+	}, result)
+
+	result, err = products.ImportProducts(strings.NewReader(csv), service.FormatCSV, false, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, map[int][]string{4: {"price"}}, importErrorFields(result))
+
+	var updated models.Product
+	require.NoError(t, db.Where("sku = ?", "IMP-001").First(&updated).Error)
+	assert.Equal(t, 6.0, updated.Price)
+	assert.Equal(t, 2, updated.Quantity)
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"order-api-stat/models"
+	"order-api-stat/service"
+)
+
+// createCatalogProduct creates a product in category with stock and a
+// description for the search and filter tests
+func createCatalogProduct(t *testing.T, db *gorm.DB, sku, name, description, category string, price float64, quantity int) {
+	t.Helper()
+	_, err := service.NewProductService(db, "").CreateProduct(&models.CreateProductRequest{
+		Name:        name,
+		Description: description,
+		Price:       price,
+		Quantity:    quantity,
+		Category:    category,
+		SKU:         sku,
+	}, "")
+	require.NoError(t, err)
+}
+
+// listSKUs runs GET target and returns the listed products' SKUs in order
+func listSKUs(t *testing.T, handler http.HandlerFunc, target string) (models.ProductListResponse, []string) {
+	t.Helper()
+	rec := Serve(handler, NewTestRequest(t, http.MethodGet, target, nil))
+	require.Equal(t, http.StatusOK, rec.Code, "GET %s: %s", target, rec.Body.String())
+
+	var list models.ProductListResponse
+	DecodeResponse(t, rec, &list)
+	skus := make([]string, len(list.Products))
+	for i, product := range list.Products {
+		skus[i] = product.SKU
+	}
+	return list, skus
+}
+
+func TestListProducts_SearchAndFilters(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := NewTestProductHandler(db)
+	createCatalogProduct(t, db, "MOUSE-001", "Wireless Mouse", "Ergonomic mouse with a USB receiver", "Electronics", 25, 5)
+	createCatalogProduct(t, db, "KEYB-001", "Wired Keyboard", "Mechanical keyboard", "Electronics", 45, 0)
+	createCatalogProduct(t, db, "CHRG-001", "Wireless Charger", "Charging pad for phones", "Accessories", 15, 3)
+	createCatalogProduct(t, db, "LAMP-001", "Desk Lamp", "LED lamp with a wireless charging base", "Home", 60, 2)
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{"SearchNameAndDescription", "/products?q=wireless&sort=price", []string{"CHRG-001", "MOUSE-001", "LAMP-001"}},
+		{"SearchExcludesWords", "/products?q=wireless%20-lamp&sort=price", []string{"CHRG-001", "MOUSE-001"}},
+		{"SearchBySKU", "/products?q=KEYB-001", []string{"KEYB-001"}},
+		{"CategoryByName", "/products?category=Electronics&sort=name", []string{"KEYB-001", "MOUSE-001"}},
+		{"SeveralCategoriesBySlug", "/products?category=electronics,accessories&sort=-price", []string{"KEYB-001", "MOUSE-001", "CHRG-001"}},
+		{"RepeatedCategory", "/products?category=Home&category=Accessories&sort=price", []string{"CHRG-001", "LAMP-001"}},
+		{"PriceRangeIsInclusive", "/products?min_price=25&max_price=45&sort=price", []string{"MOUSE-001", "KEYB-001"}},
+		{"InStock", "/products?in_stock=true&sort=-price", []string{"LAMP-001", "MOUSE-001", "CHRG-001"}},
+		{"SoldOut", "/products?in_stock=false", []string{"KEYB-001"}},
+		{"SearchWithCategoryAndStock", "/products?q=wireless&category=Electronics&in_stock=true", []string{"MOUSE-001"}},
+		{"NoMatches", "/products?q=wireless&max_price=10", []string{}},
+		{"DefaultSortIsID", "/products", []string{"MOUSE-001", "KEYB-001", "CHRG-001", "LAMP-001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, skus := listSKUs(t, handler.ListProducts, tt.target)
+			assert.Equal(t, tt.want, skus)
+			require.NotNil(t, list.Total)
+			assert.Equal(t, int64(len(tt.want)), *list.Total)
+		})
+	}
+
+	t.Run("FiltersAreEchoed", func(t *testing.T) {
+		list, _ := listSKUs(t, handler.ListProducts,
+			"/products?q=wireless&category=Electronics,Accessories&min_price=10&max_price=50&in_stock=true&sort=price")
+		assert.Equal(t, "wireless", list.Query)
+		assert.Equal(t, []string{"Electronics", "Accessories"}, list.Categories)
+		require.NotNil(t, list.MinPrice)
+		assert.Equal(t, 10.0, *list.MinPrice)
+		require.NotNil(t, list.MaxPrice)
+		assert.Equal(t, 50.0, *list.MaxPrice)
+		require.NotNil(t, list.InStock)
+		assert.True(t, *list.InStock)
+		assert.Equal(t, "price", list.Sort)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		list, skus := listSKUs(t, handler.ListProducts, "/products?sort=price&page=2&limit=3")
+		assert.Equal(t, []string{"LAMP-001"}, skus)
+		assert.Equal(t, int64(4), *list.Total)
+		assert.Equal(t, 2, list.Page)
+		assert.Equal(t, 3, list.Limit)
+	})
+
+	t.Run("InvalidPageAndLimitFallBackToDefaults", func(t *testing.T) {
+		list, skus := listSKUs(t, handler.ListProducts, "/products?page=-3&limit=1000")
+		assert.Len(t, skus, 4)
+		assert.Equal(t, 1, list.Page)
+		assert.Equal(t, 10, list.Limit)
+	})
+}
+
+func TestListProducts_SortIsAllowlisted(t *testing.T) {
+	handler := NewTestProductHandler(nil)
+
+	for _, sort := range []string{"quantity", "id", "price%20DESC", "+price", "price%3BDROP%20TABLE%20products", "--price"} {
+		rec := Serve(handler.ListProducts, NewTestRequest(t, http.MethodGet, "/products?sort="+sort, nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code, "sort=%s", sort)
+
+		var body models.ErrorResponse
+		DecodeResponse(t, rec, &body)
+		assert.Contains(t, body.Details, "sort", "sort=%s", sort)
+	}
+
+	t.Run("CursorOnlyByCreationTime", func(t *testing.T) {
+		rec := Serve(handler.ListProducts, NewTestRequest(t, http.MethodGet, "/products?cursor=&sort=price", nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var body models.ErrorResponse
+		DecodeResponse(t, rec, &body)
+		assert.Contains(t, body.Details, "sort")
+	})
+}
+
+func TestListProducts_RejectsInvalidQueryParameters(t *testing.T) {
+	handler := NewTestProductHandler(nil)
+
+	tests := []struct {
+		query string
+		field string
+	}{
+		{"min_price=cheap", "min_price"},
+		{"max_price=NaN", "max_price"},
+		{"max_price=Inf", "max_price"},
+		{"min_price=-1", "min_price"},
+		{"min_price=50&max_price=10", "min_price"},
+		{"in_stock=maybe", "in_stock"},
+		{"deleted=sometimes", "deleted"},
+		{"q=" + strings.Repeat("a", 201), "q"},
+	}
+	for _, tt := range tests {
+		rec := Serve(handler.ListProducts, NewTestRequest(t, http.MethodGet, "/products?"+tt.query, nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code, "?%s", tt.query)
+
+		var body models.ErrorResponse
+		DecodeResponse(t, rec, &body)
+		assert.Equal(t, "Invalid query parameters", body.Error)
+		assert.Contains(t, body.Details, tt.field, "?%s", tt.query)
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orderServiceID is the user ID in the order service's service token
+const orderServiceID = "6f0c3a52-8c1e-4b8e-9d43-2f1f0c6a9b10"
+
+// cartReservationItem and cartReservationRequest mirror the payload the order
+// service's product client sends to POST /reservations
+type cartReservationItem struct {
+	ProductID uint `json:"product_id"`
+	Quantity  int  `json:"quantity"`
+}
+
+type cartReservationRequest struct {
+	Items      []cartReservationItem `json:"items"`
+	TTLSeconds int                   `json:"ttl_seconds"`
+}
+
+// cartReservation mirrors the reservation model the order service decodes
+// reservation responses into
+type cartReservation struct {
+	ID        uint      `json:"id"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// reservationRequest builds a reservation request from userID with role, the
+// way the order service sends it with its service token
+func reservationRequest(t *testing.T, method, target string, body interface{}, userID, role string) *http.Request {
+	return WithActor(NewTestRequest(t, method, target, body), userID, role)
+}
+
+func TestCreateReservation_OrderServiceRequests(t *testing.T) {
+	db := SetupTestDB(t)
+	handler := NewTestReservationHandler(db)
+	first := CreateTestProduct(t, db, "RES-001", 9.99, 10)
+	second := CreateTestProduct(t, db, "RES-002", 5, 3)
+
+	body := cartReservationRequest{
+		Items:      []cartReservationItem{{ProductID: first.ID, Quantity: 2}, {ProductID: second.ID, Quantity: 3}},
+		TTLSeconds: 900,
+	}
+	reserve := func(idempotencyKey string) *http.Request {
+		req := reservationRequest(t, http.MethodPost, "/reservations", body, orderServiceID, "service")
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+		return req
+	}
+
+	rec := Serve(handler.HandleReservations, reserve("order:0b7d5e1e-5a0e-4c1c-a6a4-5b0f51c2a7d3"))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var reservation cartReservation
+	DecodeResponse(t, rec, &reservation)
+	assert.NotZero(t, reservation.ID)
+	assert.Equal(t, "held", reservation.Status)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), reservation.ExpiresAt, time.Minute)
+	path := fmt.Sprintf("/reservations/%d", reservation.ID)
+
+	t.Run("RetryReturnsTheReservation", func(t *testing.T) {
+		rec := Serve(handler.HandleReservations, reserve("order:0b7d5e1e-5a0e-4c1c-a6a4-5b0f51c2a7d3"))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var retried cartReservation
+		DecodeResponse(t, rec, &retried)
+		assert.Equal(t, reservation.ID, retried.ID)
+	})
+
+	t.Run("InsufficientStock", func(t *testing.T) {
+		rec := Serve(handler.HandleReservations, reserve("order:insufficient"))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("ReadsAreScopedToTheOwner", func(t *testing.T) {
+		rec := Serve(handler.HandleReservationByID,
+			reservationRequest(t, http.MethodGet, path, nil, "a1d4f3c2-7b9e-4f0a-8c6d-1e2f3a4b5c6d", "user"))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		for _, role := range []string{"service", "admin"} {
+			userID := orderServiceID
+			if role == "admin" {
+				userID = "a1d4f3c2-7b9e-4f0a-8c6d-1e2f3a4b5c6d"
+			}
+			rec := Serve(handler.HandleReservationByID, reservationRequest(t, http.MethodGet, path, nil, userID, role))
+			assert.Equal(t, http.StatusOK, rec.Code, "role %s: %s", role, rec.Body.String())
+		}
+	})
+
+	t.Run("Confirm", func(t *testing.T) {
+		rec := Serve(handler.HandleReservationByID,
+			reservationRequest(t, http.MethodPost, path+"/confirm", nil, orderServiceID, "service"))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var confirmed cartReservation
+		DecodeResponse(t, rec, &confirmed)
+		assert.Equal(t, "confirmed", confirmed.Status)
+
+		rec = Serve(handler.HandleReservationByID,
+			reservationRequest(t, http.MethodPost, path+"/release", nil, orderServiceID, "service"))
+		assert.Equal(t, http.StatusConflict, rec.Code, "a confirmed reservation cannot be released")
+	})
+}
+
+func TestReservations_RequireServiceOrAdminRole(t *testing.T) {
+	handler := NewTestReservationHandler(nil)
+	body := cartReservationRequest{Items: []cartReservationItem{{ProductID: 1, Quantity: 1}}}
+
+	for _, role := range []string{"user", "support", ""} {
+		rec := Serve(handler.HandleReservations,
+			reservationRequest(t, http.MethodPost, "/reservations", body, "a1d4f3c2-7b9e-4f0a-8c6d-1e2f3a4b5c6d", role))
+		assert.Equal(t, http.StatusForbidden, rec.Code, "create as %q", role)
+
+		for _, action := range []string{"confirm", "release"} {
+			rec := Serve(handler.HandleReservationByID,
+				reservationRequest(t, http.MethodPost, "/reservations/1/"+action, nil, "a1d4f3c2-7b9e-4f0a-8c6d-1e2f3a4b5c6d", role))
+			assert.Equal(t, http.StatusForbidden, rec.Code, "%s as %q", action, role)
+		}
+	}
+}
+
+func TestCreateReservation_RejectsInvalidRequests(t *testing.T) {
+	handler := NewTestReservationHandler(nil)
+
+	tooMany := make([]cartReservationItem, 101)
+	for i := range tooMany {
+		tooMany[i] = cartReservationItem{ProductID: uint(i + 1), Quantity: 1}
+	}
+	bodies := map[string]interface{}{
+		"no items":        cartReservationRequest{},
+		"missing product": cartReservationRequest{Items: []cartReservationItem{{Quantity: 1}}},
+		"zero quantity":   cartReservationRequest{Items: []cartReservationItem{{ProductID: 1}}},
+		"too many items":  cartReservationRequest{Items: tooMany},
+		"string ID":       map[string]interface{}{"items": []map[string]interface{}{{"product_id": "1", "quantity": 1}}},
+		"negative TTL":    cartReservationRequest{Items: []cartReservationItem{{ProductID: 1, Quantity: 1}}, TTLSeconds: -1},
+	}
+	for name, body := range bodies {
+		rec := Serve(handler.HandleReservations,
+			reservationRequest(t, http.MethodPost, "/reservations", body, orderServiceID, "service"))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, name)
+	}
+}
@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"order-api-stat/handlers"
+	"order-api-stat/models"
+)
+
+// saleRequest builds PATCH /products/{id}/quantity for a sale or return
+// recorded by the order service at unitPrice
+func saleRequest(t *testing.T, productID uint, change int, reason string, unitPrice float64, idempotencyKey string) *http.Request {
+	req := NewTestRequest(t, http.MethodPatch, fmt.Sprintf("/products/%d/quantity", productID),
+		map[string]interface{}{"change": change, "reason": reason, "unit_price": unitPrice})
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	return WithActor(req, orderServiceID, "service")
+}
+
+// adjustStock applies req and moves the adjustment it recorded to at
+func adjustStock(t *testing.T, db *gorm.DB, handler *handlers.ProductHandler, req *http.Request, at time.Time) {
+	t.Helper()
+	rec := Serve(handler.HandleProductByID, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, db.Model(&models.StockAdjustment{}).
+		Where("idempotency_key = ?", req.Header.Get("Idempotency-Key")).
+		Update("created_at", at).Error)
+}
+
+// getSalesStats reads GET target from the stats handler as an admin
+func getSalesStats(t *testing.T, handler *handlers.StatsHandler, target string) models.SalesStatsResponse {
+	t.Helper()
+	rec := Serve(handler.HandleStats, asAdmin(NewTestRequest(t, http.MethodGet, target, nil)))
+	require.Equal(t, http.StatusOK, rec.Code, "GET %s: %s", target, rec.Body.String())
+
+	var stats models.SalesStatsResponse
+	DecodeResponse(t, rec, &stats)
+	return stats
+}
+
+// bucketSales returns the revenue and units of each bucket by start date
+func bucketSales(stats models.SalesStatsResponse) (map[string]float64, map[string]int64) {
+	revenue, units := make(map[string]float64), make(map[string]int64)
+	for _, bucket := range stats.Buckets {
+		revenue[bucket.Start] = bucket.Revenue
+		units[bucket.Start] = bucket.UnitsSold
+	}
+	return revenue, units
+}
+
+func TestSalesStats_AggregatesSalesAndReturns(t *testing.T) {
+	db := SetupTestDB(t)
+	products := NewTestProductHandler(db)
+	reservations := NewTestReservationHandler(db)
+	stats := handlers.NewStatsHandler(db)
+	mug := CreateTestProduct(t, db, "MUG-001", 8, 100)
+	tea := CreateTestProduct(t, db, "TEA-001", 4, 100)
+
+	// Monday 4 March 2024: three mugs sold at 8
+	adjustStock(t, db, products, saleRequest(t, mug.ID, -3, "sale", 8, "inventory.decrement:mug-1"),
+		time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC))
+	// Sunday 10 March, late: two mugs sold at 10, still in the week of 4 March
+	adjustStock(t, db, products, saleRequest(t, mug.ID, -2, "sale", 10, "inventory.decrement:mug-2"),
+		time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC))
+	// Monday 11 March: one mug of the first order comes back at its sale price
+	adjustStock(t, db, products, saleRequest(t, mug.ID, 1, "return", 8, "inventory.restock:mug-1"),
+		time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC))
+	// 2 April: five packs of tea sold at 4
+	adjustStock(t, db, products, saleRequest(t, tea.ID, -5, "sale", 4, "inventory.decrement:tea-1"),
+		time.Date(2024, 4, 2, 12, 0, 0, 0, time.UTC))
+
+	// A manual adjustment is not a sale, even with a sale-like key
+	manual := NewTestRequest(t, http.MethodPatch, fmt.Sprintf("/products/%d/quantity", mug.ID), map[string]int{"change": -4})
+	manual.Header.Set("Idempotency-Key", "inventory.decrement:forged")
+	adjustStock(t, db, products, asAdmin(manual), time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC))
+
+	// Tuesday 5 March: a confirmed reservation of two packs of tea at 4
+	req := reservationRequest(t, http.MethodPost, "/reservations",
+		cartReservationRequest{Items: []cartReservationItem{{ProductID: tea.ID, Quantity: 2}}}, orderServiceID, "service")
+	req.Header.Set("Idempotency-Key", "order:tea-2")
+	rec := Serve(reservations.HandleReservations, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var reservation cartReservation
+	DecodeResponse(t, rec, &reservation)
+	rec = Serve(reservations.HandleReservationByID, reservationRequest(t, http.MethodPost,
+		fmt.Sprintf("/reservations/%d/confirm", reservation.ID), nil, orderServiceID, "service"))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, db.Model(&models.Reservation{}).Where("id = ?", reservation.ID).
+		Update("confirmed_at", time.Date(2024, 3, 5, 15, 0, 0, 0, time.UTC)).Error)
+
+	// Later price changes do not revalue past sales
+	require.NoError(t, db.Model(&models.Product{}).Where("id IN ?", []uint{mug.ID, tea.ID}).Update("price", 50).Error)
+
+	t.Run("ByDay", func(t *testing.T) {
+		sales := getSalesStats(t, stats, "/stats/sales?from=2024-03-04&to=2024-03-11&interval=day")
+		assert.Equal(t, "2024-03-04", sales.From)
+		assert.Equal(t, "2024-03-11", sales.To)
+		require.Len(t, sales.Buckets, 8, "every day is reported, with or without sales")
+
+		revenue, units := bucketSales(sales)
+		assert.Equal(t, map[string]float64{
+			"2024-03-04": 24, "2024-03-05": 8, "2024-03-06": 0, "2024-03-07": 0,
+			"2024-03-08": 0, "2024-03-09": 0, "2024-03-10": 20, "2024-03-11": -8,
+		}, revenue)
+		assert.Equal(t, int64(3), units["2024-03-04"])
+		assert.Equal(t, int64(2), units["2024-03-05"], "the manual adjustment is left out")
+		assert.Equal(t, int64(-1), units["2024-03-11"])
+		assert.Equal(t, 44.0, sales.Revenue)
+		assert.Equal(t, int64(6), sales.UnitsSold)
+	})
+
+	t.Run("ByWeek", func(t *testing.T) {
+		sales := getSalesStats(t, stats, "/stats/sales?from=2024-03-01&to=2024-04-30&interval=week")
+		require.Len(t, sales.Buckets, 10)
+		assert.Equal(t, "2024-02-26", sales.Buckets[0].Start, "weeks start on Monday")
+		assert.Equal(t, "2024-04-29", sales.Buckets[9].Start)
+
+		revenue, units := bucketSales(sales)
+		assert.Equal(t, 52.0, revenue["2024-03-04"])
+		assert.Equal(t, int64(7), units["2024-03-04"])
+		assert.Equal(t, -8.0, revenue["2024-03-11"])
+		assert.Equal(t, 20.0, revenue["2024-04-01"])
+		assert.Equal(t, 64.0, sales.Revenue)
+		assert.Equal(t, int64(11), sales.UnitsSold)
+	})
+
+	t.Run("ByMonth", func(t *testing.T) {
+		sales := getSalesStats(t, stats, "/stats/sales?from=2024-03-15&to=2024-04-30&interval=month")
+		require.Len(t, sales.Buckets, 2)
+		assert.Equal(t, "2024-03-01", sales.Buckets[0].Start)
+		assert.Equal(t, "2024-04-01", sales.Buckets[1].Start)
+		assert.Equal(t, -8.0, sales.Buckets[0].Revenue, "only sales from 15 March are counted")
+		assert.Equal(t, 20.0, sales.Buckets[1].Revenue)
+	})
+
+	t.Run("TopProducts", func(t *testing.T) {
+		sales := getSalesStats(t, stats, "/stats/sales?from=2024-03-01&to=2024-04-30&interval=month")
+		require.Len(t, sales.TopProducts, 2)
+		assert.Equal(t, models.TopSoldProduct{ProductID: tea.ID, Name: "Product TEA-001", SKU: "TEA-001", UnitsSold: 7, Revenue: 28},
+			sales.TopProducts[0])
+		assert.Equal(t, models.TopSoldProduct{ProductID: mug.ID, Name: "Product MUG-001", SKU: "MUG-001", UnitsSold: 4, Revenue: 36},
+			sales.TopProducts[1])
+
+		sales = getSalesStats(t, stats, "/stats/sales?from=2024-03-01&to=2024-04-30&interval=month&top=1")
+		require.Len(t, sales.TopProducts, 1)
+		assert.Equal(t, tea.ID, sales.TopProducts[0].ProductID)
+	})
+}
+
+func TestStats_RequireAdminRole(t *testing.T) {
+	handler := handlers.NewStatsHandler(nil)
+
+	for _, role := range []string{"user", "support", "service"} {
+		for _, target := range []string{"/stats/products", "/stats/sales"} {
+			req := WithActor(NewTestRequest(t, http.MethodGet, target, nil), "2b5c9f1e-7d3a-4f6b-8e21-9c0d4a7b3e58", role)
+			rec := Serve(handler.HandleStats, req)
+			assert.Equal(t, http.StatusForbidden, rec.Code, "GET %s as %s", target, role)
+		}
+	}
+}
+
+func TestUpdateProductQuantity_OnlyTheServiceRecordsSales(t *testing.T) {
+	handler := NewTestProductHandler(nil)
+
+	for _, reason := range []string{"sale", "return"} {
+		change := -1
+		if reason == "return" {
+			change = 1
+		}
+		req := saleRequest(t, 1, change, reason, 8, "inventory.forged:1")
+		rec := Serve(handler.HandleProductByID, asAdmin(req))
+		assert.Equal(t, http.StatusForbidden, rec.Code, "%s as admin", reason)
+	}
+}
+
+func TestUpdateProductQuantity_RejectsInvalidSales(t *testing.T) {
+	handler := NewTestProductHandler(nil)
+
+	tests := []struct {
+		name  string
+		req   *http.Request
+		field string
+	}{
+		{"PositiveSale", saleRequest(t, 1, 1, "sale", 8, "inventory.decrement:1"), "change"},
+		{"NegativeReturn", saleRequest(t, 1, -1, "return", 8, "inventory.restock:1"), "change"},
+		{"WithoutIdempotencyKey", saleRequest(t, 1, -1, "sale", 8, ""), "Idempotency-Key"},
+		{"NegativeUnitPrice", saleRequest(t, 1, -1, "sale", -8, "inventory.decrement:1"), "unit_price"},
+		{"UnknownReason", saleRequest(t, 1, -1, "gift", 8, "inventory.decrement:1"), "reason"},
+		{"UnitPriceOnManualChange", asAdmin(NewTestRequest(t, http.MethodPatch, "/products/1/quantity",
+			map[string]interface{}{"change": -1, "unit_price": 8})), "unit_price"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := Serve(handler.HandleProductByID, tt.req)
+			require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+			var body models.ErrorResponse
+			DecodeResponse(t, rec, &body)
+			assert.Contains(t, body.Details, tt.field)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"order-api-stat/config"
+	"order-api-stat/models"
+	"order-api-stat/service"
+	"order-api-stat/service/alerttest"
+)
+
+// alertSecret signs the alerts sent to the fake receiver
+const alertSecret = "alert-test-secret"
+
+// newTestStockAlertService creates a stock alert service that sends its
+// notifications to webhookURL signed with secret
+func newTestStockAlertService(db *gorm.DB, webhookURL, secret string) *service.StockAlertService {
+	notifier := service.NewWebhookNotifier(webhookURL, secret, time.Second)
+	return service.NewStockAlertService(db, notifier, config.AlertsConfig{
+		CheckInterval: time.Minute,
+		BatchSize:     10,
+	})
+}
+
+// createAlertedProduct creates a product that is alerted about at or below
+// threshold units
+func createAlertedProduct(t *testing.T, db *gorm.DB, sku string, quantity, threshold int) *models.Product {
+	t.Helper()
+	product, err := service.NewProductService(db, "").CreateProduct(&models.CreateProductRequest{
+		Name:             "Product " + sku,
+		Price:            10,
+		Quantity:         quantity,
+		SKU:              sku,
+		ReorderThreshold: threshold,
+	}, "")
+	require.NoError(t, err)
+	return product
+}
+
+// setQuantity sets a product's stock directly, as a stock change would
+func setQuantity(t *testing.T, db *gorm.DB, productID uint, quantity int) {
+	t.Helper()
+	require.NoError(t, db.Model(&models.Product{}).Where("id = ?", productID).Update("quantity", quantity).Error)
+}
+
+func TestStockAlerts_NotifyOncePerShortage(t *testing.T) {
+	db := SetupTestDB(t)
+	receiver := alerttest.NewServer(alertSecret)
+	t.Cleanup(receiver.Close)
+	alerts := newTestStockAlertService(db, receiver.WebhookURL(), alertSecret)
+	ctx := context.Background()
+
+	low := createAlertedProduct(t, db, "LOW-001", 3, 5)
+	createAlertedProduct(t, db, "FULL-001", 20, 5)
+	createAlertedProduct(t, db, "OFF-001", 0, 0)
+
+	// The receiver only accepts alerts whose signature verifies
+	require.NoError(t, alerts.Check(ctx))
+	received := receiver.Alerts()
+	require.Len(t, received, 1)
+	first := received[0]
+	assert.Equal(t, models.LowStockEventType, first.Type)
+	assert.NotZero(t, first.AlertID)
+	assert.Equal(t, low.ID, first.ProductID)
+	assert.Equal(t, "LOW-001", first.SKU)
+	assert.Equal(t, 3, first.Quantity)
+	assert.Equal(t, 5, first.ReorderThreshold)
+
+	t.Run("DuplicatesAreSuppressed", func(t *testing.T) {
+		// Further sales during the same shortage raise no new alert
+		setQuantity(t, db, low.ID, 1)
+		require.NoError(t, alerts.Check(ctx))
+		require.NoError(t, alerts.Check(ctx))
+		assert.Len(t, receiver.Alerts(), 1)
+		assert.Equal(t, 1, receiver.Requests())
+	})
+
+	t.Run("RestockEndsTheShortage", func(t *testing.T) {
+		setQuantity(t, db, low.ID, 6)
+		require.NoError(t, alerts.Check(ctx))
+		assert.Len(t, receiver.Alerts(), 1)
+
+		var alert models.StockAlert
+		require.NoError(t, db.First(&alert, first.AlertID).Error)
+		assert.NotNil(t, alert.ResolvedAt)
+		assert.NotNil(t, alert.NotifiedAt)
+
+		// Running low again is a new shortage
+		setQuantity(t, db, low.ID, 2)
+		require.NoError(t, alerts.Check(ctx))
+		received := receiver.Alerts()
+		require.Len(t, received, 2)
+		assert.Equal(t, low.ID, received[1].ProductID)
+		assert.NotEqual(t, first.AlertID, received[1].AlertID)
+		assert.Equal(t, 2, received[1].Quantity)
+	})
+}
+
+func TestStockAlerts_FailedNotificationsAreRetried(t *testing.T) {
+	db := SetupTestDB(t)
+	receiver := alerttest.NewServer(alertSecret)
+	t.Cleanup(receiver.Close)
+	alerts := newTestStockAlertService(db, receiver.WebhookURL(), alertSecret)
+	ctx := context.Background()
+	product := createAlertedProduct(t, db, "LOW-001", 1, 5)
+
+	receiver.FailNext(1)
+	require.NoError(t, alerts.Check(ctx))
+	assert.Empty(t, receiver.Alerts())
+	assert.Equal(t, 1, receiver.Requests())
+
+	var alert models.StockAlert
+	require.NoError(t, db.Where("product_id = ?", product.ID).First(&alert).Error)
+	assert.Nil(t, alert.NotifiedAt)
+	assert.Contains(t, alert.LastError, "503")
+	assert.True(t, alert.NextAttemptAt.After(time.Now()), "the retry waits for its backoff")
+
+	// Not due yet
+	require.NoError(t, alerts.Check(ctx))
+	assert.Equal(t, 1, receiver.Requests())
+
+	require.NoError(t, db.Model(&alert).Update("next_attempt_at", time.Now()).Error)
+	require.NoError(t, alerts.Check(ctx))
+	received := receiver.Alerts()
+	require.Len(t, received, 1)
+	assert.Equal(t, alert.ID, received[0].AlertID)
+
+	require.NoError(t, db.First(&alert, alert.ID).Error)
+	assert.NotNil(t, alert.NotifiedAt)
+	assert.Equal(t, 2, alert.Attempts)
+	assert.Empty(t, alert.LastError)
+}
+
+func TestWebhookNotifier_Signature(t *testing.T) {
+	event := &models.LowStockEvent{
+		Type:             models.LowStockEventType,
+		AlertID:          7,
+		ProductID:        1,
+		SKU:              "LAP-001",
+		Name:             "Laptop",
+		Quantity:         3,
+		ReorderThreshold: 10,
+		DetectedAt:       time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name           string
+		receiverSecret string
+		notifierSecret string
+		delivered      bool
+	}{
+		{"Signed", alertSecret, alertSecret, true},
+		{"WrongSecret", alertSecret, "another-secret", false},
+		{"Unsigned", alertSecret, "", false},
+		{"ReceiverWithoutSecret", "", alertSecret, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := alerttest.NewReceiver(tt.receiverSecret)
+			server := httptest.NewServer(receiver)
+			t.Cleanup(server.Close)
+
+			notifier := service.NewWebhookNotifier(server.URL+alerttest.WebhookPath, tt.notifierSecret, time.Second)
+			err := notifier.Notify(context.Background(), event)
+			if !tt.delivered {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "401")
+				assert.Empty(t, receiver.Alerts())
+				return
+			}
+			require.NoError(t, err)
+			received := receiver.Alerts()
+			require.Len(t, received, 1)
+			assert.Equal(t, *event, received[0])
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"order-api-stat/config"
+	"order-api-stat/database"
+)
+
+// testDBName is the database the tests run against unless APP_DB_NAME is set
+const testDBName = "order_api_stat_test"
+
+// SetupTestDB connects to the test database, migrates it and registers a
+// cleanup that empties its tables when the test ends. The connection comes
+// from the APP_DB_* variables like the service's. Tests that need a database
+// are skipped when none is reachable.
+func SetupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	if os.Getenv("APP_DB_NAME") == "" {
+		t.Setenv("APP_DB_NAME", testDBName)
+	}
+	cfg, err := config.LoadConfig(".")
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := gorm.Open(postgres.Open(cfg.Database.GetDSN()), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Skipf("Test database %s is not reachable: %v", cfg.Database.DBName, err)
+	}
+
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	CleanupTestDB(t, db)
+	t.Cleanup(func() { CleanupTestDB(t, db) })
+	return db
+}
+
+// CleanupTestDB empties every table the service owns
+func CleanupTestDB(t *testing.T, db *gorm.DB) {
+	err := db.Exec(`TRUNCATE products, categories, stock_adjustments, product_images, product_audits,
+		stock_alerts, reservations, reservation_items RESTART IDENTITY CASCADE`).Error
+	if err != nil {
+		t.Errorf("Failed to clean up test database: %v", err)
+	}
+}
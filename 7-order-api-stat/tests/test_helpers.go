@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"order-api-stat/config"
+	"order-api-stat/handlers"
+	"order-api-stat/models"
+	"order-api-stat/service"
+	"order-api-stat/utils"
+)
+
+// NewTestProductHandler creates a product handler over db without image
+// storage. db may be nil for requests rejected before the database is used.
+func NewTestProductHandler(db *gorm.DB) *handlers.ProductHandler {
+	return handlers.NewProductHandler(db, "test-cursor-secret", nil)
+}
+
+// NewTestReservationHandler creates a reservation handler over db with the
+// default TTLs. db may be nil for requests rejected before the database is
+// used.
+func NewTestReservationHandler(db *gorm.DB) *handlers.ReservationHandler {
+	return handlers.NewReservationHandler(service.NewReservationService(db, config.ReservationsConfig{
+		DefaultTTL:    15 * time.Minute,
+		MaxTTL:        24 * time.Hour,
+		SweepInterval: time.Minute,
+		BatchSize:     100,
+	}))
+}
+
+// CreateTestProduct creates a product with the given SKU, price and stock
+func CreateTestProduct(t *testing.T, db *gorm.DB, sku string, price float64, quantity int) *models.Product {
+	t.Helper()
+	product, err := service.NewProductService(db, "").CreateProduct(&models.CreateProductRequest{
+		Name:     "Product " + sku,
+		Price:    price,
+		Quantity: quantity,
+		SKU:      sku,
+	}, "")
+	require.NoError(t, err)
+	return product
+}
+
+// NewTestRequest builds a request with body encoded as JSON, or no body when
+// body is nil
+func NewTestRequest(t *testing.T, method, target string, body interface{}) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// WithActor returns req as utils.AuthMiddleware passes it on for a token of
+// userID with role
+func WithActor(req *http.Request, userID, role string) *http.Request {
+	ctx := context.WithValue(req.Context(), utils.UserIDKey, userID)
+	ctx = context.WithValue(ctx, utils.RoleKey, role)
+	return req.WithContext(ctx)
+}
+
+// Serve runs req through handler and returns the recorded response
+func Serve(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// DecodeResponse decodes a recorded JSON response into v
+func DecodeResponse(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), "body: %s", rec.Body.String())
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ContextKey is a typed key for request context values
+type ContextKey string
+
+// Context keys set by AuthMiddleware
+const (
+	UserIDKey ContextKey = "user_id"
+	RoleKey   ContextKey = "role"
+)
+
+// AuthMiddleware requires a token signed by the auth service (RS256 or EdDSA,
+// verified against jwks) for every request that modifies data. Reads stay
+// public, except those privateRead reports, which need a token too. When jwks
+// is nil, authentication is disabled.
+func AuthMiddleware(jwks *JWKSCache, privateRead func(r *http.Request) bool, next http.Handler) http.Handler {
+	if jwks == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isRead := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if isRead && !privateRead(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			sendUnauthorized(w, "Authorization header required")
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "), claims, jwks.Keyfunc,
+			jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+		if err != nil || !token.Valid {
+			sendUnauthorized(w, "Invalid token")
+			return
+		}
+
+		userID, _ := claims["user_id"].(string)
+		if userID == "" {
+			sendUnauthorized(w, "Invalid token claims")
+			return
+		}
+		role, _ := claims["role"].(string)
+
+		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		ctx = context.WithValue(ctx, RoleKey, role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// IsUnderPath reports whether path is prefix or below it
+func IsUnderPath(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// sendUnauthorized writes a 401 response in the API's error format
+func sendUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// minJWKSRefreshInterval limits how often an unknown kid or an unreachable
+// auth service can trigger a refetch
+const minJWKSRefreshInterval = 10 * time.Second
+
+// jwk is a single public key in JSON Web Key format
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+// verificationKey is a parsed public key and the algorithm it may verify
+type verificationKey struct {
+	alg string
+	key interface{}
+}
+
+// JWKSCache caches the auth service's JSON Web Key Set. Keys are fetched from
+// url and refreshed after ttl; if the fetch fails they are loaded from file.
+// It duplicates the order service's middleware.JWKSCache, as each service
+// builds on its own; change both together, along with the matching cases in
+// tests/jwks_test.go.
+type JWKSCache struct {
+	url    string
+	file   string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]verificationKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	lastMissAt  time.Time
+}
+
+// NewJWKSCache creates a new JWKS cache. At least one of url and file must be set.
+func NewJWKSCache(url, file string, ttl time.Duration) *JWKSCache {
+	return &JWKSCache{
+		url:    url,
+		file:   file,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   make(map[string]verificationKey),
+	}
+}
+
+// Keyfunc returns the public key for token's kid
+func (c *JWKSCache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.fetchedAt) > c.ttl && time.Since(c.lastAttempt) > minJWKSRefreshInterval {
+		c.refresh()
+	}
+
+	// An unknown kid usually means the auth service rotated its key
+	if _, known := c.keys[kid]; !known && time.Since(c.lastMissAt) > minJWKSRefreshInterval {
+		c.lastMissAt = time.Now()
+		c.refresh()
+	}
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.key, nil
+}
+
+// refresh reloads the key set, keeping the cached keys on failure.
+// Must be called with c.mu held.
+func (c *JWKSCache) refresh() {
+	c.lastAttempt = time.Now()
+
+	var keys map[string]verificationKey
+	var err error
+	if c.url != "" {
+		if keys, err = c.fetch(); err != nil {
+			logrus.WithError(err).WithField("url", c.url).Warn("Failed to fetch JWKS")
+		}
+	}
+	if keys == nil && c.file != "" {
+		if keys, err = c.load(); err != nil {
+			logrus.WithError(err).WithField("file", c.file).Warn("Failed to load JWKS")
+		}
+	}
+	if keys == nil {
+		return
+	}
+
+	c.keys = keys
+	c.fetchedAt = time.Now()
+}
+
+// fetch downloads the key set from the auth service
+func (c *JWKSCache) fetch() (map[string]verificationKey, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+// load reads the key set from the local fallback file
+func (c *JWKSCache) load() (map[string]verificationKey, error) {
+	data, err := os.ReadFile(c.file)
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+// parseJWKS parses a JWKS document, keeping only RS256 and EdDSA keys
+func parseJWKS(data []byte) (map[string]verificationKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]verificationKey)
+	for _, k := range set.Keys {
+		key, err := parseJWK(k)
+		if err != nil {
+			logrus.WithError(err).WithField("kid", k.Kid).Warn("Skipping JWK")
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// parseJWK converts a single JWK into a public key
+func parseJWK(k jwk) (verificationKey, error) {
+	switch {
+	case k.Kty == "RSA" && k.Alg == "RS256":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return verificationKey{}, errors.New("RSA key is shorter than 2048 bits")
+		}
+		return verificationKey{alg: k.Alg, key: key}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519" && k.Alg == "EdDSA":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return verificationKey{}, errors.New("invalid Ed25519 key size")
+		}
+		return verificationKey{alg: k.Alg, key: ed25519.PublicKey(x)}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %q with algorithm %q", k.Kty, k.Alg)
+	}
+}
@@ -58,6 +58,12 @@ func getErrorMessage(field, tag, param string) string {
 		return field + " must be at most " + param + " characters long"
 	case "gt":
 		return field + " must be greater than " + param
+	case "gte":
+		return field + " must be at least " + param
+	case "oneof":
+		return field + " must be one of: " + strings.ReplaceAll(param, " ", ", ")
+	case "ne":
+		return field + " must not be equal to " + param
 	case "email":
 		return field + " must be a valid email address"
 	default:
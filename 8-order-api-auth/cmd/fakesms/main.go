@@ -0,0 +1,29 @@
+// Command fakesms runs the fake SMS provider from service/smstest on a local
+// port, so the auth flow can be exercised without a real provider:
+//
+//	SMS_PROVIDER=webhook SMS_API_URL=http://localhost:8090/messages \
+//	SMS_AUTH_TOKEN=dev-token go run .
+//	curl 'http://localhost:8090/codes?phone=89990009900'
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"order-api-auth/service/smstest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	accountSID := flag.String("account-sid", "ACtest", "accepted Twilio account SID")
+	authToken := flag.String("auth-token", "dev-token", "accepted auth token, also used to sign callbacks")
+	flag.Parse()
+
+	provider := smstest.NewProvider(*accountSID, *authToken)
+
+	log.Printf("Fake SMS provider listening on %s", *addr)
+	log.Printf("  webhook format: SMS_API_URL=http://localhost%s%s", *addr, smstest.WebhookPath)
+	log.Printf("  twilio format:  SMS_API_URL=http://localhost%s SMS_ACCOUNT_SID=%s", *addr, *accountSID)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
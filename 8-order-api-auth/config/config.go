@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,8 +14,17 @@ import (
 type Config struct {
 	Port              string
 	JWTSecret         string
+	JWTSigningAlg     string
+	JWTKeysDir        string
+	JWTActiveKID      string
+	AccessTokenTTL    time.Duration
+	RefreshTokenTTL   time.Duration
 	ProductServiceURL string
 	Database          DatabaseConfig
+	SMS               SMSConfig
+	RateLimit         RateLimitConfig
+	TrustProxyHeaders bool
+	ServiceClients    map[string]string // client ID -> secret for the client credentials grant
 }
 
 // DatabaseConfig represents database configuration
@@ -25,6 +37,28 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// SMSConfig represents SMS provider configuration
+type SMSConfig struct {
+	Provider          string // mock, twilio or webhook
+	APIURL            string // Twilio API base URL or webhook endpoint
+	AccountSID        string
+	AuthToken         string // Twilio auth token or webhook shared secret
+	From              string
+	StatusCallbackURL string // public URL of POST /sms/status
+	Timeout           time.Duration
+	MaxRetries        int
+	RetryBackoff      time.Duration
+}
+
+// RateLimitConfig represents limits for POST /auth/initiate
+type RateLimitConfig struct {
+	PhoneLimit     int // SMS sends per phone per PhoneWindow
+	PhoneWindow    time.Duration
+	IPLimit        int // requests per client IP per IPWindow
+	IPWindow       time.Duration
+	ResendCooldown time.Duration // minimum time between two SMS for one session
+}
+
 const defaultJWTSecret = "your-secret-key-change-in-production"
 
 // LoadConfig загружает конфигурацию из переменных окружения
@@ -36,6 +70,11 @@ func LoadConfig() *Config {
 	config := &Config{
 		Port:              getEnv("PORT", "8080"),
 		JWTSecret:         getEnv("JWT_SECRET", defaultJWTSecret),
+		JWTSigningAlg:     getEnv("JWT_SIGNING_ALG", "HS256"),
+		JWTKeysDir:        getEnv("JWT_KEYS_DIR", "keys"),
+		JWTActiveKID:      getEnv("JWT_ACTIVE_KID", ""),
+		AccessTokenTTL:    getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:   getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
 		ProductServiceURL: getEnv("PRODUCT_SERVICE_URL", "http://localhost:8081"),
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -45,9 +84,29 @@ func LoadConfig() *Config {
 			Name:     getEnv("DB_NAME", "order_api_auth"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		SMS: SMSConfig{
+			Provider:          getEnv("SMS_PROVIDER", "mock"),
+			APIURL:            getEnv("SMS_API_URL", ""),
+			AccountSID:        getEnv("SMS_ACCOUNT_SID", ""),
+			AuthToken:         getEnv("SMS_AUTH_TOKEN", ""),
+			From:              getEnv("SMS_FROM", ""),
+			StatusCallbackURL: getEnv("SMS_STATUS_CALLBACK_URL", ""),
+			Timeout:           getEnvDuration("SMS_TIMEOUT", 5*time.Second),
+			MaxRetries:        getEnvInt("SMS_MAX_RETRIES", 2),
+			RetryBackoff:      getEnvDuration("SMS_RETRY_BACKOFF", 500*time.Millisecond),
+		},
+		RateLimit: RateLimitConfig{
+			PhoneLimit:     getEnvInt("RATE_LIMIT_PHONE_MAX", 5),
+			PhoneWindow:    getEnvDuration("RATE_LIMIT_PHONE_WINDOW", time.Hour),
+			IPLimit:        getEnvInt("RATE_LIMIT_IP_MAX", 20),
+			IPWindow:       getEnvDuration("RATE_LIMIT_IP_WINDOW", time.Hour),
+			ResendCooldown: getEnvDuration("SMS_RESEND_COOLDOWN", time.Minute),
+		},
+		TrustProxyHeaders: getEnv("TRUST_PROXY_HEADERS", "false") == "true",
+		ServiceClients:    getEnvClients("SERVICE_CLIENTS"),
 	}
 
-	if config.JWTSecret == defaultJWTSecret {
+	if config.JWTSigningAlg == "HS256" && config.JWTSecret == defaultJWTSecret {
 		log.Println("WARNING: JWT_SECRET is set to the default placeholder. Set a strong secret via the JWT_SECRET environment variable before deploying to production.")
 	}
 
@@ -61,3 +120,47 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvDuration reads a duration such as "15m" or "720h" from the environment,
+// falling back to the default when unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("WARNING: invalid duration %q for %s, using default %s", value, key, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvClients reads service client credentials from a comma-separated list
+// of "client_id:secret" pairs. Malformed entries and empty secrets are skipped
+// with a warning.
+func getEnvClients(key string) map[string]string {
+	clients := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			log.Printf("WARNING: ignoring malformed entry in %s, expected client_id:secret", key)
+			continue
+		}
+		clients[id] = secret
+	}
+	return clients
+}
+
+// getEnvInt reads a non-negative integer from the environment, falling back to
+// the default when unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+		log.Printf("WARNING: invalid integer %q for %s, using default %d", value, key, defaultValue)
+	}
+	return defaultValue
+}
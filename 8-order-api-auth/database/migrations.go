@@ -12,6 +12,11 @@ func RunMigrations(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Session{},
+		&models.Purchase{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.SMSMessage{},
+		&models.RateLimitHit{},
 	)
 	if err != nil {
 		return err
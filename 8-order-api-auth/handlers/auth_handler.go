@@ -2,8 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
+	"order-api-auth/middleware"
 	"order-api-auth/models"
 	"order-api-auth/service"
 	"order-api-auth/utils"
@@ -11,13 +17,15 @@ import (
 
 // AuthHandler handler for authorization
 type AuthHandler struct {
-	authService service.AuthService
+	authService  service.AuthService
+	tokenService service.TokenService
 }
 
 // NewAuthHandler creates a new authorization handler
-func NewAuthHandler(authService service.AuthService) *AuthHandler {
+func NewAuthHandler(authService service.AuthService, tokenService service.TokenService) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
+		authService:  authService,
+		tokenService: tokenService,
 	}
 }
 
@@ -45,8 +53,18 @@ func (h *AuthHandler) InitiateAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Initiate authorization
-	response, err := h.authService.InitiateAuth(req.Phone)
+	response, err := h.authService.InitiateAuth(req.Phone, clientIP(r))
 	if err != nil {
+		var rateLimitErr *service.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			w.Header().Set("Retry-After", retryAfterSeconds(rateLimitErr.RetryAfter))
+			utils.WriteErrorResponse(w, http.StatusTooManyRequests, "Too many requests, try again later")
+			return
+		}
+		if errors.Is(err, service.ErrSMSDeliveryFailed) {
+			utils.WriteErrorResponse(w, http.StatusBadGateway, "Failed to send verification code")
+			return
+		}
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -96,3 +114,95 @@ func (h *AuthHandler) VerifyCode(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteJSONResponse(w, http.StatusOK, response)
 }
+
+// RefreshToken exchanges a refresh token for a new token pair
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.RefreshToken == "" {
+		utils.WriteValidationErrorResponse(w, &utils.ValidationError{Field: "refresh_token", Message: "Refresh token is required"})
+		return
+	}
+
+	response, err := h.tokenService.Refresh(req.RefreshToken)
+	if err != nil {
+		if isRefreshTokenError(err) {
+			utils.WriteErrorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+// Logout revokes the caller's access token and, optionally, their refresh token family
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Get claims from context (set by auth middleware)
+	claims, ok := r.Context().Value(middleware.ClaimsKey).(*service.Claims)
+	if !ok || claims == nil {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// The body is optional: an empty body only revokes the access token
+	var req models.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	if err := h.tokenService.Logout(claims, req.RefreshToken); err != nil {
+		if isRefreshTokenError(err) {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isRefreshTokenError reports whether err is caused by the presented refresh token
+func isRefreshTokenError(err error) bool {
+	return errors.Is(err, service.ErrInvalidRefreshToken) ||
+		errors.Is(err, service.ErrRefreshTokenExpired) ||
+		errors.Is(err, service.ErrRefreshTokenReused)
+}
+
+// clientIP returns the IP part of the request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfterSeconds formats a wait time for the Retry-After header, rounding
+// up to whole seconds
+func retryAfterSeconds(d time.Duration) string {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"order-api-auth/models"
+)
+
+// newAuthTestRouter wires the token and user routes the same way main.go does
+func newAuthTestRouter(t *testing.T) (*mux.Router, *testAuth) {
+	t.Helper()
+
+	auth := newTestAuth(t)
+	authHandler := NewAuthHandler(nil, auth.tokenService)
+	userHandler := NewUserHandler(auth.store)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("POST")
+
+	protectedRouter := router.PathPrefix("").Subrouter()
+	protectedRouter.Use(auth.authMiddleware.RequireAuth)
+	protectedRouter.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
+	protectedRouter.HandleFunc("/users/me", userHandler.GetCurrentUser).Methods("GET")
+
+	return router, auth
+}
+
+// doPost performs a JSON POST against router with an optional bearer token
+func doPost(router http.Handler, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// refresh performs POST /auth/refresh and decodes a successful response
+func refresh(t *testing.T, router http.Handler, refreshToken string) (*models.TokenResponse, int) {
+	t.Helper()
+
+	rec := doPost(router, "/auth/refresh", "", models.RefreshRequest{RefreshToken: refreshToken})
+	if rec.Code != http.StatusOK {
+		return nil, rec.Code
+	}
+
+	var tokens models.TokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&tokens); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return &tokens, rec.Code
+}
+
+func TestRefreshToken_Rotates(t *testing.T) {
+	router, auth := newAuthTestRouter(t)
+	alice := createTestUser(t, auth.store, "79990000001", models.RoleUser)
+
+	issued, err := auth.tokenService.IssueTokens(alice)
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+
+	rotated, status := refresh(t, router, issued.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh status = %d, want %d", status, http.StatusOK)
+	}
+	if rotated.RefreshToken == issued.RefreshToken || rotated.Token == issued.Token {
+		t.Fatal("refresh did not rotate the token pair")
+	}
+	if rotated.ExpiresIn <= 0 {
+		t.Errorf("expires_in = %d, want > 0", rotated.ExpiresIn)
+	}
+
+	if rec := doGet(router, "/users/me", rotated.Token); rec.Code != http.StatusOK {
+		t.Errorf("new access token rejected: status = %d", rec.Code)
+	}
+
+	if _, status := refresh(t, router, "not-a-refresh-token"); status != http.StatusUnauthorized {
+		t.Errorf("unknown refresh token: status = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshToken_CarriesCurrentRole(t *testing.T) {
+	router, auth := newAuthTestRouter(t)
+	alice := createTestUser(t, auth.store, "79990000001", models.RoleUser)
+
+	issued, err := auth.tokenService.IssueTokens(alice)
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+	if _, err := auth.store.UpdateUserRole(alice.ID, models.RoleSupport); err != nil {
+		t.Fatalf("failed to update role: %v", err)
+	}
+
+	// The role is read from the user record whenever tokens are issued
+	rotated, status := refresh(t, router, issued.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh status = %d, want %d", status, http.StatusOK)
+	}
+	claims, err := auth.jwtService.ValidateToken(rotated.Token)
+	if err != nil {
+		t.Fatalf("failed to validate token: %v", err)
+	}
+	if claims.Role != models.RoleSupport {
+		t.Errorf("role claim = %q, want %q", claims.Role, models.RoleSupport)
+	}
+}
+
+func TestRefreshToken_ReuseRevokesFamily(t *testing.T) {
+	router, auth := newAuthTestRouter(t)
+	alice := createTestUser(t, auth.store, "79990000001", models.RoleUser)
+
+	issued, err := auth.tokenService.IssueTokens(alice)
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+	rotated, status := refresh(t, router, issued.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh status = %d, want %d", status, http.StatusOK)
+	}
+
+	// Presenting the already-rotated token again is treated as theft
+	if _, status := refresh(t, router, issued.RefreshToken); status != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: status = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// The legitimate successor is revoked too, as are the family's access tokens
+	if _, status := refresh(t, router, rotated.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("successor refresh token: status = %d, want %d", status, http.StatusUnauthorized)
+	}
+	for _, token := range []string{issued.Token, rotated.Token} {
+		if rec := doGet(router, "/users/me", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("access token from revoked family: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	router, auth := newAuthTestRouter(t)
+	alice := createTestUser(t, auth.store, "79990000001", models.RoleUser)
+
+	issued, err := auth.tokenService.IssueTokens(alice)
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+
+	rec := doPost(router, "/auth/logout", issued.Token, models.LogoutRequest{RefreshToken: issued.RefreshToken})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("logout status = %d, want %d (body: %s)", rec.Code, http.StatusNoContent, rec.Body.String())
+	}
+
+	if rec := doGet(router, "/users/me", issued.Token); rec.Code != http.StatusUnauthorized {
+		t.Errorf("access token after logout: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if _, status := refresh(t, router, issued.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("refresh token after logout: status = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLogout_RejectsOtherUsersRefreshToken(t *testing.T) {
+	router, auth := newAuthTestRouter(t)
+	alice := createTestUser(t, auth.store, "79990000001", models.RoleUser)
+	bob := createTestUser(t, auth.store, "79990000002", models.RoleUser)
+
+	aliceTokens, _ := auth.tokenService.IssueTokens(alice)
+	bobTokens, _ := auth.tokenService.IssueTokens(bob)
+
+	rec := doPost(router, "/auth/logout", aliceTokens.Token, models.LogoutRequest{RefreshToken: bobTokens.RefreshToken})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("logout status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if rec := doGet(router, "/users/me", aliceTokens.Token); rec.Code != http.StatusOK {
+		t.Errorf("failed logout revoked the caller's access token: status = %d", rec.Code)
+	}
+	if _, status := refresh(t, router, bobTokens.RefreshToken); status != http.StatusOK {
+		t.Errorf("bob's refresh token was revoked by alice: status = %d", status)
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"order-api-auth/service"
+	"order-api-auth/utils"
+)
+
+// JWKSHandler handler for publishing the JWT verification keys
+type JWKSHandler struct {
+	jwtService service.JWTService
+}
+
+// NewJWKSHandler creates a new JWKS handler
+func NewJWKSHandler(jwtService service.JWTService) *JWKSHandler {
+	return &JWKSHandler{
+		jwtService: jwtService,
+	}
+}
+
+// GetJWKS handles GET /.well-known/jwks.json
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Verifiers cache the set; keep the lifetime short so rotations propagate
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSONResponse(w, http.StatusOK, h.jwtService.JWKS())
+}
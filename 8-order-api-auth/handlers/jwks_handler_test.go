@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"order-api-auth/middleware"
+	"order-api-auth/models"
+	"order-api-auth/service"
+	"order-api-auth/storage"
+)
+
+// newAsymmetricTestRouter wires the JWKS and user routes with a key set
+// loaded from dir, backed by store
+func newAsymmetricTestRouter(t *testing.T, algorithm, dir string, store *storage.InMemoryStorage) (*mux.Router, service.JWTService) {
+	t.Helper()
+
+	keySet, err := service.LoadKeySet(dir, algorithm, "")
+	if err != nil {
+		t.Fatalf("failed to load key set: %v", err)
+	}
+
+	jwtService := service.NewAsymmetricJWTService(keySet, 15*time.Minute)
+	tokenService := service.NewTokenService(jwtService, store, store, time.Hour)
+	authMiddleware := middleware.NewAuthMiddleware(jwtService, tokenService)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/.well-known/jwks.json", NewJWKSHandler(jwtService).GetJWKS).Methods("GET")
+	protectedRouter := router.PathPrefix("").Subrouter()
+	protectedRouter.Use(authMiddleware.RequireAuth)
+	protectedRouter.HandleFunc("/users/me", NewUserHandler(store).GetCurrentUser).Methods("GET")
+
+	return router, jwtService
+}
+
+func TestJWKS_AsymmetricSigning(t *testing.T) {
+	for _, algorithm := range []string{service.AlgRS256, service.AlgEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			store := storage.NewInMemoryStorage()
+			router, jwtService := newAsymmetricTestRouter(t, algorithm, t.TempDir(), store)
+			alice := createTestUser(t, store, "79990000001", models.RoleUser)
+
+			rec := doGet(router, "/.well-known/jwks.json", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if cc := rec.Header().Get("Cache-Control"); cc == "" {
+				t.Error("Cache-Control header is not set")
+			}
+
+			var jwks service.JWKSet
+			if err := json.NewDecoder(rec.Body).Decode(&jwks); err != nil {
+				t.Fatalf("failed to decode JWKS: %v", err)
+			}
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Alg != algorithm || jwks.Keys[0].Kid == "" {
+				t.Fatalf("JWKS = %+v, want one %s key", jwks, algorithm)
+			}
+
+			if rec := doGet(router, "/users/me", tokenFor(t, jwtService, alice)); rec.Code != http.StatusOK {
+				t.Errorf("GET /users/me status = %d, want %d", rec.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestJWKS_RejectsHMACTokens(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	router, _ := newAsymmetricTestRouter(t, service.AlgEdDSA, t.TempDir(), store)
+	alice := createTestUser(t, store, "79990000001", models.RoleUser)
+
+	// A token signed with a shared secret must not pass asymmetric verification
+	hmacService := service.NewJWTService("test-secret-key", 15*time.Minute)
+	if rec := doGet(router, "/users/me", tokenFor(t, hmacService, alice)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestJWKS_KeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	store := storage.NewInMemoryStorage()
+	_, oldService := newAsymmetricTestRouter(t, service.AlgEdDSA, dir, store)
+	alice := createTestUser(t, store, "79990000001", models.RoleUser)
+	oldToken := tokenFor(t, oldService, alice)
+
+	// Rotate: move the existing key out, generate a new one, then put the old
+	// key back with an older mtime so the new key becomes active
+	oldKeys, _ := filepath.Glob(filepath.Join(dir, "*.pem"))
+	stash := t.TempDir()
+	for _, path := range oldKeys {
+		if err := os.Rename(path, filepath.Join(stash, filepath.Base(path))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := service.LoadKeySet(dir, service.AlgEdDSA, ""); err != nil {
+		t.Fatalf("failed to generate new key: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	for _, path := range oldKeys {
+		if err := os.Rename(filepath.Join(stash, filepath.Base(path)), path); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, past, past)
+	}
+
+	router, newService := newAsymmetricTestRouter(t, service.AlgEdDSA, dir, store)
+
+	rec := doGet(router, "/.well-known/jwks.json", "")
+	var jwks service.JWKSet
+	if err := json.NewDecoder(rec.Body).Decode(&jwks); err != nil {
+		t.Fatalf("failed to decode JWKS: %v", err)
+	}
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(jwks.Keys))
+	}
+
+	for name, token := range map[string]string{
+		"token signed before rotation": oldToken,
+		"token signed after rotation":  tokenFor(t, newService, alice),
+	} {
+		if rec := doGet(router, "/users/me", token); rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", name, rec.Code, http.StatusOK)
+		}
+	}
+}
@@ -1,17 +1,29 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 
+	"order-api-auth/middleware"
 	"order-api-auth/models"
+	"order-api-auth/storage"
 	"order-api-auth/utils"
 )
 
+// errInsufficientStock is returned when the product service refuses a stock
+// decrement because it would take the quantity below zero.
+var errInsufficientStock = errors.New("insufficient stock")
+
 // ExternalProduct represents a product from the product service
 type ExternalProduct struct {
 	ID          uint    `json:"id"`
@@ -26,12 +38,14 @@ type ExternalProduct struct {
 // PurchaseHandler handler for purchase operations
 type PurchaseHandler struct {
 	productServiceURL string
+	purchaseStorage   storage.PurchaseStorage
 }
 
 // NewPurchaseHandler creates a new purchase handler
-func NewPurchaseHandler(productServiceURL string) *PurchaseHandler {
+func NewPurchaseHandler(productServiceURL string, purchaseStorage storage.PurchaseStorage) *PurchaseHandler {
 	return &PurchaseHandler{
 		productServiceURL: productServiceURL,
+		purchaseStorage:   purchaseStorage,
 	}
 }
 
@@ -68,12 +82,12 @@ func (h *PurchaseHandler) PurchaseProduct(w http.ResponseWriter, r *http.Request
 
 	// Check stock
 	if product.Quantity < req.Quantity {
-		utils.WriteErrorResponse(w, http.StatusBadRequest, "Insufficient stock")
+		utils.WriteErrorResponse(w, http.StatusConflict, "Insufficient stock")
 		return
 	}
 
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(string)
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
 	if !ok || userID == "" {
 		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
@@ -82,18 +96,36 @@ func (h *PurchaseHandler) PurchaseProduct(w http.ResponseWriter, r *http.Request
 	// Calculate total
 	total := product.Price * float64(req.Quantity)
 
-	// Create purchase
-	purchaseID := uuid.New().String()
+	// Record the purchase as pending before touching stock, so every stock
+	// decrement has an audit record even if the request dies halfway through.
 	purchase := &models.Purchase{
-		ID:        purchaseID,
+		ID:        uuid.New().String(),
 		UserID:    userID,
 		ProductID: req.ProductID,
 		Quantity:  req.Quantity,
+		Price:     product.Price,
 		Total:     total,
-		Status:    "completed",
+		Status:    models.PurchaseStatusPending,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	if err := h.purchaseStorage.CreatePurchase(purchase); err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to record purchase")
+		return
+	}
+
+	// Decrement stock in the product service
+	if err := h.decrementStock(req.ProductID, req.Quantity, r.Header.Get("Authorization")); err != nil {
+		h.setPurchaseStatus(purchase, models.PurchaseStatusCancelled)
+		if errors.Is(err, errInsufficientStock) {
+			utils.WriteErrorResponse(w, http.StatusConflict, "Insufficient stock")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusBadGateway, "Failed to update product stock")
+		return
+	}
+
+	h.setPurchaseStatus(purchase, models.PurchaseStatusCompleted)
 
 	// Return response
 	response := models.PurchaseResponse{
@@ -106,11 +138,140 @@ func (h *PurchaseHandler) PurchaseProduct(w http.ResponseWriter, r *http.Request
 	utils.WriteJSONResponse(w, http.StatusOK, response)
 }
 
+// ListPurchases handles GET /purchases
+func (h *PurchaseHandler) ListPurchases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page := 1
+	limit := 10
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	purchases, total, err := h.purchaseStorage.GetPurchasesByUserID(userID, page, limit)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get purchases")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.PurchaseListResponse{
+		Purchases: purchases,
+		Total:     total,
+		Page:      page,
+		Limit:     limit,
+	})
+}
+
+// GetPurchase handles GET /purchases/{id}.
+// Purchases belonging to other users are reported as not found so that
+// purchase IDs cannot be probed.
+func (h *PurchaseHandler) GetPurchase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	purchaseID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(purchaseID); err != nil {
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Purchase not found")
+		return
+	}
+
+	purchase, err := h.purchaseStorage.GetPurchaseByID(purchaseID)
+	if err != nil {
+		if err.Error() == "purchase not found" {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "Purchase not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get purchase")
+		return
+	}
+
+	if purchase.UserID != userID {
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Purchase not found")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, purchase)
+}
+
+// setPurchaseStatus persists a status change. A failure here is logged rather
+// than returned because the stock operation it records has already happened.
+func (h *PurchaseHandler) setPurchaseStatus(purchase *models.Purchase, status string) {
+	purchase.Status = status
+	purchase.UpdatedAt = time.Now()
+	if err := h.purchaseStorage.UpdatePurchaseStatus(purchase.ID, status); err != nil {
+		log.Printf("WARNING: failed to mark purchase %s as %s: %v", purchase.ID, status, err)
+	}
+}
+
+// decrementStock asks the product service to reduce a product's stock. The
+// caller's Authorization header is forwarded because the product service
+// requires a valid token for write operations.
+func (h *PurchaseHandler) decrementStock(productID string, quantity int, authorization string) error {
+	reqURL := fmt.Sprintf("%s/products/%s/quantity", h.productServiceURL, url.PathEscape(productID))
+
+	payload, err := json.Marshal(map[string]int{"change": -quantity})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, reqURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return errInsufficientStock
+	default:
+		return fmt.Errorf("product service returned status %d", resp.StatusCode)
+	}
+}
+
 // getProductFromService fetches product information from the product service
 func (h *PurchaseHandler) getProductFromService(productID string) (*ExternalProduct, error) {
-	url := fmt.Sprintf("%s/products/%s", h.productServiceURL, productID)
+	reqURL := fmt.Sprintf("%s/products/%s", h.productServiceURL, url.PathEscape(productID))
 
-	resp, err := http.Get(url)
+	resp, err := http.Get(reqURL)
 	if err != nil {
 		return nil, err
 	}
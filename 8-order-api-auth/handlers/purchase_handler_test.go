@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"order-api-auth/models"
+	"order-api-auth/service"
+	"order-api-auth/storage"
+)
+
+// fakeProductService is an httptest stand-in for 7-order-api-stat that serves
+// GET /products/{id} and PATCH /products/{id}/quantity.
+type fakeProductService struct {
+	mu       sync.Mutex
+	products map[string]*ExternalProduct
+}
+
+func newFakeProductService(t *testing.T) (*fakeProductService, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeProductService{products: make(map[string]*ExternalProduct)}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeProductService) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "products" {
+		http.NotFound(w, r)
+		return
+	}
+	product, exists := f.products[parts[1]]
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 2:
+		json.NewEncoder(w).Encode(product)
+	case r.Method == http.MethodPatch && len(parts) == 3 && parts[2] == "quantity":
+		var req struct {
+			Change int `json:"change"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if product.Quantity+req.Change < 0 {
+			http.Error(w, "insufficient stock", http.StatusConflict)
+			return
+		}
+		product.Quantity += req.Change
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": product.ID, "quantity": product.Quantity})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeProductService) quantity(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.products[id].Quantity
+}
+
+// newPurchaseTestRouter wires the purchase routes the same way main.go does
+func newPurchaseTestRouter(t *testing.T, productServiceURL string) (*mux.Router, *storage.InMemoryStorage, service.JWTService) {
+	t.Helper()
+
+	auth := newTestAuth(t)
+	purchaseHandler := NewPurchaseHandler(productServiceURL, auth.store)
+
+	router := mux.NewRouter()
+	protectedRouter := router.PathPrefix("").Subrouter()
+	protectedRouter.Use(auth.authMiddleware.RequireAuth)
+	protectedRouter.HandleFunc("/purchase", purchaseHandler.PurchaseProduct).Methods("POST")
+	protectedRouter.HandleFunc("/purchases", purchaseHandler.ListPurchases).Methods("GET")
+	protectedRouter.HandleFunc("/purchases/{id}", purchaseHandler.GetPurchase).Methods("GET")
+
+	return router, auth.store, auth.jwtService
+}
+
+// doPurchase performs POST /purchase
+func doPurchase(router http.Handler, token, productID string, quantity int) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.PurchaseRequest{ProductID: productID, Quantity: quantity})
+	req := httptest.NewRequest(http.MethodPost, "/purchase", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPurchaseProduct_PersistsAndDecrementsStock(t *testing.T) {
+	products, productServer := newFakeProductService(t)
+	products.products["1"] = &ExternalProduct{ID: 1, Name: "Laptop", Price: 100, Quantity: 5}
+
+	router, store, jwtService := newPurchaseTestRouter(t, productServer.URL)
+	alice := createTestUser(t, store, "79990000001", models.RoleUser)
+	token := tokenFor(t, jwtService, alice)
+
+	rec := doPurchase(router, token, "1", 2)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var resp models.PurchaseResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Status != models.PurchaseStatusCompleted || resp.Total != 200 {
+		t.Errorf("response = %+v, want completed with total 200", resp)
+	}
+
+	if got := products.quantity("1"); got != 3 {
+		t.Errorf("product stock = %d, want 3", got)
+	}
+
+	stored, err := store.GetPurchaseByID(resp.PurchaseID)
+	if err != nil {
+		t.Fatalf("purchase was not stored: %v", err)
+	}
+	if stored.UserID != alice.ID || stored.Status != models.PurchaseStatusCompleted || stored.Quantity != 2 {
+		t.Errorf("stored purchase = %+v", stored)
+	}
+}
+
+func TestPurchaseProduct_InsufficientStock(t *testing.T) {
+	products, productServer := newFakeProductService(t)
+	products.products["1"] = &ExternalProduct{ID: 1, Name: "Laptop", Price: 100, Quantity: 1}
+
+	router, store, jwtService := newPurchaseTestRouter(t, productServer.URL)
+	alice := createTestUser(t, store, "79990000001", models.RoleUser)
+
+	rec := doPurchase(router, tokenFor(t, jwtService, alice), "1", 2)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if got := products.quantity("1"); got != 1 {
+		t.Errorf("product stock = %d, want 1", got)
+	}
+}
+
+func TestPurchases_ScopedToUser(t *testing.T) {
+	products, productServer := newFakeProductService(t)
+	products.products["1"] = &ExternalProduct{ID: 1, Name: "Laptop", Price: 100, Quantity: 10}
+
+	router, store, jwtService := newPurchaseTestRouter(t, productServer.URL)
+	alice := createTestUser(t, store, "79990000001", models.RoleUser)
+	bob := createTestUser(t, store, "79990000002", models.RoleUser)
+	aliceToken := tokenFor(t, jwtService, alice)
+	bobToken := tokenFor(t, jwtService, bob)
+
+	var alicePurchase models.PurchaseResponse
+	for i := 0; i < 2; i++ {
+		rec := doPurchase(router, aliceToken, "1", 1)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("purchase status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		json.NewDecoder(rec.Body).Decode(&alicePurchase)
+	}
+	if rec := doPurchase(router, bobToken, "1", 1); rec.Code != http.StatusOK {
+		t.Fatalf("purchase status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	t.Run("list returns only own purchases", func(t *testing.T) {
+		rec := doGet(router, "/purchases", aliceToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var list models.PurchaseListResponse
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if list.Total != 2 || len(list.Purchases) != 2 {
+			t.Fatalf("got %d purchases (total %d), want 2", len(list.Purchases), list.Total)
+		}
+		for _, p := range list.Purchases {
+			if p.UserID != alice.ID {
+				t.Errorf("purchase %s belongs to %s, want %s", p.ID, p.UserID, alice.ID)
+			}
+		}
+	})
+
+	t.Run("owner can read purchase", func(t *testing.T) {
+		rec := doGet(router, "/purchases/"+alicePurchase.PurchaseID, aliceToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("other user gets not found", func(t *testing.T) {
+		rec := doGet(router, "/purchases/"+alicePurchase.PurchaseID, bobToken)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"order-api-auth/config"
+	"order-api-auth/models"
+	"order-api-auth/service"
+)
+
+// initiateFrom performs POST /auth/initiate from the given client address
+func (e *smsTestEnv) initiateFrom(remoteAddr, phone string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.AuthRequest{Phone: phone})
+	req := httptest.NewRequest(http.MethodPost, "/auth/initiate", bytes.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// assertRateLimited checks for a 429 response with a sensible Retry-After
+func assertRateLimited(t *testing.T, rec *httptest.ResponseRecorder, maxWait time.Duration) {
+	t.Helper()
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	seconds, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || seconds < 1 || time.Duration(seconds)*time.Second > maxWait+time.Second {
+		t.Errorf("Retry-After = %q, want 1..%d seconds", rec.Header().Get("Retry-After"), int(maxWait.Seconds()))
+	}
+}
+
+func TestInitiateAuth_ResendCooldown(t *testing.T) {
+	env := newSMSTestEnv(t, service.SMSProviderWebhook, config.RateLimitConfig{ResendCooldown: time.Minute})
+	phone := "79990000001"
+
+	sessionID, status := env.initiate(t, phone)
+	if status != http.StatusOK {
+		t.Fatalf("initiate status = %d, want %d", status, http.StatusOK)
+	}
+
+	assertRateLimited(t, doPost(env.router, "/auth/initiate", "", models.AuthRequest{Phone: phone}), time.Minute)
+	if got := len(env.provider.Messages()); got != 1 {
+		t.Errorf("provider received %d messages, want 1", got)
+	}
+
+	// Once the cooldown has passed the live session is reused
+	session, err := env.store.GetSession(sessionID)
+	if err != nil {
+		t.Fatalf("session not found: %v", err)
+	}
+	session.LastSentAt = time.Now().Add(-2 * time.Minute)
+
+	resentID, status := env.initiate(t, phone)
+	if status != http.StatusOK {
+		t.Fatalf("resend status = %d, want %d", status, http.StatusOK)
+	}
+	if resentID != sessionID {
+		t.Errorf("resend created session %s, want reuse of %s", resentID, sessionID)
+	}
+	messages := env.provider.Messages()
+	if len(messages) != 2 || messages[0].Code != messages[1].Code {
+		t.Errorf("resend should deliver the same code again, got %+v", messages)
+	}
+}
+
+func TestInitiateAuth_PhoneLimit(t *testing.T) {
+	env := newSMSTestEnv(t, service.SMSProviderWebhook, config.RateLimitConfig{
+		PhoneLimit:  2,
+		PhoneWindow: time.Hour,
+	})
+
+	// Different client addresses and formatting of the same number share a limit
+	for i, phone := range []string{"79990000001", "+7 999 000 00 01"} {
+		if rec := env.initiateFrom("192.0.2."+strconv.Itoa(i+1)+":1234", phone); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+
+	assertRateLimited(t, env.initiateFrom("192.0.2.9:1234", "79990000001"), time.Hour)
+	if rec := env.initiateFrom("192.0.2.9:1234", "79990000002"); rec.Code != http.StatusOK {
+		t.Errorf("other phone: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestInitiateAuth_IPLimit(t *testing.T) {
+	env := newSMSTestEnv(t, service.SMSProviderWebhook, config.RateLimitConfig{
+		IPLimit:  2,
+		IPWindow: time.Hour,
+	})
+
+	for i, phone := range []string{"79990000001", "79990000002"} {
+		if rec := env.initiateFrom("192.0.2.1:1234", phone); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+
+	assertRateLimited(t, env.initiateFrom("192.0.2.1:5678", "79990000003"), time.Hour)
+	if got := len(env.provider.Messages()); got != 2 {
+		t.Errorf("provider received %d messages, want 2", got)
+	}
+	if rec := env.initiateFrom("192.0.2.2:1234", "79990000003"); rec.Code != http.StatusOK {
+		t.Errorf("other client: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"order-api-auth/models"
+	"order-api-auth/service"
+	"order-api-auth/utils"
+)
+
+// grantTypeClientCredentials is the only grant POST /auth/token supports
+const grantTypeClientCredentials = "client_credentials"
+
+// ServiceTokenHandler issues access tokens to other services
+type ServiceTokenHandler struct {
+	serviceTokens *service.ServiceTokenService
+}
+
+// NewServiceTokenHandler creates a new service token handler
+func NewServiceTokenHandler(serviceTokens *service.ServiceTokenService) *ServiceTokenHandler {
+	return &ServiceTokenHandler{serviceTokens: serviceTokens}
+}
+
+// IssueToken exchanges a service client's credentials for an access token
+// with the service role
+func (h *ServiceTokenHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.ServiceTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.GrantType != grantTypeClientCredentials {
+		utils.WriteValidationErrorResponse(w, &utils.ValidationError{Field: "grant_type", Message: "Grant type must be client_credentials"})
+		return
+	}
+	if req.ClientID == "" || req.ClientSecret == "" {
+		utils.WriteValidationErrorResponse(w, &utils.ValidationError{Field: "client_id", Message: "Client ID and secret are required"})
+		return
+	}
+
+	response, err := h.serviceTokens.IssueToken(req.ClientID, req.ClientSecret)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidClient) {
+			utils.WriteErrorResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to issue token")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, response)
+}
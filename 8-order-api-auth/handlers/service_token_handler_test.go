@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"order-api-auth/models"
+	"order-api-auth/service"
+)
+
+// newServiceTokenTestRouter wires POST /auth/token the same way main.go does,
+// with one configured client
+func newServiceTokenTestRouter(t *testing.T) (*mux.Router, *testAuth) {
+	t.Helper()
+
+	auth := newTestAuth(t)
+	serviceTokens := service.NewServiceTokenService(auth.jwtService, map[string]string{"order-service": "s3cret"})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/token", NewServiceTokenHandler(serviceTokens).IssueToken).Methods("POST")
+	return router, auth
+}
+
+func TestIssueServiceToken(t *testing.T) {
+	router, auth := newServiceTokenTestRouter(t)
+
+	rec := doPost(router, "/auth/token", "", models.ServiceTokenRequest{
+		GrantType:    "client_credentials",
+		ClientID:     "order-service",
+		ClientSecret: "s3cret",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response models.ServiceTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.ExpiresIn != 15*60 {
+		t.Errorf("expected the access token TTL, got expires_in %d", response.ExpiresIn)
+	}
+
+	claims, err := auth.jwtService.ValidateToken(response.Token)
+	if err != nil {
+		t.Fatalf("issued token does not validate: %v", err)
+	}
+	if claims.Role != models.RoleService {
+		t.Errorf("expected role %q, got %q", models.RoleService, claims.Role)
+	}
+	if claims.UserID != "service:order-service" {
+		t.Errorf("expected user_id service:order-service, got %q", claims.UserID)
+	}
+}
+
+func TestIssueServiceToken_RejectsInvalidRequests(t *testing.T) {
+	router, _ := newServiceTokenTestRouter(t)
+
+	tests := []struct {
+		name    string
+		request models.ServiceTokenRequest
+		status  int
+	}{
+		{"wrong secret", models.ServiceTokenRequest{GrantType: "client_credentials", ClientID: "order-service", ClientSecret: "guess"}, http.StatusUnauthorized},
+		{"unknown client", models.ServiceTokenRequest{GrantType: "client_credentials", ClientID: "other", ClientSecret: "s3cret"}, http.StatusUnauthorized},
+		{"unsupported grant", models.ServiceTokenRequest{GrantType: "password", ClientID: "order-service", ClientSecret: "s3cret"}, http.StatusBadRequest},
+		{"missing secret", models.ServiceTokenRequest{GrantType: "client_credentials", ClientID: "order-service"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doPost(router, "/auth/token", "", tt.request)
+			if rec.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
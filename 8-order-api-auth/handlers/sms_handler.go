@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"order-api-auth/service"
+	"order-api-auth/utils"
+)
+
+// SMSHandler handler for SMS provider callbacks
+type SMSHandler struct {
+	callbackHandler service.SMSCallbackHandler
+}
+
+// NewSMSHandler creates a new SMS handler
+func NewSMSHandler(callbackHandler service.SMSCallbackHandler) *SMSHandler {
+	return &SMSHandler{
+		callbackHandler: callbackHandler,
+	}
+}
+
+// StatusCallback handles POST /sms/status, the delivery-status callback the
+// SMS provider calls when a message is delivered or fails
+func (h *SMSHandler) StatusCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	err := h.callbackHandler.HandleStatusCallback(r)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, service.ErrInvalidCallbackSignature):
+		utils.WriteErrorResponse(w, http.StatusForbidden, "Invalid signature")
+	case errors.Is(err, service.ErrInvalidCallback):
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid callback")
+	case err.Error() == "sms message not found":
+		utils.WriteErrorResponse(w, http.StatusNotFound, "Message not found")
+	default:
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to process callback")
+	}
+}
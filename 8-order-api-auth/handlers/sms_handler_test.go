@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"order-api-auth/config"
+	"order-api-auth/models"
+	"order-api-auth/service"
+	"order-api-auth/service/smstest"
+)
+
+// smsTestEnv is the auth service running against the fake SMS provider
+type smsTestEnv struct {
+	*testAuth
+	router   *mux.Router
+	provider *smstest.Server
+}
+
+// newSMSTestEnv wires the auth, user and SMS callback routes the same way
+// main.go does, with an HTTP SMS provider of the given format. The router is
+// served on a real listener so the fake provider can deliver status callbacks.
+func newSMSTestEnv(t *testing.T, format string, limits config.RateLimitConfig) *smsTestEnv {
+	t.Helper()
+
+	provider := smstest.NewServer("ACtest", "sms-test-token")
+	t.Cleanup(provider.Close)
+
+	router := mux.NewRouter()
+	app := httptest.NewServer(router)
+	t.Cleanup(app.Close)
+
+	cfg := config.SMSConfig{
+		Provider:          format,
+		APIURL:            provider.URL,
+		AccountSID:        "ACtest",
+		AuthToken:         "sms-test-token",
+		From:              "+15550001111",
+		StatusCallbackURL: app.URL + "/sms/status",
+		Timeout:           time.Second,
+		MaxRetries:        2,
+		RetryBackoff:      time.Millisecond,
+	}
+	if format == service.SMSProviderWebhook {
+		cfg.APIURL = provider.WebhookURL()
+	}
+
+	auth := newTestAuth(t)
+	smsService, err := service.NewSMSService(cfg, auth.store)
+	if err != nil {
+		t.Fatalf("failed to create SMS service: %v", err)
+	}
+	authService := service.NewAuthService(auth.store, auth.store, smsService, auth.tokenService, auth.store, limits)
+	authHandler := NewAuthHandler(authService, auth.tokenService)
+
+	router.HandleFunc("/sms/status", NewSMSHandler(smsService.(service.SMSCallbackHandler)).StatusCallback).Methods("POST")
+	router.HandleFunc("/auth/initiate", authHandler.InitiateAuth).Methods("POST")
+	router.HandleFunc("/auth/verify", authHandler.VerifyCode).Methods("POST")
+	protectedRouter := router.PathPrefix("").Subrouter()
+	protectedRouter.Use(auth.authMiddleware.RequireAuth)
+	protectedRouter.HandleFunc("/users/me", NewUserHandler(auth.store).GetCurrentUser).Methods("GET")
+
+	return &smsTestEnv{testAuth: auth, router: router, provider: provider}
+}
+
+// initiate performs POST /auth/initiate and returns the session ID
+func (e *smsTestEnv) initiate(t *testing.T, phone string) (string, int) {
+	t.Helper()
+
+	rec := doPost(e.router, "/auth/initiate", "", models.AuthRequest{Phone: phone})
+	if rec.Code != http.StatusOK {
+		return "", rec.Code
+	}
+	var resp models.AuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp.SessionID, rec.Code
+}
+
+func TestAuthFlow_SMSProviders(t *testing.T) {
+	for _, format := range []string{service.SMSProviderTwilio, service.SMSProviderWebhook} {
+		t.Run(format, func(t *testing.T) {
+			env := newSMSTestEnv(t, format, config.RateLimitConfig{})
+			phone := "79990000001"
+
+			sessionID, status := env.initiate(t, phone)
+			if status != http.StatusOK {
+				t.Fatalf("initiate status = %d, want %d", status, http.StatusOK)
+			}
+
+			code, ok := env.provider.LastCode(phone)
+			if !ok {
+				t.Fatal("fake provider received no code")
+			}
+
+			rec := doPost(env.router, "/auth/verify", "", models.VerifyCodeRequest{SessionID: sessionID, Code: code})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("verify status = %d, want %d (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			var tokens models.TokenResponse
+			if err := json.NewDecoder(rec.Body).Decode(&tokens); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+
+			if rec := doGet(env.router, "/users/me", tokens.Token); rec.Code != http.StatusOK {
+				t.Errorf("GET /users/me status = %d, want %d", rec.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestSMSStatusCallback(t *testing.T) {
+	for _, format := range []string{service.SMSProviderTwilio, service.SMSProviderWebhook} {
+		t.Run(format, func(t *testing.T) {
+			env := newSMSTestEnv(t, format, config.RateLimitConfig{})
+			phone := "79990000001"
+
+			if _, status := env.initiate(t, phone); status != http.StatusOK {
+				t.Fatalf("initiate status = %d, want %d", status, http.StatusOK)
+			}
+			message, _ := env.provider.LastMessage(phone)
+
+			resp, err := env.provider.ReportStatus(message.ID, "delivered")
+			if err != nil {
+				t.Fatalf("failed to send callback: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("callback status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+			}
+
+			stored, err := env.store.GetSMSMessageByProviderID(format, message.ID)
+			if err != nil {
+				t.Fatalf("message was not recorded: %v", err)
+			}
+			if stored.Status != models.SMSStatusDelivered {
+				t.Errorf("status = %q, want %q", stored.Status, models.SMSStatusDelivered)
+			}
+
+			// A late "sent" callback must not undo delivery
+			resp, err = env.provider.ReportStatus(message.ID, "sent")
+			if err != nil {
+				t.Fatalf("failed to send callback: %v", err)
+			}
+			resp.Body.Close()
+			if stored.Status != models.SMSStatusDelivered {
+				t.Errorf("status after late callback = %q, want %q", stored.Status, models.SMSStatusDelivered)
+			}
+		})
+	}
+}
+
+func TestSMSStatusCallback_RejectsUnsignedRequests(t *testing.T) {
+	env := newSMSTestEnv(t, service.SMSProviderWebhook, config.RateLimitConfig{})
+	if _, status := env.initiate(t, "79990000001"); status != http.StatusOK {
+		t.Fatalf("initiate status = %d, want %d", status, http.StatusOK)
+	}
+	message, _ := env.provider.LastMessage("79990000001")
+
+	body := `{"id":"` + message.ID + `","status":"failed"}`
+	req := httptest.NewRequest(http.MethodPost, "/sms/status", strings.NewReader(body))
+	req.Header.Set("X-Signature", "forged")
+	rec := httptest.NewRecorder()
+	env.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestSMSRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		failStatus   int
+		wantStatus   int
+		wantRequests int
+	}{
+		{"recovers from transient errors", 2, http.StatusServiceUnavailable, http.StatusOK, 3},
+		{"retries rate limiting", 1, http.StatusTooManyRequests, http.StatusOK, 2},
+		{"gives up after max retries", 5, http.StatusServiceUnavailable, http.StatusBadGateway, 3},
+		{"does not retry client errors", 1, http.StatusBadRequest, http.StatusBadGateway, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newSMSTestEnv(t, service.SMSProviderWebhook, config.RateLimitConfig{})
+			env.provider.FailNext(tt.failures, tt.failStatus)
+
+			if _, status := env.initiate(t, "79990000001"); status != tt.wantStatus {
+				t.Errorf("initiate status = %d, want %d", status, tt.wantStatus)
+			}
+			if got := env.provider.Requests(); got != tt.wantRequests {
+				t.Errorf("provider received %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
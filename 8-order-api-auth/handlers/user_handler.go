@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"order-api-auth/middleware"
+	"order-api-auth/models"
+	"order-api-auth/storage"
+	"order-api-auth/utils"
+)
+
+// UserHandler handler for user lookups
+type UserHandler struct {
+	userStorage storage.UserStorage
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(userStorage storage.UserStorage) *UserHandler {
+	return &UserHandler{
+		userStorage: userStorage,
+	}
+}
+
+// GetCurrentUser handles GET /users/me
+func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	h.writeUser(w, userID)
+}
+
+// GetUserByID handles GET /users/{id}.
+// Callers may only read their own record unless their token carries the
+// service, support or admin role (used for service-to-service lookups and by
+// support staff looking up customers).
+func (h *UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Get user ID and role from context (set by auth middleware)
+	callerID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || callerID == "" {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	role, _ := r.Context().Value(middleware.RoleKey).(string)
+
+	userID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(userID); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	if userID != callerID && !isPrivilegedRole(role) {
+		utils.WriteErrorResponse(w, http.StatusForbidden, "You can only access your own user record")
+		return
+	}
+
+	h.writeUser(w, userID)
+}
+
+// UpdateUserRole handles PUT /users/{id}/role.
+// Only admins may change roles. The new role is carried by the user's tokens
+// from their next login or refresh on.
+func (h *UserHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		utils.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	callerID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || callerID == "" {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if role, _ := r.Context().Value(middleware.RoleKey).(string); role != models.RoleAdmin {
+		utils.WriteErrorResponse(w, http.StatusForbidden, "Only admins can change user roles")
+		return
+	}
+
+	userID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(userID); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !models.IsValidRole(req.Role) {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Role must be one of user, service, support or admin")
+		return
+	}
+
+	user, err := h.userStorage.UpdateUserRole(userID, req.Role)
+	if err != nil {
+		if err.Error() == "user not found" {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, user)
+}
+
+// writeUser looks up a user and writes it as the response
+func (h *UserHandler) writeUser(w http.ResponseWriter, userID string) {
+	user, err := h.userStorage.GetUserByID(userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			utils.WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, user)
+}
+
+// isPrivilegedRole reports whether role may read other users' records
+func isPrivilegedRole(role string) bool {
+	return role == models.RoleService || role == models.RoleSupport || role == models.RoleAdmin
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"order-api-auth/middleware"
+	"order-api-auth/models"
+	"order-api-auth/service"
+	"order-api-auth/storage"
+)
+
+// testAuth bundles the in-memory storage and token services shared by handler tests
+type testAuth struct {
+	store          *storage.InMemoryStorage
+	jwtService     service.JWTService
+	tokenService   service.TokenService
+	authMiddleware *middleware.AuthMiddleware
+}
+
+// newTestAuth builds the auth stack the same way main.go does, backed by
+// in-memory storage.
+func newTestAuth(t *testing.T) *testAuth {
+	t.Helper()
+
+	store := storage.NewInMemoryStorage()
+	jwtService := service.NewJWTService("test-secret-key", 15*time.Minute)
+	tokenService := service.NewTokenService(jwtService, store, store, time.Hour)
+	return &testAuth{
+		store:          store,
+		jwtService:     jwtService,
+		tokenService:   tokenService,
+		authMiddleware: middleware.NewAuthMiddleware(jwtService, tokenService),
+	}
+}
+
+// newUserTestRouter wires the user routes the same way main.go does
+func newUserTestRouter(t *testing.T) (*mux.Router, *storage.InMemoryStorage, service.JWTService) {
+	t.Helper()
+
+	auth := newTestAuth(t)
+	userHandler := NewUserHandler(auth.store)
+
+	router := mux.NewRouter()
+	protectedRouter := router.PathPrefix("").Subrouter()
+	protectedRouter.Use(auth.authMiddleware.RequireAuth)
+	protectedRouter.HandleFunc("/users/me", userHandler.GetCurrentUser).Methods("GET")
+	protectedRouter.HandleFunc("/users/{id}", userHandler.GetUserByID).Methods("GET")
+	protectedRouter.HandleFunc("/users/{id}/role", userHandler.UpdateUserRole).Methods("PUT")
+
+	return router, auth.store, auth.jwtService
+}
+
+// createTestUser stores a user with the given phone and role
+func createTestUser(t *testing.T, store *storage.InMemoryStorage, phone, role string) *models.User {
+	t.Helper()
+
+	user := &models.User{
+		ID:        uuid.New().String(),
+		Phone:     phone,
+		Role:      role,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+// tokenFor issues a JWT for user
+func tokenFor(t *testing.T, jwtService service.JWTService, user *models.User) string {
+	t.Helper()
+
+	token, _, err := jwtService.GenerateToken(user.ID, user.Phone, user.Role)
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	return token
+}
+
+// doGet performs a GET against router with an optional bearer token
+func doGet(router http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetUserByID(t *testing.T) {
+	router, store, jwtService := newUserTestRouter(t)
+
+	alice := createTestUser(t, store, "79990000001", models.RoleUser)
+	bob := createTestUser(t, store, "79990000002", models.RoleUser)
+	svc := createTestUser(t, store, "79990000003", models.RoleService)
+	admin := createTestUser(t, store, "79990000004", models.RoleAdmin)
+	support := createTestUser(t, store, "79990000005", models.RoleSupport)
+
+	tests := []struct {
+		name       string
+		caller     *models.User
+		path       string
+		wantStatus int
+		wantID     string
+	}{
+		{"own record", alice, "/users/" + alice.ID, http.StatusOK, alice.ID},
+		{"other user's record", alice, "/users/" + bob.ID, http.StatusForbidden, ""},
+		{"service role reads other user", svc, "/users/" + bob.ID, http.StatusOK, bob.ID},
+		{"admin role reads other user", admin, "/users/" + alice.ID, http.StatusOK, alice.ID},
+		{"support role reads other user", support, "/users/" + alice.ID, http.StatusOK, alice.ID},
+		{"unknown user as admin", admin, "/users/" + uuid.New().String(), http.StatusNotFound, ""},
+		{"invalid ID format", alice, "/users/not-a-uuid", http.StatusBadRequest, ""},
+		{"current user", bob, "/users/me", http.StatusOK, bob.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doGet(router, tt.path, tokenFor(t, jwtService, tt.caller))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantID == "" {
+				return
+			}
+
+			var user models.User
+			if err := json.NewDecoder(rec.Body).Decode(&user); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if user.ID != tt.wantID {
+				t.Errorf("user ID = %q, want %q", user.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestGetUserByID_RequiresAuth(t *testing.T) {
+	router, store, _ := newUserTestRouter(t)
+	alice := createTestUser(t, store, "79990000001", models.RoleUser)
+
+	for _, path := range []string{"/users/me", "/users/" + alice.ID} {
+		rec := doGet(router, path, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without token: status = %d, want %d", path, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	rec := doGet(router, "/users/me", "not-a-jwt")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /users/me with invalid token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestGetCurrentUser_DeletedUser(t *testing.T) {
+	router, _, jwtService := newUserTestRouter(t)
+
+	// A valid token for a user that is not in storage
+	ghost := &models.User{ID: uuid.New().String(), Phone: "79990000009", Role: models.RoleUser}
+	rec := doGet(router, "/users/me", tokenFor(t, jwtService, ghost))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// doPut performs a JSON PUT against router with an optional bearer token
+func doPut(router http.Handler, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	router, store, jwtService := newUserTestRouter(t)
+	alice := createTestUser(t, store, "79990000001", models.RoleUser)
+	bob := createTestUser(t, store, "79990000002", models.RoleUser)
+	svc := createTestUser(t, store, "79990000003", models.RoleService)
+	admin := createTestUser(t, store, "79990000004", models.RoleAdmin)
+
+	tests := []struct {
+		name       string
+		caller     *models.User
+		path       string
+		role       string
+		wantStatus int
+	}{
+		{"admin grants support", admin, "/users/" + alice.ID + "/role", models.RoleSupport, http.StatusOK},
+		{"user cannot change roles", bob, "/users/" + bob.ID + "/role", models.RoleAdmin, http.StatusForbidden},
+		{"service cannot change roles", svc, "/users/" + bob.ID + "/role", models.RoleSupport, http.StatusForbidden},
+		{"unknown role", admin, "/users/" + bob.ID + "/role", "superuser", http.StatusBadRequest},
+		{"empty role", admin, "/users/" + bob.ID + "/role", "", http.StatusBadRequest},
+		{"unknown user", admin, "/users/" + uuid.New().String() + "/role", models.RoleSupport, http.StatusNotFound},
+		{"invalid ID format", admin, "/users/not-a-uuid/role", models.RoleSupport, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doPut(router, tt.path, tokenFor(t, jwtService, tt.caller), models.UpdateRoleRequest{Role: tt.role})
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	if user, _ := store.GetUserByID(alice.ID); user.Role != models.RoleSupport {
+		t.Errorf("alice's role = %q, want %q", user.Role, models.RoleSupport)
+	}
+	if user, _ := store.GetUserByID(bob.ID); user.Role != models.RoleUser {
+		t.Errorf("bob's role = %q, want %q", user.Role, models.RoleUser)
+	}
+}
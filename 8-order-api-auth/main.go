@@ -34,17 +34,33 @@ func main() {
 	storage := storage.NewPostgreSQLStorage(db)
 
 	// Initialize services
-	smsService := service.NewMockSMSService()
-	jwtService := service.NewJWTService(cfg.JWTSecret)
-	authService := service.NewAuthService(storage, storage, smsService, jwtService)
+	smsService, err := service.NewSMSService(cfg.SMS, storage)
+	if err != nil {
+		log.Fatalf("Failed to configure SMS provider: %v", err)
+	}
+	var jwtService *service.JWTServiceImpl
+	if cfg.JWTSigningAlg == service.AlgHS256 {
+		jwtService = service.NewJWTService(cfg.JWTSecret, cfg.AccessTokenTTL)
+	} else {
+		keySet, err := service.LoadKeySet(cfg.JWTKeysDir, cfg.JWTSigningAlg, cfg.JWTActiveKID)
+		if err != nil {
+			log.Fatalf("Failed to load JWT signing keys: %v", err)
+		}
+		jwtService = service.NewAsymmetricJWTService(keySet, cfg.AccessTokenTTL)
+	}
+	tokenService := service.NewTokenService(jwtService, storage, storage, cfg.RefreshTokenTTL)
+	authService := service.NewAuthService(storage, storage, smsService, tokenService, storage, cfg.RateLimit)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(authService)
-	purchaseHandler := handlers.NewPurchaseHandler(cfg.ProductServiceURL)
+	authHandler := handlers.NewAuthHandler(authService, tokenService)
+	purchaseHandler := handlers.NewPurchaseHandler(cfg.ProductServiceURL, storage)
+	userHandler := handlers.NewUserHandler(storage)
+	jwksHandler := handlers.NewJWKSHandler(jwtService)
+	serviceTokenHandler := handlers.NewServiceTokenHandler(service.NewServiceTokenService(jwtService, cfg.ServiceClients))
 
 	// Initialize middleware
 	corsMiddleware := middleware.NewCORSMiddleware()
-	authMiddleware := middleware.NewAuthMiddleware(jwtService)
+	authMiddleware := middleware.NewAuthMiddleware(jwtService, tokenService)
 
 	// Create router
 	router := mux.NewRouter()
@@ -52,25 +68,48 @@ func main() {
 	// Apply CORS middleware to all routes
 	router.Use(corsMiddleware.CORS)
 
+	// Take the client IP from proxy headers only when running behind a proxy
+	if cfg.TrustProxyHeaders {
+		router.Use(middleware.NewRealIPMiddleware().RealIP)
+	}
+
+	// Public key set for verifying tokens in other services
+	router.HandleFunc("/.well-known/jwks.json", jwksHandler.GetJWKS).Methods("GET")
+
+	// Delivery-status callbacks from the SMS provider (public, signature-checked)
+	if callbackHandler, ok := smsService.(service.SMSCallbackHandler); ok {
+		router.HandleFunc("/sms/status", handlers.NewSMSHandler(callbackHandler).StatusCallback).Methods("POST")
+	}
+
 	// Auth routes (public)
 	router.HandleFunc("/auth/initiate", authHandler.InitiateAuth).Methods("POST")
 	router.HandleFunc("/auth/verify", authHandler.VerifyCode).Methods("POST")
+	router.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("POST")
+	router.HandleFunc("/auth/token", serviceTokenHandler.IssueToken).Methods("POST")
 
 	// Protected routes (require JWT)
 	protectedRouter := router.PathPrefix("").Subrouter()
 	protectedRouter.Use(authMiddleware.RequireAuth)
+	protectedRouter.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
 	protectedRouter.HandleFunc("/purchase", purchaseHandler.PurchaseProduct).Methods("POST")
+	protectedRouter.HandleFunc("/purchases", purchaseHandler.ListPurchases).Methods("GET")
+	protectedRouter.HandleFunc("/purchases/{id}", purchaseHandler.GetPurchase).Methods("GET")
+	protectedRouter.HandleFunc("/users/me", userHandler.GetCurrentUser).Methods("GET")
+	protectedRouter.HandleFunc("/users/{id}", userHandler.GetUserByID).Methods("GET")
+	protectedRouter.HandleFunc("/users/{id}/role", userHandler.UpdateUserRole).Methods("PUT")
 
-	// Start expired sessions cleanup in background
+	// Start expired sessions and tokens cleanup in background
 	go func() {
 		ticker := time.NewTicker(5 * time.Minute)
 		defer ticker.Stop()
 		for range ticker.C {
 			storage.CleanupExpiredSessions()
+			storage.CleanupExpiredTokens()
+			storage.CleanupExpiredRateLimits()
 		}
 	}()
 
 	// Start server
-	log.Printf("Server starting on port %s", cfg.Port)
+	log.Printf("Server starting on port %s (SMS provider: %s)", cfg.Port, cfg.SMS.Provider)
 	log.Fatal(http.ListenAndServe(":"+cfg.Port, router))
 }
@@ -8,15 +8,28 @@ import (
 	"order-api-auth/service"
 )
 
+// ContextKey is a typed key for context values to prevent collisions with
+// other packages that might use bare string keys.
+type ContextKey string
+
+const (
+	UserIDKey ContextKey = "user_id"
+	PhoneKey  ContextKey = "phone"
+	RoleKey   ContextKey = "role"
+	ClaimsKey ContextKey = "claims"
+)
+
 // AuthMiddleware middleware for JWT authorization
 type AuthMiddleware struct {
-	jwtService service.JWTService
+	jwtService   service.JWTService
+	tokenService service.TokenService
 }
 
 // NewAuthMiddleware creates a new authorization middleware
-func NewAuthMiddleware(jwtService service.JWTService) *AuthMiddleware {
+func NewAuthMiddleware(jwtService service.JWTService, tokenService service.TokenService) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtService: jwtService,
+		jwtService:   jwtService,
+		tokenService: tokenService,
 	}
 }
 
@@ -46,9 +59,22 @@ func (m *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 			return
 		}
 
+		// Reject tokens revoked by logout or refresh token reuse detection
+		revoked, err := m.tokenService.IsRevoked(claims.ID)
+		if err != nil {
+			http.Error(w, "Failed to check token status", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+			return
+		}
+
 		// Add user information to context
-		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-		ctx = context.WithValue(ctx, "phone", claims.Phone)
+		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, PhoneKey, claims.Phone)
+		ctx = context.WithValue(ctx, RoleKey, claims.Role)
+		ctx = context.WithValue(ctx, ClaimsKey, claims)
 
 		// Pass control to next handler
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIPMiddleware rewrites the request's RemoteAddr from proxy headers. Only
+// use it behind a reverse proxy that sets these headers, otherwise clients can
+// spoof their address and bypass per-IP rate limits.
+type RealIPMiddleware struct{}
+
+// NewRealIPMiddleware creates a new real IP middleware
+func NewRealIPMiddleware() *RealIPMiddleware {
+	return &RealIPMiddleware{}
+}
+
+// RealIP sets r.RemoteAddr to X-Real-IP or the first X-Forwarded-For address
+func (m *RealIPMiddleware) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+		if ip == "" {
+			forwarded := r.Header.Get("X-Forwarded-For")
+			ip = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+		if net.ParseIP(ip) != nil {
+			r.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -4,14 +4,22 @@ import (
 	"time"
 )
 
+// Purchase statuses
+const (
+	PurchaseStatusPending   = "pending"
+	PurchaseStatusCompleted = "completed"
+	PurchaseStatusCancelled = "cancelled"
+)
+
 // Purchase represents a purchase transaction
 type Purchase struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	ProductID string    `json:"product_id"`
-	Quantity  int       `json:"quantity"`
-	Total     float64   `json:"total"`
-	Status    string    `json:"status"` // pending, completed, cancelled
+	ID        string    `json:"id" gorm:"type:uuid;primary_key"`
+	UserID    string    `json:"user_id" gorm:"type:uuid;not null;index"`
+	ProductID string    `json:"product_id" gorm:"size:50;not null"`
+	Quantity  int       `json:"quantity" gorm:"not null"`
+	Price     float64   `json:"price" gorm:"type:decimal(10,2);not null"` // Unit price at the time of purchase
+	Total     float64   `json:"total" gorm:"type:decimal(10,2);not null"`
+	Status    string    `json:"status" gorm:"size:20;not null;default:pending"` // pending, completed, cancelled
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -22,6 +30,14 @@ type PurchaseRequest struct {
 	Quantity  int    `json:"quantity" validate:"required,min=1"`
 }
 
+// PurchaseListResponse represents a page of the user's purchases
+type PurchaseListResponse struct {
+	Purchases []Purchase `json:"purchases"`
+	Total     int64      `json:"total"`
+	Page      int        `json:"page"`
+	Limit     int        `json:"limit"`
+}
+
 // PurchaseResponse represents a purchase response
 type PurchaseResponse struct {
 	PurchaseID string  `json:"purchase_id"`
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// RateLimitHit is one request counted against a rate limit key, such as
+// "initiate:phone:79990009900". Hits are kept until their window has passed.
+type RateLimitHit struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	Key       string    `json:"key" gorm:"size:100;not null;index:idx_rate_limit_key_created"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;index:idx_rate_limit_key_created"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// SMS delivery statuses, normalized across providers
+const (
+	SMSStatusQueued    = "queued"
+	SMSStatusSent      = "sent"
+	SMSStatusDelivered = "delivered"
+	SMSStatusFailed    = "failed"
+)
+
+// SMSMessage records an SMS accepted by a provider so that delivery-status
+// callbacks can be matched to it. The message text is not stored because it
+// contains the verification code.
+type SMSMessage struct {
+	ID                string    `json:"id" gorm:"type:uuid;primary_key"`
+	Provider          string    `json:"provider" gorm:"size:20;not null;uniqueIndex:idx_sms_provider_message"`
+	ProviderMessageID string    `json:"provider_message_id" gorm:"size:64;not null;uniqueIndex:idx_sms_provider_message"`
+	Phone             string    `json:"phone" gorm:"size:15;not null;index"`
+	Status            string    `json:"status" gorm:"size:20;not null"`
+	ErrorCode         string    `json:"error_code,omitempty" gorm:"size:20"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken represents an issued refresh token. Only the SHA-256 hash of the
+// opaque token is stored. Tokens issued by rotating one another share a FamilyID,
+// so the whole chain can be revoked at once when reuse is detected.
+type RefreshToken struct {
+	ID                   string     `json:"id" gorm:"type:uuid;primary_key"`
+	UserID               string     `json:"user_id" gorm:"type:uuid;not null;index"`
+	FamilyID             string     `json:"family_id" gorm:"type:uuid;not null;index"`
+	TokenHash            string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	AccessTokenID        string     `json:"-" gorm:"size:36"` // jti of the access token issued alongside
+	AccessTokenExpiresAt time.Time  `json:"-"`
+	ExpiresAt            time.Time  `json:"expires_at" gorm:"not null"`
+	CreatedAt            time.Time  `json:"created_at"`
+	RevokedAt            *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID         string     `json:"replaced_by_id,omitempty" gorm:"size:36"`
+}
+
+// RevokedToken represents a revoked access token, identified by its jti claim.
+// Entries are kept only until the access token would have expired anyway.
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"size:36;primary_key"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RefreshRequest represents a token refresh request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// ServiceTokenRequest represents a client credentials grant request, made by
+// another service to get an access token with the service role
+type ServiceTokenRequest struct {
+	GrantType    string `json:"grant_type" validate:"required"`
+	ClientID     string `json:"client_id" validate:"required"`
+	ClientSecret string `json:"client_secret" validate:"required"`
+}
+
+// ServiceTokenResponse represents an access token issued to a service. There
+// is no refresh token: the service asks for a new token with its credentials.
+type ServiceTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+// LogoutRequest represents a logout request. The refresh token is optional;
+// when present its whole token family is revoked as well.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
@@ -4,23 +4,47 @@ import (
 	"time"
 )
 
+// User roles
+const (
+	RoleUser    = "user"
+	RoleService = "service"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// IsValidRole reports whether role is one of the roles a user can hold
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleService, RoleSupport, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 // User represents a user in the system
 type User struct {
 	ID        string    `json:"id" gorm:"type:uuid;primary_key"`
 	Phone     string    `json:"phone" gorm:"size:15;uniqueIndex;not null"`
+	Role      string    `json:"role" gorm:"size:20;not null;default:user"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // Session represents an authorization session
 type Session struct {
-	ID        string    `json:"id" gorm:"type:uuid;primary_key"`
-	Phone     string    `json:"phone" gorm:"size:15;not null"`
-	Code      string    `json:"code" gorm:"size:4;not null"`
-	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at"`
-	IsUsed    bool      `json:"is_used" gorm:"default:false"`
-	Attempts  int       `json:"attempts" gorm:"default:0"`
+	ID         string    `json:"id" gorm:"type:uuid;primary_key"`
+	Phone      string    `json:"phone" gorm:"size:15;not null;index"`
+	Code       string    `json:"code" gorm:"size:4;not null"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSentAt time.Time `json:"last_sent_at"` // when the code was last sent, for the resend cooldown
+	IsUsed     bool      `json:"is_used" gorm:"default:false"`
+	Attempts   int       `json:"attempts" gorm:"default:0"`
+}
+
+// UpdateRoleRequest represents a request to change a user's role
+type UpdateRoleRequest struct {
+	Role string `json:"role" validate:"required"`
 }
 
 // AuthRequest represents an authorization request
@@ -39,9 +63,11 @@ type AuthResponse struct {
 	SessionID string `json:"sessionId"`
 }
 
-// TokenResponse represents a response with JWT token
+// TokenResponse represents a response with JWT access and refresh tokens
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
 }
 
 // ErrorResponse represents an error response
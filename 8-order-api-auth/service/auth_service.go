@@ -3,19 +3,32 @@ package service
 import (
 	"crypto/subtle"
 	"errors"
+	"regexp"
 	"time"
 
 	"github.com/google/uuid"
 
+	"order-api-auth/config"
 	"order-api-auth/models"
 	"order-api-auth/storage"
 )
 
 const maxCodeAttempts = 5
 
+var nonDigits = regexp.MustCompile(`\D`)
+
+// RateLimitError is returned when a client has to wait before retrying
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "too many requests"
+}
+
 // AuthService interface for authorization
 type AuthService interface {
-	InitiateAuth(phone string) (*models.AuthResponse, error)
+	InitiateAuth(phone, clientIP string) (*models.AuthResponse, error)
 	VerifyCode(sessionID, code string) (*models.TokenResponse, error)
 }
 
@@ -24,7 +37,9 @@ type AuthServiceImpl struct {
 	userStorage    storage.UserStorage
 	sessionStorage storage.SessionStorage
 	smsService     SMSService
-	jwtService     JWTService
+	tokenService   TokenService
+	rateLimiter    storage.RateLimiter
+	limits         config.RateLimitConfig
 }
 
 // NewAuthService creates a new authorization service
@@ -32,18 +47,52 @@ func NewAuthService(
 	userStorage storage.UserStorage,
 	sessionStorage storage.SessionStorage,
 	smsService SMSService,
-	jwtService JWTService,
+	tokenService TokenService,
+	rateLimiter storage.RateLimiter,
+	limits config.RateLimitConfig,
 ) *AuthServiceImpl {
 	return &AuthServiceImpl{
 		userStorage:    userStorage,
 		sessionStorage: sessionStorage,
 		smsService:     smsService,
-		jwtService:     jwtService,
+		tokenService:   tokenService,
+		rateLimiter:    rateLimiter,
+		limits:         limits,
 	}
 }
 
-// InitiateAuth initiates authorization process
-func (a *AuthServiceImpl) InitiateAuth(phone string) (*models.AuthResponse, error) {
+// InitiateAuth initiates authorization process. Requests are limited per
+// client IP and per phone, and while a session for the phone is still live its
+// code is resent (at most once per resend cooldown) instead of creating a new
+// session.
+func (a *AuthServiceImpl) InitiateAuth(phone, clientIP string) (*models.AuthResponse, error) {
+	// Per-IP limit first, so one client cannot spray SMS across many numbers
+	if err := a.checkLimit("initiate:ip:"+clientIP, a.limits.IPLimit, a.limits.IPWindow); err != nil {
+		return nil, err
+	}
+
+	session, err := a.sessionStorage.GetActiveSessionByPhone(phone)
+	if err != nil {
+		if err.Error() != "session not found" {
+			return nil, err
+		}
+		session = nil
+	}
+	// A locked session is never reused; the user needs a fresh code
+	if session != nil && session.Attempts >= maxCodeAttempts {
+		session = nil
+	}
+	if session != nil {
+		if wait := time.Until(session.LastSentAt.Add(a.limits.ResendCooldown)); wait > 0 {
+			return nil, &RateLimitError{RetryAfter: wait}
+		}
+	}
+
+	// Every SMS counts against the phone, whether it is a resend or not
+	if err := a.checkLimit("initiate:phone:"+nonDigits.ReplaceAllString(phone, ""), a.limits.PhoneLimit, a.limits.PhoneWindow); err != nil {
+		return nil, err
+	}
+
 	// Check if user exists; only create one when record is genuinely absent
 	user, err := a.userStorage.GetUserByPhone(phone)
 	if err != nil {
@@ -53,6 +102,7 @@ func (a *AuthServiceImpl) InitiateAuth(phone string) (*models.AuthResponse, erro
 		user = &models.User{
 			ID:        uuid.New().String(),
 			Phone:     phone,
+			Role:      models.RoleUser,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
@@ -61,6 +111,19 @@ func (a *AuthServiceImpl) InitiateAuth(phone string) (*models.AuthResponse, erro
 		}
 	}
 
+	// Resend the live session's code
+	if session != nil {
+		if err := a.smsService.SendCode(phone, session.Code); err != nil {
+			return nil, err
+		}
+		if err := a.sessionStorage.UpdateSessionSentAt(session.ID, time.Now()); err != nil {
+			return nil, err
+		}
+		return &models.AuthResponse{
+			SessionID: session.ID,
+		}, nil
+	}
+
 	// Generate verification code and send SMS before persisting the session,
 	// so a failed SMS does not leave an orphaned session in the DB.
 	code := a.smsService.GenerateCode()
@@ -69,13 +132,15 @@ func (a *AuthServiceImpl) InitiateAuth(phone string) (*models.AuthResponse, erro
 	}
 
 	sessionID := uuid.New().String()
-	session := &models.Session{
-		ID:        sessionID,
-		Phone:     phone,
-		Code:      code,
-		ExpiresAt: time.Now().Add(5 * time.Minute),
-		CreatedAt: time.Now(),
-		IsUsed:    false,
+	now := time.Now()
+	session = &models.Session{
+		ID:         sessionID,
+		Phone:      phone,
+		Code:       code,
+		ExpiresAt:  now.Add(5 * time.Minute),
+		CreatedAt:  now,
+		LastSentAt: now,
+		IsUsed:     false,
 	}
 	if err := a.sessionStorage.CreateSession(session); err != nil {
 		return nil, err
@@ -86,6 +151,23 @@ func (a *AuthServiceImpl) InitiateAuth(phone string) (*models.AuthResponse, erro
 	}, nil
 }
 
+// checkLimit counts a hit against key and returns a RateLimitError when the
+// limit is exhausted. A limit of zero disables the check.
+func (a *AuthServiceImpl) checkLimit(key string, limit int, window time.Duration) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	allowed, retryAfter, err := a.rateLimiter.Allow(key, limit, window)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &RateLimitError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
 // VerifyCode verifies confirmation code
 func (a *AuthServiceImpl) VerifyCode(sessionID, code string) (*models.TokenResponse, error) {
 	// Get session
@@ -126,13 +208,6 @@ func (a *AuthServiceImpl) VerifyCode(sessionID, code string) (*models.TokenRespo
 		return nil, err
 	}
 
-	// Generate JWT token
-	token, err := a.jwtService.GenerateToken(user.ID, user.Phone)
-	if err != nil {
-		return nil, err
-	}
-
-	return &models.TokenResponse{
-		Token: token,
-	}, nil
+	// Issue access and refresh tokens
+	return a.tokenService.IssueTokens(user)
 }
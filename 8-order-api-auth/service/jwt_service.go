@@ -5,65 +5,129 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // JWTService interface for working with JWT tokens
 type JWTService interface {
-	GenerateToken(userID, phone string) (string, error)
+	GenerateToken(userID, phone, role string) (string, *Claims, error)
 	ValidateToken(tokenString string) (*Claims, error)
+	JWKS() *JWKSet
 }
 
 // Claims represents claims in JWT token
 type Claims struct {
 	UserID string `json:"user_id"`
 	Phone  string `json:"phone"`
+	Role   string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWTServiceImpl JWT service implementation
+// JWTServiceImpl JWT service implementation. It signs either with a shared
+// HMAC secret (HS256) or, when a key set is configured, with the key set's
+// active RSA (RS256) or Ed25519 (EdDSA) key.
 type JWTServiceImpl struct {
-	secretKey []byte
+	secretKey      []byte
+	keySet         *KeySet
+	accessTokenTTL time.Duration
 }
 
-// NewJWTService creates a new JWT service
-func NewJWTService(secretKey string) *JWTServiceImpl {
+// NewJWTService creates a new JWT service that signs with an HMAC secret
+func NewJWTService(secretKey string, accessTokenTTL time.Duration) *JWTServiceImpl {
 	return &JWTServiceImpl{
-		secretKey: []byte(secretKey),
+		secretKey:      []byte(secretKey),
+		accessTokenTTL: accessTokenTTL,
 	}
 }
 
-// GenerateToken generates JWT token for user
-func (j *JWTServiceImpl) GenerateToken(userID, phone string) (string, error) {
+// NewAsymmetricJWTService creates a new JWT service that signs with the active
+// key of keySet and publishes the public keys as a JWKS
+func NewAsymmetricJWTService(keySet *KeySet, accessTokenTTL time.Duration) *JWTServiceImpl {
+	return &JWTServiceImpl{
+		keySet:         keySet,
+		accessTokenTTL: accessTokenTTL,
+	}
+}
+
+// GenerateToken generates a short-lived JWT access token for user and returns
+// it together with the claims it carries. Every token gets a unique jti so it
+// can be revoked individually.
+func (j *JWTServiceImpl) GenerateToken(userID, phone, role string) (string, *Claims, error) {
+	now := time.Now()
 	claims := &Claims{
 		UserID: userID,
 		Phone:  phone,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token valid for 24 hours
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.accessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secretKey)
+	var tokenString string
+	var err error
+	if j.keySet != nil {
+		key := j.keySet.Active()
+		token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+		token.Header["kid"] = key.KID
+		tokenString, err = token.SignedString(key.PrivateKey)
+	} else {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		tokenString, err = token.SignedString(j.secretKey)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, claims, nil
 }
 
 // ValidateToken validates JWT token and returns claims
 func (j *JWTServiceImpl) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return j.secretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, j.keyFunc)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		if claims.ID == "" {
+			return nil, errors.New("token has no jti claim")
+		}
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
+
+// JWKS returns the public signing keys. It is empty in HS256 mode, since the
+// HMAC secret must never be published.
+func (j *JWTServiceImpl) JWKS() *JWKSet {
+	if j.keySet == nil {
+		return &JWKSet{Keys: []JWK{}}
+	}
+	return j.keySet.JWKS()
+}
+
+// keyFunc returns the verification key for token. In asymmetric mode the key
+// is looked up by the kid header and must match the token's algorithm, so an
+// HS256 token can never be verified using a public key as the HMAC secret.
+func (j *JWTServiceImpl) keyFunc(token *jwt.Token) (interface{}, error) {
+	if j.keySet == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return j.secretKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := j.keySet.Get(kid)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.PrivateKey.Public(), nil
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Supported JWT signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is a private key used to sign JWTs, identified by its key ID
+type SigningKey struct {
+	KID        string
+	Algorithm  string
+	PrivateKey crypto.Signer
+}
+
+// KeySet holds every key whose public half is published in the JWKS. Only the
+// active key signs new tokens; the others stay available for verification so
+// tokens signed before a rotation remain valid until they expire.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// JWK is a single public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKSet is a JSON Web Key Set as served from /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet loads every PEM-encoded private key (*.pem) from dir. The key ID
+// of each key is its file name without the extension. If dir contains no keys,
+// a new key for algorithm is generated and written there so it survives
+// restarts. activeKID selects the signing key; when empty, the most recently
+// modified key file is used.
+func LoadKeySet(dir, algorithm, activeKID string) (*KeySet, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		path, err := generateKeyFile(dir, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		paths = []string{path}
+	}
+
+	// Oldest first, so the newest file wins when no active key is configured
+	sort.Slice(paths, func(i, j int) bool {
+		return modTime(paths[i]) < modTime(paths[j])
+	})
+
+	keySet := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, path := range paths {
+		key, err := loadKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %w", path, err)
+		}
+		keySet.keys[key.KID] = key
+		keySet.active = key
+	}
+
+	if activeKID != "" {
+		key, ok := keySet.keys[activeKID]
+		if !ok {
+			return nil, fmt.Errorf("active key %q not found in %s", activeKID, dir)
+		}
+		keySet.active = key
+	}
+
+	log.Printf("Loaded %d JWT signing key(s), active key %s (%s)", len(keySet.keys), keySet.active.KID, keySet.active.Algorithm)
+	return keySet, nil
+}
+
+// Active returns the key used to sign new tokens
+func (k *KeySet) Active() *SigningKey {
+	return k.active
+}
+
+// Get returns the key with the given key ID
+func (k *KeySet) Get(kid string) (*SigningKey, bool) {
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// JWKS returns the public halves of all keys in the set
+func (k *KeySet) JWKS() *JWKSet {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := &JWKSet{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := k.keys[kid]
+		jwk := JWK{Kid: key.KID, Use: "sig", Alg: key.Algorithm}
+		switch pub := key.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// loadKeyFile parses a PKCS#8 (or PKCS#1 RSA) PEM private key
+func loadKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return &SigningKey{KID: kid, Algorithm: AlgRS256, PrivateKey: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{KID: kid, Algorithm: AlgEdDSA, PrivateKey: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// generateKeyFile creates a new private key for algorithm in dir and returns
+// its path. The key ID is derived from a hash of the public key.
+func generateKeyFile(dir, algorithm string) (string, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(publicDER)
+	kid := hex.EncodeToString(sum[:8])
+
+	path := filepath.Join(dir, kid+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write key: %w", err)
+	}
+
+	log.Printf("Generated new %s signing key %s in %s", algorithm, kid, dir)
+	return path, nil
+}
+
+// modTime returns the modification time of path in nanoseconds, or 0
+func modTime(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"order-api-auth/config"
+	"order-api-auth/models"
+	"order-api-auth/storage"
+)
+
+// Supported SMS providers
+const (
+	SMSProviderMock    = "mock"
+	SMSProviderTwilio  = "twilio"
+	SMSProviderWebhook = "webhook"
+)
+
+const (
+	defaultTwilioAPIURL = "https://api.twilio.com"
+
+	// smsCodeMessage is the text of the verification SMS
+	smsCodeMessage = "Your verification code is %s"
+
+	// maxCallbackBodySize limits the size of delivery-status callbacks
+	maxCallbackBodySize = 64 << 10
+)
+
+var (
+	// ErrSMSDeliveryFailed is returned when the provider did not accept a
+	// message, even after retries.
+	ErrSMSDeliveryFailed = errors.New("failed to send SMS")
+
+	// ErrInvalidCallbackSignature is returned for delivery-status callbacks
+	// that are not signed by the provider.
+	ErrInvalidCallbackSignature = errors.New("invalid callback signature")
+
+	// ErrInvalidCallback is returned for malformed delivery-status callbacks
+	ErrInvalidCallback = errors.New("invalid callback")
+)
+
+// SMSCallbackHandler is implemented by SMS services whose provider reports
+// delivery status through HTTP callbacks.
+type SMSCallbackHandler interface {
+	HandleStatusCallback(r *http.Request) error
+}
+
+// NewSMSService creates the SMS service selected by cfg.Provider
+func NewSMSService(cfg config.SMSConfig, smsStorage storage.SMSStorage) (SMSService, error) {
+	switch cfg.Provider {
+	case "", SMSProviderMock:
+		return NewMockSMSService(), nil
+	case SMSProviderTwilio:
+		if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.From == "" {
+			return nil, errors.New("twilio provider requires SMS_ACCOUNT_SID, SMS_AUTH_TOKEN and SMS_FROM")
+		}
+		if cfg.APIURL == "" {
+			cfg.APIURL = defaultTwilioAPIURL
+		}
+		return NewHTTPSMSService(cfg, smsStorage), nil
+	case SMSProviderWebhook:
+		if cfg.APIURL == "" {
+			return nil, errors.New("webhook provider requires SMS_API_URL")
+		}
+		return NewHTTPSMSService(cfg, smsStorage), nil
+	default:
+		return nil, fmt.Errorf("unsupported SMS provider %q", cfg.Provider)
+	}
+}
+
+// HTTPSMSService sends SMS through an HTTP provider API. Two request formats
+// are supported:
+//
+//   - twilio: form-encoded POST to {APIURL}/2010-04-01/Accounts/{sid}/Messages.json
+//     with basic auth; callbacks are signed with X-Twilio-Signature
+//   - webhook: JSON POST of {"to", "from", "message", "status_callback"} to
+//     APIURL with a bearer token; callbacks are signed with X-Signature
+//     (hex HMAC-SHA256 of the body)
+type HTTPSMSService struct {
+	cfg        config.SMSConfig
+	client     *http.Client
+	smsStorage storage.SMSStorage
+}
+
+// NewHTTPSMSService creates a new HTTP SMS service
+func NewHTTPSMSService(cfg config.SMSConfig, smsStorage storage.SMSStorage) *HTTPSMSService {
+	return &HTTPSMSService{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		smsStorage: smsStorage,
+	}
+}
+
+// providerError is a non-2xx response from the provider
+type providerError struct {
+	statusCode int
+}
+
+func (e *providerError) Error() string {
+	return fmt.Sprintf("provider returned status %d", e.statusCode)
+}
+
+// GenerateCode generates a cryptographically random 4-digit verification code
+func (s *HTTPSMSService) GenerateCode() string {
+	return generateCode()
+}
+
+// SendCode sends the verification code, retrying network errors, 5xx and 429
+// responses with exponential backoff.
+func (s *HTTPSMSService) SendCode(phone, code string) error {
+	text := fmt.Sprintf(smsCodeMessage, code)
+
+	var lastErr error
+	for attempt := 0; attempt <= s.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(s.cfg.RetryBackoff << (attempt - 1))
+		}
+
+		messageID, err := s.send(phone, text)
+		if err == nil {
+			s.recordMessage(phone, messageID)
+			return nil
+		}
+
+		lastErr = err
+		if !isRetryableSMSError(err) {
+			break
+		}
+	}
+
+	// The code is intentionally not logged to avoid leaking OTPs
+	log.Printf("Failed to send SMS to %s via %s: %v", phone, s.cfg.Provider, lastErr)
+	return fmt.Errorf("%w: %v", ErrSMSDeliveryFailed, lastErr)
+}
+
+// send performs a single provider request and returns the provider's message ID
+func (s *HTTPSMSService) send(phone, text string) (string, error) {
+	var req *http.Request
+	var err error
+	if s.cfg.Provider == SMSProviderTwilio {
+		req, err = s.newTwilioRequest(phone, text)
+	} else {
+		req, err = s.newWebhookRequest(phone, text)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		return "", &providerError{statusCode: resp.StatusCode}
+	}
+
+	// Twilio returns "sid", webhook providers return "id"
+	var body struct {
+		SID string `json:"sid"`
+		ID  string `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.SID != "" {
+		return body.SID, nil
+	}
+	return body.ID, nil
+}
+
+// newTwilioRequest builds a Twilio Messages API request
+func (s *HTTPSMSService) newTwilioRequest(phone, text string) (*http.Request, error) {
+	form := url.Values{}
+	form.Set("To", phone)
+	form.Set("From", s.cfg.From)
+	form.Set("Body", text)
+	if s.cfg.StatusCallbackURL != "" {
+		form.Set("StatusCallback", s.cfg.StatusCallbackURL)
+	}
+
+	reqURL := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json",
+		strings.TrimSuffix(s.cfg.APIURL, "/"), url.PathEscape(s.cfg.AccountSID))
+	req, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.cfg.AccountSID, s.cfg.AuthToken)
+	return req, nil
+}
+
+// newWebhookRequest builds a generic JSON webhook request
+func (s *HTTPSMSService) newWebhookRequest(phone, text string) (*http.Request, error) {
+	payload, err := json.Marshal(map[string]string{
+		"to":              phone,
+		"from":            s.cfg.From,
+		"message":         text,
+		"status_callback": s.cfg.StatusCallbackURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.cfg.APIURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.AuthToken)
+	}
+	return req, nil
+}
+
+// recordMessage stores the sent message so delivery callbacks can be matched.
+// Failures are logged: the SMS has already been sent.
+func (s *HTTPSMSService) recordMessage(phone, providerMessageID string) {
+	if s.smsStorage == nil || providerMessageID == "" {
+		return
+	}
+
+	message := &models.SMSMessage{
+		ID:                uuid.New().String(),
+		Provider:          s.cfg.Provider,
+		ProviderMessageID: providerMessageID,
+		Phone:             phone,
+		Status:            models.SMSStatusQueued,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+	if err := s.smsStorage.CreateSMSMessage(message); err != nil {
+		log.Printf("WARNING: failed to record SMS %s: %v", providerMessageID, err)
+	}
+}
+
+// HandleStatusCallback verifies and applies a delivery-status callback
+func (s *HTTPSMSService) HandleStatusCallback(r *http.Request) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBodySize))
+	if err != nil {
+		return ErrInvalidCallback
+	}
+
+	var messageID, status, errorCode string
+	if s.cfg.Provider == SMSProviderTwilio {
+		messageID, status, errorCode, err = s.parseTwilioCallback(r, body)
+	} else {
+		messageID, status, errorCode, err = s.parseWebhookCallback(r, body)
+	}
+	if err != nil {
+		return err
+	}
+
+	normalized := normalizeSMSStatus(status)
+	if messageID == "" || normalized == "" {
+		return ErrInvalidCallback
+	}
+
+	message, err := s.smsStorage.GetSMSMessageByProviderID(s.cfg.Provider, messageID)
+	if err != nil {
+		return err
+	}
+
+	// Callbacks may arrive out of order; never move a message out of a final state
+	if message.Status == models.SMSStatusDelivered || message.Status == models.SMSStatusFailed {
+		return nil
+	}
+	return s.smsStorage.UpdateSMSStatus(message.ID, normalized, errorCode)
+}
+
+// parseTwilioCallback verifies the X-Twilio-Signature header and extracts the
+// message status. The signature covers the configured callback URL followed by
+// every POST parameter, sorted by name.
+func (s *HTTPSMSService) parseTwilioCallback(r *http.Request, body []byte) (string, string, string, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", "", "", ErrInvalidCallback
+	}
+
+	expected := twilioSignature(s.cfg.AuthToken, s.cfg.StatusCallbackURL, form)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Twilio-Signature"))) {
+		return "", "", "", ErrInvalidCallbackSignature
+	}
+
+	return form.Get("MessageSid"), form.Get("MessageStatus"), form.Get("ErrorCode"), nil
+}
+
+// parseWebhookCallback verifies the X-Signature header and decodes the JSON
+// callback body {"id", "status", "error_code"}
+func (s *HTTPSMSService) parseWebhookCallback(r *http.Request, body []byte) (string, string, string, error) {
+	// Without a shared secret anyone could forge a callback
+	if s.cfg.AuthToken == "" {
+		return "", "", "", ErrInvalidCallbackSignature
+	}
+
+	expected := webhookSignature(s.cfg.AuthToken, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Signature"))) {
+		return "", "", "", ErrInvalidCallbackSignature
+	}
+
+	var callback struct {
+		ID        string `json:"id"`
+		Status    string `json:"status"`
+		ErrorCode string `json:"error_code"`
+	}
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return "", "", "", ErrInvalidCallback
+	}
+	return callback.ID, callback.Status, callback.ErrorCode, nil
+}
+
+// twilioSignature computes the X-Twilio-Signature value for a callback
+func twilioSignature(authToken, callbackURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var data strings.Builder
+	data.WriteString(callbackURL)
+	for _, key := range keys {
+		for _, value := range params[key] {
+			data.WriteString(key)
+			data.WriteString(value)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(data.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSignature computes the X-Signature value for a webhook callback body
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isRetryableSMSError reports whether a failed send may succeed on retry
+func isRetryableSMSError(err error) bool {
+	var providerErr *providerError
+	if errors.As(err, &providerErr) {
+		return providerErr.statusCode >= 500 || providerErr.statusCode == http.StatusTooManyRequests
+	}
+	// Network errors and timeouts
+	return true
+}
+
+// normalizeSMSStatus maps provider statuses onto models.SMSStatus* values,
+// returning "" for statuses it does not know
+func normalizeSMSStatus(status string) string {
+	switch strings.ToLower(status) {
+	case "accepted", "scheduled", "queued", "sending":
+		return models.SMSStatusQueued
+	case "sent":
+		return models.SMSStatusSent
+	case "delivered":
+		return models.SMSStatusDelivered
+	case "failed", "undelivered", "canceled":
+		return models.SMSStatusFailed
+	default:
+		return ""
+	}
+}
@@ -30,6 +30,11 @@ func (s *MockSMSService) SendCode(phone, code string) error {
 
 // GenerateCode generates a cryptographically random 4-digit verification code.
 func (s *MockSMSService) GenerateCode() string {
+	return generateCode()
+}
+
+// generateCode generates a cryptographically random 4-digit verification code
+func generateCode() string {
 	n, err := rand.Int(rand.Reader, big.NewInt(10000))
 	if err != nil {
 		panic("failed to generate secure random code: " + err.Error())
@@ -0,0 +1,314 @@
+// Package smstest provides a fake SMS provider for tests and local development.
+// It speaks both request formats supported by service.HTTPSMSService, records
+// every message and extracts verification codes, so auth flows can be scripted
+// without reading the service's output.
+package smstest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookPath is the endpoint for webhook-format requests
+const WebhookPath = "/messages"
+
+var codePattern = regexp.MustCompile(`\b\d{4}\b`)
+
+// Message is an SMS received by the fake provider
+type Message struct {
+	ID             string    `json:"id"`
+	Format         string    `json:"format"` // "twilio" or "webhook"
+	To             string    `json:"to"`
+	From           string    `json:"from"`
+	Body           string    `json:"body"`
+	Code           string    `json:"code,omitempty"`
+	StatusCallback string    `json:"status_callback,omitempty"`
+	ReceivedAt     time.Time `json:"received_at"`
+}
+
+// Provider is a fake SMS provider. It serves:
+//
+//	POST /2010-04-01/Accounts/{sid}/Messages.json  Twilio-style request
+//	POST /messages                                 webhook-style request
+//	GET  /codes?phone=...                          last code sent to phone
+//	GET  /messages                                 all received messages
+type Provider struct {
+	AccountSID string
+	AuthToken  string
+
+	mu          sync.Mutex
+	messages    []Message
+	failures    int
+	failStatus  int
+	requests    int
+	callbackCli *http.Client
+}
+
+// NewProvider creates a fake provider that accepts the given credentials
+func NewProvider(accountSID, authToken string) *Provider {
+	return &Provider{
+		AccountSID:  accountSID,
+		AuthToken:   authToken,
+		callbackCli: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Server is a fake provider running on a local httptest server
+type Server struct {
+	*Provider
+	*httptest.Server
+}
+
+// NewServer starts a fake provider on a random local port. Close it when done.
+func NewServer(accountSID, authToken string) *Server {
+	provider := NewProvider(accountSID, authToken)
+	return &Server{Provider: provider, Server: httptest.NewServer(provider)}
+}
+
+// WebhookURL returns the URL to configure as SMS_API_URL for the webhook format
+func (s *Server) WebhookURL() string {
+	return s.URL + WebhookPath
+}
+
+// ServeHTTP implements http.Handler
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/2010-04-01/Accounts/"):
+		p.handleTwilio(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == WebhookPath:
+		p.handleWebhook(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == WebhookPath:
+		writeJSON(w, http.StatusOK, p.Messages())
+	case r.Method == http.MethodGet && r.URL.Path == "/codes":
+		code, ok := p.LastCode(r.URL.Query().Get("phone"))
+		if !ok {
+			http.Error(w, "no code sent to this phone", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"code": code})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Provider) handleTwilio(w http.ResponseWriter, r *http.Request) {
+	sid, token, ok := r.BasicAuth()
+	if !ok || sid != p.AccountSID || token != p.AuthToken {
+		http.Error(w, "authentication failed", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path != fmt.Sprintf("/2010-04-01/Accounts/%s/Messages.json", p.AccountSID) {
+		http.NotFound(w, r)
+		return
+	}
+	if p.shouldFail(w) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	message := p.record("twilio", r.PostForm.Get("To"), r.PostForm.Get("From"),
+		r.PostForm.Get("Body"), r.PostForm.Get("StatusCallback"))
+	writeJSON(w, http.StatusCreated, map[string]string{"sid": message.ID, "status": "queued"})
+}
+
+func (p *Provider) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if p.AuthToken != "" && r.Header.Get("Authorization") != "Bearer "+p.AuthToken {
+		http.Error(w, "authentication failed", http.StatusUnauthorized)
+		return
+	}
+	if p.shouldFail(w) {
+		return
+	}
+
+	var req struct {
+		To             string `json:"to"`
+		From           string `json:"from"`
+		Message        string `json:"message"`
+		StatusCallback string `json:"status_callback"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	message := p.record("webhook", req.To, req.From, req.Message, req.StatusCallback)
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": message.ID, "status": "queued"})
+}
+
+// shouldFail consumes one injected failure, writing the error response
+func (p *Provider) shouldFail(w http.ResponseWriter) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests++
+	if p.failures == 0 {
+		return false
+	}
+	p.failures--
+	http.Error(w, "injected failure", p.failStatus)
+	return true
+}
+
+func (p *Provider) record(format, to, from, body, statusCallback string) Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	message := Message{
+		ID:             "SM" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Format:         format,
+		To:             to,
+		From:           from,
+		Body:           body,
+		Code:           codePattern.FindString(body),
+		StatusCallback: statusCallback,
+		ReceivedAt:     time.Now(),
+	}
+	p.messages = append(p.messages, message)
+	return message
+}
+
+// FailNext makes the next n send requests fail with the given HTTP status
+func (p *Provider) FailNext(n, status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures = n
+	p.failStatus = status
+}
+
+// Requests returns the number of authenticated send requests received,
+// including injected failures
+func (p *Provider) Requests() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests
+}
+
+// Messages returns every message received so far
+func (p *Provider) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	messages := make([]Message, len(p.messages))
+	copy(messages, p.messages)
+	return messages
+}
+
+// LastMessage returns the most recent message sent to phone
+func (p *Provider) LastMessage(phone string) (Message, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := len(p.messages) - 1; i >= 0; i-- {
+		if p.messages[i].To == phone {
+			return p.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// LastCode returns the verification code in the most recent message to phone
+func (p *Provider) LastCode(phone string) (string, bool) {
+	message, ok := p.LastMessage(phone)
+	if !ok || message.Code == "" {
+		return "", false
+	}
+	return message.Code, true
+}
+
+// ReportStatus sends a signed delivery-status callback for messageID to the
+// callback URL given when the message was sent, the way the real provider does
+func (p *Provider) ReportStatus(messageID, status string) (*http.Response, error) {
+	var message *Message
+	for _, m := range p.Messages() {
+		if m.ID == messageID {
+			message = &m
+			break
+		}
+	}
+	if message == nil {
+		return nil, errors.New("unknown message")
+	}
+	if message.StatusCallback == "" {
+		return nil, errors.New("message has no status callback")
+	}
+
+	var req *http.Request
+	var err error
+	if message.Format == "twilio" {
+		form := url.Values{}
+		form.Set("AccountSid", p.AccountSID)
+		form.Set("MessageSid", message.ID)
+		form.Set("MessageStatus", status)
+		req, err = http.NewRequest(http.MethodPost, message.StatusCallback, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Twilio-Signature", signTwilio(p.AuthToken, message.StatusCallback, form))
+	} else {
+		body, _ := json.Marshal(map[string]string{"id": message.ID, "status": status})
+		req, err = http.NewRequest(http.MethodPost, message.StatusCallback, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Signature", signWebhook(p.AuthToken, body))
+	}
+
+	return p.callbackCli.Do(req)
+}
+
+// signTwilio implements Twilio's request signing: base64 HMAC-SHA1 over the
+// URL followed by each POST parameter name and value, sorted by name
+func signTwilio(authToken, callbackURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data := callbackURL
+	for _, key := range keys {
+		for _, value := range params[key] {
+			data += key + value
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signWebhook signs a webhook callback body with hex HMAC-SHA256
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"order-api-auth/models"
+	"order-api-auth/storage"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenExpired is returned for refresh tokens past their expiry
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	// ErrRefreshTokenReused is returned when an already-rotated refresh token is
+	// presented again; the whole token family is revoked when this happens
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+)
+
+// TokenService interface for issuing, rotating and revoking tokens
+type TokenService interface {
+	IssueTokens(user *models.User) (*models.TokenResponse, error)
+	Refresh(refreshToken string) (*models.TokenResponse, error)
+	Logout(claims *Claims, refreshToken string) error
+	IsRevoked(jti string) (bool, error)
+}
+
+// TokenServiceImpl token service implementation
+type TokenServiceImpl struct {
+	jwtService      JWTService
+	tokenStorage    storage.TokenStorage
+	userStorage     storage.UserStorage
+	refreshTokenTTL time.Duration
+}
+
+// NewTokenService creates a new token service
+func NewTokenService(
+	jwtService JWTService,
+	tokenStorage storage.TokenStorage,
+	userStorage storage.UserStorage,
+	refreshTokenTTL time.Duration,
+) *TokenServiceImpl {
+	return &TokenServiceImpl{
+		jwtService:      jwtService,
+		tokenStorage:    tokenStorage,
+		userStorage:     userStorage,
+		refreshTokenTTL: refreshTokenTTL,
+	}
+}
+
+// IssueTokens issues an access token and a refresh token that starts a new
+// token family. Used after a successful login.
+func (t *TokenServiceImpl) IssueTokens(user *models.User) (*models.TokenResponse, error) {
+	response, refreshToken, err := t.newTokenPair(user, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.tokenStorage.CreateRefreshToken(refreshToken); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token in the same family. Each refresh token may be used exactly once;
+// presenting a rotated token again revokes the whole family, since it means the
+// token was copied by someone else.
+func (t *TokenServiceImpl) Refresh(refreshToken string) (*models.TokenResponse, error) {
+	current, err := t.tokenStorage.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil {
+		if err.Error() == "refresh token not found" {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		if current.ReplacedByID != "" {
+			return nil, t.revokeFamilyOnReuse(current)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	user, err := t.userStorage.GetUserByID(current.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	response, next, err := t.newTokenPair(user, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rotation fails if another request rotated the same token first, which is
+	// the same situation as reuse.
+	if err := t.tokenStorage.RotateRefreshToken(current.ID, next); err != nil {
+		if err.Error() == "refresh token already used" {
+			return nil, t.revokeFamilyOnReuse(current)
+		}
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Logout revokes the presented access token and, if a refresh token belonging
+// to the same user is supplied, its whole token family.
+func (t *TokenServiceImpl) Logout(claims *Claims, refreshToken string) error {
+	// Validate the refresh token before revoking anything, so a bad request
+	// leaves the caller's session untouched
+	var current *models.RefreshToken
+	if refreshToken != "" {
+		var err error
+		current, err = t.tokenStorage.GetRefreshTokenByHash(hashToken(refreshToken))
+		if err != nil {
+			if err.Error() == "refresh token not found" {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if current.UserID != claims.UserID {
+			return ErrInvalidRefreshToken
+		}
+	}
+
+	if err := t.tokenStorage.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	if current == nil {
+		return nil
+	}
+	return t.tokenStorage.RevokeTokenFamily(current.FamilyID)
+}
+
+// IsRevoked reports whether the access token with the given jti was revoked
+func (t *TokenServiceImpl) IsRevoked(jti string) (bool, error) {
+	return t.tokenStorage.IsAccessTokenRevoked(jti)
+}
+
+// newTokenPair signs an access token and builds (but does not store) the
+// matching refresh token record.
+func (t *TokenServiceImpl) newTokenPair(user *models.User, familyID string) (*models.TokenResponse, *models.RefreshToken, error) {
+	accessToken, claims, err := t.jwtService.GenerateToken(user.ID, user.Phone, user.Role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawRefreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	refreshToken := &models.RefreshToken{
+		ID:                   uuid.New().String(),
+		UserID:               user.ID,
+		FamilyID:             familyID,
+		TokenHash:            hashToken(rawRefreshToken),
+		AccessTokenID:        claims.ID,
+		AccessTokenExpiresAt: claims.ExpiresAt.Time,
+		ExpiresAt:            now.Add(t.refreshTokenTTL),
+		CreatedAt:            now,
+	}
+
+	response := &models.TokenResponse{
+		Token:        accessToken,
+		RefreshToken: rawRefreshToken,
+		ExpiresIn:    int64(claims.ExpiresAt.Sub(claims.IssuedAt.Time).Seconds()),
+	}
+
+	return response, refreshToken, nil
+}
+
+// revokeFamilyOnReuse revokes the family of a reused refresh token and returns
+// the error to report to the caller.
+func (t *TokenServiceImpl) revokeFamilyOnReuse(token *models.RefreshToken) error {
+	log.Printf("WARNING: refresh token reuse detected for user %s, revoking token family %s",
+		token.UserID, token.FamilyID)
+	if err := t.tokenStorage.RevokeTokenFamily(token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// generateOpaqueToken returns a cryptographically random URL-safe token
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 of a token; only hashes are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"order-api-auth/models"
 )
@@ -14,17 +15,55 @@ type UserStorage interface {
 	CreateUser(user *models.User) error
 	GetUserByPhone(phone string) (*models.User, error)
 	GetUserByID(id string) (*models.User, error)
+	UpdateUserRole(id, role string) (*models.User, error)
 }
 
 // SessionStorage interface for working with sessions
 type SessionStorage interface {
 	CreateSession(session *models.Session) error
 	GetSession(sessionID string) (*models.Session, error)
+	GetActiveSessionByPhone(phone string) (*models.Session, error)
+	UpdateSessionSentAt(sessionID string, sentAt time.Time) error
 	MarkSessionAsUsed(sessionID string) error
 	IncrementAttempts(sessionID string) error
 	CleanupExpiredSessions()
 }
 
+// PurchaseStorage interface for working with purchases
+type PurchaseStorage interface {
+	CreatePurchase(purchase *models.Purchase) error
+	UpdatePurchaseStatus(purchaseID, status string) error
+	GetPurchaseByID(purchaseID string) (*models.Purchase, error)
+	GetPurchasesByUserID(userID string, page, limit int) ([]models.Purchase, int64, error)
+}
+
+// TokenStorage interface for working with refresh tokens and revoked access tokens
+type TokenStorage interface {
+	CreateRefreshToken(token *models.RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(oldTokenID string, newToken *models.RefreshToken) error
+	RevokeTokenFamily(familyID string) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+	CleanupExpiredTokens()
+}
+
+// SMSStorage interface for working with sent SMS messages
+type SMSStorage interface {
+	CreateSMSMessage(message *models.SMSMessage) error
+	GetSMSMessageByProviderID(provider, providerMessageID string) (*models.SMSMessage, error)
+	UpdateSMSStatus(messageID, status, errorCode string) error
+}
+
+// RateLimiter interface for sliding-window rate limits
+type RateLimiter interface {
+	// Allow counts a hit against key unless limit hits were already counted
+	// within the last window. When the limit is reached it returns false and
+	// the time until the oldest hit leaves the window.
+	Allow(key string, limit int, window time.Duration) (bool, time.Duration, error)
+	CleanupExpiredRateLimits()
+}
+
 // PostgreSQLStorage represents a PostgreSQL storage implementation
 type PostgreSQLStorage struct {
 	db *gorm.DB
@@ -72,6 +111,21 @@ func (s *PostgreSQLStorage) GetUserByID(id string) (*models.User, error) {
 	return &user, nil
 }
 
+// UpdateUserRole sets the role of a user and returns the updated user
+func (s *PostgreSQLStorage) UpdateUserRole(id, role string) (*models.User, error) {
+	result := s.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"role":       role,
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("user not found")
+	}
+	return s.GetUserByID(id)
+}
+
 // CreateSession creates a new session
 func (s *PostgreSQLStorage) CreateSession(session *models.Session) error {
 	result := s.db.Create(session)
@@ -94,6 +148,35 @@ func (s *PostgreSQLStorage) GetSession(sessionID string) (*models.Session, error
 	return &session, nil
 }
 
+// GetActiveSessionByPhone gets the newest unused, unexpired session for a phone
+func (s *PostgreSQLStorage) GetActiveSessionByPhone(phone string) (*models.Session, error) {
+	var session models.Session
+	result := s.db.Where("phone = ? AND is_used = ? AND expires_at > ?", phone, false, time.Now()).
+		Order("created_at DESC").
+		First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("session not found")
+		}
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// UpdateSessionSentAt records when the session's code was last sent
+func (s *PostgreSQLStorage) UpdateSessionSentAt(sessionID string, sentAt time.Time) error {
+	result := s.db.Model(&models.Session{}).
+		Where("id = ?", sessionID).
+		Update("last_sent_at", sentAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("session not found")
+	}
+	return nil
+}
+
 // MarkSessionAsUsed atomically marks a session as used. Returns an error if the
 // session was already used (protects against concurrent double-verification).
 func (s *PostgreSQLStorage) MarkSessionAsUsed(sessionID string) error {
@@ -122,3 +205,224 @@ func (s *PostgreSQLStorage) CleanupExpiredSessions() {
 	now := time.Now()
 	s.db.Where("expires_at < ?", now).Delete(&models.Session{})
 }
+
+// CreatePurchase creates a new purchase
+func (s *PostgreSQLStorage) CreatePurchase(purchase *models.Purchase) error {
+	result := s.db.Create(purchase)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// UpdatePurchaseStatus changes the status of a purchase
+func (s *PostgreSQLStorage) UpdatePurchaseStatus(purchaseID, status string) error {
+	result := s.db.Model(&models.Purchase{}).
+		Where("id = ?", purchaseID).
+		Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("purchase not found")
+	}
+	return nil
+}
+
+// GetPurchaseByID gets purchase by ID
+func (s *PostgreSQLStorage) GetPurchaseByID(purchaseID string) (*models.Purchase, error) {
+	var purchase models.Purchase
+	result := s.db.Where("id = ?", purchaseID).First(&purchase)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("purchase not found")
+		}
+		return nil, result.Error
+	}
+	return &purchase, nil
+}
+
+// GetPurchasesByUserID returns a page of a user's purchases, newest first,
+// together with the total number of purchases the user has.
+func (s *PostgreSQLStorage) GetPurchasesByUserID(userID string, page, limit int) ([]models.Purchase, int64, error) {
+	var total int64
+	if err := s.db.Model(&models.Purchase{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var purchases []models.Purchase
+	offset := (page - 1) * limit
+	result := s.db.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Offset(offset).Limit(limit).
+		Find(&purchases)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return purchases, total, nil
+}
+
+// CreateRefreshToken stores a new refresh token
+func (s *PostgreSQLStorage) CreateRefreshToken(token *models.RefreshToken) error {
+	result := s.db.Create(token)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// GetRefreshTokenByHash gets refresh token by the hash of its value
+func (s *PostgreSQLStorage) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	result := s.db.Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("refresh token not found")
+		}
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken atomically retires a refresh token and stores its
+// replacement. Returns an error if the old token was already retired, which
+// protects against two concurrent refreshes with the same token.
+func (s *PostgreSQLStorage) RotateRefreshToken(oldTokenID string, newToken *models.RefreshToken) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", oldTokenID).
+			Updates(map[string]interface{}{
+				"revoked_at":     time.Now(),
+				"replaced_by_id": newToken.ID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("refresh token already used")
+		}
+		return tx.Create(newToken).Error
+	})
+}
+
+// RevokeTokenFamily revokes every refresh token in a family and adds the
+// still-valid access tokens issued alongside them to the revocation list.
+func (s *PostgreSQLStorage) RevokeTokenFamily(familyID string) error {
+	now := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var tokens []models.RefreshToken
+		if err := tx.Where("family_id = ? AND access_token_id <> '' AND access_token_expires_at > ?", familyID, now).
+			Find(&tokens).Error; err != nil {
+			return err
+		}
+
+		for _, token := range tokens {
+			revoked := &models.RevokedToken{JTI: token.AccessTokenID, ExpiresAt: token.AccessTokenExpiresAt}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(revoked).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// RevokeAccessToken adds an access token to the revocation list
+func (s *PostgreSQLStorage) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	revoked := &models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(revoked)
+	return result.Error
+}
+
+// IsAccessTokenRevoked reports whether an access token has been revoked
+func (s *PostgreSQLStorage) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	result := s.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return count > 0, nil
+}
+
+// CleanupExpiredTokens removes expired refresh tokens and revocation entries
+func (s *PostgreSQLStorage) CleanupExpiredTokens() {
+	now := time.Now()
+	s.db.Where("expires_at < ?", now).Delete(&models.RevokedToken{})
+	s.db.Where("expires_at < ?", now).Delete(&models.RefreshToken{})
+}
+
+// CreateSMSMessage records a sent SMS message
+func (s *PostgreSQLStorage) CreateSMSMessage(message *models.SMSMessage) error {
+	result := s.db.Create(message)
+	return result.Error
+}
+
+// GetSMSMessageByProviderID gets an SMS message by the ID its provider assigned
+func (s *PostgreSQLStorage) GetSMSMessageByProviderID(provider, providerMessageID string) (*models.SMSMessage, error) {
+	var message models.SMSMessage
+	result := s.db.Where("provider = ? AND provider_message_id = ?", provider, providerMessageID).First(&message)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("sms message not found")
+		}
+		return nil, result.Error
+	}
+	return &message, nil
+}
+
+// UpdateSMSStatus updates the delivery status of an SMS message
+func (s *PostgreSQLStorage) UpdateSMSStatus(messageID, status, errorCode string) error {
+	result := s.db.Model(&models.SMSMessage{}).
+		Where("id = ?", messageID).
+		Updates(map[string]interface{}{"status": status, "error_code": errorCode, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("sms message not found")
+	}
+	return nil
+}
+
+// Allow implements a sliding-window log. A transaction-scoped advisory lock on
+// the key serializes concurrent requests, so the count and the insert cannot
+// race across instances.
+func (s *PostgreSQLStorage) Allow(key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	allowed := false
+	var retryAfter time.Duration
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var hits []models.RateLimitHit
+		err := tx.Where("key = ? AND created_at > ?", key, now.Add(-window)).
+			Order("created_at ASC").
+			Limit(limit).
+			Find(&hits).Error
+		if err != nil {
+			return err
+		}
+
+		if len(hits) >= limit {
+			retryAfter = hits[0].CreatedAt.Add(window).Sub(now)
+			return nil
+		}
+
+		allowed = true
+		return tx.Create(&models.RateLimitHit{Key: key, CreatedAt: now, ExpiresAt: now.Add(window)}).Error
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, retryAfter, nil
+}
+
+// CleanupExpiredRateLimits removes hits whose window has passed
+func (s *PostgreSQLStorage) CleanupExpiredRateLimits() {
+	s.db.Where("expires_at < ?", time.Now()).Delete(&models.RateLimitHit{})
+}
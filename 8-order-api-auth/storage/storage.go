@@ -2,24 +2,41 @@ package storage
 
 import (
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
 	"order-api-auth/models"
 )
 
+// rateLimitLog holds the hits of one rate limit key, oldest first
+type rateLimitLog struct {
+	hits      []time.Time
+	expiresAt time.Time // when the newest hit leaves its window
+}
+
 // InMemoryStorage represents an in-memory storage
 type InMemoryStorage struct {
-	users    map[string]*models.User
-	sessions map[string]*models.Session
-	mu       sync.RWMutex
+	users         map[string]*models.User
+	sessions      map[string]*models.Session
+	purchases     map[string]*models.Purchase
+	refreshTokens map[string]*models.RefreshToken // keyed by token hash
+	revokedTokens map[string]time.Time            // jti -> access token expiry
+	smsMessages   map[string]*models.SMSMessage
+	rateLimits    map[string]*rateLimitLog
+	mu            sync.RWMutex
 }
 
 // NewInMemoryStorage creates a new in-memory storage
 func NewInMemoryStorage() *InMemoryStorage {
 	return &InMemoryStorage{
-		users:    make(map[string]*models.User),
-		sessions: make(map[string]*models.Session),
+		users:         make(map[string]*models.User),
+		sessions:      make(map[string]*models.Session),
+		purchases:     make(map[string]*models.Purchase),
+		refreshTokens: make(map[string]*models.RefreshToken),
+		revokedTokens: make(map[string]time.Time),
+		smsMessages:   make(map[string]*models.SMSMessage),
+		rateLimits:    make(map[string]*rateLimitLog),
 	}
 }
 
@@ -66,6 +83,23 @@ func (s *InMemoryStorage) GetUserByID(id string) (*models.User, error) {
 	return user, nil
 }
 
+// UpdateUserRole sets the role of a user and returns the updated user
+func (s *InMemoryStorage) UpdateUserRole(id, role string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, errors.New("user not found")
+	}
+
+	updated := *user
+	updated.Role = role
+	updated.UpdatedAt = time.Now()
+	s.users[id] = &updated
+	return &updated, nil
+}
+
 // CreateSession creates a new session
 func (s *InMemoryStorage) CreateSession(session *models.Session) error {
 	s.mu.Lock()
@@ -88,6 +122,40 @@ func (s *InMemoryStorage) GetSession(sessionID string) (*models.Session, error)
 	return session, nil
 }
 
+// GetActiveSessionByPhone gets the newest unused, unexpired session for a phone
+func (s *InMemoryStorage) GetActiveSessionByPhone(phone string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var active *models.Session
+	for _, session := range s.sessions {
+		if session.Phone != phone || session.IsUsed || !session.ExpiresAt.After(now) {
+			continue
+		}
+		if active == nil || session.CreatedAt.After(active.CreatedAt) {
+			active = session
+		}
+	}
+	if active == nil {
+		return nil, errors.New("session not found")
+	}
+	return active, nil
+}
+
+// UpdateSessionSentAt records when the session's code was last sent
+func (s *InMemoryStorage) UpdateSessionSentAt(sessionID string, sentAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return errors.New("session not found")
+	}
+	session.LastSentAt = sentAt
+	return nil
+}
+
 // MarkSessionAsUsed atomically marks a session as used.
 func (s *InMemoryStorage) MarkSessionAsUsed(sessionID string) error {
 	s.mu.Lock()
@@ -129,3 +197,254 @@ func (s *InMemoryStorage) CleanupExpiredSessions() {
 		}
 	}
 }
+
+// CreatePurchase stores a new purchase
+func (s *InMemoryStorage) CreatePurchase(purchase *models.Purchase) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *purchase
+	s.purchases[purchase.ID] = &stored
+	return nil
+}
+
+// UpdatePurchaseStatus changes the status of a purchase
+func (s *InMemoryStorage) UpdatePurchaseStatus(purchaseID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purchase, exists := s.purchases[purchaseID]
+	if !exists {
+		return errors.New("purchase not found")
+	}
+	purchase.Status = status
+	purchase.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetPurchaseByID gets purchase by ID
+func (s *InMemoryStorage) GetPurchaseByID(purchaseID string) (*models.Purchase, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	purchase, exists := s.purchases[purchaseID]
+	if !exists {
+		return nil, errors.New("purchase not found")
+	}
+
+	result := *purchase
+	return &result, nil
+}
+
+// GetPurchasesByUserID returns a page of a user's purchases, newest first,
+// together with the total number of purchases the user has.
+func (s *InMemoryStorage) GetPurchasesByUserID(userID string, page, limit int) ([]models.Purchase, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var userPurchases []models.Purchase
+	for _, purchase := range s.purchases {
+		if purchase.UserID == userID {
+			userPurchases = append(userPurchases, *purchase)
+		}
+	}
+	sort.Slice(userPurchases, func(i, j int) bool {
+		return userPurchases[i].CreatedAt.After(userPurchases[j].CreatedAt)
+	})
+
+	total := int64(len(userPurchases))
+	start := (page - 1) * limit
+	if start >= len(userPurchases) {
+		return []models.Purchase{}, total, nil
+	}
+	end := start + limit
+	if end > len(userPurchases) {
+		end = len(userPurchases)
+	}
+
+	return userPurchases[start:end], total, nil
+}
+
+// CreateRefreshToken stores a new refresh token
+func (s *InMemoryStorage) CreateRefreshToken(token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *token
+	s.refreshTokens[token.TokenHash] = &stored
+	return nil
+}
+
+// GetRefreshTokenByHash gets refresh token by the hash of its value
+func (s *InMemoryStorage) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, exists := s.refreshTokens[tokenHash]
+	if !exists {
+		return nil, errors.New("refresh token not found")
+	}
+
+	result := *token
+	return &result, nil
+}
+
+// RotateRefreshToken atomically retires a refresh token and stores its replacement.
+func (s *InMemoryStorage) RotateRefreshToken(oldTokenID string, newToken *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.refreshTokens {
+		if token.ID != oldTokenID {
+			continue
+		}
+		if token.RevokedAt != nil {
+			return errors.New("refresh token already used")
+		}
+		now := time.Now()
+		token.RevokedAt = &now
+		token.ReplacedByID = newToken.ID
+
+		stored := *newToken
+		s.refreshTokens[newToken.TokenHash] = &stored
+		return nil
+	}
+
+	return errors.New("refresh token not found")
+}
+
+// RevokeTokenFamily revokes every refresh token in a family and the still-valid
+// access tokens issued alongside them.
+func (s *InMemoryStorage) RevokeTokenFamily(familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range s.refreshTokens {
+		if token.FamilyID != familyID {
+			continue
+		}
+		if token.AccessTokenID != "" && token.AccessTokenExpiresAt.After(now) {
+			s.revokedTokens[token.AccessTokenID] = token.AccessTokenExpiresAt
+		}
+		if token.RevokedAt == nil {
+			revokedAt := now
+			token.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken adds an access token to the revocation list
+func (s *InMemoryStorage) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokedTokens[jti] = expiresAt
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether an access token has been revoked
+func (s *InMemoryStorage) IsAccessTokenRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.revokedTokens[jti]
+	return revoked, nil
+}
+
+// CleanupExpiredTokens removes expired refresh tokens and revocation entries
+func (s *InMemoryStorage) CleanupExpiredTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, token := range s.refreshTokens {
+		if token.ExpiresAt.Before(now) {
+			delete(s.refreshTokens, hash)
+		}
+	}
+	for jti, expiresAt := range s.revokedTokens {
+		if expiresAt.Before(now) {
+			delete(s.revokedTokens, jti)
+		}
+	}
+}
+
+// CreateSMSMessage records a sent SMS message
+func (s *InMemoryStorage) CreateSMSMessage(message *models.SMSMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.smsMessages[message.ID] = message
+	return nil
+}
+
+// GetSMSMessageByProviderID gets an SMS message by the ID its provider assigned
+func (s *InMemoryStorage) GetSMSMessageByProviderID(provider, providerMessageID string) (*models.SMSMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, message := range s.smsMessages {
+		if message.Provider == provider && message.ProviderMessageID == providerMessageID {
+			return message, nil
+		}
+	}
+	return nil, errors.New("sms message not found")
+}
+
+// UpdateSMSStatus updates the delivery status of an SMS message
+func (s *InMemoryStorage) UpdateSMSStatus(messageID, status, errorCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, exists := s.smsMessages[messageID]
+	if !exists {
+		return errors.New("sms message not found")
+	}
+	message.Status = status
+	message.ErrorCode = errorCode
+	message.UpdatedAt = time.Now()
+	return nil
+}
+
+// Allow implements a sliding-window log
+func (s *InMemoryStorage) Allow(key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, exists := s.rateLimits[key]
+	if !exists {
+		entry = &rateLimitLog{}
+		s.rateLimits[key] = entry
+	}
+
+	// Drop hits that have left the window
+	start := 0
+	for start < len(entry.hits) && !entry.hits[start].After(now.Add(-window)) {
+		start++
+	}
+	entry.hits = entry.hits[start:]
+
+	if len(entry.hits) >= limit {
+		return false, entry.hits[0].Add(window).Sub(now), nil
+	}
+
+	entry.hits = append(entry.hits, now)
+	entry.expiresAt = now.Add(window)
+	return true, 0, nil
+}
+
+// CleanupExpiredRateLimits removes keys whose hits have all left their window
+func (s *InMemoryStorage) CleanupExpiredRateLimits() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range s.rateLimits {
+		if entry.expiresAt.Before(now) {
+			delete(s.rateLimits, key)
+		}
+	}
+}
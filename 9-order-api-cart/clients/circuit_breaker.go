@@ -0,0 +1,120 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting a service whose circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calls to a service that keeps failing, so requests fail
+// fast instead of each waiting for a timeout.
+//
+// The breaker opens after failureThreshold consecutive failures. While open,
+// Allow rejects every call with ErrCircuitOpen. Once cooldown has passed the
+// breaker is half-open: a single trial call is let through, and its outcome
+// closes the breaker again or reopens it for another cooldown.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	cooldown         time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool // a half-open trial call is in flight
+}
+
+// NewCircuitBreaker creates a closed circuit breaker for the named service.
+// failureThreshold is at least 1.
+func NewCircuitBreaker(name string, failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		state:            BreakerClosed,
+	}
+}
+
+// State returns the breaker's current state
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may be made now. Every allowed call must be
+// followed by exactly one of Success, Failure or Abandon.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = BreakerHalfOpen
+	}
+	switch {
+	case b.state == BreakerOpen, b.state == BreakerHalfOpen && b.probing:
+		return fmt.Errorf("%s: %w", b.name, ErrCircuitOpen)
+	case b.state == BreakerHalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// Success records a call the service answered properly
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		log.Printf("Circuit breaker for %s closed, the service is answering again", b.name)
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records a call that failed because of the service: it could not be
+// reached, timed out or answered with a server error
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		if b.state != BreakerOpen {
+			log.Printf("WARNING: circuit breaker for %s opened after %d consecutive failures, failing fast for %s",
+				b.name, b.failures, b.cooldown)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+	b.probing = false
+}
+
+// Abandon ends an allowed call without judging the service, e.g. because the
+// caller cancelled it. A half-open breaker lets the next call through instead.
+func (b *CircuitBreaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
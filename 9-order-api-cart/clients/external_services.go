@@ -1,53 +1,44 @@
 package clients
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"order-api-cart/config"
 	"order-api-cart/models"
 )
 
 // AuthServiceClient handles communication with the auth service
 type AuthServiceClient struct {
-	baseURL string
-	client  *http.Client
+	serviceClient
 }
 
 // NewAuthServiceClient creates a new auth service client
-func NewAuthServiceClient(baseURL string) *AuthServiceClient {
+func NewAuthServiceClient(baseURL string, cfg config.ClientConfig) *AuthServiceClient {
 	return &AuthServiceClient{
-		baseURL: baseURL,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		serviceClient: newServiceClient("auth service", baseURL, cfg),
 	}
 }
 
 // GetUserByID fetches user data from the auth service
-func (c *AuthServiceClient) GetUserByID(userID, authToken string) (*models.ExternalUser, error) {
-	url := fmt.Sprintf("%s/users/%s", c.baseURL, userID)
-
-	req, err := http.NewRequest("GET", url, nil)
+func (c *AuthServiceClient) GetUserByID(ctx context.Context, userID, authToken string) (*models.ExternalUser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/users/"+userID, nil, authToken, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
-	req.Header.Set("Authorization", authToken)
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("user not found: status %d", resp.StatusCode)
 	}
 
 	var user models.ExternalUser
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+	if err := json.Unmarshal(resp.Body, &user); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
@@ -55,84 +46,225 @@ func (c *AuthServiceClient) GetUserByID(userID, authToken string) (*models.Exter
 }
 
 // ValidateUser validates that a user exists in the auth service
-func (c *AuthServiceClient) ValidateUser(userID, authToken string) error {
-	_, err := c.GetUserByID(userID, authToken)
+func (c *AuthServiceClient) ValidateUser(ctx context.Context, userID, authToken string) error {
+	_, err := c.GetUserByID(ctx, userID, authToken)
 	return err
 }
 
+// ServiceToken gets an access token with the service role from the auth
+// service's client credentials grant, and returns it with its lifetime
+func (c *AuthServiceClient) ServiceToken(ctx context.Context, clientID, clientSecret string) (string, time.Duration, error) {
+	jsonData, err := json.Marshal(map[string]string{
+		"grant_type":    "client_credentials",
+		"client_id":     clientID,
+		"client_secret": clientSecret,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/auth/token", jsonData, "", "")
+	if err != nil {
+		return "", 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, &StatusError{Op: "failed to get service token", StatusCode: resp.StatusCode}
+	}
+
+	var token struct {
+		Token     string `json:"token"`
+		ExpiresIn int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(resp.Body, &token); err != nil {
+		return "", 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if token.Token == "" || token.ExpiresIn <= 0 {
+		return "", 0, errors.New("failed to get service token: empty token in response")
+	}
+
+	return token.Token, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
 // ProductServiceClient handles communication with the product service
 type ProductServiceClient struct {
-	baseURL string
-	client  *http.Client
+	serviceClient
 }
 
 // NewProductServiceClient creates a new product service client
-func NewProductServiceClient(baseURL string) *ProductServiceClient {
+func NewProductServiceClient(baseURL string, cfg config.ClientConfig) *ProductServiceClient {
 	return &ProductServiceClient{
-		baseURL: baseURL,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		serviceClient: newServiceClient("product service", baseURL, cfg),
 	}
 }
 
 // GetProductByID fetches product data from the product service
-func (c *ProductServiceClient) GetProductByID(productID, authToken string) (*models.ExternalProduct, error) {
-	url := fmt.Sprintf("%s/products/%s", c.baseURL, productID)
-
-	req, err := http.NewRequest("GET", url, nil)
+func (c *ProductServiceClient) GetProductByID(ctx context.Context, productID uint, authToken string) (*models.ExternalProduct, error) {
+	resp, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/products/%d", productID), nil, authToken, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
-	req.Header.Set("Authorization", authToken)
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("product not found: status %d", resp.StatusCode)
 	}
 
 	var product models.ExternalProduct
-	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
+	if err := json.Unmarshal(resp.Body, &product); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	return &product, nil
 }
 
-// UpdateProductQuantity updates product quantity in the product service
-func (c *ProductServiceClient) UpdateProductQuantity(productID string, quantityChange int, authToken string) error {
-	url := fmt.Sprintf("%s/products/%s/quantity", c.baseURL, productID)
+// MaxProductBatchSize is the most IDs the product service accepts in one
+// GET /products?ids=... request
+const MaxProductBatchSize = 100
+
+// GetProductsByIDs fetches up to MaxProductBatchSize products in one request.
+// The result is keyed by product ID; IDs the product service does not know are
+// absent from it.
+func (c *ProductServiceClient) GetProductsByIDs(ctx context.Context, productIDs []uint, authToken string) (map[uint]*models.ExternalProduct, error) {
+	if len(productIDs) > MaxProductBatchSize {
+		return nil, fmt.Errorf("too many product IDs: %d (max %d)", len(productIDs), MaxProductBatchSize)
+	}
+
+	ids := make([]string, len(productIDs))
+	for i, id := range productIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	resp, err := c.do(ctx, http.MethodGet, "/products?ids="+strings.Join(ids, ","), nil, authToken, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Op: "failed to get products", StatusCode: resp.StatusCode}
+	}
+
+	var list struct {
+		Products []models.ExternalProduct `json:"products"`
+	}
+	if err := json.Unmarshal(resp.Body, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	products := make(map[uint]*models.ExternalProduct, len(list.Products))
+	for i := range list.Products {
+		products[list.Products[i].ID] = &list.Products[i]
+	}
+	return products, nil
+}
+
+// StatusError is returned when a service answers with an unexpected HTTP status
+type StatusError struct {
+	Op         string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: status %d", e.Op, e.StatusCode)
+}
 
-	payload := map[string]int{
-		"change": quantityChange,
+// ErrReservationClosed is returned when the product service refuses to confirm
+// or release a reservation because it is no longer held: it expired or was
+// released before being confirmed, or was confirmed before being released
+var ErrReservationClosed = errors.New("reservation is no longer held")
+
+// CreateReservation reserves the items' stock in the product service for ttl.
+// A retried request with the same idempotencyKey returns the reservation made
+// by the first one. A product that is short fails with a StatusError with
+// status 409.
+func (c *ProductServiceClient) CreateReservation(ctx context.Context, items []models.OrderItemRequest, ttl time.Duration, idempotencyKey, authToken string) (*models.ExternalReservation, error) {
+	type reservationItem struct {
+		ProductID uint `json:"product_id"`
+		Quantity  int  `json:"quantity"`
+	}
+	payload := struct {
+		Items      []reservationItem `json:"items"`
+		TTLSeconds int               `json:"ttl_seconds"`
+	}{TTLSeconds: int(ttl / time.Second)}
+	for _, item := range items {
+		payload.Items = append(payload.Items, reservationItem{ProductID: item.ProductID, Quantity: item.Quantity})
 	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/reservations", jsonData, authToken, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Op: "failed to reserve stock", StatusCode: resp.StatusCode}
 	}
 
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(jsonData))
+	var reservation models.ExternalReservation
+	if err := json.Unmarshal(resp.Body, &reservation); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &reservation, nil
+}
+
+// ConfirmReservation confirms a held reservation, making its stock change
+// final. Confirming it again succeeds; a reservation that expired or was
+// released fails with ErrReservationClosed.
+func (c *ProductServiceClient) ConfirmReservation(ctx context.Context, reservationID uint, authToken string) error {
+	return c.closeReservation(ctx, reservationID, "confirm", authToken)
+}
+
+// ReleaseReservation releases a held reservation, returning its stock.
+// Releasing it again, or after it expired, succeeds; a confirmed reservation
+// fails with ErrReservationClosed.
+func (c *ProductServiceClient) ReleaseReservation(ctx context.Context, reservationID uint, authToken string) error {
+	return c.closeReservation(ctx, reservationID, "release", authToken)
+}
+
+// closeReservation sends a confirm or release action for a reservation
+func (c *ProductServiceClient) closeReservation(ctx context.Context, reservationID uint, action, authToken string) error {
+	resp, err := c.do(ctx, http.MethodPost, fmt.Sprintf("/reservations/%d/%s", reservationID, action), nil, authToken, "")
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", authToken)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return fmt.Errorf("failed to %s reservation %d: %w", action, reservationID, ErrReservationClosed)
+	default:
+		return &StatusError{Op: fmt.Sprintf("failed to %s reservation %d", action, reservationID), StatusCode: resp.StatusCode}
+	}
+}
+
+// UpdateProductQuantity updates product quantity in the product service. The
+// change is recorded with reason, "sale" or "return", at unitPrice, or at the
+// product's current price if it is nil. A non-empty idempotencyKey is sent as
+// the Idempotency-Key header, so a retried request with the same key is
+// applied at most once.
+func (c *ProductServiceClient) UpdateProductQuantity(ctx context.Context, productID uint, quantityChange int, reason string, unitPrice *float64, idempotencyKey, authToken string) error {
+	payload := struct {
+		Change    int      `json:"change"`
+		Reason    string   `json:"reason"`
+		UnitPrice *float64 `json:"unit_price,omitempty"`
+	}{Change: quantityChange, Reason: reason, UnitPrice: unitPrice}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/products/%d/quantity", productID), jsonData, authToken, idempotencyKey)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to update product quantity: status %d", resp.StatusCode)
+		return &StatusError{Op: "failed to update product quantity", StatusCode: resp.StatusCode}
 	}
 
 	return nil
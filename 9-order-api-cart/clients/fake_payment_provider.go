@@ -0,0 +1,185 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"order-api-cart/models"
+
+	"github.com/google/uuid"
+)
+
+// Outcomes of the fake payment provider's charges
+const (
+	FakeOutcomeSuccess = "success"
+	FakeOutcomeDecline = "decline"
+	FakeOutcome3DS     = "3ds" // requires a 3-D Secure challenge, settled by webhook
+)
+
+// FakePaymentProvider is an in-process PaymentProvider for development and
+// tests. Charges get the configured outcome unless the payment method names
+// one of the FakeOutcome* values, so a single instance can exercise every
+// path. Charges awaiting a 3-D Secure challenge are settled with
+// CompleteAction, which returns the signed webhook the real provider would
+// send.
+type FakePaymentProvider struct {
+	outcome   string
+	secret    string
+	tolerance time.Duration
+
+	mu      sync.Mutex
+	charges map[string]*fakeCharge // by idempotency key
+	byRef   map[string]*fakeCharge
+}
+
+type fakeCharge struct {
+	result   ChargeResult
+	refunded bool
+}
+
+// NewFakePaymentProvider creates a fake provider whose charges get outcome by
+// default and whose webhooks are signed with secret and accepted for tolerance
+func NewFakePaymentProvider(outcome, secret string, tolerance time.Duration) (*FakePaymentProvider, error) {
+	if !isFakeOutcome(outcome) {
+		return nil, fmt.Errorf("unknown fake payment outcome %q (want %s, %s or %s)",
+			outcome, FakeOutcomeSuccess, FakeOutcomeDecline, FakeOutcome3DS)
+	}
+	return &FakePaymentProvider{
+		outcome:   outcome,
+		secret:    secret,
+		tolerance: tolerance,
+		charges:   make(map[string]*fakeCharge),
+		byRef:     make(map[string]*fakeCharge),
+	}, nil
+}
+
+func isFakeOutcome(outcome string) bool {
+	return outcome == FakeOutcomeSuccess || outcome == FakeOutcomeDecline || outcome == FakeOutcome3DS
+}
+
+// Name identifies the fake provider
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+// Charge settles a charge immediately, or leaves it awaiting CompleteAction
+// for the 3-D Secure outcome
+func (p *FakePaymentProvider) Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if charge, ok := p.charges[req.IdempotencyKey]; ok {
+		result := charge.result
+		return &result, nil
+	}
+
+	outcome := p.outcome
+	if isFakeOutcome(req.PaymentMethod) {
+		outcome = req.PaymentMethod
+	}
+
+	ref := "fake_" + uuid.New().String()
+	charge := &fakeCharge{result: ChargeResult{ProviderRef: ref}}
+	switch outcome {
+	case FakeOutcomeSuccess:
+		charge.result.Status = models.PaymentStatusSucceeded
+	case FakeOutcomeDecline:
+		charge.result.Status = models.PaymentStatusDeclined
+		charge.result.Reason = "card declined"
+	case FakeOutcome3DS:
+		charge.result.Status = models.PaymentStatusRequiresAction
+		charge.result.ActionURL = "https://payments.example.com/3ds/" + ref
+	}
+	p.charges[req.IdempotencyKey] = charge
+	p.byRef[ref] = charge
+
+	result := charge.result
+	return &result, nil
+}
+
+// Refund marks a succeeded charge as refunded
+func (p *FakePaymentProvider) Refund(ctx context.Context, providerRef string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.byRef[providerRef]
+	if !ok {
+		return fmt.Errorf("charge %s not found", providerRef)
+	}
+	if charge.result.Status != models.PaymentStatusSucceeded {
+		return fmt.Errorf("charge %s is %s and cannot be refunded", providerRef, charge.result.Status)
+	}
+	charge.refunded = true
+	return nil
+}
+
+// Refunded reports whether a charge was refunded
+func (p *FakePaymentProvider) Refunded(providerRef string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.byRef[providerRef]
+	return ok && charge.refunded
+}
+
+// ParseWebhook verifies a webhook signed by this provider
+func (p *FakePaymentProvider) ParseWebhook(payload []byte, signature string) (*PaymentEvent, error) {
+	if err := VerifyPaymentWebhook(p.secret, payload, signature, p.tolerance); err != nil {
+		return nil, err
+	}
+
+	var event PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhookEvent, err)
+	}
+	if event.ProviderRef == "" || (event.Status != models.PaymentStatusSucceeded && event.Status != models.PaymentStatusDeclined) {
+		return nil, fmt.Errorf("%w: ref %q, status %q", ErrInvalidWebhookEvent, event.ProviderRef, event.Status)
+	}
+	return &event, nil
+}
+
+// CompleteAction settles a charge awaiting a 3-D Secure challenge, as if the
+// customer had passed it or failed it, and returns the webhook payload and
+// signature the provider sends to report the outcome
+func (p *FakePaymentProvider) CompleteAction(providerRef string, passed bool) ([]byte, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.byRef[providerRef]
+	if !ok {
+		return nil, "", fmt.Errorf("charge %s not found", providerRef)
+	}
+	if charge.result.Status != models.PaymentStatusRequiresAction {
+		return nil, "", fmt.Errorf("charge %s is %s and awaits no action", providerRef, charge.result.Status)
+	}
+
+	charge.result.ActionURL = ""
+	if passed {
+		charge.result.Status = models.PaymentStatusSucceeded
+	} else {
+		charge.result.Status = models.PaymentStatusDeclined
+		charge.result.Reason = "3-D Secure authentication failed"
+	}
+
+	payload, err := json.Marshal(PaymentEvent{
+		ID:          uuid.New().String(),
+		ProviderRef: providerRef,
+		Status:      charge.result.Status,
+		Reason:      charge.result.Reason,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode webhook: %w", err)
+	}
+	return payload, SignPaymentWebhook(p.secret, payload, time.Now()), nil
+}
@@ -0,0 +1,142 @@
+package clients
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"order-api-cart/config"
+)
+
+// PaymentProvider charges customers and reports the outcome of charges that
+// complete asynchronously through signed webhooks
+type PaymentProvider interface {
+	// Name identifies the provider in stored payments
+	Name() string
+
+	// Charge charges the request's amount. A retried request with the same
+	// IdempotencyKey returns the outcome of the first one instead of charging
+	// again. A declined charge is a result, not an error; errors mean the
+	// outcome is unknown.
+	Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error)
+
+	// Refund returns a succeeded charge to the customer. Refunding a charge
+	// again succeeds.
+	Refund(ctx context.Context, providerRef string) error
+
+	// ParseWebhook verifies a webhook's signature header and returns the event
+	// it carries. A missing, invalid or stale signature fails with
+	// ErrInvalidWebhookSignature, an unreadable event with
+	// ErrInvalidWebhookEvent.
+	ParseWebhook(payload []byte, signature string) (*PaymentEvent, error)
+}
+
+// NewPaymentProvider creates the configured payment provider. An empty webhook
+// secret is replaced by a random one, which only the in-process fake provider
+// can sign with.
+func NewPaymentProvider(cfg config.PaymentConfig) (PaymentProvider, error) {
+	secret := cfg.WebhookSecret
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		secret = hex.EncodeToString(key)
+	}
+
+	switch cfg.Provider {
+	case "fake":
+		return NewFakePaymentProvider(cfg.FakeOutcome, secret, cfg.WebhookTolerance)
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.Provider)
+	}
+}
+
+// ChargeRequest is a charge of an order's total
+type ChargeRequest struct {
+	IdempotencyKey string
+	OrderID        string
+	Amount         float64
+	PaymentMethod  string
+}
+
+// ChargeResult is the provider's answer to a charge. Status is a
+// models.PaymentStatus* value: succeeded, declined with Reason, or
+// requires_action with the ActionURL the customer must visit, in which case
+// the final status arrives by webhook.
+type ChargeResult struct {
+	ProviderRef string
+	Status      string
+	Reason      string
+	ActionURL   string
+}
+
+// PaymentEvent is the final outcome of a charge, delivered by webhook
+type PaymentEvent struct {
+	ID          string `json:"id"`
+	ProviderRef string `json:"provider_ref"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// PaymentSignatureHeader is the header carrying a payment webhook's signature
+const PaymentSignatureHeader = "X-Payment-Signature"
+
+var (
+	// ErrInvalidWebhookSignature is returned for a webhook whose signature
+	// does not match its payload or is too old
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+	// ErrInvalidWebhookEvent is returned for a correctly signed webhook that
+	// does not carry a payment outcome
+	ErrInvalidWebhookEvent = errors.New("invalid webhook event")
+)
+
+// SignPaymentWebhook returns the signature header of a webhook payload sent at
+// the given time: "t=<unix seconds>,v1=<hex HMAC-SHA256 of t.payload>". The
+// timestamp is signed too, so a captured webhook cannot be replayed later.
+func SignPaymentWebhook(secret string, payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + paymentWebhookMAC(secret, timestamp, payload)
+}
+
+// VerifyPaymentWebhook checks a signature made by SignPaymentWebhook, accepting
+// webhooks signed at most tolerance ago
+func VerifyPaymentWebhook(secret string, payload []byte, signature string, tolerance time.Duration) error {
+	var timestamp, mac string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			mac = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || mac == "" {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidWebhookSignature)
+	}
+	if !hmac.Equal([]byte(mac), []byte(paymentWebhookMAC(secret, timestamp, payload))) {
+		return ErrInvalidWebhookSignature
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: signed %s ago", ErrInvalidWebhookSignature, age.Round(time.Second))
+	}
+	return nil
+}
+
+func paymentWebhookMAC(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,153 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"order-api-cart/models"
+)
+
+// maxCachedProducts bounds the cache; expired entries are purged once it is full
+const maxCachedProducts = 10000
+
+// cachedProduct is a product and the time it stops being served from the cache
+type cachedProduct struct {
+	product   *models.ExternalProduct
+	expiresAt time.Time
+}
+
+// ProductCache is a short-lived in-process cache in front of the product
+// service. Products missing from the cache are fetched in batches of batchSize
+// IDs, with at most workers batch requests in flight at once.
+//
+// Cached products may be up to ttl old, so the cache is only meant for display
+// (order responses); anything that depends on current stock must call the
+// product service directly.
+type ProductCache struct {
+	client    *ProductServiceClient
+	ttl       time.Duration
+	batchSize int
+	workers   int
+
+	mu       sync.Mutex
+	products map[uint]cachedProduct
+}
+
+// NewProductCache creates a new product cache. batchSize is capped at
+// MaxProductBatchSize and workers is at least 1.
+func NewProductCache(client *ProductServiceClient, ttl time.Duration, batchSize, workers int) *ProductCache {
+	if batchSize <= 0 || batchSize > MaxProductBatchSize {
+		batchSize = MaxProductBatchSize
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return &ProductCache{
+		client:    client,
+		ttl:       ttl,
+		batchSize: batchSize,
+		workers:   workers,
+		products:  make(map[uint]cachedProduct),
+	}
+}
+
+// GetProducts returns the products with the given IDs, keyed by ID. IDs the
+// product service does not know are absent from the result. If some batches
+// fail, the products that could be loaded are returned together with the error.
+func (c *ProductCache) GetProducts(ctx context.Context, productIDs []uint, authToken string) (map[uint]*models.ExternalProduct, error) {
+	products := make(map[uint]*models.ExternalProduct, len(productIDs))
+	seen := make(map[uint]bool, len(productIDs))
+	var missing []uint
+
+	c.mu.Lock()
+	now := time.Now()
+	for _, id := range productIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if entry, ok := c.products[id]; ok && now.Before(entry.expiresAt) {
+			products[id] = entry.product
+			continue
+		}
+		missing = append(missing, id)
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return products, nil
+	}
+
+	fetched, err := c.fetch(ctx, missing, authToken)
+	c.Store(fetched)
+	for id, product := range fetched {
+		products[id] = product
+	}
+	return products, err
+}
+
+// Store caches products, e.g. ones just fetched directly from the product service
+func (c *ProductCache) Store(products map[uint]*models.ExternalProduct) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.products)+len(products) > maxCachedProducts {
+		for id, entry := range c.products {
+			if !now.Before(entry.expiresAt) {
+				delete(c.products, id)
+			}
+		}
+	}
+	for id, product := range products {
+		if len(c.products) >= maxCachedProducts {
+			break
+		}
+		c.products[id] = cachedProduct{product: product, expiresAt: now.Add(c.ttl)}
+	}
+}
+
+// fetch loads productIDs from the product service in concurrent batches
+func (c *ProductCache) fetch(ctx context.Context, productIDs []uint, authToken string) (map[uint]*models.ExternalProduct, error) {
+	var batches [][]uint
+	for start := 0; start < len(productIDs); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(productIDs) {
+			end = len(productIDs)
+		}
+		batches = append(batches, productIDs[start:end])
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		products = make(map[uint]*models.ExternalProduct, len(productIDs))
+		errs     []error
+		sem      = make(chan struct{}, c.workers)
+	)
+	for _, batch := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(batch []uint) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result, err := c.client.GetProductsByIDs(ctx, batch, authToken)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			for id, product := range result {
+				products[id] = product
+			}
+		}(batch)
+	}
+	wg.Wait()
+
+	return products, errors.Join(errs...)
+}
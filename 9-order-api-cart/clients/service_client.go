@@ -0,0 +1,151 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"order-api-cart/config"
+)
+
+// maxResponseSize bounds how much of a response body is read
+const maxResponseSize = 10 << 20 // 10 MB
+
+// response is a service's answer, read in full so that the attempt's timeout
+// can be released before the caller decodes it
+type response struct {
+	StatusCode int
+	Body       []byte
+}
+
+// serviceClient sends requests to one service with a timeout per attempt,
+// retries for idempotent requests and a circuit breaker shared by every call
+// to the service. Calls are bound to the caller's context, so a cancelled
+// incoming request aborts the calls made on its behalf.
+type serviceClient struct {
+	baseURL string
+	client  *http.Client
+	breaker *CircuitBreaker
+	cfg     config.ClientConfig
+}
+
+func newServiceClient(name, baseURL string, cfg config.ClientConfig) serviceClient {
+	return serviceClient{
+		baseURL: baseURL,
+		client:  &http.Client{},
+		breaker: NewCircuitBreaker(name, cfg.BreakerFailures, cfg.BreakerCooldown),
+		cfg:     cfg,
+	}
+}
+
+// Breaker returns the service's circuit breaker
+func (c *serviceClient) Breaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// do sends a request to path and returns the service's response. authToken is
+// sent as the Authorization header, a non-empty idempotencyKey as the
+// Idempotency-Key header and a non-nil body as JSON.
+//
+// GET requests are retried with backoff when the service cannot be reached,
+// times out or answers 408, 429 or 5xx; the last response or error is
+// returned. Other methods are sent once: whether they may be repeated is up to
+// the caller.
+func (c *serviceClient) do(ctx context.Context, method, path string, body []byte, authToken, idempotencyKey string) (*response, error) {
+	retries := 0
+	if method == http.MethodGet {
+		retries = c.cfg.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(ctx, method, path, body, authToken, idempotencyKey)
+		if attempt >= retries || ctx.Err() != nil || !isRetryable(resp, err) {
+			return resp, err
+		}
+
+		timer := time.NewTimer(c.backoff(attempt + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends a request once, through the circuit breaker
+func (c *serviceClient) attempt(ctx context.Context, method, path string, body []byte, authToken, idempotencyKey string) (*response, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(attemptCtx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", authToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	var data []byte
+	if err == nil {
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		resp.Body.Close()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the service
+			c.breaker.Abandon()
+		} else {
+			c.breaker.Failure()
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		c.breaker.Failure()
+	} else {
+		c.breaker.Success()
+	}
+	return &response{StatusCode: resp.StatusCode, Body: data}, nil
+}
+
+// backoff returns the delay before the given retry: RetryBaseDelay doubled per
+// retry, capped at RetryMaxDelay, of which a random half is waited so that
+// callers failing together do not retry in lockstep
+func (c *serviceClient) backoff(retry int) time.Duration {
+	delay := c.cfg.RetryBaseDelay
+	for i := 1; i < retry && delay < c.cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.cfg.RetryMaxDelay {
+		delay = c.cfg.RetryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// isRetryable reports whether a failed attempt may succeed if repeated
+func isRetryable(resp *response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen)
+	}
+	code := resp.StatusCode
+	return code >= http.StatusInternalServerError || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
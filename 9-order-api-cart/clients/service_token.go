@@ -0,0 +1,74 @@
+package clients
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"order-api-cart/config"
+)
+
+// ServiceTokenSource provides the Authorization header for calls the service
+// makes on its own behalf rather than a user's.
+//
+// With client credentials configured, it gets access tokens with the service
+// role from the auth service and renews each one once three quarters of its
+// lifetime have passed, so a token is never used close to its expiry. If the
+// auth service cannot be reached, the current token is used for as long as it
+// is valid. Without client credentials the static token is used as is.
+type ServiceTokenSource struct {
+	auth         *AuthServiceClient
+	clientID     string
+	clientSecret string
+	staticToken  string
+
+	mu        sync.Mutex
+	token     string
+	renewAt   time.Time
+	expiresAt time.Time
+}
+
+// NewServiceTokenSource creates a token source for the credentials in cfg,
+// getting tokens from auth
+func NewServiceTokenSource(auth *AuthServiceClient, cfg config.ServicesConfig) *ServiceTokenSource {
+	return &ServiceTokenSource{
+		auth:         auth,
+		clientID:     cfg.ServiceClientID,
+		clientSecret: cfg.ServiceClientSecret,
+		staticToken:  cfg.ServiceToken,
+	}
+}
+
+// Authorization returns the Authorization header value, "Bearer <token>", or
+// "" when no service token is configured
+func (s *ServiceTokenSource) Authorization(ctx context.Context) (string, error) {
+	if s.clientID == "" {
+		if s.staticToken == "" {
+			return "", nil
+		}
+		return "Bearer " + s.staticToken, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.token != "" && now.Before(s.renewAt) {
+		return "Bearer " + s.token, nil
+	}
+
+	token, lifetime, err := s.auth.ServiceToken(ctx, s.clientID, s.clientSecret)
+	if err != nil {
+		if s.token != "" && now.Before(s.expiresAt) {
+			log.Printf("WARNING: failed to renew the service token, using the current one until it expires: %v", err)
+			return "Bearer " + s.token, nil
+		}
+		return "", err
+	}
+
+	s.token = token
+	s.renewAt = now.Add(lifetime * 3 / 4)
+	s.expiresAt = now.Add(lifetime)
+	return "Bearer " + s.token, nil
+}
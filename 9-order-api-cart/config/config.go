@@ -4,16 +4,25 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	JWT      JWTConfig
-	Services ServicesConfig
+	Database    DatabaseConfig
+	Server      ServerConfig
+	JWT         JWTConfig
+	Services    ServicesConfig
+	Clients     ClientConfig
+	Outbox      OutboxConfig
+	Products    ProductCacheConfig
+	Pagination  PaginationConfig
+	Idempotency IdempotencyConfig
+	Reservation ReservationConfig
+	Payments    PaymentConfig
 }
 
 // DatabaseConfig holds database configuration
@@ -31,15 +40,94 @@ type ServerConfig struct {
 	Port string
 }
 
-// JWTConfig holds JWT configuration
+// JWTConfig holds JWT configuration. Setting JWKSURL or JWKSFile switches token
+// verification from the shared secret to the auth service's public keys.
 type JWTConfig struct {
-	Secret string
+	Secret       string
+	JWKSURL      string
+	JWKSFile     string
+	JWKSCacheTTL time.Duration
 }
 
-// ServicesConfig holds external service configuration
+// ServicesConfig holds external service configuration. Calls made outside a
+// user request, such as delivering inventory commands from the outbox, and
+// stock reservations, which the product service only accepts from the service
+// role, carry a service token. With ServiceClientID and ServiceClientSecret it
+// is obtained from the auth service and renewed before it expires; otherwise
+// the static ServiceToken is used.
 type ServicesConfig struct {
-	AuthServiceURL    string
-	ProductServiceURL string
+	AuthServiceURL      string
+	ProductServiceURL   string
+	ServiceToken        string
+	ServiceClientID     string
+	ServiceClientSecret string
+}
+
+// ClientConfig controls calls to the auth and product services. Each attempt
+// is abandoned after Timeout. Idempotent GET requests are retried up to
+// MaxRetries times after RetryBaseDelay, doubling up to RetryMaxDelay, with
+// jitter. After BreakerFailures consecutive failures a service's circuit
+// breaker opens and calls to it fail fast for BreakerCooldown.
+type ClientConfig struct {
+	Timeout         time.Duration
+	MaxRetries      int
+	RetryBaseDelay  time.Duration
+	RetryMaxDelay   time.Duration
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+// ProductCacheConfig controls how product details shown in order responses are
+// fetched: cached for TTL, requested BatchSize IDs at a time, with at most
+// Workers requests to the product service in flight per lookup.
+type ProductCacheConfig struct {
+	TTL       time.Duration
+	BatchSize int
+	Workers   int
+}
+
+// PaginationConfig holds list pagination configuration. CursorSecret signs
+// pagination cursors; when empty a random secret is generated at startup.
+type PaginationConfig struct {
+	CursorSecret string
+}
+
+// IdempotencyConfig controls Idempotency-Key handling. A key is remembered,
+// and its response replayed, for TTL after its first use; expired keys are
+// deleted every CleanupInterval.
+type IdempotencyConfig struct {
+	TTL             time.Duration
+	CleanupInterval time.Duration
+}
+
+// ReservationConfig controls the stock reservations made for new orders. A
+// pending order's stock is held for TTL; an order not confirmed by then loses
+// its reservation and can no longer be confirmed.
+type ReservationConfig struct {
+	TTL time.Duration
+}
+
+// PaymentConfig selects the payment provider. Only the in-process "fake"
+// provider exists; its charges get FakeOutcome (success, decline or 3ds)
+// unless the payment method names another outcome. Webhooks must be signed
+// with WebhookSecret no longer than WebhookTolerance ago; when the secret is
+// empty a random one is generated at startup.
+type PaymentConfig struct {
+	Provider         string
+	FakeOutcome      string
+	WebhookSecret    string
+	WebhookTolerance time.Duration
+}
+
+// OutboxConfig controls delivery of inventory commands to the product service.
+// A failed message is retried after BaseBackoff, doubling up to MaxBackoff, and
+// is dead-lettered after MaxAttempts.
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
 }
 
 // LoadConfig loads configuration from environment variables and .env file
@@ -62,11 +150,53 @@ func LoadConfig() *Config {
 			Port: getEnv("SERVER_PORT", "8080"),
 		},
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "your-secret-key"),
+			Secret:       getEnv("JWT_SECRET", "your-secret-key"),
+			JWKSURL:      getEnv("JWKS_URL", ""),
+			JWKSFile:     getEnv("JWKS_FILE", ""),
+			JWKSCacheTTL: getEnvDuration("JWKS_CACHE_TTL", 5*time.Minute),
 		},
 		Services: ServicesConfig{
-			AuthServiceURL:    getEnv("AUTH_SERVICE_URL", "http://localhost:8081"),
-			ProductServiceURL: getEnv("PRODUCT_SERVICE_URL", "http://localhost:8082"),
+			AuthServiceURL:      getEnv("AUTH_SERVICE_URL", "http://localhost:8081"),
+			ProductServiceURL:   getEnv("PRODUCT_SERVICE_URL", "http://localhost:8082"),
+			ServiceToken:        getEnv("SERVICE_AUTH_TOKEN", ""),
+			ServiceClientID:     getEnv("SERVICE_CLIENT_ID", ""),
+			ServiceClientSecret: getEnv("SERVICE_CLIENT_SECRET", ""),
+		},
+		Clients: ClientConfig{
+			Timeout:         getEnvDuration("SERVICE_TIMEOUT", 5*time.Second),
+			MaxRetries:      getEnvInt("SERVICE_MAX_RETRIES", 2),
+			RetryBaseDelay:  getEnvDuration("SERVICE_RETRY_BASE_DELAY", 100*time.Millisecond),
+			RetryMaxDelay:   getEnvDuration("SERVICE_RETRY_MAX_DELAY", 2*time.Second),
+			BreakerFailures: getEnvInt("SERVICE_BREAKER_FAILURES", 5),
+			BreakerCooldown: getEnvDuration("SERVICE_BREAKER_COOLDOWN", 30*time.Second),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			BatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 50),
+			MaxAttempts:  getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+			BaseBackoff:  getEnvDuration("OUTBOX_BASE_BACKOFF", time.Second),
+			MaxBackoff:   getEnvDuration("OUTBOX_MAX_BACKOFF", 5*time.Minute),
+		},
+		Products: ProductCacheConfig{
+			TTL:       getEnvDuration("PRODUCT_CACHE_TTL", 30*time.Second),
+			BatchSize: getEnvInt("PRODUCT_BATCH_SIZE", 50),
+			Workers:   getEnvInt("PRODUCT_FETCH_WORKERS", 4),
+		},
+		Pagination: PaginationConfig{
+			CursorSecret: getEnv("PAGINATION_CURSOR_SECRET", ""),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:             getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+			CleanupInterval: getEnvDuration("IDEMPOTENCY_CLEANUP_INTERVAL", time.Hour),
+		},
+		Reservation: ReservationConfig{
+			TTL: getEnvDuration("RESERVATION_TTL", 15*time.Minute),
+		},
+		Payments: PaymentConfig{
+			Provider:         getEnv("PAYMENT_PROVIDER", "fake"),
+			FakeOutcome:      getEnv("PAYMENT_FAKE_OUTCOME", "success"),
+			WebhookSecret:    getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+			WebhookTolerance: getEnvDuration("PAYMENT_WEBHOOK_TOLERANCE", 5*time.Minute),
 		},
 	}
 }
@@ -90,3 +220,25 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvDuration gets a duration environment variable with a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvInt gets an integer environment variable with a default value
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+		log.Printf("Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
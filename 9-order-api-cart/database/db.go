@@ -28,9 +28,19 @@ func Connect(cfg *config.Config) error {
 
 // Migrate runs database migrations
 func Migrate() error {
+	if err := migrateProductIDs(DB); err != nil {
+		return err
+	}
+
 	err := DB.AutoMigrate(
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusHistory{},
+		&models.OutboxMessage{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.IdempotencyRecord{},
+		&models.Payment{},
 	)
 
 	if err != nil {
@@ -41,6 +51,83 @@ func Migrate() error {
 	return nil
 }
 
+// migrateProductIDs converts product_id columns from the UUIDs the order
+// service used to store to the stat service's numeric product IDs, which
+// AutoMigrate cannot do on its own. UUIDs have no numeric equivalent, so:
+//   - order items keep theirs in legacy_product_id and get product ID 0, which
+//     the product service does not know
+//   - cart items referencing them are deleted, as they could never be checked out
+//   - pending outbox messages referencing them are dead-lettered; messages with
+//     numeric IDs keep them
+//
+// Tables whose product_id is already numeric, or that do not exist yet, are
+// left alone, so this is a no-op once it has run.
+func migrateProductIDs(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if legacy, err := hasLegacyProductIDs(tx, "order_items"); err != nil {
+			return err
+		} else if legacy {
+			log.Println("Moving UUID product IDs of order items to legacy_product_id")
+			statements := []string{
+				`ALTER TABLE order_items RENAME COLUMN product_id TO legacy_product_id`,
+				`ALTER TABLE order_items ALTER COLUMN legacy_product_id DROP NOT NULL`,
+				`ALTER TABLE order_items ADD COLUMN product_id bigint NOT NULL DEFAULT 0`,
+				`ALTER TABLE order_items ALTER COLUMN product_id DROP DEFAULT`,
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if legacy, err := hasLegacyProductIDs(tx, "cart_items"); err != nil {
+			return err
+		} else if legacy {
+			result := tx.Exec(`DELETE FROM cart_items`)
+			if result.Error != nil {
+				return result.Error
+			}
+			log.Printf("Deleted %d cart items with UUID product IDs", result.RowsAffected)
+			if err := tx.Exec(`ALTER TABLE cart_items ALTER COLUMN product_id TYPE bigint USING 0`).Error; err != nil {
+				return err
+			}
+		}
+
+		if legacy, err := hasLegacyProductIDs(tx, "outbox_messages"); err != nil {
+			return err
+		} else if legacy {
+			result := tx.Exec(`UPDATE outbox_messages SET status = ?, last_error = ?
+				WHERE status = ? AND product_id !~ '^[0-9]+$'`,
+				models.OutboxStatusDead, "product ID is not a numeric product ID", models.OutboxStatusPending)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				log.Printf("ERROR: ALERT dead-lettered %d pending outbox messages with UUID product IDs, their stock changes must be applied by hand", result.RowsAffected)
+			}
+			if err := tx.Exec(`ALTER TABLE outbox_messages ALTER COLUMN product_id TYPE bigint
+				USING CASE WHEN product_id ~ '^[0-9]+$' THEN product_id::bigint ELSE 0 END`).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// hasLegacyProductIDs reports whether table has a product_id column that is not
+// numeric
+func hasLegacyProductIDs(db *gorm.DB, table string) (bool, error) {
+	var dataType string
+	err := db.Raw(`SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_name = 'product_id'`, table).
+		Scan(&dataType).Error
+	if err != nil {
+		return false, err
+	}
+	return dataType != "" && dataType != "bigint" && dataType != "integer", nil
+}
+
 // GetDB returns the database instance
 func GetDB() *gorm.DB {
 	return DB
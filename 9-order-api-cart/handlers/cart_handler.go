@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"order-api-cart/clients"
+	"order-api-cart/middleware"
+	"order-api-cart/models"
+	"order-api-cart/service"
+	"order-api-cart/validation"
+)
+
+// CartHandler handles shopping cart HTTP requests
+type CartHandler struct {
+	cartService *service.CartService
+	validator   *validation.Validator
+}
+
+// NewCartHandler creates a new cart handler
+func NewCartHandler(cartService *service.CartService) *CartHandler {
+	return &CartHandler{
+		cartService: cartService,
+		validator:   validation.New(),
+	}
+}
+
+// GetCart handles GET /cart
+func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	cart, err := h.cartService.GetCart(r.Context(), userID, r.Header.Get("Authorization"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get cart: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+// ReplaceCart handles PUT /cart with the cart's new items
+func (h *CartHandler) ReplaceCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !middleware.ValidateStruct(w, h.validator, &req) {
+		return
+	}
+
+	cart, err := h.cartService.ReplaceCart(r.Context(), userID, req.Items, r.Header.Get("Authorization"))
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+// ClearCart handles DELETE /cart
+func (h *CartHandler) ClearCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.cartService.ClearCart(userID); err != nil {
+		if errors.Is(err, service.ErrCheckoutInProgress) {
+			http.Error(w, "The cart is being checked out", http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to clear cart: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddItem handles POST /cart/items, adding to the quantity already in the cart
+func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.OrderItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !middleware.ValidateStruct(w, h.validator, &req) {
+		return
+	}
+
+	cart, err := h.cartService.AddItem(r.Context(), userID, req, r.Header.Get("Authorization"))
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+// UpdateItem handles PUT /cart/items/{product_id}, setting the item's quantity
+func (h *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	productID, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/v1/cart/items/"), 10, 32)
+	if err != nil {
+		writeCartError(w, service.ErrCartItemNotFound)
+		return
+	}
+
+	var req models.CartItemQuantityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !middleware.ValidateStruct(w, h.validator, &req) {
+		return
+	}
+
+	cart, err := h.cartService.SetItemQuantity(r.Context(), userID, uint(productID), req.Quantity, r.Header.Get("Authorization"))
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+// RemoveItem handles DELETE /cart/items/{product_id}
+func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	productID, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/v1/cart/items/"), 10, 32)
+	if err != nil {
+		writeCartError(w, service.ErrCartItemNotFound)
+		return
+	}
+
+	cart, err := h.cartService.RemoveItem(r.Context(), userID, uint(productID), r.Header.Get("Authorization"))
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	writeCart(w, cart)
+}
+
+// Checkout handles POST /cart/checkout, placing an order for the cart's items
+func (h *CartHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	order, err := h.cartService.Checkout(r.Context(), userID, r.Header.Get("Authorization"))
+	if err != nil {
+		if errors.Is(err, service.ErrCartEmpty) {
+			http.Error(w, "Cart is empty", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrCheckoutInProgress) {
+			http.Error(w, "The cart is already being checked out", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, clients.ErrCircuitOpen) {
+			http.Error(w, "A dependent service is unavailable, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	body, err := json.Marshal(order)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
+}
+
+// writeCartError maps a cart service error to its HTTP response
+func writeCartError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrCartItemNotFound):
+		http.Error(w, "Product is not in the cart", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidCartItem):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrCheckoutInProgress):
+		http.Error(w, "The cart is being checked out", http.StatusConflict)
+	case errors.Is(err, clients.ErrCircuitOpen):
+		http.Error(w, "Product service is unavailable, try again later", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to update cart: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// writeCart writes a cart as the JSON response
+func writeCart(w http.ResponseWriter, cart *models.CartResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cart); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
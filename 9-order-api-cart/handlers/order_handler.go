@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"order-api-cart/clients"
 	"order-api-cart/middleware"
 	"order-api-cart/models"
 	"order-api-cart/service"
@@ -15,19 +19,30 @@ import (
 
 // OrderHandler handles order-related HTTP requests
 type OrderHandler struct {
-	orderService *service.OrderService
-	validator    *validation.Validator
+	orderService       *service.OrderService
+	idempotencyService *service.IdempotencyService
+	validator          *validation.Validator
 }
 
 // NewOrderHandler creates a new order handler
-func NewOrderHandler(authServiceURL, productServiceURL string) *OrderHandler {
+func NewOrderHandler(orderService *service.OrderService, idempotencyService *service.IdempotencyService) *OrderHandler {
 	return &OrderHandler{
-		orderService: service.NewOrderService(authServiceURL, productServiceURL),
-		validator:    validation.New(),
+		orderService:       orderService,
+		idempotencyService: idempotencyService,
+		validator:          validation.New(),
 	}
 }
 
-// CreateOrder handles POST /order
+// maxIdempotencyKeyLength is the longest Idempotency-Key header accepted
+const maxIdempotencyKeyLength = 255
+
+// CreateOrder handles POST /order. With an Idempotency-Key header, a retry of
+// the same request by the same user replays the original response instead of
+// creating another order; reusing the key for a different request is rejected
+// with 422. Only successful responses are remembered, so a failed request can
+// be retried with its key. The key is tied to the order in the order's own
+// transaction, so should storing the response fail, retries rebuild it from
+// the order rather than creating another.
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -52,23 +67,109 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := h.orderService.CreateOrder(userID, &req, authToken)
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			http.Error(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength), http.StatusBadRequest)
+			return
+		}
+
+		// Hash the decoded request, so retries that only differ in formatting match
+		normalized, err := json.Marshal(&req)
+		if err != nil {
+			http.Error(w, "Failed to encode request", http.StatusInternalServerError)
+			return
+		}
+
+		record, err := h.idempotencyService.Begin(userID, idempotencyKey, service.RequestHash(r.URL.Path, normalized))
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrIdempotencyKeyReused):
+				http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+			case errors.Is(err, service.ErrIdempotencyKeyInProgress):
+				http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+			default:
+				http.Error(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+		if record != nil && record.StatusCode == 0 {
+			// The order was created but its response was not stored
+			h.replayOrder(w, r, userID, idempotencyKey, *record.OrderID, authToken)
+			return
+		}
+		if record != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Response)
+			return
+		}
+	}
+
+	order, err := h.orderService.CreateOrder(r.Context(), userID, &req, idempotencyKey, authToken)
 	if err != nil {
+		h.releaseIdempotencyKey(userID, idempotencyKey)
+		if errors.Is(err, clients.ErrCircuitOpen) {
+			http.Error(w, "A dependent service is unavailable, try again later", http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusBadRequest)
 		return
 	}
 
+	body, err := json.Marshal(order)
+	if err != nil {
+		h.releaseIdempotencyKey(userID, idempotencyKey)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	if idempotencyKey != "" {
+		// The key already names the order, so retries find it even if this fails
+		if err := h.idempotencyService.Complete(userID, idempotencyKey, http.StatusCreated, body); err != nil {
+			log.Printf("WARNING: order %s created but its idempotent response was not stored, retries rebuild it: %v", order.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
+}
+
+// replayOrder answers a retry whose idempotency key names an order created by
+// an earlier request that did not store its response, and stores it now
+func (h *OrderHandler) replayOrder(w http.ResponseWriter, r *http.Request, userID, idempotencyKey, orderID, authToken string) {
+	order, err := h.orderService.GetOrderByID(r.Context(), orderID, userID, "", authToken)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get order: %v", err), http.StatusInternalServerError)
+		return
+	}
 	body, err := json.Marshal(order)
 	if err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
+	if err := h.idempotencyService.Complete(userID, idempotencyKey, http.StatusCreated, body); err != nil {
+		log.Printf("WARNING: idempotent response of order %s was not stored: %v", order.ID, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
 	w.WriteHeader(http.StatusCreated)
 	w.Write(body)
 }
 
+// releaseIdempotencyKey frees the key of a failed request, if it had one
+func (h *OrderHandler) releaseIdempotencyKey(userID, idempotencyKey string) {
+	if idempotencyKey == "" {
+		return
+	}
+	if err := h.idempotencyService.Release(userID, idempotencyKey); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+}
+
 // GetOrderByID handles GET /order/{id}
 func (h *OrderHandler) GetOrderByID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -88,9 +189,13 @@ func (h *OrderHandler) GetOrderByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	role, _ := r.Context().Value(middleware.RoleKey).(string)
+
 	authToken := r.Header.Get("Authorization")
 
-	order, err := h.orderService.GetOrderByID(path, authToken)
+	// Other users' orders are reported as not found rather than forbidden, so
+	// order IDs cannot be probed for existence
+	order, err := h.orderService.GetOrderByID(r.Context(), path, userID, role, authToken)
 	if err != nil {
 		if err.Error() == "order not found" {
 			http.Error(w, "Order not found", http.StatusNotFound)
@@ -100,8 +205,70 @@ func (h *OrderHandler) GetOrderByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if order.UserID != userID {
-		http.Error(w, "You can only access your own orders", http.StatusForbidden)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// orderActions maps the action in POST /order/{id}/{action} to the status it sets
+var orderActions = map[string]string{
+	"confirm": models.OrderStatusConfirmed,
+	"ship":    models.OrderStatusShipped,
+	"deliver": models.OrderStatusDelivered,
+	"cancel":  models.OrderStatusCancelled,
+}
+
+// UpdateOrderStatus handles POST /order/{id}/cancel|confirm|ship|deliver.
+// The request body is optional and may carry a reason for the change.
+func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	orderID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/order/"), "/")
+	newStatus, ok := orderActions[action]
+	if orderID == "" || !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+	role, _ := r.Context().Value(middleware.RoleKey).(string)
+
+	authToken := r.Header.Get("Authorization")
+
+	var req models.OrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !middleware.ValidateStruct(w, h.validator, &req) {
+		return
+	}
+
+	order, err := h.orderService.TransitionOrder(r.Context(), orderID, newStatus, userID, role, req.Reason, authToken)
+	if err != nil {
+		switch {
+		case err.Error() == "order not found":
+			http.Error(w, "Order not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrOrderForbidden):
+			http.Error(w, "You are not allowed to change this order", http.StatusForbidden)
+		case errors.Is(err, service.ErrInvalidStatusTransition), errors.Is(err, service.ErrReservationExpired),
+			errors.Is(err, service.ErrOrderNotPaid):
+			http.Error(w, fmt.Sprintf("Cannot %s order: %v", action, err), http.StatusConflict)
+		case errors.Is(err, clients.ErrCircuitOpen):
+			http.Error(w, "Product service is unavailable, try again later", http.StatusServiceUnavailable)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to update order: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -112,7 +279,41 @@ func (h *OrderHandler) GetOrderByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetMyOrders handles GET /my-orders
+// GetOrderHistory handles GET /order/{id}/history
+func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/order/"), "/history")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+	role, _ := r.Context().Value(middleware.RoleKey).(string)
+
+	history, err := h.orderService.GetOrderHistory(orderID, userID, role)
+	if err != nil {
+		if err.Error() == "order not found" {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get order history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"history": history}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetMyOrders handles GET /my-orders. Passing cursor (empty for the first
+// page) selects cursor pagination instead of page/limit.
 func (h *OrderHandler) GetMyOrders(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -145,7 +346,37 @@ func (h *OrderHandler) GetMyOrders(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	orders, total, err := h.orderService.GetOrdersByUserID(userID, page, limit, authToken)
+	if r.URL.Query().Has("cursor") {
+		orders, next, prev, err := h.orderService.GetOrdersByUserIDCursor(r.Context(), userID, r.URL.Query().Get("cursor"), limit, authToken)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidCursor) {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to get orders: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"orders": orders,
+			"limit":  limit,
+		}
+		if next != "" {
+			response["next_cursor"] = next
+		}
+		if prev != "" {
+			response["prev_cursor"] = prev
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	orders, total, err := h.orderService.GetOrdersByUserID(r.Context(), userID, page, limit, authToken)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get orders: %v", err), http.StatusInternalServerError)
 		return
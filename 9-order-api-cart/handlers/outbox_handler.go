@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"order-api-cart/middleware"
+	"order-api-cart/models"
+	"order-api-cart/service"
+)
+
+// OutboxHandler handles the admin endpoints for inspecting and replaying
+// inventory commands in the outbox
+type OutboxHandler struct {
+	outboxService *service.OutboxService
+}
+
+// NewOutboxHandler creates a new outbox handler
+func NewOutboxHandler(outboxService *service.OutboxService) *OutboxHandler {
+	return &OutboxHandler{outboxService: outboxService}
+}
+
+// ListMessages handles GET /admin/outbox?status=dead&limit=50
+func (h *OutboxHandler) ListMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.OutboxStatusPending, models.OutboxStatusSent, models.OutboxStatusDead, models.OutboxStatusCancelled:
+	default:
+		http.Error(w, fmt.Sprintf("Invalid status: %s", status), http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 200 {
+			limit = l
+		}
+	}
+
+	messages, err := h.outboxService.ListMessages(status, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list outbox messages: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"messages": messages,
+		"limit":    limit,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetMessage handles GET /admin/outbox/{id}
+func (h *OutboxHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/outbox/")
+
+	message, err := h.outboxService.GetMessage(id)
+	if err != nil {
+		if err.Error() == "outbox message not found" {
+			http.Error(w, "Outbox message not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get outbox message: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(message); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// ReplayMessage handles POST /admin/outbox/{id}/replay
+func (h *OutboxHandler) ReplayMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/outbox/"), "/replay")
+
+	message, err := h.outboxService.Replay(id)
+	if err != nil {
+		switch {
+		case err.Error() == "outbox message not found":
+			http.Error(w, "Outbox message not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrOutboxNotReplayable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to replay outbox message: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(message); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// requireAdmin writes a 403 response unless the caller has the admin role
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if role, _ := r.Context().Value(middleware.RoleKey).(string); role != models.RoleAdmin {
+		http.Error(w, "Admin role required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"order-api-cart/clients"
+	"order-api-cart/middleware"
+	"order-api-cart/models"
+	"order-api-cart/service"
+	"order-api-cart/validation"
+)
+
+// maxWebhookSize bounds the payment webhook bodies that are read
+const maxWebhookSize = 64 << 10 // 64 KB
+
+// PaymentHandler handles order payments and the payment provider's webhooks
+type PaymentHandler struct {
+	paymentService *service.PaymentService
+	validator      *validation.Validator
+}
+
+// NewPaymentHandler creates a new payment handler
+func NewPaymentHandler(paymentService *service.PaymentService) *PaymentHandler {
+	return &PaymentHandler{
+		paymentService: paymentService,
+		validator:      validation.New(),
+	}
+}
+
+// PayOrder handles POST /order/{id}/pay. It answers 200 when the payment
+// succeeded and the order is confirmed, 202 when the customer must complete
+// the action at the payment's action_url first, and 402 when the payment was
+// declined.
+func (h *PaymentHandler) PayOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	orderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/order/"), "/pay")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.PaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !middleware.ValidateStruct(w, h.validator, &req) {
+		return
+	}
+
+	payment, err := h.paymentService.PayOrder(r.Context(), orderID, userID, req.PaymentMethod, r.Header.Get("Authorization"))
+	if err != nil {
+		switch {
+		case err.Error() == "order not found":
+			http.Error(w, "Order not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrOrderNotPayable):
+			http.Error(w, fmt.Sprintf("Cannot pay order: %v", err), http.StatusConflict)
+		case errors.Is(err, service.ErrReservationExpired):
+			http.Error(w, fmt.Sprintf("Cannot pay order: %v, the payment was refunded", err), http.StatusConflict)
+		case errors.Is(err, service.ErrPaymentProvider):
+			http.Error(w, "Payment provider did not answer, pay again to retry the same charge", http.StatusBadGateway)
+		case errors.Is(err, clients.ErrCircuitOpen):
+			http.Error(w, "Product service is unavailable, pay again later to confirm the order", http.StatusServiceUnavailable)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to pay order: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	switch payment.Status {
+	case models.PaymentStatusRequiresAction:
+		status = http.StatusAccepted
+	case models.PaymentStatusDeclined:
+		status = http.StatusPaymentRequired
+	}
+
+	body, err := json.Marshal(payment)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// PaymentWebhook handles POST /payments/webhook, signed by the payment
+// provider in the X-Payment-Signature header. Any answer other than 204 makes
+// the provider deliver the webhook again.
+func (h *PaymentHandler) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	err = h.paymentService.HandleWebhook(r.Context(), payload, r.Header.Get(clients.PaymentSignatureHeader))
+	if err != nil {
+		switch {
+		case errors.Is(err, clients.ErrInvalidWebhookSignature):
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		case errors.Is(err, clients.ErrInvalidWebhookEvent):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrPaymentNotFound):
+			http.Error(w, "Payment not found", http.StatusNotFound)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to process webhook: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"strings"
 
+	"order-api-cart/clients"
 	"order-api-cart/config"
 	"order-api-cart/database"
 	"order-api-cart/handlers"
 	"order-api-cart/middleware"
+	"order-api-cart/service"
 )
 
 func main() {
@@ -25,8 +28,35 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
-	// Create handlers with service URLs from config
-	orderHandler := handlers.NewOrderHandler(cfg.Services.AuthServiceURL, cfg.Services.ProductServiceURL)
+	if cfg.Pagination.CursorSecret == "" {
+		log.Println("WARNING: PAGINATION_CURSOR_SECRET is not set, pagination cursors are only valid until restart")
+	}
+
+	if cfg.Payments.WebhookSecret == "" {
+		log.Println("WARNING: PAYMENT_WEBHOOK_SECRET is not set, only webhooks signed by the in-process fake provider are accepted")
+	}
+
+	// One client per dependency, so each has a single circuit breaker
+	authClient := clients.NewAuthServiceClient(cfg.Services.AuthServiceURL, cfg.Clients)
+	productClient := clients.NewProductServiceClient(cfg.Services.ProductServiceURL, cfg.Clients)
+	serviceTokens := clients.NewServiceTokenSource(authClient, cfg.Services)
+	paymentProvider, err := clients.NewPaymentProvider(cfg.Payments)
+	if err != nil {
+		log.Fatal("Failed to create payment provider:", err)
+	}
+
+	// Create handlers
+	orderService := service.NewOrderService(authClient, productClient, paymentProvider, cfg.Products, cfg.Reservation, cfg.Pagination.CursorSecret, serviceTokens)
+	idempotencyService := service.NewIdempotencyService(cfg.Idempotency)
+	go idempotencyService.Run(context.Background())
+	orderHandler := handlers.NewOrderHandler(orderService, idempotencyService)
+	cartHandler := handlers.NewCartHandler(service.NewCartService(orderService))
+	paymentHandler := handlers.NewPaymentHandler(service.NewPaymentService(paymentProvider, orderService, serviceTokens))
+
+	// Start delivering queued inventory updates to the product service
+	outboxService := service.NewOutboxService(cfg.Outbox, productClient, serviceTokens)
+	go outboxService.Run(context.Background())
+	outboxHandler := handlers.NewOutboxHandler(outboxService)
 
 	// Create mux
 	mux := http.NewServeMux()
@@ -43,14 +73,63 @@ func main() {
 		}
 	})
 
-	// Order by ID endpoint
+	// Order by ID, status history, payment and status transition endpoints
 	mux.HandleFunc("/api/v1/order/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/history"):
+			orderHandler.GetOrderHistory(w, r)
+		case r.Method == http.MethodGet:
 			orderHandler.GetOrderByID(w, r)
-		} else {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/pay"):
+			paymentHandler.PayOrder(w, r)
+		case r.Method == http.MethodPost:
+			// Status transitions: /api/v1/order/{id}/cancel|confirm|ship|deliver
+			orderHandler.UpdateOrderStatus(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Cart endpoints
+	mux.HandleFunc("/api/v1/cart", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			cartHandler.GetCart(w, r)
+		case http.MethodPut:
+			cartHandler.ReplaceCart(w, r)
+		case http.MethodDelete:
+			cartHandler.ClearCart(w, r)
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/api/v1/cart/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/cart/checkout" && r.Method == http.MethodPost:
+			cartHandler.Checkout(w, r)
+		case r.URL.Path == "/api/v1/cart/items" && r.Method == http.MethodPost:
+			cartHandler.AddItem(w, r)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/cart/items/") && r.Method == http.MethodPut:
+			cartHandler.UpdateItem(w, r)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/cart/items/") && r.Method == http.MethodDelete:
+			cartHandler.RemoveItem(w, r)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+
+	// Admin outbox endpoints
+	mux.HandleFunc("/api/v1/admin/outbox", outboxHandler.ListMessages)
+	mux.HandleFunc("/api/v1/admin/outbox/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/replay") {
+			outboxHandler.ReplayMessage(w, r)
+		} else {
+			outboxHandler.GetMessage(w, r)
+		}
+	})
+
+	// Payment provider webhooks, authenticated by their signature
+	mux.HandleFunc("/api/v1/payments/webhook", paymentHandler.PaymentWebhook)
 
 	// My orders endpoint
 	mux.HandleFunc("/api/v1/my-orders", func(w http.ResponseWriter, r *http.Request) {
@@ -63,14 +142,14 @@ func main() {
 
 	// Apply middleware
 	handler := middleware.CORSMiddleware()(mux)
+	authHandler := middleware.AuthMiddleware(cfg)(handler)
 
 	// Apply auth middleware to protected routes
 	protectedHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if the request is for a protected endpoint
-		if strings.HasPrefix(r.URL.Path, "/api/v1/order") || strings.HasPrefix(r.URL.Path, "/api/v1/my-orders") {
-			// Apply auth middleware
-			authMiddleware := middleware.AuthMiddleware(cfg)
-			authMiddleware(handler).ServeHTTP(w, r)
+		if strings.HasPrefix(r.URL.Path, "/api/v1/order") || strings.HasPrefix(r.URL.Path, "/api/v1/my-orders") ||
+			strings.HasPrefix(r.URL.Path, "/api/v1/cart") || strings.HasPrefix(r.URL.Path, "/api/v1/admin") {
+			authHandler.ServeHTTP(w, r)
 		} else {
 			// Serve unprotected routes directly
 			handler.ServeHTTP(w, r)
@@ -14,10 +14,27 @@ import (
 // other packages that might use bare string keys.
 type ContextKey string
 
-const UserIDKey ContextKey = "user_id"
+const (
+	UserIDKey ContextKey = "user_id"
+	RoleKey   ContextKey = "role"
+)
 
-// AuthMiddleware validates JWT tokens
+// AuthMiddleware validates JWT tokens. When a JWKS URL or file is configured,
+// tokens must be signed by the auth service with RS256 or EdDSA and are verified
+// against its published keys; otherwise they are verified with the shared
+// HMAC secret. Build the middleware once: the JWKS cache lives in the closure.
 func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWT.Secret), nil
+	}
+	validMethods := []string{"HS256"}
+
+	if cfg.JWT.JWKSURL != "" || cfg.JWT.JWKSFile != "" {
+		jwks := NewJWKSCache(cfg.JWT.JWKSURL, cfg.JWT.JWKSFile, cfg.JWT.JWKSCacheTTL)
+		keyfunc = jwks.Keyfunc
+		validMethods = []string{"RS256", "EdDSA"}
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -33,12 +50,7 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.ErrSignatureInvalid
-				}
-				return []byte(cfg.JWT.Secret), nil
-			})
+			token, err := jwt.Parse(tokenString, keyfunc, jwt.WithValidMethods(validMethods))
 
 			if err != nil || !token.Valid {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
@@ -47,7 +59,9 @@ func AuthMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
 
 			if claims, ok := token.Claims.(jwt.MapClaims); ok {
 				if userID, ok := claims["user_id"].(string); ok {
+					role, _ := claims["role"].(string)
 					ctx := context.WithValue(r.Context(), UserIDKey, userID)
+					ctx = context.WithValue(ctx, RoleKey, role)
 					next.ServeHTTP(w, r.WithContext(ctx))
 					return
 				}
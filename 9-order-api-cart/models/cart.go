@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxCartItems is the most distinct products a cart may hold, so a cart can be
+// priced with a single batch lookup against the product service
+const MaxCartItems = 100
+
+// Cart is a user's shopping cart. Every user has at most one, created the
+// first time it is used and emptied when it is checked out.
+type Cart struct {
+	ID        string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    string    `json:"user_id" gorm:"type:uuid;not null;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// CheckoutID is set while the cart's items are being ordered, from
+	// CheckoutStartedAt on; the cart cannot change until the checkout ends
+	CheckoutID        *string    `json:"-" gorm:"type:uuid"`
+	CheckoutStartedAt *time.Time `json:"-"`
+
+	Items []CartItem `json:"items,omitempty" gorm:"foreignKey:CartID"`
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (c *Cart) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// CartItem is a product in a cart. Price is a snapshot of the product's price,
+// refreshed whenever the cart is read.
+type CartItem struct {
+	ID        string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CartID    string    `json:"cart_id" gorm:"type:uuid;not null;uniqueIndex:idx_cart_items_product,priority:1"`
+	ProductID uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_cart_items_product,priority:2"`
+	Quantity  int       `json:"quantity" gorm:"not null"`
+	Price     float64   `json:"price" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (ci *CartItem) BeforeCreate(tx *gorm.DB) error {
+	if ci.ID == "" {
+		ci.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// CartRequest replaces the whole content of a cart
+type CartRequest struct {
+	Items []OrderItemRequest `json:"items" validate:"max=100,dive"`
+}
+
+// CartItemQuantityRequest sets the quantity of a product already in the cart
+type CartItemQuantityRequest struct {
+	Quantity int `json:"quantity" validate:"required,min=1,max=1000"`
+}
+
+// CartResponse represents a cart with its items priced at the product
+// service's current prices
+type CartResponse struct {
+	ID        string             `json:"id"`
+	UserID    string             `json:"user_id"`
+	Items     []CartItemResponse `json:"items"`
+	Total     float64            `json:"total"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// CartItemResponse represents a cart item in the response. PreviousPrice is
+// set when the price changed since the cart was last read; Available is false
+// when the product no longer exists or has less stock than the item requires.
+type CartItemResponse struct {
+	ProductID     uint            `json:"product_id"`
+	Product       ExternalProduct `json:"product"`
+	Quantity      int             `json:"quantity"`
+	Price         float64         `json:"price"`
+	PreviousPrice *float64        `json:"previous_price,omitempty"`
+	Available     bool            `json:"available"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// IdempotencyRecord remembers a request made with an Idempotency-Key header,
+// so a retry with the same key gets the original response instead of being
+// applied again. Keys are scoped to the user who sent them. StatusCode is 0
+// while the first request is still being processed. OrderID is set in the
+// transaction that creates the order, so the order is found again even if its
+// response was never stored.
+type IdempotencyRecord struct {
+	UserID         string    `json:"user_id" gorm:"type:uuid;primaryKey"`
+	IdempotencyKey string    `json:"idempotency_key" gorm:"primaryKey;size:255"`
+	RequestHash    string    `json:"request_hash" gorm:"size:64;not null"` // hex SHA-256 of path and normalized body
+	StatusCode     int       `json:"status_code" gorm:"not null;default:0"`
+	Response       []byte    `json:"-" gorm:"type:bytea"`
+	OrderID        *string   `json:"order_id,omitempty" gorm:"type:uuid"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	ExpiresAt      time.Time `json:"expires_at" gorm:"not null;index"`
+}
+
+// TableName overrides the default pluralized table name
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
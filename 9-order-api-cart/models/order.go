@@ -15,9 +15,10 @@ type ExternalUser struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// ExternalProduct represents a product from the stat service
+// ExternalProduct represents a product from the stat service. Products are
+// identified everywhere by the stat service's numeric product ID.
 type ExternalProduct struct {
-	ID          string   `json:"id"`
+	ID          uint     `json:"id"`
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Price       float64  `json:"price"`
@@ -29,16 +30,63 @@ type ExternalProduct struct {
 	UpdatedAt   string   `json:"updated_at"`
 }
 
+// ExternalReservation represents a stock reservation from the stat service
+type ExternalReservation struct {
+	ID        uint      `json:"id"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Order statuses. An order starts as pending and moves through the lifecycle
+// according to orderTransitions; delivered and cancelled are final.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusConfirmed = "confirmed"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+)
+
+// Roles from the JWT role claim that may access other users' orders. Support
+// staff may read any order; service and admin may also change them.
+const (
+	RoleService = "service"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// orderTransitions lists the statuses each status may move to
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:   {OrderStatusDelivered},
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another
+func CanTransitionOrder(from, to string) bool {
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
 // Order represents an order in the system
 type Order struct {
 	ID        string         `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	UserID    string         `json:"user_id" gorm:"type:uuid;not null"`
-	Status    string         `json:"status" gorm:"not null;default:'pending'"` // pending, confirmed, shipped, delivered, cancelled
+	Status    string         `json:"status" gorm:"not null;default:'pending'"` // see OrderStatus* constants
 	Total     float64        `json:"total" gorm:"not null;default:0"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// ReservationID is the stat service reservation holding the order's stock;
+	// nil for orders placed before reservations, whose stock was decremented
+	// through the outbox
+	ReservationID *uint `json:"reservation_id,omitempty"`
+
 	// Relationships (no foreign key constraints since tables don't exist in this service)
 	OrderItems []OrderItem `json:"order_items,omitempty" gorm:"foreignKey:OrderID"`
 }
@@ -55,7 +103,7 @@ func (o *Order) BeforeCreate(tx *gorm.DB) error {
 type OrderItem struct {
 	ID        string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	OrderID   string    `json:"order_id" gorm:"type:uuid;not null"`
-	ProductID string    `json:"product_id" gorm:"type:uuid;not null"`
+	ProductID uint      `json:"product_id" gorm:"not null"`
 	Quantity  int       `json:"quantity" gorm:"not null;min:1"`
 	Price     float64   `json:"price" gorm:"not null"` // Price at the time of order
 	CreatedAt time.Time `json:"created_at"`
@@ -73,6 +121,30 @@ func (oi *OrderItem) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// OrderStatusHistory records a single status change of an order
+type OrderStatusHistory struct {
+	ID         string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	OrderID    string    `json:"order_id" gorm:"type:uuid;not null;index"`
+	FromStatus string    `json:"from_status"` // empty for the initial pending entry
+	ToStatus   string    `json:"to_status" gorm:"not null"`
+	ChangedBy  string    `json:"changed_by" gorm:"type:uuid;not null"` // user ID from the JWT
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName overrides the default pluralized table name
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (h *OrderStatusHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == "" {
+		h.ID = uuid.New().String()
+	}
+	return nil
+}
+
 // OrderRequest represents a request to create a new order
 type OrderRequest struct {
 	Items []OrderItemRequest `json:"items" validate:"required,min=1,dive"`
@@ -80,25 +152,31 @@ type OrderRequest struct {
 
 // OrderItemRequest represents an item in the order request
 type OrderItemRequest struct {
-	ProductID string `json:"product_id" validate:"required,uuid"`
-	Quantity  int    `json:"quantity" validate:"required,min=1,max=1000"`
+	ProductID uint `json:"product_id" validate:"required"`
+	Quantity  int  `json:"quantity" validate:"required,min=1,max=1000"`
+}
+
+// OrderStatusRequest is the optional body of a status transition request
+type OrderStatusRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
 }
 
 // OrderResponse represents a response for order operations
 type OrderResponse struct {
-	ID        string              `json:"id"`
-	UserID    string              `json:"user_id"`
-	Status    string              `json:"status"`
-	Total     float64             `json:"total"`
-	Items     []OrderItemResponse `json:"items"`
-	CreatedAt time.Time           `json:"created_at"`
-	UpdatedAt time.Time           `json:"updated_at"`
+	ID            string              `json:"id"`
+	UserID        string              `json:"user_id"`
+	Status        string              `json:"status"`
+	Total         float64             `json:"total"`
+	ReservationID *uint               `json:"reservation_id,omitempty"`
+	Items         []OrderItemResponse `json:"items"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
 }
 
 // OrderItemResponse represents an order item in the response
 type OrderItemResponse struct {
 	ID        string          `json:"id"`
-	ProductID string          `json:"product_id"`
+	ProductID uint            `json:"product_id"`
 	Product   ExternalProduct `json:"product"`
 	Quantity  int             `json:"quantity"`
 	Price     float64         `json:"price"`
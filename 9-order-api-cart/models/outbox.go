@@ -0,0 +1,94 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Outbox message types
+const (
+	OutboxInventoryDecrement = "inventory.decrement"
+	OutboxInventoryRestock   = "inventory.restock"
+)
+
+// Outbox message statuses. Pending messages are retried by the dispatcher until
+// they are sent or dead-lettered; cancelled messages were never delivered and
+// are no longer needed because their order was cancelled.
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusSent      = "sent"
+	OutboxStatusDead      = "dead"
+	OutboxStatusCancelled = "cancelled"
+)
+
+// Stock adjustment reasons sent to the product service, which counts sales and
+// returns in its statistics at the unit price they were made at
+const (
+	InventoryReasonSale   = "sale"
+	InventoryReasonReturn = "return"
+)
+
+// OutboxMessage is an inventory command for the product service, written in the
+// same transaction as the order change that caused it and delivered afterwards
+// by the outbox dispatcher
+type OutboxMessage struct {
+	ID             string     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	OrderID        string     `json:"order_id" gorm:"type:uuid;not null;index"`
+	OrderItemID    string     `json:"order_item_id" gorm:"type:uuid;not null"`
+	Type           string     `json:"type" gorm:"not null"`
+	ProductID      uint       `json:"product_id" gorm:"not null"`
+	Change         int        `json:"change" gorm:"not null"`
+	UnitPrice      *float64   `json:"unit_price,omitempty"`
+	IdempotencyKey string     `json:"idempotency_key" gorm:"not null;uniqueIndex"`
+	Status         string     `json:"status" gorm:"not null;default:'pending';index:idx_outbox_due,priority:1"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_outbox_due,priority:2"`
+	LastError      string     `json:"last_error,omitempty"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName overrides the default pluralized table name
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (m *OutboxMessage) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Reason returns the stock adjustment reason the message is sent with: a
+// decrement is a sale and a restock returns a sale
+func (m *OutboxMessage) Reason() string {
+	if m.Type == OutboxInventoryDecrement {
+		return InventoryReasonSale
+	}
+	return InventoryReasonReturn
+}
+
+// NewInventoryMessage builds the outbox message that applies change to an
+// order item's product at the price the item was ordered at. The idempotency
+// key is derived from the message type and the order item, so each item is
+// decremented and restocked at most once.
+func NewInventoryMessage(messageType string, item OrderItem, change int) *OutboxMessage {
+	price := item.Price
+	return &OutboxMessage{
+		OrderID:        item.OrderID,
+		OrderItemID:    item.ID,
+		Type:           messageType,
+		ProductID:      item.ProductID,
+		Change:         change,
+		UnitPrice:      &price,
+		IdempotencyKey: fmt.Sprintf("%s:%s", messageType, item.ID),
+		Status:         OutboxStatusPending,
+		NextAttemptAt:  time.Now(),
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Payment statuses. A payment is pending until the provider's answer to the
+// charge is recorded; requires_action waits for the customer (e.g. a 3-D
+// Secure challenge) and is settled by the provider's webhook. A declined
+// payment is final and the order may be paid again; a succeeded payment
+// becomes refunded when the order cannot be or is no longer fulfilled.
+const (
+	PaymentStatusPending        = "pending"
+	PaymentStatusRequiresAction = "requires_action"
+	PaymentStatusSucceeded      = "succeeded"
+	PaymentStatusDeclined       = "declined"
+	PaymentStatusRefunded       = "refunded"
+)
+
+// paymentTransitions lists the statuses each payment status may move to
+var paymentTransitions = map[string][]string{
+	PaymentStatusPending:        {PaymentStatusRequiresAction, PaymentStatusSucceeded, PaymentStatusDeclined},
+	PaymentStatusRequiresAction: {PaymentStatusSucceeded, PaymentStatusDeclined},
+	PaymentStatusSucceeded:      {PaymentStatusRefunded},
+}
+
+// CanTransitionPayment reports whether a payment may move from one status to another
+func CanTransitionPayment(from, to string) bool {
+	for _, allowed := range paymentTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Payment is an attempt to charge an order's total through a payment provider
+type Payment struct {
+	ID            string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	OrderID       string    `json:"order_id" gorm:"type:uuid;not null;index"`
+	UserID        string    `json:"user_id" gorm:"type:uuid;not null"`
+	Amount        float64   `json:"amount" gorm:"not null"`
+	Status        string    `json:"status" gorm:"not null;default:'pending'"` // see PaymentStatus* constants
+	Provider      string    `json:"provider" gorm:"not null;index:idx_payments_provider_ref,priority:1"`
+	ProviderRef   string    `json:"provider_ref,omitempty" gorm:"index:idx_payments_provider_ref,priority:2"` // the provider's ID for the charge
+	PaymentMethod string    `json:"payment_method" gorm:"not null"`
+	ActionURL     string    `json:"action_url,omitempty"`     // where the customer completes a required action
+	FailureReason string    `json:"failure_reason,omitempty"` // why the payment was declined or refunded
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (p *Payment) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// PaymentRequest is the body of a request to pay for an order. PaymentMethod
+// is the provider's token for the customer's payment details.
+type PaymentRequest struct {
+	PaymentMethod string `json:"payment_method" validate:"required,max=255"`
+}
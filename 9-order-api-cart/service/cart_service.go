@@ -0,0 +1,504 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"order-api-cart/clients"
+	"order-api-cart/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrCartEmpty is returned when checking out a cart without items
+	ErrCartEmpty = errors.New("cart is empty")
+
+	// ErrCartItemNotFound is returned when changing a product that is not in
+	// the cart
+	ErrCartItemNotFound = errors.New("cart item not found")
+
+	// ErrInvalidCartItem is returned when a product cannot be put in the cart:
+	// it does not exist, has too little stock or the cart is full
+	ErrInvalidCartItem = errors.New("invalid cart item")
+
+	// ErrCheckoutInProgress is returned when changing or checking out a cart
+	// whose items are being ordered
+	ErrCheckoutInProgress = errors.New("checkout in progress")
+)
+
+const (
+	// maxCartItemQuantity is the most units of a product a cart may hold, the
+	// same limit OrderItemRequest enforces
+	maxCartItemQuantity = 1000
+
+	// checkoutLease is how long a checkout holds the cart. A checkout that has
+	// not ended by then, because the instance placing the order died, no
+	// longer blocks the cart.
+	checkoutLease = 5 * time.Minute
+)
+
+// CartService manages users' shopping carts and turns them into orders.
+//
+// Every change to a cart locks the cart row, so concurrent changes by the same
+// user are applied one after the other. Products are checked against the
+// product service before the lock is taken, keeping external calls out of the
+// transaction like OrderService.CreateOrder does. Checkout follows the same
+// rule: it marks the cart as being checked out in one short transaction,
+// places the order with no transaction open and empties the cart in another.
+// While the mark is set the cart cannot change.
+type CartService struct {
+	db            *gorm.DB
+	productClient *clients.ProductServiceClient
+	orders        *OrderService
+}
+
+// NewCartService creates a new cart service that checks out through orders
+func NewCartService(orders *OrderService) *CartService {
+	return &CartService{
+		db:            orders.db,
+		productClient: orders.productClient,
+		orders:        orders,
+	}
+}
+
+// GetCart returns the user's cart, creating an empty one if the user has none.
+// Item prices are refreshed from the product service; items whose price
+// changed since the last read carry the previous price.
+func (s *CartService) GetCart(ctx context.Context, userID, authToken string) (*models.CartResponse, error) {
+	cart, err := s.loadCart(s.db, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.cartToResponse(ctx, cart, authToken), nil
+}
+
+// ReplaceCart replaces the content of the user's cart with items. Items for
+// the same product are merged.
+func (s *CartService) ReplaceCart(ctx context.Context, userID string, items []models.OrderItemRequest, authToken string) (*models.CartResponse, error) {
+	quantities := make(map[uint]int, len(items))
+	var productIDs []uint
+	for _, item := range items {
+		if _, seen := quantities[item.ProductID]; !seen {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	if len(productIDs) > models.MaxCartItems {
+		return nil, fmt.Errorf("%w: a cart holds at most %d products", ErrInvalidCartItem, models.MaxCartItems)
+	}
+
+	var products map[uint]*models.ExternalProduct
+	if len(productIDs) > 0 {
+		var err error
+		products, err = s.productClient.GetProductsByIDs(ctx, productIDs, authToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get products: %w", err)
+		}
+	}
+	for _, productID := range productIDs {
+		if err := checkCartItem(products[productID], productID, quantities[productID]); err != nil {
+			return nil, err
+		}
+	}
+
+	var cart *models.Cart
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if cart, err = s.lockCart(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return fmt.Errorf("failed to clear cart: %w", err)
+		}
+
+		cart.Items = make([]models.CartItem, 0, len(productIDs))
+		for _, productID := range productIDs {
+			cart.Items = append(cart.Items, models.CartItem{
+				CartID:    cart.ID,
+				ProductID: productID,
+				Quantity:  quantities[productID],
+				Price:     products[productID].Price,
+			})
+		}
+		if len(cart.Items) > 0 {
+			if err := tx.Create(&cart.Items).Error; err != nil {
+				return fmt.Errorf("failed to add cart items: %w", err)
+			}
+		}
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.cartToResponse(ctx, cart, authToken), nil
+}
+
+// AddItem adds quantity units of a product to the user's cart, on top of any
+// already in it
+func (s *CartService) AddItem(ctx context.Context, userID string, req models.OrderItemRequest, authToken string) (*models.CartResponse, error) {
+	product, err := s.getProduct(ctx, req.ProductID, authToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var cart *models.Cart
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if cart, err = s.lockCart(tx, userID); err != nil {
+			return err
+		}
+
+		item := findCartItem(cart, req.ProductID)
+		if item == nil {
+			if len(cart.Items) >= models.MaxCartItems {
+				return fmt.Errorf("%w: a cart holds at most %d products", ErrInvalidCartItem, models.MaxCartItems)
+			}
+			if err := checkCartItem(product, req.ProductID, req.Quantity); err != nil {
+				return err
+			}
+			cart.Items = append(cart.Items, models.CartItem{
+				CartID:    cart.ID,
+				ProductID: req.ProductID,
+				Quantity:  req.Quantity,
+				Price:     product.Price,
+			})
+			if err := tx.Create(&cart.Items[len(cart.Items)-1]).Error; err != nil {
+				return fmt.Errorf("failed to add cart item: %w", err)
+			}
+			return touchCart(tx, cart)
+		}
+
+		quantity := item.Quantity + req.Quantity
+		if err := checkCartItem(product, req.ProductID, quantity); err != nil {
+			return err
+		}
+		if err := updateCartItem(tx, item, quantity, product.Price); err != nil {
+			return err
+		}
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.cartToResponse(ctx, cart, authToken), nil
+}
+
+// SetItemQuantity sets the quantity of a product in the user's cart
+func (s *CartService) SetItemQuantity(ctx context.Context, userID string, productID uint, quantity int, authToken string) (*models.CartResponse, error) {
+	product, err := s.getProduct(ctx, productID, authToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCartItem(product, productID, quantity); err != nil {
+		return nil, err
+	}
+
+	var cart *models.Cart
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if cart, err = s.lockCart(tx, userID); err != nil {
+			return err
+		}
+
+		item := findCartItem(cart, productID)
+		if item == nil {
+			return ErrCartItemNotFound
+		}
+		if err := updateCartItem(tx, item, quantity, product.Price); err != nil {
+			return err
+		}
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.cartToResponse(ctx, cart, authToken), nil
+}
+
+// RemoveItem removes a product from the user's cart
+func (s *CartService) RemoveItem(ctx context.Context, userID string, productID uint, authToken string) (*models.CartResponse, error) {
+	var cart *models.Cart
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if cart, err = s.lockCart(tx, userID); err != nil {
+			return err
+		}
+
+		item := findCartItem(cart, productID)
+		if item == nil {
+			return ErrCartItemNotFound
+		}
+		if err := tx.Delete(item).Error; err != nil {
+			return fmt.Errorf("failed to remove cart item: %w", err)
+		}
+
+		remaining := cart.Items[:0]
+		for _, other := range cart.Items {
+			if other.ProductID != productID {
+				remaining = append(remaining, other)
+			}
+		}
+		cart.Items = remaining
+		return touchCart(tx, cart)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.cartToResponse(ctx, cart, authToken), nil
+}
+
+// ClearCart removes all items from the user's cart
+func (s *CartService) ClearCart(userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		cart, err := s.lockCart(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return fmt.Errorf("failed to clear cart: %w", err)
+		}
+		return touchCart(tx, cart)
+	})
+}
+
+// Checkout places an order for the content of the user's cart through
+// OrderService.CreateOrder and empties the cart. The order is priced and
+// checked against the product service at checkout time, like any other order.
+//
+// The cart is marked as being checked out before the order is placed, so a
+// checkout sent twice creates a single order: while the first is placing the
+// order the second gets ErrCheckoutInProgress, and afterwards it finds the
+// cart empty. If placing the order fails the mark is removed and the cart is
+// left as it was.
+func (s *CartService) Checkout(ctx context.Context, userID, authToken string) (*models.OrderResponse, error) {
+	checkoutID := uuid.New().String()
+	var cart *models.Cart
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if cart, err = s.lockCart(tx, userID); err != nil {
+			return err
+		}
+		if len(cart.Items) == 0 {
+			return ErrCartEmpty
+		}
+		if err := tx.Model(&models.Cart{}).Where("id = ?", cart.ID).Updates(map[string]interface{}{
+			"checkout_id":         checkoutID,
+			"checkout_started_at": time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to start checkout: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req := &models.OrderRequest{Items: make([]models.OrderItemRequest, 0, len(cart.Items))}
+	for _, item := range cart.Items {
+		req.Items = append(req.Items, models.OrderItemRequest{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	order, err := s.orders.CreateOrder(ctx, userID, req, "", authToken)
+	if err != nil {
+		if endErr := s.endCheckout(cart, checkoutID, false); endErr != nil {
+			log.Printf("WARNING: failed to end checkout of cart of user %s after the order failed: %v", userID, endErr)
+		}
+		return nil, err
+	}
+
+	if err := s.endCheckout(cart, checkoutID, true); err != nil {
+		// The order exists; only emptying the cart failed
+		log.Printf("WARNING: order %s was created but cart of user %s was not emptied: %v", order.ID, userID, err)
+	}
+	return order, nil
+}
+
+// endCheckout removes the checkout mark checkoutID from cart and, if the order
+// was placed, empties the cart. Nothing changes if the checkout no longer holds
+// the cart because its lease ran out.
+func (s *CartService) endCheckout(cart *models.Cart, checkoutID string, ordered bool) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// The update locks the cart row for the rest of the transaction
+		result := tx.Model(&models.Cart{}).Where("id = ? AND checkout_id = ?", cart.ID, checkoutID).
+			Updates(map[string]interface{}{"checkout_id": nil, "checkout_started_at": nil})
+		if result.Error != nil {
+			return fmt.Errorf("failed to end checkout: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("checkout lease expired")
+		}
+		if !ordered {
+			return nil
+		}
+
+		if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return fmt.Errorf("failed to empty cart: %w", err)
+		}
+		return touchCart(tx, cart)
+	})
+}
+
+// lockCart loads the user's cart like loadCart and locks it for a change,
+// which is refused while the cart is being checked out
+func (s *CartService) lockCart(tx *gorm.DB, userID string) (*models.Cart, error) {
+	cart, err := s.loadCart(tx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+	if cart.CheckoutID != nil && cart.CheckoutStartedAt != nil && time.Since(*cart.CheckoutStartedAt) < checkoutLease {
+		return nil, ErrCheckoutInProgress
+	}
+	return cart, nil
+}
+
+// loadCart returns the user's cart with its items, oldest first, creating the
+// cart if the user has none. With lock set the cart row is locked until the
+// transaction db belongs to ends.
+func (s *CartService) loadCart(db *gorm.DB, userID string, lock bool) (*models.Cart, error) {
+	// Concurrent first requests may both try to create the cart; the unique
+	// index on user_id lets exactly one of them insert it
+	if err := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "user_id"}}, DoNothing: true}).
+		Create(&models.Cart{UserID: userID}).Error; err != nil {
+		return nil, fmt.Errorf("failed to create cart: %w", err)
+	}
+
+	query := db
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var cart models.Cart
+	if err := query.First(&cart, "user_id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+	if err := db.Where("cart_id = ?", cart.ID).Order("created_at, id").Find(&cart.Items).Error; err != nil {
+		return nil, fmt.Errorf("failed to get cart items: %w", err)
+	}
+	return &cart, nil
+}
+
+// getProduct fetches a product to be put in the cart
+func (s *CartService) getProduct(ctx context.Context, productID uint, authToken string) (*models.ExternalProduct, error) {
+	product, err := s.productClient.GetProductByID(ctx, productID, authToken)
+	if errors.Is(err, clients.ErrCircuitOpen) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: product not found: %d", ErrInvalidCartItem, productID)
+	}
+	return product, nil
+}
+
+// cartToResponse converts a cart to a CartResponse, pricing its items at the
+// product service's current prices and storing changed prices as the items'
+// new snapshots. If the products cannot be fetched, the stored prices are
+// shown and the items are reported as unavailable.
+func (s *CartService) cartToResponse(ctx context.Context, cart *models.Cart, authToken string) *models.CartResponse {
+	var products map[uint]*models.ExternalProduct
+	if len(cart.Items) > 0 {
+		productIDs := make([]uint, 0, len(cart.Items))
+		for _, item := range cart.Items {
+			productIDs = append(productIDs, item.ProductID)
+		}
+
+		var err error
+		products, err = s.productClient.GetProductsByIDs(ctx, productIDs, authToken)
+		if err != nil {
+			log.Printf("WARNING: failed to fetch products for cart %s: %v", cart.ID, err)
+		}
+	}
+
+	response := &models.CartResponse{
+		ID:        cart.ID,
+		UserID:    cart.UserID,
+		Items:     make([]models.CartItemResponse, 0, len(cart.Items)),
+		UpdatedAt: cart.UpdatedAt,
+	}
+	for _, item := range cart.Items {
+		itemResponse := models.CartItemResponse{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		}
+
+		product, ok := products[item.ProductID]
+		if !ok {
+			itemResponse.Product = models.ExternalProduct{
+				ID:    item.ProductID,
+				Name:  "Product not available",
+				Price: item.Price,
+			}
+			response.Items = append(response.Items, itemResponse)
+			response.Total += item.Price * float64(item.Quantity)
+			continue
+		}
+
+		itemResponse.Product = *product
+		itemResponse.Available = product.Quantity >= item.Quantity
+		if product.Price != item.Price {
+			previous := item.Price
+			itemResponse.Price = product.Price
+			itemResponse.PreviousPrice = &previous
+			if err := s.db.Model(&models.CartItem{}).Where("id = ?", item.ID).
+				Update("price", product.Price).Error; err != nil {
+				log.Printf("WARNING: failed to refresh price of cart item %s: %v", item.ID, err)
+			}
+		}
+		response.Items = append(response.Items, itemResponse)
+		response.Total += itemResponse.Price * float64(item.Quantity)
+	}
+
+	return response
+}
+
+// checkCartItem reports whether quantity units of product may be put in a cart
+func checkCartItem(product *models.ExternalProduct, productID uint, quantity int) error {
+	if product == nil {
+		return fmt.Errorf("%w: product not found: %d", ErrInvalidCartItem, productID)
+	}
+	if quantity > maxCartItemQuantity {
+		return fmt.Errorf("%w: at most %d units of a product per order", ErrInvalidCartItem, maxCartItemQuantity)
+	}
+	if product.Quantity < quantity {
+		return fmt.Errorf("%w: insufficient quantity for product %s. Available: %d, Requested: %d",
+			ErrInvalidCartItem, product.Name, product.Quantity, quantity)
+	}
+	return nil
+}
+
+// findCartItem returns the cart's item for a product, or nil
+func findCartItem(cart *models.Cart, productID uint) *models.CartItem {
+	for i := range cart.Items {
+		if cart.Items[i].ProductID == productID {
+			return &cart.Items[i]
+		}
+	}
+	return nil
+}
+
+// updateCartItem sets the quantity and price snapshot of a cart item
+func updateCartItem(tx *gorm.DB, item *models.CartItem, quantity int, price float64) error {
+	if err := tx.Model(&models.CartItem{}).Where("id = ?", item.ID).
+		Updates(map[string]interface{}{"quantity": quantity, "price": price}).Error; err != nil {
+		return fmt.Errorf("failed to update cart item: %w", err)
+	}
+	item.Quantity, item.Price = quantity, price
+	return nil
+}
+
+// touchCart bumps the cart's updated_at after a change to its items
+func touchCart(tx *gorm.DB, cart *models.Cart) error {
+	cart.UpdatedAt = time.Now()
+	if err := tx.Model(&models.Cart{}).Where("id = ?", cart.ID).Update("updated_at", cart.UpdatedAt).Error; err != nil {
+		return fmt.Errorf("failed to update cart: %w", err)
+	}
+	return nil
+}
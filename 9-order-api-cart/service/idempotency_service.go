@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"order-api-cart/config"
+	"order-api-cart/database"
+	"order-api-cart/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// idempotencyLease is how long a request may hold its key while being
+// processed. A key still in progress after that was left behind by a crashed
+// instance and may be taken over by a retry.
+const idempotencyLease = time.Minute
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a
+	// different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+	// ErrIdempotencyKeyInProgress is returned when the request that first used
+	// a key has not finished yet
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// IdempotencyService records requests sent with an Idempotency-Key header and
+// their responses, so that retrying a request replays its response instead of
+// applying it twice.
+//
+// A request first claims its key with Begin, which inserts the record or
+// reports the existing one; the unique (user, key) primary key guarantees that
+// only one of several concurrent requests wins. The order created for the key
+// is recorded with it in the order's own transaction (see
+// recordIdempotentOrder), and the winner then stores its response with
+// Complete, or gives the key up with Release if it failed, so the client may
+// retry it. Keys expire after the configured TTL and are then free again.
+type IdempotencyService struct {
+	db  *gorm.DB
+	cfg config.IdempotencyConfig
+}
+
+// NewIdempotencyService creates a new idempotency service
+func NewIdempotencyService(cfg config.IdempotencyConfig) *IdempotencyService {
+	return &IdempotencyService{
+		db:  database.GetDB(),
+		cfg: cfg,
+	}
+}
+
+// RequestHash returns the hash Begin compares retries by
+func RequestHash(path string, body []byte) string {
+	sum := sha256.Sum256(append([]byte(path+"\n"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+// Begin claims key for a request of the user. It returns nil if the caller now
+// holds the key and must process the request, or the completed record whose
+// response is to be replayed. A record with an OrderID but no StatusCode
+// belongs to a request that created its order but did not store the response;
+// the order is to be replayed instead. A key that is held by a request with a
+// different hash fails with ErrIdempotencyKeyReused, one whose request is
+// still being processed with ErrIdempotencyKeyInProgress.
+func (s *IdempotencyService) Begin(userID, key, requestHash string) (*models.IdempotencyRecord, error) {
+	// The record may be released between a failed insert and reading it back;
+	// the next attempt then inserts it
+	for attempt := 0; attempt < 3; attempt++ {
+		now := time.Now()
+		result := s.db.Exec(`INSERT INTO idempotency_keys
+				(user_id, idempotency_key, request_hash, status_code, response, created_at, updated_at, expires_at)
+			VALUES (?, ?, ?, 0, NULL, ?, ?, ?)
+			ON CONFLICT (user_id, idempotency_key) DO UPDATE SET
+				request_hash = excluded.request_hash, status_code = 0, response = NULL, order_id = NULL,
+				created_at = excluded.created_at, updated_at = excluded.updated_at, expires_at = excluded.expires_at
+			WHERE idempotency_keys.expires_at <= ?
+				OR (idempotency_keys.status_code = 0 AND idempotency_keys.order_id IS NULL
+					AND idempotency_keys.updated_at <= ?)`,
+			userID, key, requestHash, now, now, now.Add(s.cfg.TTL), now, now.Add(-idempotencyLease))
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to claim idempotency key: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var record models.IdempotencyRecord
+		if err := s.db.First(&record, "user_id = ? AND idempotency_key = ?", userID, key).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+
+		switch {
+		case record.RequestHash != requestHash:
+			return nil, ErrIdempotencyKeyReused
+		case record.StatusCode == 0 && record.OrderID == nil:
+			return nil, ErrIdempotencyKeyInProgress
+		default:
+			return &record, nil
+		}
+	}
+	return nil, ErrIdempotencyKeyInProgress
+}
+
+// Complete stores the response of the request holding key, to be replayed for
+// its retries
+func (s *IdempotencyService) Complete(userID, key string, statusCode int, response []byte) error {
+	err := s.db.Model(&models.IdempotencyRecord{}).
+		Where("user_id = ? AND idempotency_key = ?", userID, key).
+		Updates(map[string]interface{}{
+			"status_code": statusCode,
+			"response":    response,
+			"updated_at":  time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release gives up key after its request failed, so a retry is processed anew.
+// A key whose order was created is kept.
+func (s *IdempotencyService) Release(userID, key string) error {
+	err := s.db.Where("user_id = ? AND idempotency_key = ? AND status_code = 0 AND order_id IS NULL", userID, key).
+		Delete(&models.IdempotencyRecord{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// recordIdempotentOrder records orderID as the order created for the user's
+// idempotency key, in the transaction tx that creates the order. The key's row
+// is locked, so of two requests holding the key, such as a slow one and the
+// retry that took the key over after its lease ran out, only the first records
+// its order. The other gets the ID of that order back and must not create its
+// own.
+func recordIdempotentOrder(tx *gorm.DB, userID, key, orderID string) (string, error) {
+	var record models.IdempotencyRecord
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&record, "user_id = ? AND idempotency_key = ?", userID, key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", errors.New("idempotency key expired while the order was being created")
+		}
+		return "", fmt.Errorf("failed to lock idempotency key: %w", err)
+	}
+	if record.OrderID != nil {
+		return *record.OrderID, nil
+	}
+
+	err = tx.Model(&models.IdempotencyRecord{}).
+		Where("user_id = ? AND idempotency_key = ?", userID, key).
+		Update("order_id", orderID).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to record order of idempotency key: %w", err)
+	}
+	return "", nil
+}
+
+// Run deletes expired keys every cleanup interval until ctx is cancelled.
+// Expired keys are already treated as unused; this only reclaims the space.
+func (s *IdempotencyService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result := s.db.Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyRecord{})
+		if result.Error != nil {
+			log.Printf("WARNING: failed to delete expired idempotency keys: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("Deleted %d expired idempotency keys", result.RowsAffected)
+		}
+	}
+}
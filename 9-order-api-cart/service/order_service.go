@@ -1,16 +1,42 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"time"
 
 	"order-api-cart/clients"
+	"order-api-cart/config"
 	"order-api-cart/database"
 	"order-api-cart/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errOrderExists aborts the transaction of an order whose idempotency key
+// already has an order
+var errOrderExists = errors.New("order already created for idempotency key")
+
+var (
+	// ErrInvalidStatusTransition is returned when the order's current status
+	// does not allow the requested change
+	ErrInvalidStatusTransition = errors.New("invalid status transition")
+
+	// ErrOrderForbidden is returned when the caller may not change the order
+	ErrOrderForbidden = errors.New("not allowed to change this order")
+
+	// ErrReservationExpired is returned when a pending order is confirmed after
+	// the reservation of its stock has expired
+	ErrReservationExpired = errors.New("stock reservation has expired")
+
+	// ErrOrderNotPaid is returned when a pending order is confirmed before a
+	// payment for it has succeeded
+	ErrOrderNotPaid = errors.New("order has not been paid")
 )
 
 // OrderService handles order business logic
@@ -18,50 +44,214 @@ type OrderService struct {
 	db            *gorm.DB
 	authClient    *clients.AuthServiceClient
 	productClient *clients.ProductServiceClient
+	payments      clients.PaymentProvider
+	products      *clients.ProductCache
+	cursors       *CursorCodec
+	reservation   config.ReservationConfig
+	serviceTokens *clients.ServiceTokenSource
 }
 
-// NewOrderService creates a new order service
-func NewOrderService(authServiceURL, productServiceURL string) *OrderService {
+// orderCursor is the position an order cursor resumes from
+type orderCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"i"`
+	Before    bool      `json:"b,omitempty"` // the page preceding the position
+}
+
+// NewOrderService creates a new order service calling the given clients.
+// payments refunds the payments of cancelled orders. cursorSecret signs
+// pagination cursors (see NewCursorCodec). serviceTokens authenticates stock
+// reservation calls, which the product service only accepts from the service
+// or admin role.
+func NewOrderService(authClient *clients.AuthServiceClient, productClient *clients.ProductServiceClient, payments clients.PaymentProvider, productCache config.ProductCacheConfig, reservation config.ReservationConfig, cursorSecret string, serviceTokens *clients.ServiceTokenSource) *OrderService {
 	return &OrderService{
+		cursors:       NewCursorCodec(cursorSecret),
+		reservation:   reservation,
+		serviceTokens: serviceTokens,
 		db:            database.GetDB(),
-		authClient:    clients.NewAuthServiceClient(authServiceURL),
-		productClient: clients.NewProductServiceClient(productServiceURL),
+		authClient:    authClient,
+		productClient: productClient,
+		payments:      payments,
+		products: clients.NewProductCache(productClient, productCache.TTL,
+			productCache.BatchSize, productCache.Workers),
 	}
 }
 
 // CreateOrder creates a new order.
 //
+// The order's stock is reserved in the product service before the order is
+// written. The product service takes the items out of stock under a row lock,
+// so two concurrent orders can never both get the last units; the reservation
+// is confirmed when the order is confirmed and released when it is cancelled,
+// or expires after the configured TTL if the order is never confirmed.
+//
+// With an idempotencyKey held by the request (see IdempotencyService.Begin),
+// the order is recorded with the key in the transaction that writes it. If
+// another request with the same key got there first, that request's order is
+// returned instead and no second order is created.
+//
 // Design note: all external HTTP calls (auth + product) are made outside the
-// DB transaction so that a transaction rollback never leaves partially-decremented
-// inventory in the product service. Inventory is decremented only after the DB
-// transaction commits successfully.
-func (s *OrderService) CreateOrder(userID string, req *models.OrderRequest, authToken string) (*models.OrderResponse, error) {
+// DB transaction. If the transaction fails, the reservation is released again;
+// should that fail too, it expires on its own.
+func (s *OrderService) CreateOrder(ctx context.Context, userID string, req *models.OrderRequest, idempotencyKey, authToken string) (*models.OrderResponse, error) {
 	// Validate user exists in auth service
-	if err := s.authClient.ValidateUser(userID, authToken); err != nil {
+	if err := s.authClient.ValidateUser(ctx, userID, authToken); err != nil {
 		return nil, fmt.Errorf("user validation failed: %w", err)
 	}
 
-	// Pre-fetch all products and validate quantities before opening a transaction.
-	// Keeping external calls outside the transaction prevents inventory from being
-	// decremented in the product service when the DB transaction later rolls back.
+	// Pre-fetch all products for their prices and fail fast on unknown products
+	// or plain shortages. The reservation below is what guarantees the stock.
 	type itemData struct {
 		req     models.OrderItemRequest
 		product *models.ExternalProduct
 	}
 	itemsData := make([]itemData, 0, len(req.Items))
+	fetched := make(map[uint]*models.ExternalProduct, len(req.Items))
 	for _, itemReq := range req.Items {
-		product, err := s.productClient.GetProductByID(itemReq.ProductID, authToken)
+		product, err := s.productClient.GetProductByID(ctx, itemReq.ProductID, authToken)
+		if errors.Is(err, clients.ErrCircuitOpen) {
+			return nil, err
+		}
 		if err != nil {
-			return nil, fmt.Errorf("product not found: %s", itemReq.ProductID)
+			return nil, fmt.Errorf("product not found: %d", itemReq.ProductID)
 		}
+		fetched[itemReq.ProductID] = product
 		if product.Quantity < itemReq.Quantity {
 			return nil, fmt.Errorf("insufficient quantity for product %s. Available: %d, Requested: %d",
 				product.Name, product.Quantity, itemReq.Quantity)
 		}
 		itemsData = append(itemsData, itemData{req: itemReq, product: product})
 	}
+	// The response below shows these products; spare it another round trip
+	s.products.Store(fetched)
+
+	// The order ID keys the reservation, so a retried reservation request holds
+	// the stock only once
+	order := &models.Order{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		Status: models.OrderStatusPending,
+		Total:  0,
+	}
+	serviceAuth, err := s.serviceTokens.Authorization(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	reservation, err := s.productClient.CreateReservation(ctx, req.Items, s.reservation.TTL, "order:"+order.ID, serviceAuth)
+	if err != nil {
+		var statusErr *clients.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+			return nil, errors.New("insufficient quantity: the requested stock is no longer available")
+		}
+		return nil, fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	order.ReservationID = &reservation.ID
 
 	// DB-only transaction — no external service calls inside
+	var existingOrderID string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if idempotencyKey != "" {
+			var err error
+			if existingOrderID, err = recordIdempotentOrder(tx, userID, idempotencyKey, order.ID); err != nil {
+				return err
+			}
+			if existingOrderID != "" {
+				return errOrderExists
+			}
+		}
+
+		if err := tx.Create(order).Error; err != nil {
+			return fmt.Errorf("failed to create order: %w", err)
+		}
+
+		history := &models.OrderStatusHistory{
+			OrderID:   order.ID,
+			ToStatus:  models.OrderStatusPending,
+			ChangedBy: userID,
+		}
+		if err := tx.Create(history).Error; err != nil {
+			return fmt.Errorf("failed to record order status: %w", err)
+		}
+
+		var total float64
+		for _, item := range itemsData {
+			orderItem := models.OrderItem{
+				OrderID:   order.ID,
+				ProductID: item.req.ProductID,
+				Quantity:  item.req.Quantity,
+				Price:     item.product.Price,
+			}
+			if err := tx.Create(&orderItem).Error; err != nil {
+				return fmt.Errorf("failed to create order item: %w", err)
+			}
+			total += item.product.Price * float64(item.req.Quantity)
+		}
+
+		if err := tx.Model(order).Update("total", total).Error; err != nil {
+			return fmt.Errorf("failed to update order total: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if releaseErr := s.productClient.ReleaseReservation(context.WithoutCancel(ctx), reservation.ID, serviceAuth); releaseErr != nil {
+			log.Printf("WARNING: failed to release reservation %d of failed order %s, it will expire: %v",
+				reservation.ID, order.ID, releaseErr)
+		}
+		if errors.Is(err, errOrderExists) {
+			return s.GetOrderByID(ctx, existingOrderID, userID, "", authToken)
+		}
+		return nil, err
+	}
+
+	var orderWithItems models.Order
+	if err := s.db.Preload("OrderItems").First(&orderWithItems, "id = ?", order.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load order: %w", err)
+	}
+
+	return s.orderToResponse(&orderWithItems, s.lookupProducts(ctx, authToken, orderWithItems)), nil
+}
+
+// GetOrderByID retrieves an order by ID on behalf of the user with the given ID
+// and role. Other users' orders are reported as not found, so their existence
+// is not revealed, unless the role may read any order.
+func (s *OrderService) GetOrderByID(ctx context.Context, orderID, userID, role, authToken string) (*models.OrderResponse, error) {
+	if _, err := uuid.Parse(orderID); err != nil {
+		return nil, errors.New("order not found")
+	}
+
+	var order models.Order
+
+	if err := s.ownedOrders(userID, role).Preload("OrderItems").First(&order, "id = ?", orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("order not found")
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	return s.orderToResponse(&order, s.lookupProducts(ctx, authToken, order)), nil
+}
+
+// TransitionOrder moves an order to newStatus on behalf of the user with the
+// given ID and role and records the change in the order's status history.
+// Owners may only cancel their orders; every other transition requires the
+// service or admin role. Orders of other users are reported as not found to
+// callers without such a role.
+//
+// The order row is locked for the duration of the transaction so concurrent
+// transitions are applied one after the other and each sees the status the
+// previous one wrote. A pending order can only be confirmed once a payment for
+// it has succeeded (ErrOrderNotPaid otherwise). Confirming an order confirms
+// its stock reservation while the row is locked, and fails with
+// ErrReservationExpired if the reservation has expired. Cancelling a pending
+// order releases its reservation once the cancellation is committed;
+// cancelling a confirmed order returns its items to stock through the outbox,
+// in the same transaction as the status change. Succeeded payments of a
+// cancelled order are refunded after the commit.
+func (s *OrderService) TransitionOrder(ctx context.Context, orderID, newStatus, userID, role, reason, authToken string) (*models.OrderResponse, error) {
+	if _, err := uuid.Parse(orderID); err != nil {
+		return nil, errors.New("order not found")
+	}
+
 	tx := s.db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -69,34 +259,87 @@ func (s *OrderService) CreateOrder(userID string, req *models.OrderRequest, auth
 		}
 	}()
 
-	order := &models.Order{
-		UserID: userID,
-		Status: "pending",
-		Total:  0,
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("OrderItems").First(&order, "id = ?", orderID).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("order not found")
+		}
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	if order.UserID != userID && !canReadAnyOrder(role) {
+		tx.Rollback()
+		return nil, errors.New("order not found")
 	}
-	if err := tx.Create(order).Error; err != nil {
+	if !isStaffRole(role) && (order.UserID != userID || newStatus != models.OrderStatusCancelled) {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to create order: %w", err)
+		return nil, ErrOrderForbidden
 	}
 
-	var total float64
-	for _, item := range itemsData {
-		orderItem := models.OrderItem{
-			OrderID:   order.ID,
-			ProductID: item.req.ProductID,
-			Quantity:  item.req.Quantity,
-			Price:     item.product.Price,
+	if !models.CanTransitionOrder(order.Status, newStatus) {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, order.Status, newStatus)
+	}
+
+	if newStatus == models.OrderStatusConfirmed && order.Status == models.OrderStatusPending {
+		var paid int64
+		if err := tx.Model(&models.Payment{}).
+			Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusSucceeded).
+			Count(&paid).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to check order payment: %w", err)
 		}
-		if err := tx.Create(&orderItem).Error; err != nil {
+		if paid == 0 {
+			tx.Rollback()
+			return nil, ErrOrderNotPaid
+		}
+	}
+
+	// The only external call made inside the transaction: the order stays
+	// locked until the reservation is confirmed, so a concurrent cancellation
+	// cannot release it in between
+	if newStatus == models.OrderStatusConfirmed && order.Status == models.OrderStatusPending && order.ReservationID != nil {
+		serviceAuth, err := s.serviceTokens.Authorization(ctx)
+		if err == nil {
+			err = s.productClient.ConfirmReservation(ctx, *order.ReservationID, serviceAuth)
+		}
+		if err != nil {
 			tx.Rollback()
-			return nil, fmt.Errorf("failed to create order item: %w", err)
+			if errors.Is(err, clients.ErrReservationClosed) {
+				return nil, fmt.Errorf("%w: reservation %d", ErrReservationExpired, *order.ReservationID)
+			}
+			return nil, fmt.Errorf("failed to confirm stock reservation: %w", err)
 		}
-		total += item.product.Price * float64(item.req.Quantity)
 	}
 
-	if err := tx.Model(order).Update("total", total).Error; err != nil {
+	previousStatus := order.Status
+	if err := tx.Model(&order).Update("status", newStatus).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	history := &models.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: previousStatus,
+		ToStatus:   newStatus,
+		ChangedBy:  userID,
+		Reason:     reason,
+	}
+	if err := tx.Create(history).Error; err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to update order total: %w", err)
+		return nil, fmt.Errorf("failed to record order status: %w", err)
+	}
+
+	// A pending order's stock is still held by its reservation
+	releaseReservation := newStatus == models.OrderStatusCancelled &&
+		previousStatus == models.OrderStatusPending && order.ReservationID != nil
+	if newStatus == models.OrderStatusCancelled && !releaseReservation {
+		if err := s.queueRestock(tx, &order); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
 	}
 
 	if err := tx.Commit().Error; err != nil {
@@ -104,46 +347,150 @@ func (s *OrderService) CreateOrder(userID string, req *models.OrderRequest, auth
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Decrement inventory after a successful DB commit.
-	// If an update fails at this point the order is already persisted; log a
-	// warning so ops can reconcile manually. A full solution would use a saga
-	// or an outbox pattern.
-	for _, item := range itemsData {
-		if err := s.productClient.UpdateProductQuantity(item.req.ProductID, -item.req.Quantity, authToken); err != nil {
-			log.Printf("WARNING: inventory update failed for product %s after order %s was committed: %v",
-				item.req.ProductID, order.ID, err)
+	if releaseReservation {
+		s.releaseReservation(context.WithoutCancel(ctx), &order)
+	}
+	if newStatus == models.OrderStatusCancelled {
+		s.refundPayments(context.WithoutCancel(ctx), &order)
+	}
+
+	return s.orderToResponse(&order, s.lookupProducts(ctx, authToken, order)), nil
+}
+
+// queueRestock writes the outbox messages that return a cancelled order's items
+// to stock. Only decrements the product service has acknowledged are restocked;
+// undelivered ones are cancelled instead. Their rows are locked, so a decrement
+// that is delivered while the order is being cancelled is restocked by the
+// dispatcher when it finds the message already cancelled.
+func (s *OrderService) queueRestock(tx *gorm.DB, order *models.Order) error {
+	var decrements []models.OutboxMessage
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND type = ?", order.ID, models.OutboxInventoryDecrement).
+		Find(&decrements).Error; err != nil {
+		return fmt.Errorf("failed to load inventory updates: %w", err)
+	}
+	decrementByItem := make(map[string]models.OutboxMessage, len(decrements))
+	for _, message := range decrements {
+		decrementByItem[message.OrderItemID] = message
+	}
+
+	for _, item := range order.OrderItems {
+		decrement, queued := decrementByItem[item.ID]
+		if queued && decrement.Status != models.OutboxStatusSent {
+			if err := tx.Model(&decrement).Update("status", models.OutboxStatusCancelled).Error; err != nil {
+				return fmt.Errorf("failed to cancel inventory update: %w", err)
+			}
+			continue
+		}
+
+		// Sent, placed before the outbox existed and decremented directly, or
+		// taken out of stock by a confirmed reservation
+		message := models.NewInventoryMessage(models.OutboxInventoryRestock, item, item.Quantity)
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("failed to queue restock: %w", err)
+		}
+	}
+	return nil
+}
+
+// releaseReservation returns the stock held for a cancelled pending order. A
+// reservation that cannot be released now expires after its TTL. One the
+// product service reports as confirmed belongs to an order whose confirmation
+// was not recorded here; its items are restocked through the outbox instead.
+func (s *OrderService) releaseReservation(ctx context.Context, order *models.Order) {
+	serviceAuth, err := s.serviceTokens.Authorization(ctx)
+	if err == nil {
+		err = s.productClient.ReleaseReservation(ctx, *order.ReservationID, serviceAuth)
+	}
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, clients.ErrReservationClosed) {
+		log.Printf("WARNING: failed to release reservation %d of cancelled order %s, it will expire: %v",
+			*order.ReservationID, order.ID, err)
+		return
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.queueRestock(tx, order)
+	}); err != nil {
+		log.Printf("ERROR: failed to restock confirmed reservation %d of cancelled order %s: %v",
+			*order.ReservationID, order.ID, err)
+	}
+}
+
+// refundPayments refunds the succeeded payments of a cancelled order. A refund
+// that fails is logged and must be issued manually.
+func (s *OrderService) refundPayments(ctx context.Context, order *models.Order) {
+	var payments []models.Payment
+	if err := s.db.Where("order_id = ? AND status = ?", order.ID, models.PaymentStatusSucceeded).
+		Find(&payments).Error; err != nil {
+		log.Printf("ERROR: failed to load payments of cancelled order %s, refund them manually: %v", order.ID, err)
+		return
+	}
+
+	for i := range payments {
+		if err := s.refundPayment(ctx, &payments[i], "order cancelled"); err != nil {
+			log.Printf("ERROR: %v, refund it manually", err)
 		}
 	}
+}
 
-	var orderWithItems models.Order
-	if err := s.db.Preload("OrderItems").First(&orderWithItems, "id = ?", order.ID).Error; err != nil {
-		return nil, fmt.Errorf("failed to load order: %w", err)
+// refundPayment refunds a succeeded payment through the provider and records
+// reason with it. The payment is claimed as refunded first, so a cancellation
+// and a late payment result racing to refund it send a single refund; if the
+// provider fails, the claim is undone.
+func (s *OrderService) refundPayment(ctx context.Context, payment *models.Payment, reason string) error {
+	result := s.db.Model(&models.Payment{}).
+		Where("id = ? AND status = ?", payment.ID, models.PaymentStatusSucceeded).
+		Updates(map[string]interface{}{"status": models.PaymentStatusRefunded, "failure_reason": reason})
+	if result.Error != nil {
+		return fmt.Errorf("failed to refund payment %s: %w", payment.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
 	}
 
-	return s.orderToResponse(&orderWithItems, authToken), nil
+	if err := s.payments.Refund(ctx, payment.ProviderRef); err != nil {
+		if undoErr := s.db.Model(&models.Payment{}).Where("id = ?", payment.ID).
+			Updates(map[string]interface{}{"status": models.PaymentStatusSucceeded, "failure_reason": ""}).Error; undoErr != nil {
+			log.Printf("ERROR: payment %s is marked refunded but was not: %v", payment.ID, undoErr)
+		}
+		return fmt.Errorf("failed to refund payment %s: %w", payment.ID, err)
+	}
+
+	log.Printf("Refunded payment %s of order %s: %s", payment.ID, payment.OrderID, reason)
+	payment.Status = models.PaymentStatusRefunded
+	payment.FailureReason = reason
+	return nil
 }
 
-// GetOrderByID retrieves an order by ID
-func (s *OrderService) GetOrderByID(orderID, authToken string) (*models.OrderResponse, error) {
+// GetOrderHistory returns the status changes of an order, oldest first. Like
+// GetOrderByID, other users' orders are not found unless role may read them.
+func (s *OrderService) GetOrderHistory(orderID, userID, role string) ([]models.OrderStatusHistory, error) {
 	if _, err := uuid.Parse(orderID); err != nil {
 		return nil, errors.New("order not found")
 	}
 
 	var order models.Order
-
-	if err := s.db.Preload("OrderItems").First(&order, "id = ?", orderID).Error; err != nil {
+	if err := s.ownedOrders(userID, role).First(&order, "id = ?", orderID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("order not found")
 		}
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	return s.orderToResponse(&order, authToken), nil
+	var history []models.OrderStatusHistory
+	if err := s.db.Where("order_id = ?", orderID).Order("created_at ASC").Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("failed to get order history: %w", err)
+	}
+
+	return history, nil
 }
 
 // GetOrdersByUserID retrieves paginated orders for a user.
 // Pagination is performed at the DB level to avoid loading all orders into memory.
-func (s *OrderService) GetOrdersByUserID(userID string, page, limit int, authToken string) ([]models.OrderResponse, int64, error) {
+func (s *OrderService) GetOrdersByUserID(ctx context.Context, userID string, page, limit int, authToken string) ([]models.OrderResponse, int64, error) {
 	var total int64
 	if err := s.db.Model(&models.Order{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to count user orders: %w", err)
@@ -156,25 +503,138 @@ func (s *OrderService) GetOrdersByUserID(userID string, page, limit int, authTok
 		return nil, 0, fmt.Errorf("failed to get user orders: %w", err)
 	}
 
+	// One lookup for the whole page rather than a request per item
+	products := s.lookupProducts(ctx, authToken, orders...)
 	responses := make([]models.OrderResponse, 0, len(orders))
 	for _, order := range orders {
-		responses = append(responses, *s.orderToResponse(&order, authToken))
+		responses = append(responses, *s.orderToResponse(&order, products))
 	}
 
 	return responses, total, nil
 }
 
+// GetOrdersByUserIDCursor returns a page of the user's orders, newest first,
+// following cursor (or preceding it, for a previous-page cursor). An empty
+// cursor returns the first page. The returned next and previous cursors are
+// empty when there are no orders in that direction.
+func (s *OrderService) GetOrdersByUserIDCursor(ctx context.Context, userID, cursor string, limit int, authToken string) ([]models.OrderResponse, string, string, error) {
+	var position orderCursor
+	if cursor != "" {
+		if err := s.cursors.Decode(cursor, &position); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	// Keyset on (created_at, id): previous pages are read in ascending order
+	// and reversed, so neither direction needs OFFSET
+	query := s.db.Preload("OrderItems").Where("user_id = ?", userID)
+	direction := "DESC"
+	if cursor != "" {
+		op := "<"
+		if position.Before {
+			op, direction = ">", "ASC"
+		}
+		query = query.Where("(created_at, id) "+op+" (?, ?)", position.CreatedAt, position.ID)
+	}
+
+	var orders []models.Order
+	if err := query.Order("created_at " + direction + ", id " + direction).
+		Limit(limit + 1).Find(&orders).Error; err != nil {
+		return nil, "", "", fmt.Errorf("failed to get user orders: %w", err)
+	}
+
+	hasMore := len(orders) > limit
+	if hasMore {
+		orders = orders[:limit]
+	}
+	if position.Before {
+		for i, j := 0, len(orders)-1; i < j; i, j = i+1, j-1 {
+			orders[i], orders[j] = orders[j], orders[i]
+		}
+	}
+
+	products := s.lookupProducts(ctx, authToken, orders...)
+	responses := make([]models.OrderResponse, 0, len(orders))
+	for _, order := range orders {
+		responses = append(responses, *s.orderToResponse(&order, products))
+	}
+	if len(orders) == 0 {
+		return responses, "", "", nil
+	}
+
+	// Going forward there is a next page if more rows were found and a previous
+	// one if we started from a cursor; going backward it is the other way round
+	hasNext, hasPrev := hasMore, cursor != ""
+	if position.Before {
+		hasNext, hasPrev = true, hasMore
+	}
+	var next, prev string
+	if hasNext {
+		last := orders[len(orders)-1]
+		encoded, err := s.cursors.Encode(orderCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		next = encoded
+	}
+	if hasPrev {
+		first := orders[0]
+		encoded, err := s.cursors.Encode(orderCursor{CreatedAt: first.CreatedAt, ID: first.ID, Before: true})
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		prev = encoded
+	}
+
+	return responses, next, prev, nil
+}
+
+// ownedOrders scopes order queries to the user's own orders unless role may
+// read any order
+func (s *OrderService) ownedOrders(userID, role string) *gorm.DB {
+	if canReadAnyOrder(role) {
+		return s.db
+	}
+	return s.db.Where("user_id = ?", userID)
+}
+
+// isStaffRole reports whether role may manage orders it does not own
+func isStaffRole(role string) bool {
+	return role == models.RoleService || role == models.RoleAdmin
+}
+
+// canReadAnyOrder reports whether role may read orders it does not own
+func canReadAnyOrder(role string) bool {
+	return isStaffRole(role) || role == models.RoleSupport
+}
+
+// lookupProducts fetches the products of all items in orders through the
+// product cache. A failed lookup is logged; the affected items are shown with
+// a stub by orderToResponse rather than failing the whole request.
+func (s *OrderService) lookupProducts(ctx context.Context, authToken string, orders ...models.Order) map[uint]*models.ExternalProduct {
+	var productIDs []uint
+	for _, order := range orders {
+		for _, item := range order.OrderItems {
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+
+	products, err := s.products.GetProducts(ctx, productIDs, authToken)
+	if err != nil {
+		log.Printf("WARNING: failed to fetch products for order response: %v", err)
+	}
+	return products
+}
+
 // orderToResponse converts an Order model to an OrderResponse, enriching each
-// item with product details from the product service. If a product fetch fails,
-// a stub is used and a warning is logged rather than failing the whole request.
-func (s *OrderService) orderToResponse(order *models.Order, authToken string) *models.OrderResponse {
+// item with product details from products. Items whose product is missing get
+// a stub.
+func (s *OrderService) orderToResponse(order *models.Order, products map[uint]*models.ExternalProduct) *models.OrderResponse {
 	var items []models.OrderItemResponse
 
 	for _, item := range order.OrderItems {
-		product, err := s.productClient.GetProductByID(item.ProductID, authToken)
-		if err != nil {
-			log.Printf("WARNING: failed to fetch product %s for order %s response: %v",
-				item.ProductID, order.ID, err)
+		product, ok := products[item.ProductID]
+		if !ok {
 			product = &models.ExternalProduct{
 				ID:    item.ProductID,
 				Name:  "Product not available",
@@ -192,12 +652,13 @@ func (s *OrderService) orderToResponse(order *models.Order, authToken string) *m
 	}
 
 	return &models.OrderResponse{
-		ID:        order.ID,
-		UserID:    order.UserID,
-		Status:    order.Status,
-		Total:     order.Total,
-		Items:     items,
-		CreatedAt: order.CreatedAt,
-		UpdatedAt: order.UpdatedAt,
+		ID:            order.ID,
+		UserID:        order.UserID,
+		Status:        order.Status,
+		Total:         order.Total,
+		ReservationID: order.ReservationID,
+		Items:         items,
+		CreatedAt:     order.CreatedAt,
+		UpdatedAt:     order.UpdatedAt,
 	}
 }
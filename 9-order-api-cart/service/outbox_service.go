@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"order-api-cart/clients"
+	"order-api-cart/config"
+	"order-api-cart/database"
+	"order-api-cart/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// outboxLease is how long a claimed message is hidden from other dispatchers
+// while it is being delivered. It must exceed the product client's timeout.
+const outboxLease = 30 * time.Second
+
+// ErrOutboxNotReplayable is returned when replaying a message that was already
+// sent or cancelled
+var ErrOutboxNotReplayable = errors.New("only pending or dead messages can be replayed")
+
+// OutboxService delivers inventory commands from the outbox table to the
+// product service and lets admins inspect and replay them.
+//
+// Messages are claimed in batches with SELECT ... FOR UPDATE SKIP LOCKED, so
+// several instances of the service can dispatch concurrently without sending
+// the same message twice at the same time. Delivery is still at-least-once; the
+// product service uses each message's idempotency key to apply it only once.
+type OutboxService struct {
+	db            *gorm.DB
+	productClient *clients.ProductServiceClient
+	serviceTokens *clients.ServiceTokenSource
+	cfg           config.OutboxConfig
+}
+
+// NewOutboxService creates a new outbox service delivering through
+// productClient, authenticated with serviceTokens
+func NewOutboxService(cfg config.OutboxConfig, productClient *clients.ProductServiceClient, serviceTokens *clients.ServiceTokenSource) *OutboxService {
+	return &OutboxService{
+		db:            database.GetDB(),
+		productClient: productClient,
+		serviceTokens: serviceTokens,
+		cfg:           cfg,
+	}
+}
+
+// Run dispatches due messages every poll interval until ctx is cancelled
+func (s *OutboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the backlog before waiting for the next tick. While the product
+		// service's circuit breaker is open deliveries would only fail and use
+		// up attempts, so they wait until it lets a trial call through.
+		for s.productClient.Breaker().State() != clients.BreakerOpen {
+			n, err := s.DispatchPending(ctx)
+			if err != nil {
+				log.Printf("WARNING: outbox dispatch failed: %v", err)
+			}
+			if err != nil || n < s.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchPending delivers one batch of due messages and returns how many were
+// attempted. Cancelling ctx aborts the delivery in progress, which is retried
+// later like any failed delivery.
+func (s *OutboxService) DispatchPending(ctx context.Context) (int, error) {
+	messages, err := s.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range messages {
+		s.deliver(ctx, &messages[i])
+	}
+	return len(messages), nil
+}
+
+// claim locks a batch of due messages, counts the attempt and pushes their next
+// attempt past the lease so no other dispatcher picks them up meanwhile
+func (s *OutboxService) claim() ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, now).
+			Order("next_attempt_at ASC").Limit(s.cfg.BatchSize).
+			Find(&messages).Error; err != nil {
+			return fmt.Errorf("failed to claim outbox messages: %w", err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(messages))
+		for i := range messages {
+			ids[i] = messages[i].ID
+			messages[i].Attempts++
+		}
+		return tx.Model(&models.OutboxMessage{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(outboxLease),
+		}).Error
+	})
+	return messages, err
+}
+
+// deliver sends a claimed message and records the outcome
+func (s *OutboxService) deliver(ctx context.Context, message *models.OutboxMessage) {
+	authToken, err := s.serviceTokens.Authorization(ctx)
+	if err == nil {
+		err = s.productClient.UpdateProductQuantity(ctx, message.ProductID, message.Change,
+			message.Reason(), message.UnitPrice, message.IdempotencyKey, authToken)
+	}
+	if err == nil {
+		s.markSent(message)
+		return
+	}
+
+	updates := map[string]interface{}{"last_error": err.Error()}
+	switch {
+	case isPermanentDeliveryError(err):
+		// The product service will reject the command however often it is
+		// sent; the stock of the product stays wrong until someone acts
+		updates["status"] = models.OutboxStatusDead
+		log.Printf("ERROR: ALERT outbox message %s (%s of %d units of product %d for order %s) was rejected by the product service and dead-lettered, fix the product and replay the message: %v",
+			message.ID, message.Type, message.Change, message.ProductID, message.OrderID, err)
+	case message.Attempts >= s.cfg.MaxAttempts:
+		updates["status"] = models.OutboxStatusDead
+		log.Printf("ERROR: outbox message %s (%s of product %d for order %s) dead-lettered after %d attempts: %v",
+			message.ID, message.Type, message.ProductID, message.OrderID, message.Attempts, err)
+	default:
+		updates["next_attempt_at"] = time.Now().Add(s.backoff(message.Attempts))
+	}
+
+	// A message cancelled while in flight keeps its cancelled status
+	if err := s.db.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", message.ID, models.OutboxStatusPending).
+		Updates(updates).Error; err != nil {
+		log.Printf("WARNING: failed to record outbox delivery failure for %s: %v", message.ID, err)
+	}
+}
+
+// markSent marks a delivered message as sent. If the order was cancelled while
+// a decrement was in flight, the cancellation has already marked the message
+// cancelled without restocking, so the delivered decrement is compensated here.
+func (s *OutboxService) markSent(message *models.OutboxMessage) {
+	now := time.Now()
+	result := s.db.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", message.ID, models.OutboxStatusPending).
+		Updates(map[string]interface{}{"status": models.OutboxStatusSent, "sent_at": now, "last_error": ""})
+	if result.Error != nil {
+		// The product service has applied the change; redelivery is a no-op
+		log.Printf("WARNING: failed to mark outbox message %s as sent: %v", message.ID, result.Error)
+		return
+	}
+	if result.RowsAffected > 0 || message.Type != models.OutboxInventoryDecrement {
+		return
+	}
+
+	item := models.OrderItem{ID: message.OrderItemID, OrderID: message.OrderID, ProductID: message.ProductID}
+	restock := models.NewInventoryMessage(models.OutboxInventoryRestock, item, -message.Change)
+	// The restock returns the sale at the price the decrement was sent with
+	restock.UnitPrice = message.UnitPrice
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(restock).Error; err != nil {
+		log.Printf("ERROR: failed to enqueue restock for cancelled order %s, product %d: %v",
+			message.OrderID, message.ProductID, err)
+	}
+}
+
+// backoff returns the delay before the given attempt is retried: BaseBackoff
+// doubled per attempt, capped at MaxBackoff, with up to 20% random jitter so
+// that messages failing together do not retry in lockstep
+func (s *OutboxService) backoff(attempts int) time.Duration {
+	delay := s.cfg.BaseBackoff
+	for i := 1; i < attempts && delay < s.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.cfg.MaxBackoff {
+		delay = s.cfg.MaxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// isPermanentDeliveryError reports whether retrying cannot succeed because the
+// product service rejected the command itself, with the statuses its quantity
+// endpoint uses for that: 400 (malformed product ID or change), 404 (unknown
+// product), 409 (insufficient stock) and 422 (idempotency key already used for
+// another change). Any other status, such as 401 or 403 for a bad service
+// token, is retried like an outage until the attempts run out.
+func isPermanentDeliveryError(err error) bool {
+	var statusErr *clients.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// ListMessages returns outbox messages, newest first, optionally filtered by status
+func (s *OutboxService) ListMessages(status string, limit int) ([]models.OutboxMessage, error) {
+	query := s.db.Order("created_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var messages []models.OutboxMessage
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to list outbox messages: %w", err)
+	}
+	return messages, nil
+}
+
+// GetMessage returns a single outbox message
+func (s *OutboxService) GetMessage(id string) (*models.OutboxMessage, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errors.New("outbox message not found")
+	}
+
+	var message models.OutboxMessage
+	if err := s.db.First(&message, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("outbox message not found")
+		}
+		return nil, fmt.Errorf("failed to get outbox message: %w", err)
+	}
+	return &message, nil
+}
+
+// Replay makes a dead or pending message due immediately with a fresh attempt
+// budget. The idempotency key is kept, so replaying a message the product
+// service did apply has no further effect.
+func (s *OutboxService) Replay(id string) (*models.OutboxMessage, error) {
+	message, err := s.GetMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.Model(message).
+		Where("status IN ?", []string{models.OutboxStatusPending, models.OutboxStatusDead}).
+		Updates(map[string]interface{}{
+			"status":          models.OutboxStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to replay outbox message: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrOutboxNotReplayable
+	}
+
+	return s.GetMessage(id)
+}
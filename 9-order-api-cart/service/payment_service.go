@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"order-api-cart/clients"
+	"order-api-cart/database"
+	"order-api-cart/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrOrderNotPayable is returned when an order is paid that is no longer
+	// pending, or is cancelled while its payment completes
+	ErrOrderNotPayable = errors.New("order is not awaiting payment")
+
+	// ErrPaymentProvider is returned when the payment provider's answer to a
+	// charge is unknown; paying again retries the same charge
+	ErrPaymentProvider = errors.New("payment provider error")
+
+	// ErrPaymentNotFound is returned for a webhook about an unknown charge
+	ErrPaymentNotFound = errors.New("payment not found")
+)
+
+// PaymentService charges orders through a payment provider and confirms them
+// once their payment succeeds
+type PaymentService struct {
+	db            *gorm.DB
+	provider      clients.PaymentProvider
+	orders        *OrderService
+	serviceTokens *clients.ServiceTokenSource
+}
+
+// NewPaymentService creates a new payment service. serviceTokens authenticates
+// the calls made to confirm orders paid through a webhook, which are not made
+// on behalf of a user.
+func NewPaymentService(provider clients.PaymentProvider, orderService *OrderService, serviceTokens *clients.ServiceTokenSource) *PaymentService {
+	return &PaymentService{
+		db:            database.GetDB(),
+		provider:      provider,
+		orders:        orderService,
+		serviceTokens: serviceTokens,
+	}
+}
+
+// paymentResult is a charge outcome to record on a payment
+type paymentResult struct {
+	ProviderRef string
+	Status      string
+	Reason      string
+	ActionURL   string
+}
+
+// PayOrder charges the total of the user's pending order with paymentMethod
+// and returns the payment. A succeeded payment confirms the order; a declined
+// one leaves it pending, to be paid again; one that requires action is settled
+// later by HandleWebhook.
+//
+// An order has at most one payment in progress. Paying an order whose payment
+// awaits action returns that payment; one whose charge outcome is unknown
+// (ErrPaymentProvider) repeats the charge with the same idempotency key, so
+// the customer is charged at most once. Paying an order whose payment
+// succeeded but whose confirmation failed only retries the confirmation.
+func (s *PaymentService) PayOrder(ctx context.Context, orderID, userID, paymentMethod, authToken string) (*models.Payment, error) {
+	if _, err := uuid.Parse(orderID); err != nil {
+		return nil, errors.New("order not found")
+	}
+
+	var payment models.Payment
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the order serializes concurrent payments of it
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).First(&order, "id = ?", orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("order not found")
+			}
+			return fmt.Errorf("failed to get order: %w", err)
+		}
+		if order.Status != models.OrderStatusPending {
+			return fmt.Errorf("%w: order is %s", ErrOrderNotPayable, order.Status)
+		}
+
+		err := tx.Where("order_id = ? AND status IN ?", order.ID, []string{models.PaymentStatusPending,
+			models.PaymentStatusRequiresAction, models.PaymentStatusSucceeded}).First(&payment).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to get order payments: %w", err)
+		}
+
+		payment = models.Payment{
+			OrderID:       order.ID,
+			UserID:        userID,
+			Amount:        order.Total,
+			Status:        models.PaymentStatusPending,
+			Provider:      s.provider.Name(),
+			PaymentMethod: paymentMethod,
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return fmt.Errorf("failed to create payment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch payment.Status {
+	case models.PaymentStatusRequiresAction:
+		return &payment, nil
+	case models.PaymentStatusSucceeded:
+		return &payment, s.confirmOrder(ctx, &payment, authToken)
+	}
+
+	// The charge outlives the request: once sent, its outcome must be recorded
+	result, err := s.provider.Charge(context.WithoutCancel(ctx), clients.ChargeRequest{
+		IdempotencyKey: payment.ID,
+		OrderID:        payment.OrderID,
+		Amount:         payment.Amount,
+		PaymentMethod:  payment.PaymentMethod,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPaymentProvider, err)
+	}
+
+	return s.applyResult(ctx, payment.ID, paymentResult{
+		ProviderRef: result.ProviderRef,
+		Status:      result.Status,
+		Reason:      result.Reason,
+		ActionURL:   result.ActionURL,
+	}, authToken)
+}
+
+// HandleWebhook records the outcome of a charge reported by the provider's
+// signed webhook, confirming the order if the payment succeeded. Webhooks are
+// delivered at least once: a repeated outcome changes nothing, except that a
+// confirmation that failed before is retried. An error asks the provider to
+// deliver the webhook again.
+func (s *PaymentService) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	event, err := s.provider.ParseWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+
+	var payment models.Payment
+	if err := s.db.Where("provider = ? AND provider_ref = ?", s.provider.Name(), event.ProviderRef).
+		First(&payment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: charge %s", ErrPaymentNotFound, event.ProviderRef)
+		}
+		return fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	authToken, err := s.serviceTokens.Authorization(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.applyResult(ctx, payment.ID, paymentResult{Status: event.Status, Reason: event.Reason}, authToken)
+	if errors.Is(err, ErrReservationExpired) || errors.Is(err, ErrOrderNotPayable) {
+		// The payment was refunded; redelivering the webhook would not help
+		log.Printf("WARNING: payment %s of order %s succeeded after the order could no longer be confirmed: %v",
+			payment.ID, payment.OrderID, err)
+		return nil
+	}
+	return err
+}
+
+// applyResult records a charge outcome on a payment and confirms the payment's
+// order if it succeeded. Outcomes that do not follow from the payment's status,
+// such as a late decline of a succeeded payment, are logged and ignored.
+func (s *PaymentService) applyResult(ctx context.Context, paymentID string, result paymentResult, authToken string) (*models.Payment, error) {
+	var payment models.Payment
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", paymentID).Error; err != nil {
+			return fmt.Errorf("failed to get payment: %w", err)
+		}
+		if payment.Status == result.Status {
+			return nil
+		}
+		if !models.CanTransitionPayment(payment.Status, result.Status) {
+			log.Printf("WARNING: ignoring %s outcome of payment %s, which is %s", result.Status, payment.ID, payment.Status)
+			return nil
+		}
+
+		payment.Status = result.Status
+		payment.FailureReason = result.Reason
+		payment.ActionURL = result.ActionURL
+		if result.ProviderRef != "" {
+			payment.ProviderRef = result.ProviderRef
+		}
+		if err := tx.Save(&payment).Error; err != nil {
+			return fmt.Errorf("failed to update payment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status == models.PaymentStatusSucceeded {
+		return &payment, s.confirmOrder(ctx, &payment, authToken)
+	}
+	return &payment, nil
+}
+
+// confirmOrder confirms the order of a succeeded payment. If the order can no
+// longer be confirmed, because its stock reservation expired or it was
+// cancelled meanwhile, the payment is refunded. Other failures leave the order
+// pending and the payment succeeded, so the confirmation can be retried.
+func (s *PaymentService) confirmOrder(ctx context.Context, payment *models.Payment, authToken string) error {
+	_, err := s.orders.TransitionOrder(ctx, payment.OrderID, models.OrderStatusConfirmed, payment.UserID,
+		models.RoleService, "paid with payment "+payment.ID, authToken)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrReservationExpired):
+		s.refund(ctx, payment, "stock reservation expired before payment")
+		return err
+	case errors.Is(err, ErrInvalidStatusTransition):
+		var order models.Order
+		if err := s.db.Select("status").First(&order, "id = ?", payment.OrderID).Error; err != nil {
+			return fmt.Errorf("failed to get order: %w", err)
+		}
+		if order.Status != models.OrderStatusCancelled {
+			// Confirmed by an earlier delivery of the same outcome
+			return nil
+		}
+		s.refund(ctx, payment, "order cancelled")
+		return fmt.Errorf("%w: order was cancelled", ErrOrderNotPayable)
+	default:
+		return fmt.Errorf("payment succeeded but the order was not confirmed: %w", err)
+	}
+}
+
+// refund refunds a succeeded payment whose order cannot be fulfilled. A refund
+// that fails is logged and must be issued manually.
+func (s *PaymentService) refund(ctx context.Context, payment *models.Payment, reason string) {
+	if err := s.orders.refundPayment(context.WithoutCancel(ctx), payment, reason); err != nil {
+		log.Printf("ERROR: %v, refund it manually", err)
+	}
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"order-api-cart/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCursor struct {
+	ID string `json:"i"`
+}
+
+func TestCursorCodec_RoundTrip(t *testing.T) {
+	codec := service.NewCursorCodec("secret")
+
+	token, err := codec.Encode(testCursor{ID: "order-1"})
+	require.NoError(t, err)
+
+	var decoded testCursor
+	require.NoError(t, codec.Decode(token, &decoded))
+	assert.Equal(t, "order-1", decoded.ID)
+}
+
+func TestCursorCodec_RejectsForeignAndTamperedCursors(t *testing.T) {
+	codec := service.NewCursorCodec("secret")
+	token, err := codec.Encode(testCursor{ID: "order-1"})
+	require.NoError(t, err)
+
+	// Swap in a payload for another position, keeping the old signature
+	forged, err := codec.Encode(testCursor{ID: "order-2"})
+	require.NoError(t, err)
+	payload, _, _ := strings.Cut(forged, ".")
+	_, signature, _ := strings.Cut(token, ".")
+
+	var decoded testCursor
+	for name, cursor := range map[string]string{
+		"tampered payload": payload + "." + signature,
+		"no signature":     payload,
+		"garbage":          "not-a-cursor",
+	} {
+		assert.ErrorIs(t, codec.Decode(cursor, &decoded), service.ErrInvalidCursor, name)
+	}
+
+	other := service.NewCursorCodec("other-secret")
+	assert.ErrorIs(t, other.Decode(token, &decoded), service.ErrInvalidCursor, "signed with another secret")
+}
+
+func TestCursorCodec_EmptySecretIsRandom(t *testing.T) {
+	token, err := service.NewCursorCodec("").Encode(testCursor{ID: "order-1"})
+	require.NoError(t, err)
+
+	var decoded testCursor
+	assert.ErrorIs(t, service.NewCursorCodec("").Decode(token, &decoded), service.ErrInvalidCursor)
+}
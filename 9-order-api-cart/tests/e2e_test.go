@@ -4,18 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"order-api-cart/clients"
 	"order-api-cart/config"
 	"order-api-cart/database"
 	"order-api-cart/handlers"
 	"order-api-cart/middleware"
 	"order-api-cart/models"
+	"order-api-cart/service"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -71,7 +78,7 @@ func TestCreateOrderE2E(t *testing.T) {
 	t.Run("CreateOrder_Success", func(t *testing.T) {
 		// Create order request
 		orderReq := CreateTestOrderRequest(
-			[]string{testProduct1.ID, testProduct2.ID},
+			[]uint{testProduct1.ID, testProduct2.ID},
 			[]int{2, 1},
 		)
 
@@ -97,7 +104,7 @@ func TestCreateOrderE2E(t *testing.T) {
 	t.Run("CreateOrder_InvalidProduct", func(t *testing.T) {
 		// Create order request with non-existent product
 		orderReq := CreateTestOrderRequest(
-			[]string{"non-existent-product-id"},
+			[]uint{MissingProductID},
 			[]int{1},
 		)
 
@@ -113,7 +120,7 @@ func TestCreateOrderE2E(t *testing.T) {
 	t.Run("CreateOrder_InsufficientQuantity", func(t *testing.T) {
 		// Create order request with quantity exceeding available stock
 		orderReq := CreateTestOrderRequest(
-			[]string{testProduct1.ID},
+			[]uint{testProduct1.ID},
 			[]int{1000}, // More than available (100)
 		)
 
@@ -129,7 +136,7 @@ func TestCreateOrderE2E(t *testing.T) {
 	t.Run("CreateOrder_Unauthorized", func(t *testing.T) {
 		// Create order request without auth token
 		orderReq := CreateTestOrderRequest(
-			[]string{testProduct1.ID},
+			[]uint{testProduct1.ID},
 			[]int{1},
 		)
 
@@ -191,7 +198,7 @@ func TestGetOrderByIDE2E(t *testing.T) {
 
 	// Create an order first
 	orderReq := CreateTestOrderRequest(
-		[]string{testProduct.ID},
+		[]uint{testProduct.ID},
 		[]int{3},
 	)
 
@@ -276,7 +283,7 @@ func TestGetMyOrdersE2E(t *testing.T) {
 	// Create multiple orders
 	for i := 0; i < 3; i++ {
 		orderReq := CreateTestOrderRequest(
-			[]string{testProduct1.ID, testProduct2.ID},
+			[]uint{testProduct1.ID, testProduct2.ID},
 			[]int{i + 1, i + 1},
 		)
 
@@ -314,12 +321,1290 @@ func TestGetMyOrdersE2E(t *testing.T) {
 		require.True(t, ok)
 		assert.Equal(t, float64(10), limit)
 	})
+
+	t.Run("GetMyOrders_ProductDetails", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "http://localhost:8083/api/v1/my-orders", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+authToken)
+
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var response struct {
+			Orders []models.OrderResponse `json:"orders"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+
+		// Every item is enriched from the batched, cached product lookup
+		names := map[uint]string{testProduct1.ID: testProduct1.Name, testProduct2.ID: testProduct2.Name}
+		for _, order := range response.Orders {
+			for _, item := range order.Items {
+				assert.Equal(t, names[item.ProductID], item.Product.Name)
+			}
+		}
+	})
+
+	t.Run("GetMyOrders_CursorPagination", func(t *testing.T) {
+		type cursorPage struct {
+			Orders     []models.OrderResponse `json:"orders"`
+			NextCursor string                 `json:"next_cursor"`
+			PrevCursor string                 `json:"prev_cursor"`
+		}
+		fetch := func(t *testing.T, cursor string) (int, cursorPage) {
+			req, err := http.NewRequest("GET", "http://localhost:8083/api/v1/my-orders?limit=1&cursor="+url.QueryEscape(cursor), nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+authToken)
+
+			client := &http.Client{Timeout: 10 * time.Second}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			var page cursorPage
+			if resp.StatusCode == http.StatusOK {
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+			}
+			return resp.StatusCode, page
+		}
+
+		var total int64
+		require.NoError(t, database.GetDB().Model(&models.Order{}).Where("user_id = ?", testUser.ID).Count(&total).Error)
+		require.GreaterOrEqual(t, total, int64(2), "needs orders on more than one page")
+
+		// Walk forward one order at a time, newest first
+		var forward []models.OrderResponse
+		var pages []cursorPage
+		status, page := fetch(t, "")
+		require.Equal(t, http.StatusOK, status)
+		assert.Empty(t, page.PrevCursor, "first page has no previous page")
+		for {
+			require.Len(t, page.Orders, 1)
+			forward = append(forward, page.Orders[0])
+			pages = append(pages, page)
+			if page.NextCursor == "" {
+				break
+			}
+			status, page = fetch(t, page.NextCursor)
+			require.Equal(t, http.StatusOK, status)
+		}
+		require.Len(t, forward, int(total))
+		for i := 1; i < len(forward); i++ {
+			assert.False(t, forward[i].CreatedAt.After(forward[i-1].CreatedAt), "orders are newest first")
+		}
+
+		// The previous cursor of the last page leads back to the one before it
+		status, page = fetch(t, pages[len(pages)-1].PrevCursor)
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, page.Orders, 1)
+		assert.Equal(t, forward[len(forward)-2].ID, page.Orders[0].ID)
+		assert.NotEmpty(t, page.NextCursor)
+
+		// Tampered cursors are rejected
+		tampered := pages[0].NextCursor[:len(pages[0].NextCursor)-2] + "xx"
+		status, _ = fetch(t, tampered)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
+
+func TestOrderOwnershipE2E(t *testing.T) {
+	// Setup test database
+	cfg := LoadTestConfig()
+	defer CleanupTestDB(t)
+
+	// Connect to test database
+	err := database.Connect(cfg.Config)
+	require.NoError(t, err)
+
+	// Run migrations
+	err = database.Migrate()
+	require.NoError(t, err)
+
+	// Start mock services
+	mockAuth := StartMockAuthService(t, "8084")
+	mockProduct := StartMockProductService(t, "8085")
+
+	// Create test data: two customers and a support agent
+	alice := mockAuth.CreateTestUser(t)
+	bob := mockAuth.CreateTestUser(t)
+	supportUser := mockAuth.CreateTestUser(t)
+	testProduct := mockProduct.CreateTestProduct(t, "Test Product", 15.00, 100)
+
+	// Generate test JWT tokens
+	aliceToken := GenerateTestJWT(alice.ID)
+	bobToken := GenerateTestJWT(bob.ID)
+	supportToken := GenerateTestJWTWithRole(supportUser.ID, "support")
+
+	// Start the main application server
+	server := startTestServer(t, cfg.Config)
+	defer server.Shutdown(context.Background())
+
+	// Wait for server to start
+	time.Sleep(200 * time.Millisecond)
+
+	createOrder := func(t *testing.T, token string) models.OrderResponse {
+		resp, err := MakeOrderRequest(t, "http://localhost:8083", token,
+			CreateTestOrderRequest([]uint{testProduct.ID}, []int{1}))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var order models.OrderResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+		return order
+	}
+
+	aliceOrder := createOrder(t, aliceToken)
+	bobOrder := createOrder(t, bobToken)
+
+	get := func(t *testing.T, token, path string) *http.Response {
+		req, err := http.NewRequest("GET", "http://localhost:8083"+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("OwnerCanReadOwnOrder", func(t *testing.T) {
+		resp := get(t, aliceToken, "/api/v1/order/"+aliceOrder.ID)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("ForeignOrderIsNotFound", func(t *testing.T) {
+		foreign := get(t, bobToken, "/api/v1/order/"+aliceOrder.ID)
+		defer foreign.Body.Close()
+		foreignBody, err := io.ReadAll(foreign.Body)
+		require.NoError(t, err)
+
+		missing := get(t, bobToken, "/api/v1/order/"+uuid.New().String())
+		defer missing.Body.Close()
+		missingBody, err := io.ReadAll(missing.Body)
+		require.NoError(t, err)
+
+		// Indistinguishable from an order that does not exist
+		assert.Equal(t, http.StatusNotFound, foreign.StatusCode)
+		assert.Equal(t, missing.StatusCode, foreign.StatusCode)
+		assert.Equal(t, string(missingBody), string(foreignBody))
+	})
+
+	t.Run("ForeignOrderHistoryIsNotFound", func(t *testing.T) {
+		resp := get(t, bobToken, "/api/v1/order/"+aliceOrder.ID+"/history")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("ForeignOrderCannotBeCancelled", func(t *testing.T) {
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", bobToken, aliceOrder.ID, "cancel")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		var order models.Order
+		require.NoError(t, database.GetDB().First(&order, "id = ?", aliceOrder.ID).Error)
+		assert.Equal(t, "pending", order.Status)
+	})
+
+	t.Run("MyOrdersAreIsolated", func(t *testing.T) {
+		resp := get(t, bobToken, "/api/v1/my-orders")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var response struct {
+			Orders []models.OrderResponse `json:"orders"`
+			Total  int64                  `json:"total"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		require.Len(t, response.Orders, 1)
+		assert.Equal(t, bobOrder.ID, response.Orders[0].ID)
+		assert.Equal(t, int64(1), response.Total)
+	})
+
+	t.Run("SupportCanReadAnyOrder", func(t *testing.T) {
+		resp := get(t, supportToken, "/api/v1/order/"+aliceOrder.ID)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var order models.OrderResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+		assert.Equal(t, alice.ID, order.UserID)
+	})
+
+	t.Run("SupportCannotCancelForeignOrder", func(t *testing.T) {
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", supportToken, aliceOrder.ID, "cancel")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestOrderStatusTransitionsE2E(t *testing.T) {
+	// Setup test database
+	cfg := LoadTestConfig()
+	defer CleanupTestDB(t)
+
+	// Connect to test database
+	err := database.Connect(cfg.Config)
+	require.NoError(t, err)
+
+	// Run migrations
+	err = database.Migrate()
+	require.NoError(t, err)
+
+	// Start mock services
+	mockAuth := StartMockAuthService(t, "8084")
+	mockProduct := StartMockProductService(t, "8085")
+
+	// Create test data
+	testUser := mockAuth.CreateTestUser(t)
+	adminUser := mockAuth.CreateTestUser(t)
+	testProduct := mockProduct.CreateTestProduct(t, "Test Product", 15.00, 100)
+
+	// Generate test JWT tokens
+	authToken := GenerateTestJWT(testUser.ID)
+	adminToken := GenerateTestJWTWithRole(adminUser.ID, "admin")
+
+	// Start the main application server
+	server := startTestServer(t, cfg.Config)
+	defer server.Shutdown(context.Background())
+
+	// Wait for server to start
+	time.Sleep(200 * time.Millisecond)
+
+	createOrder := func(t *testing.T) models.OrderResponse {
+		resp, err := MakeOrderRequest(t, "http://localhost:8083", authToken,
+			CreateTestOrderRequest([]uint{testProduct.ID}, []int{3}))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var order models.OrderResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+		return order
+	}
+
+	t.Run("FullLifecycle", func(t *testing.T) {
+		order := createOrder(t)
+
+		// Paying confirms the order
+		resp, err := MakePaymentRequest(t, "http://localhost:8083", authToken, order.ID, clients.FakeOutcomeSuccess)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		for _, step := range []struct{ action, status string }{
+			{"ship", "shipped"},
+			{"deliver", "delivered"},
+		} {
+			resp, err := MakeOrderActionRequest(t, "http://localhost:8083", adminToken, order.ID, step.action)
+			require.NoError(t, err)
+			var updated models.OrderResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&updated))
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, step.status, updated.Status)
+		}
+
+		var history []models.OrderStatusHistory
+		err = database.GetDB().Where("order_id = ?", order.ID).Order("created_at ASC").Find(&history).Error
+		require.NoError(t, err)
+		require.Len(t, history, 4)
+		assert.Equal(t, "pending", history[0].ToStatus)
+		assert.Equal(t, "confirmed", history[1].ToStatus)
+		assert.Equal(t, testUser.ID, history[1].ChangedBy)
+		assert.Equal(t, "shipped", history[3].FromStatus)
+		assert.Equal(t, "delivered", history[3].ToStatus)
+		assert.Equal(t, adminUser.ID, history[3].ChangedBy)
+	})
+
+	t.Run("InvalidTransition", func(t *testing.T) {
+		order := createOrder(t)
+
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", adminToken, order.ID, "deliver")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("UnpaidOrderCannotBeConfirmed", func(t *testing.T) {
+		order := createOrder(t)
+
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", adminToken, order.ID, "confirm")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("OwnerCannotConfirm", func(t *testing.T) {
+		order := createOrder(t)
+
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", authToken, order.ID, "confirm")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("CancelRestocksInventory", func(t *testing.T) {
+		product, err := mockProduct.GetProductByID(testProduct.ID)
+		require.NoError(t, err)
+		stockBefore := product.Quantity
+
+		order := createOrder(t)
+		WaitForProductQuantity(t, mockProduct, testProduct.ID, stockBefore-3)
+
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", authToken, order.ID, "cancel")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		WaitForProductQuantity(t, mockProduct, testProduct.ID, stockBefore)
+
+		// Cancelled is final
+		resp, err = MakeOrderActionRequest(t, "http://localhost:8083", authToken, order.ID, "cancel")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+}
+
+func TestInventoryOutboxE2E(t *testing.T) {
+	// Setup test database
+	cfg := LoadTestConfig()
+	defer CleanupTestDB(t)
+
+	// Connect to test database
+	err := database.Connect(cfg.Config)
+	require.NoError(t, err)
+
+	// Run migrations
+	err = database.Migrate()
+	require.NoError(t, err)
+
+	// Start mock services
+	mockAuth := StartMockAuthService(t, "8084")
+	mockProduct := StartMockProductService(t, "8085")
+
+	// Create test data
+	testUser := mockAuth.CreateTestUser(t)
+	adminUser := mockAuth.CreateTestUser(t)
+	testProduct := mockProduct.CreateTestProduct(t, "Test Product", 15.00, 100)
+
+	// Generate test JWT tokens
+	authToken := GenerateTestJWT(testUser.ID)
+	adminToken := GenerateTestJWTWithRole(adminUser.ID, "admin")
+
+	// Start the main application server
+	server := startTestServer(t, cfg.Config)
+	defer server.Shutdown(context.Background())
+
+	// Wait for server to start
+	time.Sleep(200 * time.Millisecond)
+
+	// Stock is reserved when an order is placed; only cancelling a confirmed
+	// order sends an inventory command, to restock its items
+	cancelConfirmedOrder := func(t *testing.T, quantity int) models.OrderResponse {
+		resp, err := MakeOrderRequest(t, "http://localhost:8083", authToken,
+			CreateTestOrderRequest([]uint{testProduct.ID}, []int{quantity}))
+		require.NoError(t, err)
+		var order models.OrderResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, err = MakePaymentRequest(t, "http://localhost:8083", authToken, order.ID, clients.FakeOutcomeSuccess)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, err = MakeOrderActionRequest(t, "http://localhost:8083", adminToken, order.ID, "cancel")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return order
+	}
+
+	outboxMessage := func(t *testing.T, orderID string) models.OutboxMessage {
+		var message models.OutboxMessage
+		err := database.GetDB().First(&message, "order_id = ?", orderID).Error
+		require.NoError(t, err)
+		return message
+	}
+
+	t.Run("RetriesTransientFailures", func(t *testing.T) {
+		mockProduct.FailQuantityUpdates(2, http.StatusServiceUnavailable)
+
+		order := cancelConfirmedOrder(t, 2)
+		WaitForProductQuantity(t, mockProduct, testProduct.ID, 100)
+
+		message := outboxMessage(t, order.ID)
+		assert.Equal(t, models.OutboxInventoryRestock, message.Type)
+		assert.Equal(t, 2, message.Change)
+		assert.Equal(t, models.OutboxStatusSent, message.Status)
+		assert.Equal(t, 3, message.Attempts)
+
+		// The restock is recorded as a return at the price the order paid
+		adjustment, ok := mockProduct.Adjustment(message.IdempotencyKey)
+		require.True(t, ok)
+		assert.Equal(t, models.InventoryReasonReturn, adjustment.Reason)
+		require.NotNil(t, adjustment.UnitPrice)
+		assert.Equal(t, 15.00, *adjustment.UnitPrice)
+	})
+
+	t.Run("DeadLetterAndReplay", func(t *testing.T) {
+		// OUTBOX_MAX_ATTEMPTS is 3 in tests
+		mockProduct.FailQuantityUpdates(3, http.StatusServiceUnavailable)
+
+		order := cancelConfirmedOrder(t, 5)
+		require.Eventually(t, func() bool {
+			return outboxMessage(t, order.ID).Status == models.OutboxStatusDead
+		}, 5*time.Second, 50*time.Millisecond)
+		WaitForProductQuantity(t, mockProduct, testProduct.ID, 95)
+
+		// Only admins can inspect the outbox
+		req, err := http.NewRequest("GET", "http://localhost:8083/api/v1/admin/outbox?status=dead", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+authToken)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		var list struct {
+			Messages []models.OutboxMessage `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		resp.Body.Close()
+		require.Len(t, list.Messages, 1)
+		assert.Equal(t, order.ID, list.Messages[0].OrderID)
+		assert.NotEmpty(t, list.Messages[0].LastError)
+
+		req, err = http.NewRequest("POST", fmt.Sprintf("http://localhost:8083/api/v1/admin/outbox/%s/replay", list.Messages[0].ID), nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		WaitForProductQuantity(t, mockProduct, testProduct.ID, 100)
+		assert.Equal(t, models.OutboxStatusSent, outboxMessage(t, order.ID).Status)
+	})
+
+	t.Run("PermanentFailureIsNotRetried", func(t *testing.T) {
+		mockProduct.FailQuantityUpdates(1, http.StatusNotFound)
+
+		order := cancelConfirmedOrder(t, 1)
+		require.Eventually(t, func() bool {
+			return outboxMessage(t, order.ID).Status == models.OutboxStatusDead
+		}, 5*time.Second, 50*time.Millisecond)
+		assert.Equal(t, 1, outboxMessage(t, order.ID).Attempts)
+	})
+
+	t.Run("AuthFailureIsRetried", func(t *testing.T) {
+		// A rejected service token is a configuration problem, not a
+		// rejected command
+		mockProduct.FailQuantityUpdates(1, http.StatusUnauthorized)
+
+		order := cancelConfirmedOrder(t, 1)
+		require.Eventually(t, func() bool {
+			return outboxMessage(t, order.ID).Status == models.OutboxStatusSent
+		}, 5*time.Second, 50*time.Millisecond)
+		assert.Equal(t, 2, outboxMessage(t, order.ID).Attempts)
+	})
+}
+
+func TestStockReservationE2E(t *testing.T) {
+	// Setup test database
+	cfg := LoadTestConfig()
+	defer CleanupTestDB(t)
+
+	// Connect to test database
+	err := database.Connect(cfg.Config)
+	require.NoError(t, err)
+
+	// Run migrations
+	err = database.Migrate()
+	require.NoError(t, err)
+
+	// Start mock services
+	mockAuth := StartMockAuthService(t, "8084")
+	mockProduct := StartMockProductService(t, "8085")
+
+	// Create test data
+	testUser := mockAuth.CreateTestUser(t)
+	adminUser := mockAuth.CreateTestUser(t)
+
+	// Generate test JWT tokens
+	authToken := GenerateTestJWT(testUser.ID)
+	adminToken := GenerateTestJWTWithRole(adminUser.ID, "admin")
+
+	// Start the main application server
+	server := startTestServer(t, cfg.Config)
+	defer server.Shutdown(context.Background())
+
+	// Wait for server to start
+	time.Sleep(200 * time.Millisecond)
+
+	createOrder := func(t *testing.T, productID uint, quantity int) models.OrderResponse {
+		resp, err := MakeOrderRequest(t, "http://localhost:8083", authToken,
+			CreateTestOrderRequest([]uint{productID}, []int{quantity}))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var order models.OrderResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+		require.NotNil(t, order.ReservationID)
+		return order
+	}
+
+	t.Run("ReserveThenConfirm", func(t *testing.T) {
+		testProduct := mockProduct.CreateTestProduct(t, "Reserved Product", 10.00, 10)
+
+		order := createOrder(t, testProduct.ID, 4)
+		assert.Equal(t, "held", mockProduct.ReservationStatus(*order.ReservationID))
+		product, err := mockProduct.GetProductByID(testProduct.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 6, product.Quantity)
+
+		resp, err := MakePaymentRequest(t, "http://localhost:8083", authToken, order.ID, clients.FakeOutcomeSuccess)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "confirmed", mockProduct.ReservationStatus(*order.ReservationID))
+
+		// Confirming takes nothing more out of stock and sends no inventory command
+		product, err = mockProduct.GetProductByID(testProduct.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 6, product.Quantity)
+		var messages int64
+		require.NoError(t, database.GetDB().Model(&models.OutboxMessage{}).
+			Where("order_id = ?", order.ID).Count(&messages).Error)
+		assert.Zero(t, messages)
+	})
+
+	t.Run("CancelReleasesReservation", func(t *testing.T) {
+		testProduct := mockProduct.CreateTestProduct(t, "Released Product", 10.00, 10)
+
+		order := createOrder(t, testProduct.ID, 4)
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", authToken, order.ID, "cancel")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, "released", mockProduct.ReservationStatus(*order.ReservationID))
+		product, err := mockProduct.GetProductByID(testProduct.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 10, product.Quantity)
+	})
+
+	t.Run("ExpiredReservationCannotBeConfirmed", func(t *testing.T) {
+		testProduct := mockProduct.CreateTestProduct(t, "Expiring Product", 10.00, 10)
+
+		order := createOrder(t, testProduct.ID, 4)
+		mockProduct.ExpireReservation(*order.ReservationID)
+
+		// The charge succeeds but cannot confirm the order, so it is refunded
+		resp, err := MakePaymentRequest(t, "http://localhost:8083", authToken, order.ID, clients.FakeOutcomeSuccess)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		var stored models.Order
+		require.NoError(t, database.GetDB().First(&stored, "id = ?", order.ID).Error)
+		assert.Equal(t, models.OrderStatusPending, stored.Status)
+		var payment models.Payment
+		require.NoError(t, database.GetDB().First(&payment, "order_id = ?", order.ID).Error)
+		assert.Equal(t, models.PaymentStatusRefunded, payment.Status)
+
+		// Nor can staff confirm it, as it is no longer paid
+		resp, err = MakeOrderActionRequest(t, "http://localhost:8083", adminToken, order.ID, "confirm")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		// The expired order can still be cancelled; its stock is already back
+		resp, err = MakeOrderActionRequest(t, "http://localhost:8083", authToken, order.ID, "cancel")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		product, err := mockProduct.GetProductByID(testProduct.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 10, product.Quantity)
+	})
+
+	t.Run("ConcurrentOrdersCannotOversell", func(t *testing.T) {
+		testProduct := mockProduct.CreateTestProduct(t, "Scarce Product", 10.00, 5)
+
+		var wg sync.WaitGroup
+		var created atomic.Int32
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := MakeOrderRequest(t, "http://localhost:8083", authToken,
+					CreateTestOrderRequest([]uint{testProduct.ID}, []int{1}))
+				if err != nil {
+					return
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode == http.StatusCreated {
+					created.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(5), created.Load())
+		product, err := mockProduct.GetProductByID(testProduct.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 0, product.Quantity)
+	})
+}
+
+func TestOrderIdempotencyE2E(t *testing.T) {
+	// Setup test database
+	cfg := LoadTestConfig()
+	defer CleanupTestDB(t)
+
+	// Connect to test database
+	err := database.Connect(cfg.Config)
+	require.NoError(t, err)
+
+	// Run migrations
+	err = database.Migrate()
+	require.NoError(t, err)
+
+	// Start mock services
+	mockAuth := StartMockAuthService(t, "8084")
+	mockProduct := StartMockProductService(t, "8085")
+
+	// Create test data
+	testUser := mockAuth.CreateTestUser(t)
+	otherUser := mockAuth.CreateTestUser(t)
+	testProduct := mockProduct.CreateTestProduct(t, "Test Product", 20.00, 100)
+
+	// Generate test JWT tokens
+	authToken := GenerateTestJWT(testUser.ID)
+	otherToken := GenerateTestJWT(otherUser.ID)
+
+	// Start the main application server
+	server := startTestServer(t, cfg.Config)
+	defer server.Shutdown(context.Background())
+
+	// Wait for server to start
+	time.Sleep(200 * time.Millisecond)
+
+	createOrder := func(t *testing.T, token, key string, quantity int) (*http.Response, models.OrderResponse) {
+		resp, err := MakeOrderRequestWithKey(t, "http://localhost:8083", token, key,
+			CreateTestOrderRequest([]uint{testProduct.ID}, []int{quantity}))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var order models.OrderResponse
+		if resp.StatusCode == http.StatusCreated {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+		}
+		return resp, order
+	}
+
+	countOrders := func(t *testing.T, userID string) int64 {
+		var count int64
+		require.NoError(t, database.GetDB().Model(&models.Order{}).Where("user_id = ?", userID).Count(&count).Error)
+		return count
+	}
+
+	t.Run("RetryReplaysResponse", func(t *testing.T) {
+		key := uuid.New().String()
+
+		resp, first := createOrder(t, authToken, key, 2)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+
+		resp, retried := createOrder(t, authToken, key, 2)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+		assert.Equal(t, first.ID, retried.ID)
+
+		// One order, stock decremented once
+		assert.Equal(t, int64(1), countOrders(t, testUser.ID))
+		WaitForProductQuantity(t, mockProduct, testProduct.ID, 98)
+	})
+
+	t.Run("KeyReusedForDifferentRequest", func(t *testing.T) {
+		key := uuid.New().String()
+
+		resp, _ := createOrder(t, authToken, key, 1)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, _ = createOrder(t, authToken, key, 3)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	})
+
+	t.Run("KeysAreScopedToUser", func(t *testing.T) {
+		key := uuid.New().String()
+
+		resp, mine := createOrder(t, authToken, key, 1)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, theirs := createOrder(t, otherToken, key, 1)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.NotEqual(t, mine.ID, theirs.ID)
+		assert.Equal(t, otherUser.ID, theirs.UserID)
+	})
+
+	t.Run("FailedRequestCanBeRetried", func(t *testing.T) {
+		key := uuid.New().String()
+
+		// More than in stock
+		resp, _ := createOrder(t, authToken, key, 1000)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		var count int64
+		require.NoError(t, database.GetDB().Model(&models.IdempotencyRecord{}).
+			Where("idempotency_key = ?", key).Count(&count).Error)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("OrderReplayedWhenResponseWasNotStored", func(t *testing.T) {
+		key := uuid.New().String()
+
+		resp, first := createOrder(t, authToken, key, 1)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		before := countOrders(t, testUser.ID)
+
+		// As if storing the response had failed, and the lease had since run out
+		require.NoError(t, database.GetDB().Model(&models.IdempotencyRecord{}).
+			Where("idempotency_key = ?", key).Updates(map[string]interface{}{
+			"status_code": 0,
+			"response":    nil,
+			"updated_at":  time.Now().Add(-2 * time.Minute),
+		}).Error)
+
+		resp, retried := createOrder(t, authToken, key, 1)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+		assert.Equal(t, first.ID, retried.ID)
+		assert.Equal(t, before, countOrders(t, testUser.ID), "no second order")
+
+		// The rebuilt response is stored for later retries
+		var record models.IdempotencyRecord
+		require.NoError(t, database.GetDB().First(&record, "idempotency_key = ?", key).Error)
+		assert.Equal(t, http.StatusCreated, record.StatusCode)
+		require.NotNil(t, record.OrderID)
+		assert.Equal(t, first.ID, *record.OrderID)
+	})
+
+	t.Run("ExpiredKeyCreatesNewOrder", func(t *testing.T) {
+		key := uuid.New().String()
+
+		resp, first := createOrder(t, authToken, key, 1)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		require.NoError(t, database.GetDB().Model(&models.IdempotencyRecord{}).
+			Where("idempotency_key = ?", key).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		resp, second := createOrder(t, authToken, key, 1)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+		assert.NotEqual(t, first.ID, second.ID)
+	})
+}
+
+func TestCartE2E(t *testing.T) {
+	// Setup test database
+	cfg := LoadTestConfig()
+	defer CleanupTestDB(t)
+
+	// Connect to test database
+	err := database.Connect(cfg.Config)
+	require.NoError(t, err)
+
+	// Run migrations
+	err = database.Migrate()
+	require.NoError(t, err)
+
+	// Start mock services
+	mockAuth := StartMockAuthService(t, "8084")
+	mockProduct := StartMockProductService(t, "8085")
+
+	// Create test data
+	testUser := mockAuth.CreateTestUser(t)
+	otherUser := mockAuth.CreateTestUser(t)
+	testProduct1 := mockProduct.CreateTestProduct(t, "Test Product 1", 10.00, 100)
+	testProduct2 := mockProduct.CreateTestProduct(t, "Test Product 2", 4.50, 5)
+
+	// Generate test JWT tokens
+	authToken := GenerateTestJWT(testUser.ID)
+	otherToken := GenerateTestJWT(otherUser.ID)
+
+	// Start the main application server
+	server := startTestServer(t, cfg.Config)
+	defer server.Shutdown(context.Background())
+
+	// Wait for server to start
+	time.Sleep(200 * time.Millisecond)
+
+	cartRequest := func(t *testing.T, token, method, path string, body interface{}) (int, models.CartResponse) {
+		resp, err := MakeCartRequest(t, "http://localhost:8083", token, method, path, body)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var cart models.CartResponse
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&cart))
+		}
+		return resp.StatusCode, cart
+	}
+
+	t.Run("EmptyCart", func(t *testing.T) {
+		status, cart := cartRequest(t, authToken, "GET", "", nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.NotEmpty(t, cart.ID)
+		assert.Equal(t, testUser.ID, cart.UserID)
+		assert.Empty(t, cart.Items)
+		assert.Equal(t, 0.0, cart.Total)
+	})
+
+	t.Run("AddUpdateRemoveItems", func(t *testing.T) {
+		status, cart := cartRequest(t, authToken, "POST", "/items",
+			models.OrderItemRequest{ProductID: testProduct1.ID, Quantity: 2})
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, cart.Items, 1)
+
+		// Adding the same product again adds to its quantity
+		status, cart = cartRequest(t, authToken, "POST", "/items",
+			models.OrderItemRequest{ProductID: testProduct1.ID, Quantity: 1})
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, cart.Items, 1)
+		assert.Equal(t, 3, cart.Items[0].Quantity)
+
+		status, cart = cartRequest(t, authToken, "POST", "/items",
+			models.OrderItemRequest{ProductID: testProduct2.ID, Quantity: 2})
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, cart.Items, 2)
+		assert.Equal(t, 39.0, cart.Total) // (10.00 * 3) + (4.50 * 2)
+
+		status, cart = cartRequest(t, authToken, "PUT", fmt.Sprintf("/items/%d", testProduct1.ID),
+			models.CartItemQuantityRequest{Quantity: 1})
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, 19.0, cart.Total)
+
+		status, cart = cartRequest(t, authToken, "DELETE", fmt.Sprintf("/items/%d", testProduct2.ID), nil)
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, cart.Items, 1)
+		assert.Equal(t, testProduct1.ID, cart.Items[0].ProductID)
+
+		status, _ = cartRequest(t, authToken, "DELETE", fmt.Sprintf("/items/%d", testProduct2.ID), nil)
+		assert.Equal(t, http.StatusNotFound, status)
+
+		// Carts are per user
+		status, cart = cartRequest(t, otherToken, "GET", "", nil)
+		require.Equal(t, http.StatusOK, status)
+		assert.Empty(t, cart.Items)
+	})
+
+	t.Run("InvalidItems", func(t *testing.T) {
+		status, _ := cartRequest(t, authToken, "POST", "/items",
+			models.OrderItemRequest{ProductID: MissingProductID, Quantity: 1})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		// Only 5 in stock
+		status, _ = cartRequest(t, authToken, "POST", "/items",
+			models.OrderItemRequest{ProductID: testProduct2.ID, Quantity: 6})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = cartRequest(t, authToken, "POST", "/items",
+			models.OrderItemRequest{ProductID: 0, Quantity: 1})
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("PricesRefreshedOnRead", func(t *testing.T) {
+		status, _ := cartRequest(t, authToken, "PUT", "", models.CartRequest{
+			Items: []models.OrderItemRequest{{ProductID: testProduct1.ID, Quantity: 2}},
+		})
+		require.Equal(t, http.StatusOK, status)
+
+		mockProduct.SetProductPrice(testProduct1.ID, 12.00)
+		defer mockProduct.SetProductPrice(testProduct1.ID, 10.00)
+
+		status, cart := cartRequest(t, authToken, "GET", "", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, cart.Items, 1)
+		assert.Equal(t, 12.00, cart.Items[0].Price)
+		require.NotNil(t, cart.Items[0].PreviousPrice)
+		assert.Equal(t, 10.00, *cart.Items[0].PreviousPrice)
+		assert.Equal(t, 24.00, cart.Total)
+
+		// The new price is the snapshot now
+		_, cart = cartRequest(t, authToken, "GET", "", nil)
+		assert.Nil(t, cart.Items[0].PreviousPrice)
+	})
+
+	t.Run("Checkout", func(t *testing.T) {
+		status, _ := cartRequest(t, authToken, "PUT", "", models.CartRequest{
+			Items: []models.OrderItemRequest{
+				{ProductID: testProduct1.ID, Quantity: 2},
+				{ProductID: testProduct2.ID, Quantity: 1},
+			},
+		})
+		require.Equal(t, http.StatusOK, status)
+
+		resp, err := MakeCartRequest(t, "http://localhost:8083", authToken, "POST", "/checkout", nil)
+		require.NoError(t, err)
+		AssertOrderResponse(t, resp, testUser.ID, 2)
+		resp.Body.Close()
+
+		// The order decremented stock through the outbox and emptied the cart
+		WaitForProductQuantity(t, mockProduct, testProduct1.ID, 98)
+		WaitForProductQuantity(t, mockProduct, testProduct2.ID, 4)
+
+		status, cart := cartRequest(t, authToken, "GET", "", nil)
+		require.Equal(t, http.StatusOK, status)
+		assert.Empty(t, cart.Items)
+
+		resp, err = MakeCartRequest(t, "http://localhost:8083", authToken, "POST", "/checkout", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("ChangesDuringCheckout", func(t *testing.T) {
+		status, _ := cartRequest(t, authToken, "PUT", "", models.CartRequest{
+			Items: []models.OrderItemRequest{{ProductID: testProduct1.ID, Quantity: 1}},
+		})
+		require.Equal(t, http.StatusOK, status)
+
+		// Hold the checkout in the product service while the cart is changed
+		mockProduct.DelayReservations(500 * time.Millisecond)
+		defer mockProduct.DelayReservations(0)
+		checkoutStatus := make(chan int, 1)
+		go func() {
+			resp, err := MakeCartRequest(t, "http://localhost:8083", authToken, "POST", "/checkout", nil)
+			if err != nil {
+				checkoutStatus <- 0
+				return
+			}
+			resp.Body.Close()
+			checkoutStatus <- resp.StatusCode
+		}()
+		time.Sleep(200 * time.Millisecond)
+
+		status, _ = cartRequest(t, authToken, "POST", "/items",
+			models.OrderItemRequest{ProductID: testProduct2.ID, Quantity: 1})
+		assert.Equal(t, http.StatusConflict, status)
+		status, _ = cartRequest(t, authToken, "DELETE", "", nil)
+		assert.Equal(t, http.StatusConflict, status)
+		resp, err := MakeCartRequest(t, "http://localhost:8083", authToken, "POST", "/checkout", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		assert.Equal(t, http.StatusCreated, <-checkoutStatus)
+		_, cart := cartRequest(t, authToken, "GET", "", nil)
+		assert.Empty(t, cart.Items, "only the checked out items were in the cart")
+	})
+
+	t.Run("FailedCheckoutKeepsCart", func(t *testing.T) {
+		scarce := mockProduct.CreateTestProduct(t, "Scarce Product", 5.00, 1)
+		status, _ := cartRequest(t, authToken, "PUT", "", models.CartRequest{
+			Items: []models.OrderItemRequest{{ProductID: scarce.ID, Quantity: 1}},
+		})
+		require.Equal(t, http.StatusOK, status)
+		// The product sells out between putting it in the cart and checking out
+		mockProduct.SetProductQuantity(scarce.ID, 0)
+
+		resp, err := MakeCartRequest(t, "http://localhost:8083", authToken, "POST", "/checkout", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		// The cart is unchanged and can be changed again
+		_, cart := cartRequest(t, authToken, "GET", "", nil)
+		require.Len(t, cart.Items, 1)
+		status, _ = cartRequest(t, authToken, "DELETE", "", nil)
+		assert.Equal(t, http.StatusNoContent, status)
+	})
+
+	t.Run("ClearCart", func(t *testing.T) {
+		status, _ := cartRequest(t, authToken, "POST", "/items",
+			models.OrderItemRequest{ProductID: testProduct1.ID, Quantity: 1})
+		require.Equal(t, http.StatusOK, status)
+
+		status, _ = cartRequest(t, authToken, "DELETE", "", nil)
+		assert.Equal(t, http.StatusNoContent, status)
+
+		_, cart := cartRequest(t, authToken, "GET", "", nil)
+		assert.Empty(t, cart.Items)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		status, _ := cartRequest(t, "", "GET", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, status)
+	})
 }
 
 // startTestServer starts the test server
+func TestPaymentsE2E(t *testing.T) {
+	// Setup test database
+	cfg := LoadTestConfig()
+	defer CleanupTestDB(t)
+
+	// Connect to test database
+	err := database.Connect(cfg.Config)
+	require.NoError(t, err)
+
+	// Run migrations
+	err = database.Migrate()
+	require.NoError(t, err)
+
+	// Start mock services
+	mockAuth := StartMockAuthService(t, "8084")
+	mockProduct := StartMockProductService(t, "8085")
+
+	// Create test data
+	testUser := mockAuth.CreateTestUser(t)
+	otherUser := mockAuth.CreateTestUser(t)
+	testProduct := mockProduct.CreateTestProduct(t, "Paid Product", 12.50, 100)
+
+	// Generate test JWT tokens
+	authToken := GenerateTestJWT(testUser.ID)
+	otherToken := GenerateTestJWT(otherUser.ID)
+
+	// Start the main application server
+	server, payments := startPaymentTestServer(t, cfg.Config)
+	defer server.Shutdown(context.Background())
+
+	// Wait for server to start
+	time.Sleep(200 * time.Millisecond)
+
+	createOrder := func(t *testing.T) models.OrderResponse {
+		resp, err := MakeOrderRequest(t, "http://localhost:8083", authToken,
+			CreateTestOrderRequest([]uint{testProduct.ID}, []int{2}))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var order models.OrderResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&order))
+		return order
+	}
+
+	pay := func(t *testing.T, token, orderID, paymentMethod string) (int, models.Payment) {
+		resp, err := MakePaymentRequest(t, "http://localhost:8083", token, orderID, paymentMethod)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var payment models.Payment
+		if resp.StatusCode < http.StatusBadRequest || resp.StatusCode == http.StatusPaymentRequired {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&payment))
+		}
+		return resp.StatusCode, payment
+	}
+
+	orderStatus := func(t *testing.T, orderID string) string {
+		var order models.Order
+		require.NoError(t, database.GetDB().First(&order, "id = ?", orderID).Error)
+		return order.Status
+	}
+
+	paymentStatus := func(t *testing.T, paymentID string) string {
+		var payment models.Payment
+		require.NoError(t, database.GetDB().First(&payment, "id = ?", paymentID).Error)
+		return payment.Status
+	}
+
+	webhook := func(t *testing.T, payload []byte, signature string) int {
+		resp, err := MakeWebhookRequest(t, "http://localhost:8083", payload, signature)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("SuccessConfirmsOrder", func(t *testing.T) {
+		order := createOrder(t)
+
+		status, payment := pay(t, authToken, order.ID, clients.FakeOutcomeSuccess)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, models.PaymentStatusSucceeded, payment.Status)
+		assert.Equal(t, 25.0, payment.Amount)
+		assert.NotEmpty(t, payment.ProviderRef)
+
+		assert.Equal(t, models.OrderStatusConfirmed, orderStatus(t, order.ID))
+		assert.Equal(t, "confirmed", mockProduct.ReservationStatus(*order.ReservationID))
+
+		// A confirmed order cannot be paid again
+		status, _ = pay(t, authToken, order.ID, clients.FakeOutcomeSuccess)
+		assert.Equal(t, http.StatusConflict, status)
+	})
+
+	t.Run("DeclineLeavesOrderPending", func(t *testing.T) {
+		order := createOrder(t)
+
+		status, declined := pay(t, authToken, order.ID, clients.FakeOutcomeDecline)
+		require.Equal(t, http.StatusPaymentRequired, status)
+		assert.Equal(t, models.PaymentStatusDeclined, declined.Status)
+		assert.NotEmpty(t, declined.FailureReason)
+		assert.Equal(t, models.OrderStatusPending, orderStatus(t, order.ID))
+
+		// The order can be paid again with another payment method
+		status, payment := pay(t, authToken, order.ID, clients.FakeOutcomeSuccess)
+		require.Equal(t, http.StatusOK, status)
+		assert.NotEqual(t, declined.ID, payment.ID)
+		assert.Equal(t, models.OrderStatusConfirmed, orderStatus(t, order.ID))
+	})
+
+	t.Run("ThreeDSecureSettledByWebhook", func(t *testing.T) {
+		order := createOrder(t)
+
+		status, payment := pay(t, authToken, order.ID, clients.FakeOutcome3DS)
+		require.Equal(t, http.StatusAccepted, status)
+		assert.Equal(t, models.PaymentStatusRequiresAction, payment.Status)
+		assert.NotEmpty(t, payment.ActionURL)
+		assert.Equal(t, models.OrderStatusPending, orderStatus(t, order.ID))
+
+		// Paying again while the action is outstanding returns the same payment
+		status, again := pay(t, authToken, order.ID, clients.FakeOutcomeSuccess)
+		assert.Equal(t, http.StatusAccepted, status)
+		assert.Equal(t, payment.ID, again.ID)
+
+		payload, signature, err := payments.CompleteAction(payment.ProviderRef, true)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, webhook(t, payload, signature))
+
+		assert.Equal(t, models.PaymentStatusSucceeded, paymentStatus(t, payment.ID))
+		assert.Equal(t, models.OrderStatusConfirmed, orderStatus(t, order.ID))
+
+		// A redelivered webhook changes nothing
+		assert.Equal(t, http.StatusNoContent, webhook(t, payload, signature))
+		assert.Equal(t, models.OrderStatusConfirmed, orderStatus(t, order.ID))
+	})
+
+	t.Run("ThreeDSecureFailed", func(t *testing.T) {
+		order := createOrder(t)
+
+		status, payment := pay(t, authToken, order.ID, clients.FakeOutcome3DS)
+		require.Equal(t, http.StatusAccepted, status)
+
+		payload, signature, err := payments.CompleteAction(payment.ProviderRef, false)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, webhook(t, payload, signature))
+
+		assert.Equal(t, models.PaymentStatusDeclined, paymentStatus(t, payment.ID))
+		assert.Equal(t, models.OrderStatusPending, orderStatus(t, order.ID))
+	})
+
+	t.Run("WebhookSignatureRequired", func(t *testing.T) {
+		order := createOrder(t)
+		status, payment := pay(t, authToken, order.ID, clients.FakeOutcome3DS)
+		require.Equal(t, http.StatusAccepted, status)
+
+		forged := []byte(`{"id":"evt-1","provider_ref":"` + payment.ProviderRef + `","status":"succeeded"}`)
+		assert.Equal(t, http.StatusUnauthorized, webhook(t, forged, ""))
+		assert.Equal(t, http.StatusUnauthorized, webhook(t, forged,
+			clients.SignPaymentWebhook("wrong-secret", forged, time.Now())))
+		assert.Equal(t, http.StatusUnauthorized, webhook(t, forged,
+			clients.SignPaymentWebhook("test-webhook-secret", forged, time.Now().Add(-time.Hour))),
+			"stale signatures are rejected, so captured webhooks cannot be replayed")
+
+		// A signature does not carry over to another payload
+		signature := clients.SignPaymentWebhook("test-webhook-secret", forged, time.Now())
+		tampered := []byte(strings.Replace(string(forged), "evt-1", "evt-2", 1))
+		assert.Equal(t, http.StatusUnauthorized, webhook(t, tampered, signature))
+
+		unknown := []byte(`{"id":"evt-3","provider_ref":"fake_unknown","status":"succeeded"}`)
+		assert.Equal(t, http.StatusNotFound, webhook(t, unknown,
+			clients.SignPaymentWebhook("test-webhook-secret", unknown, time.Now())))
+
+		assert.Equal(t, models.PaymentStatusRequiresAction, paymentStatus(t, payment.ID))
+		assert.Equal(t, models.OrderStatusPending, orderStatus(t, order.ID))
+	})
+
+	t.Run("CancelRefundsPayment", func(t *testing.T) {
+		order := createOrder(t)
+		status, payment := pay(t, authToken, order.ID, clients.FakeOutcomeSuccess)
+		require.Equal(t, http.StatusOK, status)
+
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", authToken, order.ID, "cancel")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, models.PaymentStatusRefunded, paymentStatus(t, payment.ID))
+		assert.True(t, payments.Refunded(payment.ProviderRef))
+	})
+
+	t.Run("PaymentAfterCancellationIsRefunded", func(t *testing.T) {
+		order := createOrder(t)
+		status, payment := pay(t, authToken, order.ID, clients.FakeOutcome3DS)
+		require.Equal(t, http.StatusAccepted, status)
+
+		resp, err := MakeOrderActionRequest(t, "http://localhost:8083", authToken, order.ID, "cancel")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// The customer completes the challenge after all
+		payload, signature, err := payments.CompleteAction(payment.ProviderRef, true)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, webhook(t, payload, signature))
+
+		assert.Equal(t, models.OrderStatusCancelled, orderStatus(t, order.ID))
+		assert.Equal(t, models.PaymentStatusRefunded, paymentStatus(t, payment.ID))
+		assert.True(t, payments.Refunded(payment.ProviderRef))
+	})
+
+	t.Run("ForeignOrderIsNotFound", func(t *testing.T) {
+		order := createOrder(t)
+
+		status, _ := pay(t, otherToken, order.ID, clients.FakeOutcomeSuccess)
+		assert.Equal(t, http.StatusNotFound, status)
+		assert.Equal(t, models.OrderStatusPending, orderStatus(t, order.ID))
+	})
+}
+
 func startTestServer(t *testing.T, cfg *config.Config) *http.Server {
+	server, _ := startPaymentTestServer(t, cfg)
+	return server
+}
+
+// startPaymentTestServer starts the application server like startTestServer
+// and also returns its fake payment provider, to settle 3-D Secure charges
+func startPaymentTestServer(t *testing.T, cfg *config.Config) (*http.Server, *clients.FakePaymentProvider) {
 	// Create handlers
-	orderHandler := handlers.NewOrderHandler(cfg.Services.AuthServiceURL, cfg.Services.ProductServiceURL)
+	authClient := clients.NewAuthServiceClient(cfg.Services.AuthServiceURL, cfg.Clients)
+	productClient := clients.NewProductServiceClient(cfg.Services.ProductServiceURL, cfg.Clients)
+	serviceTokens := clients.NewServiceTokenSource(authClient, cfg.Services)
+	paymentProvider, err := clients.NewFakePaymentProvider(cfg.Payments.FakeOutcome, cfg.Payments.WebhookSecret, cfg.Payments.WebhookTolerance)
+	require.NoError(t, err)
+	orderService := service.NewOrderService(authClient, productClient, paymentProvider, cfg.Products, cfg.Reservation, cfg.Pagination.CursorSecret, serviceTokens)
+	idempotencyService := service.NewIdempotencyService(cfg.Idempotency)
+	orderHandler := handlers.NewOrderHandler(orderService, idempotencyService)
+	cartHandler := handlers.NewCartHandler(service.NewCartService(orderService))
+	paymentHandler := handlers.NewPaymentHandler(service.NewPaymentService(paymentProvider, orderService, serviceTokens))
+
+	// Start delivering queued inventory updates to the product service
+	outboxService := service.NewOutboxService(cfg.Outbox, productClient, serviceTokens)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go outboxService.Run(ctx)
+	outboxHandler := handlers.NewOutboxHandler(outboxService)
 
 	// Create mux
 	mux := http.NewServeMux()
@@ -336,14 +1621,63 @@ func startTestServer(t *testing.T, cfg *config.Config) *http.Server {
 		}
 	})
 
-	// Order by ID endpoint
+	// Order by ID, status history, payment and status transition endpoints
 	mux.HandleFunc("/api/v1/order/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/history"):
+			orderHandler.GetOrderHistory(w, r)
+		case r.Method == http.MethodGet:
 			orderHandler.GetOrderByID(w, r)
-		} else {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/pay"):
+			paymentHandler.PayOrder(w, r)
+		case r.Method == http.MethodPost:
+			// Status transitions: /api/v1/order/{id}/cancel|confirm|ship|deliver
+			orderHandler.UpdateOrderStatus(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Cart endpoints
+	mux.HandleFunc("/api/v1/cart", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			cartHandler.GetCart(w, r)
+		case http.MethodPut:
+			cartHandler.ReplaceCart(w, r)
+		case http.MethodDelete:
+			cartHandler.ClearCart(w, r)
+		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/api/v1/cart/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/cart/checkout" && r.Method == http.MethodPost:
+			cartHandler.Checkout(w, r)
+		case r.URL.Path == "/api/v1/cart/items" && r.Method == http.MethodPost:
+			cartHandler.AddItem(w, r)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/cart/items/") && r.Method == http.MethodPut:
+			cartHandler.UpdateItem(w, r)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/cart/items/") && r.Method == http.MethodDelete:
+			cartHandler.RemoveItem(w, r)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+
+	// Admin outbox endpoints
+	mux.HandleFunc("/api/v1/admin/outbox", outboxHandler.ListMessages)
+	mux.HandleFunc("/api/v1/admin/outbox/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/replay") {
+			outboxHandler.ReplayMessage(w, r)
+		} else {
+			outboxHandler.GetMessage(w, r)
+		}
+	})
+
+	// Payment provider webhooks, authenticated by their signature
+	mux.HandleFunc("/api/v1/payments/webhook", paymentHandler.PaymentWebhook)
 
 	// My orders endpoint
 	mux.HandleFunc("/api/v1/my-orders", func(w http.ResponseWriter, r *http.Request) {
@@ -356,14 +1690,14 @@ func startTestServer(t *testing.T, cfg *config.Config) *http.Server {
 
 	// Apply middleware
 	handler := middleware.CORSMiddleware()(mux)
+	authHandler := middleware.AuthMiddleware(cfg)(handler)
 
 	// Apply auth middleware to protected routes
 	protectedHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if the request is for a protected endpoint
-		if strings.HasPrefix(r.URL.Path, "/api/v1/order") || strings.HasPrefix(r.URL.Path, "/api/v1/my-orders") {
-			// Apply auth middleware
-			authMiddleware := middleware.AuthMiddleware(cfg)
-			authMiddleware(handler).ServeHTTP(w, r)
+		if strings.HasPrefix(r.URL.Path, "/api/v1/order") || strings.HasPrefix(r.URL.Path, "/api/v1/my-orders") ||
+			strings.HasPrefix(r.URL.Path, "/api/v1/cart") || strings.HasPrefix(r.URL.Path, "/api/v1/admin") {
+			authHandler.ServeHTTP(w, r)
 		} else {
 			// Serve unprotected routes directly
 			handler.ServeHTTP(w, r)
@@ -383,5 +1717,5 @@ func startTestServer(t *testing.T, cfg *config.Config) *http.Server {
 		}
 	}()
 
-	return server
+	return server, paymentProvider
 }
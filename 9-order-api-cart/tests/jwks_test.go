@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"order-api-cart/config"
+	"order-api-cart/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSigningKey is a private key with the JWK that publishes its public half
+type testSigningKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+	jwk    map[string]string
+}
+
+func newEd25519TestKey(t *testing.T, kid string) *testSigningKey {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &testSigningKey{
+		kid:    kid,
+		method: jwt.SigningMethodEdDSA,
+		key:    priv,
+		jwk: map[string]string{
+			"kty": "OKP", "kid": kid, "use": "sig", "alg": "EdDSA", "crv": "Ed25519",
+			"x": base64.RawURLEncoding.EncodeToString(pub),
+		},
+	}
+}
+
+func newRSATestKey(t *testing.T, kid string) *testSigningKey {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return &testSigningKey{
+		kid:    kid,
+		method: jwt.SigningMethodRS256,
+		key:    priv,
+		jwk: map[string]string{
+			"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+		},
+	}
+}
+
+// sign issues a token for userID the way the auth service does
+func (k *testSigningKey) sign(t *testing.T, userID string) string {
+	token := jwt.NewWithClaims(k.method, jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = k.kid
+	tokenString, err := token.SignedString(k.key)
+	require.NoError(t, err)
+	return tokenString
+}
+
+// jwksDocument renders keys as a JWKS document
+func jwksDocument(t *testing.T, keys ...*testSigningKey) []byte {
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	return data
+}
+
+// writeJWKSFile writes keys to a JWKS file in a temporary directory
+func writeJWKSFile(t *testing.T, keys ...*testSigningKey) string {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwksDocument(t, keys...), 0o600))
+	return path
+}
+
+// newJWKSProtectedHandler wraps a handler that echoes the authenticated user ID
+func newJWKSProtectedHandler(jwtCfg config.JWTConfig) http.Handler {
+	cfg := &config.Config{JWT: jwtCfg}
+	return middleware.AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+		w.Write([]byte(userID))
+	}))
+}
+
+func doAuthRequest(handler http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/my-orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthMiddleware_JWKSFile(t *testing.T) {
+	edKey := newEd25519TestKey(t, "ed-key")
+	rsaKey := newRSATestKey(t, "rsa-key")
+	handler := newJWKSProtectedHandler(config.JWTConfig{
+		Secret:       "test-secret-key",
+		JWKSFile:     writeJWKSFile(t, edKey, rsaKey),
+		JWKSCacheTTL: time.Minute,
+	})
+
+	t.Run("EdDSA token", func(t *testing.T) {
+		rec := doAuthRequest(handler, edKey.sign(t, "user-1"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user-1", rec.Body.String())
+	})
+
+	t.Run("RS256 token", func(t *testing.T) {
+		rec := doAuthRequest(handler, rsaKey.sign(t, "user-2"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user-2", rec.Body.String())
+	})
+
+	t.Run("HS256 token with shared secret is rejected", func(t *testing.T) {
+		rec := doAuthRequest(handler, GenerateTestJWT("user-1"))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("unknown key is rejected", func(t *testing.T) {
+		rec := doAuthRequest(handler, newEd25519TestKey(t, "other-key").sign(t, "user-1"))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("key used with the wrong kid is rejected", func(t *testing.T) {
+		forged := *edKey
+		forged.kid = rsaKey.kid
+		rec := doAuthRequest(handler, forged.sign(t, "user-1"))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestAuthMiddleware_JWKSURL(t *testing.T) {
+	oldKey := newEd25519TestKey(t, "old-key")
+	newKey := newEd25519TestKey(t, "new-key")
+
+	published := jwksDocument(t, oldKey)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(published)
+	}))
+	defer server.Close()
+
+	handler := newJWKSProtectedHandler(config.JWTConfig{
+		JWKSURL:      server.URL,
+		JWKSCacheTTL: time.Minute,
+	})
+
+	for i := 0; i < 3; i++ {
+		rec := doAuthRequest(handler, oldKey.sign(t, "user-1"))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Equal(t, 1, fetches, "key set should be cached between requests")
+
+	// After a rotation the first token with the new kid triggers a refetch
+	published = jwksDocument(t, oldKey, newKey)
+	rec := doAuthRequest(handler, newKey.sign(t, "user-1"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, fetches)
+}
+
+func TestAuthMiddleware_JWKSFileFallback(t *testing.T) {
+	key := newEd25519TestKey(t, "ed-key")
+
+	// Nothing listens on the URL, so keys come from the file
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	handler := newJWKSProtectedHandler(config.JWTConfig{
+		JWKSURL:      server.URL,
+		JWKSFile:     writeJWKSFile(t, key),
+		JWKSCacheTTL: time.Minute,
+	})
+
+	rec := doAuthRequest(handler, key.sign(t, "user-1"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"testing"
+
+	"order-api-cart/database"
+	"order-api-cart/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrateLegacyProductIDs migrates tables created when product IDs were
+// UUIDs: order items keep theirs as legacy_product_id, cart items are dropped
+// and pending outbox messages with UUIDs are dead-lettered
+func TestMigrateLegacyProductIDs(t *testing.T) {
+	SetupTestDB(t)
+	defer CleanupTestDB(t)
+	db := database.GetDB()
+
+	// Turn the fresh schema back into the one with UUID product IDs
+	for _, statement := range []string{
+		`ALTER TABLE order_items ALTER COLUMN product_id TYPE uuid USING NULL`,
+		`ALTER TABLE cart_items ALTER COLUMN product_id TYPE uuid USING NULL`,
+		`ALTER TABLE outbox_messages ALTER COLUMN product_id TYPE text`,
+	} {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+
+	orderID, itemID, legacyProductID := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	cartID := uuid.New().String()
+	require.NoError(t, db.Exec(`INSERT INTO orders (id, user_id, status, total, created_at, updated_at)
+		VALUES (?, ?, 'confirmed', 10, now(), now())`, orderID, uuid.New().String()).Error)
+	require.NoError(t, db.Exec(`INSERT INTO order_items (id, order_id, product_id, quantity, price, created_at, updated_at)
+		VALUES (?, ?, ?, 1, 10, now(), now())`, itemID, orderID, legacyProductID).Error)
+	require.NoError(t, db.Exec(`INSERT INTO carts (id, user_id, created_at, updated_at)
+		VALUES (?, ?, now(), now())`, cartID, uuid.New().String()).Error)
+	require.NoError(t, db.Exec(`INSERT INTO cart_items (id, cart_id, product_id, quantity, price, created_at, updated_at)
+		VALUES (?, ?, ?, 1, 10, now(), now())`, uuid.New().String(), cartID, uuid.New().String()).Error)
+	for _, message := range []struct{ key, productID string }{
+		{"inventory.decrement:" + uuid.New().String(), legacyProductID},
+		{"inventory.decrement:" + uuid.New().String(), "42"},
+	} {
+		require.NoError(t, db.Exec(`INSERT INTO outbox_messages
+			(id, order_id, order_item_id, type, product_id, change, idempotency_key, status, next_attempt_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, -1, ?, ?, now(), now(), now())`,
+			uuid.New().String(), orderID, itemID, models.OutboxInventoryDecrement, message.productID,
+			message.key, models.OutboxStatusPending).Error)
+	}
+
+	require.NoError(t, database.Migrate())
+	// Running it again changes nothing
+	require.NoError(t, database.Migrate())
+
+	t.Run("OrderItemsKeepTheirUUIDs", func(t *testing.T) {
+		var item struct {
+			ProductID       uint
+			LegacyProductID string
+		}
+		require.NoError(t, db.Raw(`SELECT product_id, legacy_product_id FROM order_items WHERE id = ?`, itemID).
+			Scan(&item).Error)
+		assert.Equal(t, uint(0), item.ProductID)
+		assert.Equal(t, legacyProductID, item.LegacyProductID)
+
+		// New items do not need a legacy ID
+		require.NoError(t, db.Create(&models.OrderItem{OrderID: orderID, ProductID: 7, Quantity: 1, Price: 5}).Error)
+	})
+
+	t.Run("CartItemsAreDropped", func(t *testing.T) {
+		var count int64
+		require.NoError(t, db.Model(&models.CartItem{}).Count(&count).Error)
+		assert.Zero(t, count)
+		require.NoError(t, db.Create(&models.CartItem{CartID: cartID, ProductID: 7, Quantity: 1, Price: 5}).Error)
+	})
+
+	t.Run("OutboxMessagesWithUUIDsAreDeadLettered", func(t *testing.T) {
+		var messages []models.OutboxMessage
+		require.NoError(t, db.Order("product_id").Find(&messages).Error)
+		require.Len(t, messages, 2)
+		assert.Equal(t, uint(0), messages[0].ProductID)
+		assert.Equal(t, models.OutboxStatusDead, messages[0].Status)
+		assert.NotEmpty(t, messages[0].LastError)
+		assert.Equal(t, uint(42), messages[1].ProductID)
+		assert.Equal(t, models.OutboxStatusPending, messages[1].Status)
+	})
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"order-api-cart/clients"
+	"order-api-cart/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchProductServer is a product service stand-in serving GET /products?ids=
+// that records how many requests it received and how many overlapped. Like the
+// real product service it rejects IDs that are not numeric; products from
+// missingProductIDs on do not exist.
+type batchProductServer struct {
+	*httptest.Server
+	requests    atomic.Int32
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	batchSizes  []int
+	mu          sync.Mutex
+	delay       time.Duration
+}
+
+func newBatchProductServer(t *testing.T, delay time.Duration) *batchProductServer {
+	s := &batchProductServer{delay: delay}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/products" || !r.URL.Query().Has("ids") {
+			http.NotFound(w, r)
+			return
+		}
+		s.requests.Add(1)
+		current := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for {
+			max := s.maxInFlight.Load()
+			if current <= max || s.maxInFlight.CompareAndSwap(max, current) {
+				break
+			}
+		}
+		time.Sleep(s.delay)
+
+		ids := strings.Split(r.URL.Query().Get("ids"), ",")
+		s.mu.Lock()
+		s.batchSizes = append(s.batchSizes, len(ids))
+		s.mu.Unlock()
+
+		var products []models.ExternalProduct
+		for _, part := range ids {
+			id, err := strconv.ParseUint(part, 10, 32)
+			if err != nil {
+				http.Error(w, "Invalid product ID", http.StatusBadRequest)
+				return
+			}
+			if id >= missingProductIDs {
+				continue
+			}
+			products = append(products, models.ExternalProduct{ID: uint(id), Name: "Product " + part, Price: 1})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"products": products})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// missingProductIDs is the first ID batchProductServer does not know
+const missingProductIDs = 1000
+
+func productIDs(n int) []uint {
+	ids := make([]uint, n)
+	for i := range ids {
+		ids[i] = uint(i + 1)
+	}
+	return ids
+}
+
+func TestProductCache_BatchesAndBoundsConcurrency(t *testing.T) {
+	server := newBatchProductServer(t, 50*time.Millisecond)
+	cache := clients.NewProductCache(clients.NewProductServiceClient(server.URL, testClientConfig()), time.Minute, 10, 2)
+
+	products, err := cache.GetProducts(context.Background(), productIDs(45), "")
+	require.NoError(t, err)
+
+	assert.Len(t, products, 45)
+	assert.Equal(t, int32(5), server.requests.Load(), "45 IDs in batches of 10")
+	assert.LessOrEqual(t, server.maxInFlight.Load(), int32(2), "at most 2 concurrent requests")
+	assert.ElementsMatch(t, []int{10, 10, 10, 10, 5}, server.batchSizes)
+}
+
+func TestProductCache_ServesFromCacheUntilExpiry(t *testing.T) {
+	server := newBatchProductServer(t, 0)
+	cache := clients.NewProductCache(clients.NewProductServiceClient(server.URL, testClientConfig()), 100*time.Millisecond, 50, 4)
+
+	_, err := cache.GetProducts(context.Background(), []uint{1, 2}, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), server.requests.Load())
+
+	// Cached IDs are not requested again; only the new one is
+	products, err := cache.GetProducts(context.Background(), []uint{1, 2, 3, 1}, "")
+	require.NoError(t, err)
+	assert.Len(t, products, 3)
+	assert.Equal(t, int32(2), server.requests.Load())
+	assert.Equal(t, []int{2, 1}, server.batchSizes)
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = cache.GetProducts(context.Background(), []uint{1}, "")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), server.requests.Load(), "expired entries are refetched")
+}
+
+func TestProductCache_UnknownProductsAreOmitted(t *testing.T) {
+	server := newBatchProductServer(t, 0)
+	cache := clients.NewProductCache(clients.NewProductServiceClient(server.URL, testClientConfig()), time.Minute, 50, 4)
+
+	products, err := cache.GetProducts(context.Background(), []uint{1, missingProductIDs}, "")
+	require.NoError(t, err)
+
+	assert.Contains(t, products, uint(1))
+	assert.NotContains(t, products, uint(missingProductIDs))
+}
+
+func TestProductCache_PartialFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := strings.Split(r.URL.Query().Get("ids"), ",")
+		if ids[0] == "2" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var products []models.ExternalProduct
+		for _, part := range ids {
+			id, _ := strconv.ParseUint(part, 10, 32)
+			products = append(products, models.ExternalProduct{ID: uint(id)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"products": products})
+	}))
+	t.Cleanup(server.Close)
+	cache := clients.NewProductCache(clients.NewProductServiceClient(server.URL, testClientConfig()), time.Minute, 1, 1)
+
+	products, err := cache.GetProducts(context.Background(), []uint{1, 2}, "")
+
+	assert.Error(t, err)
+	assert.Contains(t, products, uint(1), "successful batches are still returned")
+	assert.NotContains(t, products, uint(2))
+}
@@ -0,0 +1,232 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"order-api-cart/clients"
+	"order-api-cart/config"
+	"order-api-cart/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClientConfig is a service client configuration with short delays, so
+// retries and breaker cooldowns pass quickly
+func testClientConfig() config.ClientConfig {
+	return config.ClientConfig{
+		Timeout:         time.Second,
+		MaxRetries:      2,
+		RetryBaseDelay:  10 * time.Millisecond,
+		RetryMaxDelay:   50 * time.Millisecond,
+		BreakerFailures: 3,
+		BreakerCooldown: 200 * time.Millisecond,
+	}
+}
+
+// flakyServer is a service stand-in that answers each request with the
+// handler for its number (starting at 1) and counts the requests it received
+type flakyServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newFlakyServer(t *testing.T, handler func(n int32, w http.ResponseWriter, r *http.Request)) *flakyServer {
+	s := &flakyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(s.requests.Add(1), w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func writeProduct(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.ExternalProduct{ID: 1, Name: "Product", Price: 1, Quantity: 10})
+}
+
+func TestServiceClient_RetriesReadsOnServerErrors(t *testing.T) {
+	server := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		if n < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeProduct(w, r)
+	})
+	client := clients.NewProductServiceClient(server.URL, testClientConfig())
+
+	product, err := client.GetProductByID(context.Background(), 1, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, uint(1), product.ID)
+	assert.Equal(t, int32(3), server.requests.Load(), "two failed attempts, then a successful one")
+	assert.Equal(t, clients.BreakerClosed, client.Breaker().State(), "the success resets the failure count")
+}
+
+func TestServiceClient_GivesUpAfterMaxRetries(t *testing.T) {
+	server := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	cfg := testClientConfig()
+	cfg.BreakerFailures = 10
+	client := clients.NewProductServiceClient(server.URL, cfg)
+
+	_, err := client.GetProductByID(context.Background(), 1, "")
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), server.requests.Load(), "one attempt plus two retries")
+}
+
+func TestServiceClient_DoesNotRetryClientErrors(t *testing.T) {
+	server := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	client := clients.NewProductServiceClient(server.URL, testClientConfig())
+
+	_, err := client.GetProductByID(context.Background(), 2, "")
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), server.requests.Load())
+	assert.Equal(t, clients.BreakerClosed, client.Breaker().State(), "a 404 is not the service failing")
+}
+
+func TestServiceClient_DoesNotRetryWrites(t *testing.T) {
+	server := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	client := clients.NewProductServiceClient(server.URL, testClientConfig())
+
+	err := client.UpdateProductQuantity(context.Background(), 1, -1, models.InventoryReasonSale, nil, "key-1", "")
+
+	var statusErr *clients.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	assert.Equal(t, int32(1), server.requests.Load(), "writes are sent once")
+}
+
+func TestServiceClient_RetriesAttemptsThatTimeOut(t *testing.T) {
+	server := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		if n == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		writeProduct(w, r)
+	})
+	cfg := testClientConfig()
+	cfg.Timeout = 100 * time.Millisecond
+	client := clients.NewProductServiceClient(server.URL, cfg)
+
+	start := time.Now()
+	product, err := client.GetProductByID(context.Background(), 1, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, uint(1), product.ID)
+	assert.Equal(t, int32(2), server.requests.Load())
+	assert.Less(t, time.Since(start), time.Second, "the slow attempt is cut off by its timeout")
+}
+
+func TestServiceClient_CancelledContextStopsRetries(t *testing.T) {
+	server := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+	client := clients.NewProductServiceClient(server.URL, testClientConfig())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetProductByID(ctx, 1, "")
+
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, int32(1), server.requests.Load(), "a cancelled call is not retried")
+	assert.Equal(t, clients.BreakerClosed, client.Breaker().State(), "the caller giving up is not the service failing")
+}
+
+func TestServiceClient_CircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	server := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		writeProduct(w, r)
+	})
+	cfg := testClientConfig()
+	cfg.MaxRetries = 0
+	client := clients.NewProductServiceClient(server.URL, cfg)
+	ctx := context.Background()
+
+	t.Run("OpensAfterConsecutiveFailures", func(t *testing.T) {
+		for i := 0; i < cfg.BreakerFailures; i++ {
+			_, err := client.GetProductByID(ctx, 1, "")
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, clients.ErrCircuitOpen)
+		}
+		assert.Equal(t, clients.BreakerOpen, client.Breaker().State())
+	})
+
+	t.Run("FailsFastWhileOpen", func(t *testing.T) {
+		before := server.requests.Load()
+		_, err := client.GetProductByID(ctx, 1, "")
+
+		assert.ErrorIs(t, err, clients.ErrCircuitOpen)
+		assert.Equal(t, before, server.requests.Load(), "the service is not contacted")
+	})
+
+	t.Run("FailedTrialReopens", func(t *testing.T) {
+		time.Sleep(cfg.BreakerCooldown)
+		assert.Equal(t, clients.BreakerHalfOpen, client.Breaker().State())
+
+		before := server.requests.Load()
+		_, err := client.GetProductByID(ctx, 1, "")
+		assert.NotErrorIs(t, err, clients.ErrCircuitOpen)
+		assert.Equal(t, before+1, server.requests.Load(), "a single trial call is let through")
+		assert.Equal(t, clients.BreakerOpen, client.Breaker().State())
+	})
+
+	t.Run("SuccessfulTrialCloses", func(t *testing.T) {
+		healthy.Store(true)
+		time.Sleep(cfg.BreakerCooldown)
+
+		product, err := client.GetProductByID(ctx, 1, "")
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), product.ID)
+		assert.Equal(t, clients.BreakerClosed, client.Breaker().State())
+	})
+}
+
+func TestServiceClient_BreakersArePerService(t *testing.T) {
+	authServer := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	productServer := newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		writeProduct(w, r)
+	})
+	cfg := testClientConfig()
+	cfg.MaxRetries = 0
+	authClient := clients.NewAuthServiceClient(authServer.URL, cfg)
+	productClient := clients.NewProductServiceClient(productServer.URL, cfg)
+	ctx := context.Background()
+
+	for i := 0; i < cfg.BreakerFailures; i++ {
+		authClient.GetUserByID(ctx, "u1", "")
+	}
+	_, err := authClient.GetUserByID(ctx, "u1", "")
+	assert.ErrorIs(t, err, clients.ErrCircuitOpen)
+
+	_, err = productClient.GetProductByID(ctx, 1, "")
+	assert.NoError(t, err, "the product service is unaffected by the auth service's breaker")
+	assert.Equal(t, clients.BreakerClosed, productClient.Breaker().State())
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"order-api-cart/clients"
+	"order-api-cart/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTokenServer stands in for the auth service's POST /auth/token, issuing
+// "token-<n>" for one second to the order-service client; from failFrom on it
+// answers 503
+func newTokenServer(t *testing.T, failFrom int32) *flakyServer {
+	return newFlakyServer(t, func(n int32, w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		if r.URL.Path != "/auth/token" || json.NewDecoder(r.Body).Decode(&req) != nil ||
+			req["grant_type"] != "client_credentials" || req["client_id"] != "order-service" || req["client_secret"] != "s3cret" {
+			http.Error(w, "invalid client credentials", http.StatusUnauthorized)
+			return
+		}
+		if failFrom > 0 && n >= failFrom {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": fmt.Sprintf("token-%d", n), "expires_in": 1})
+	})
+}
+
+func newTestTokenSource(server *flakyServer, secret string) *clients.ServiceTokenSource {
+	auth := clients.NewAuthServiceClient(server.URL, testClientConfig())
+	return clients.NewServiceTokenSource(auth, config.ServicesConfig{
+		ServiceClientID:     "order-service",
+		ServiceClientSecret: secret,
+	})
+}
+
+func TestServiceTokenSource_RenewsBeforeExpiry(t *testing.T) {
+	server := newTokenServer(t, 0)
+	tokens := newTestTokenSource(server, "s3cret")
+
+	for i := 0; i < 3; i++ {
+		auth, err := tokens.Authorization(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer token-1", auth)
+	}
+	assert.Equal(t, int32(1), server.requests.Load(), "the token is cached while fresh")
+
+	// Renewed once three quarters of its lifetime have passed
+	time.Sleep(800 * time.Millisecond)
+	auth, err := tokens.Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-2", auth)
+}
+
+func TestServiceTokenSource_KeepsValidTokenWhileAuthIsDown(t *testing.T) {
+	server := newTokenServer(t, 2)
+	tokens := newTestTokenSource(server, "s3cret")
+
+	auth, err := tokens.Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-1", auth)
+
+	time.Sleep(800 * time.Millisecond)
+	auth, err = tokens.Authorization(context.Background())
+	require.NoError(t, err, "the current token is still valid")
+	assert.Equal(t, "Bearer token-1", auth)
+
+	time.Sleep(300 * time.Millisecond)
+	_, err = tokens.Authorization(context.Background())
+	assert.Error(t, err, "an expired token is not used")
+}
+
+func TestServiceTokenSource_RejectedCredentials(t *testing.T) {
+	tokens := newTestTokenSource(newTokenServer(t, 0), "wrong")
+
+	_, err := tokens.Authorization(context.Background())
+	var statusErr *clients.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+}
+
+func TestServiceTokenSource_StaticToken(t *testing.T) {
+	auth, err := clients.NewServiceTokenSource(nil, config.ServicesConfig{ServiceToken: "static"}).
+		Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer static", auth)
+
+	auth, err = clients.NewServiceTokenSource(nil, config.ServicesConfig{}).Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, auth, "no token is configured")
+}
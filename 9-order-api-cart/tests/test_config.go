@@ -6,6 +6,8 @@ import (
 
 	"order-api-cart/config"
 	"order-api-cart/database"
+
+	"github.com/google/uuid"
 )
 
 // TestConfig holds test configuration
@@ -22,6 +24,13 @@ func LoadTestConfig() *TestConfig {
 	os.Setenv("AUTH_SERVICE_URL", "http://localhost:8084")
 	os.Setenv("PRODUCT_SERVICE_URL", "http://localhost:8085")
 	os.Setenv("JWT_SECRET", "test-secret-key")
+	os.Setenv("OUTBOX_POLL_INTERVAL", "50ms")
+	os.Setenv("OUTBOX_BASE_BACKOFF", "50ms")
+	os.Setenv("OUTBOX_MAX_ATTEMPTS", "3")
+	os.Setenv("PAYMENT_WEBHOOK_SECRET", "test-webhook-secret")
+	// Reservations need the service role in the mock product service, as in
+	// the real one
+	os.Setenv("SERVICE_AUTH_TOKEN", GenerateTestJWTWithRole(uuid.New().String(), "service"))
 
 	cfg := config.LoadConfig()
 	return &TestConfig{
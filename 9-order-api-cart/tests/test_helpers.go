@@ -5,13 +5,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"order-api-cart/clients"
 	"order-api-cart/models"
+	"order-api-cart/validation"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -21,7 +27,7 @@ import (
 // TestData holds test data for e2e tests
 type TestData struct {
 	UserID     string
-	ProductIDs []string
+	ProductIDs []uint
 	AuthToken  string
 }
 
@@ -30,9 +36,46 @@ type MockAuthService struct {
 	users map[string]*models.ExternalUser
 }
 
-// MockProductService mocks the product service for testing
+// MockProductService mocks the product service for testing. Quantity updates
+// arrive from the outbox dispatcher's goroutine, so state is guarded by mu.
 type MockProductService struct {
-	products map[string]*models.ExternalProduct
+	mu              sync.Mutex
+	products        map[uint]*models.ExternalProduct
+	appliedKeys     map[string]bool
+	adjustments     map[string]MockAdjustment
+	failUpdates     int
+	failStatus      int
+	reservations    map[uint]*mockReservation
+	reservationKeys map[string]uint
+	reserveDelay    time.Duration
+}
+
+// MockAdjustment is a stock adjustment applied through the mock, as the
+// product service records it for its sales statistics
+type MockAdjustment struct {
+	ProductID uint
+	Change    int
+	Reason    string
+	UnitPrice *float64
+}
+
+// mockReservationRequest and mockReservationItemRequest mirror the product
+// service's CreateReservationRequest and ReservationItemRequest, validation
+// included, so the mock rejects what the product service would
+type mockReservationRequest struct {
+	Items      []mockReservationItemRequest `json:"items" validate:"required,min=1,max=100,dive"`
+	TTLSeconds int                          `json:"ttl_seconds" validate:"omitempty,min=1"`
+}
+
+type mockReservationItemRequest struct {
+	ProductID uint `json:"product_id" validate:"required"`
+	Quantity  int  `json:"quantity" validate:"required,min=1"`
+}
+
+// mockReservation is a stock reservation held by the mock product service
+type mockReservation struct {
+	models.ExternalReservation
+	items map[uint]int
 }
 
 // NewMockAuthService creates a new mock auth service
@@ -45,7 +88,11 @@ func NewMockAuthService() *MockAuthService {
 // NewMockProductService creates a new mock product service
 func NewMockProductService() *MockProductService {
 	return &MockProductService{
-		products: make(map[string]*models.ExternalProduct),
+		products:        make(map[uint]*models.ExternalProduct),
+		appliedKeys:     make(map[string]bool),
+		adjustments:     make(map[string]MockAdjustment),
+		reservations:    make(map[uint]*mockReservation),
+		reservationKeys: make(map[string]uint),
 	}
 }
 
@@ -71,9 +118,16 @@ func (m *MockAuthService) GetUserByID(userID string) (*models.ExternalUser, erro
 	return user, nil
 }
 
+// MissingProductID is a product ID that no mock product service knows
+const MissingProductID uint = math.MaxUint32
+
+// lastProductID numbers the mock products. It is shared by all mocks, so
+// products of different tests never share an ID in the database.
+var lastProductID atomic.Uint32
+
 // CreateTestProduct creates a test product in the mock product service
 func (m *MockProductService) CreateTestProduct(t *testing.T, name string, price float64, quantity int) *models.ExternalProduct {
-	productID := uuid.New().String()
+	productID := uint(lastProductID.Add(1))
 	product := &models.ExternalProduct{
 		ID:          productID,
 		Name:        name,
@@ -81,37 +135,202 @@ func (m *MockProductService) CreateTestProduct(t *testing.T, name string, price
 		Price:       price,
 		Quantity:    quantity,
 		Category:    "test",
-		SKU:         fmt.Sprintf("TEST-%s", productID[:8]),
+		SKU:         fmt.Sprintf("TEST-%d", productID),
 		Images:      []string{},
 		CreatedAt:   time.Now().Format(time.RFC3339),
 		UpdatedAt:   time.Now().Format(time.RFC3339),
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.products[productID] = product
 	return product
 }
 
-// GetProductByID returns product by ID
-func (m *MockProductService) GetProductByID(productID string) (*models.ExternalProduct, error) {
+// GetProductByID returns a copy of the product with the given ID
+func (m *MockProductService) GetProductByID(productID uint) (*models.ExternalProduct, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	product, exists := m.products[productID]
 	if !exists {
 		return nil, fmt.Errorf("product not found")
 	}
-	return product, nil
+	productCopy := *product
+	return &productCopy, nil
 }
 
-// UpdateProductQuantity updates product quantity
-func (m *MockProductService) UpdateProductQuantity(productID string, quantityChange int) error {
+// UpdateProductQuantity updates product quantity. Like the real product
+// service, a change with an already applied idempotency key is a no-op.
+func (m *MockProductService) UpdateProductQuantity(productID uint, adjustment MockAdjustment, idempotencyKey string) error {
+	quantityChange := adjustment.Change
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	product, exists := m.products[productID]
 	if !exists {
 		return fmt.Errorf("product not found")
 	}
-	product.Quantity += quantityChange
-	if product.Quantity < 0 {
+	if idempotencyKey != "" && m.appliedKeys[idempotencyKey] {
+		return nil
+	}
+	if product.Quantity+quantityChange < 0 {
 		return fmt.Errorf("insufficient quantity")
 	}
+	product.Quantity += quantityChange
+	if idempotencyKey != "" {
+		m.appliedKeys[idempotencyKey] = true
+		adjustment.ProductID = productID
+		m.adjustments[idempotencyKey] = adjustment
+	}
 	return nil
 }
 
+// Adjustment returns the stock adjustment applied with idempotencyKey
+func (m *MockProductService) Adjustment(idempotencyKey string) (MockAdjustment, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	adjustment, ok := m.adjustments[idempotencyKey]
+	return adjustment, ok
+}
+
+// CreateReservation reserves the items' stock for ttl. Like the real product
+// service it takes every item out of stock or, if any product is short, none,
+// and returns the existing reservation for a repeated idempotency key.
+func (m *MockProductService) CreateReservation(items map[uint]int, ttl time.Duration, idempotencyKey string) (*models.ExternalReservation, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, exists := m.reservationKeys[idempotencyKey]; exists && idempotencyKey != "" {
+		reservation := m.reservations[id].ExternalReservation
+		return &reservation, false, nil
+	}
+	for productID, quantity := range items {
+		product, exists := m.products[productID]
+		if !exists {
+			return nil, false, fmt.Errorf("product not found")
+		}
+		if product.Quantity < quantity {
+			return nil, false, fmt.Errorf("insufficient quantity")
+		}
+	}
+	for productID, quantity := range items {
+		m.products[productID].Quantity -= quantity
+	}
+
+	reservation := &mockReservation{
+		ExternalReservation: models.ExternalReservation{
+			ID:        uint(len(m.reservations) + 1),
+			Status:    "held",
+			ExpiresAt: time.Now().Add(ttl),
+		},
+		items: items,
+	}
+	m.reservations[reservation.ID] = reservation
+	if idempotencyKey != "" {
+		m.reservationKeys[idempotencyKey] = reservation.ID
+	}
+	result := reservation.ExternalReservation
+	return &result, true, nil
+}
+
+// CloseReservation applies a "confirm" or "release" action to a reservation.
+// It returns an error if the reservation does not exist and false if the
+// action conflicts with the reservation's status.
+func (m *MockProductService) CloseReservation(id uint, action string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reservation, exists := m.reservations[id]
+	if !exists {
+		return false, fmt.Errorf("reservation not found")
+	}
+	switch {
+	case action == "confirm" && reservation.Status == "held":
+		reservation.Status = "confirmed"
+	case action == "release" && reservation.Status == "held":
+		m.restockReservation(reservation, "released")
+	case action == "confirm" && reservation.Status == "confirmed",
+		action == "release" && (reservation.Status == "released" || reservation.Status == "expired"):
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// ExpireReservation expires a held reservation as if its TTL had passed,
+// returning its stock
+func (m *MockProductService) ExpireReservation(id uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reservation, exists := m.reservations[id]; exists && reservation.Status == "held" {
+		m.restockReservation(reservation, "expired")
+	}
+}
+
+// ReservationStatus returns the status of a reservation, or "" if it does not
+// exist
+func (m *MockProductService) ReservationStatus(id uint) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reservation, exists := m.reservations[id]; exists {
+		return reservation.Status
+	}
+	return ""
+}
+
+// restockReservation closes a held reservation with status and returns its
+// items to stock. The caller holds mu.
+func (m *MockProductService) restockReservation(reservation *mockReservation, status string) {
+	for productID, quantity := range reservation.items {
+		m.products[productID].Quantity += quantity
+	}
+	reservation.Status = status
+}
+
+// SetProductPrice changes a product's price, e.g. to check that carts pick up
+// price changes
+func (m *MockProductService) SetProductPrice(productID uint, price float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if product, exists := m.products[productID]; exists {
+		product.Price = price
+	}
+}
+
+// SetProductQuantity sets a product's stock, e.g. to sell it out behind the
+// order service's back
+func (m *MockProductService) SetProductQuantity(productID uint, quantity int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if product, exists := m.products[productID]; exists {
+		product.Quantity = quantity
+	}
+}
+
+// FailQuantityUpdates makes the next n quantity updates fail with the given
+// HTTP status, e.g. 503 to exercise outbox retries
+func (m *MockProductService) FailQuantityUpdates(n, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failUpdates = n
+	m.failStatus = status
+}
+
+// DelayReservations makes reservation requests take at least d, so a test can
+// act while an order is being placed
+func (m *MockProductService) DelayReservations(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reserveDelay = d
+}
+
+// nextUpdateFailure consumes one injected failure and returns its status, or 0
+func (m *MockProductService) nextUpdateFailure() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failUpdates == 0 {
+		return 0
+	}
+	m.failUpdates--
+	return m.failStatus
+}
+
 // StartMockAuthService starts a mock auth service server and registers a
 // cleanup that shuts it down when the test ends, freeing the port for the
 // next test.
@@ -160,20 +379,42 @@ func StartMockProductService(t *testing.T, port string) *MockProductService {
 	mock := NewMockProductService()
 
 	mux := http.NewServeMux()
+	mux.HandleFunc("/products", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !r.URL.Query().Has("ids") {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Like the real product service, IDs must be numeric
+		products := []*models.ExternalProduct{}
+		for _, part := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			id, err := strconv.ParseUint(part, 10, 32)
+			if err != nil {
+				http.Error(w, "Invalid product ID", http.StatusBadRequest)
+				return
+			}
+			if product, err := mock.GetProductByID(uint(id)); err == nil {
+				products = append(products, product)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"products": products})
+	})
 	mux.HandleFunc("/products/", func(w http.ResponseWriter, r *http.Request) {
 		// Strip the "/products/" prefix, then split off any sub-path (e.g. "/quantity")
 		rest := r.URL.Path[len("/products/"):]
 		parts := strings.SplitN(rest, "/", 2)
-		productID := parts[0]
 		subpath := ""
 		if len(parts) == 2 {
 			subpath = parts[1]
 		}
 
-		if productID == "" {
-			http.Error(w, "Product ID required", http.StatusBadRequest)
+		parsedID, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
 			return
 		}
+		productID := uint(parsedID)
 
 		switch {
 		case r.Method == http.MethodGet && subpath == "":
@@ -186,15 +427,29 @@ func StartMockProductService(t *testing.T, port string) *MockProductService {
 			json.NewEncoder(w).Encode(product)
 
 		case r.Method == http.MethodPatch && subpath == "quantity":
+			if status := mock.nextUpdateFailure(); status != 0 {
+				http.Error(w, "injected failure", status)
+				return
+			}
 			var req struct {
-				Change int `json:"change"`
+				Change    int      `json:"change"`
+				Reason    string   `json:"reason"`
+				UnitPrice *float64 `json:"unit_price"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "Invalid request body", http.StatusBadRequest)
 				return
 			}
-			if err := mock.UpdateProductQuantity(productID, req.Change); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+			// Like the product service, a sale must remove stock and a
+			// return add it
+			if (req.Reason == models.InventoryReasonSale && req.Change >= 0) ||
+				(req.Reason == models.InventoryReasonReturn && req.Change <= 0) {
+				http.Error(w, "Validation failed", http.StatusBadRequest)
+				return
+			}
+			adjustment := MockAdjustment{Change: req.Change, Reason: req.Reason, UnitPrice: req.UnitPrice}
+			if err := mock.UpdateProductQuantity(productID, adjustment, r.Header.Get("Idempotency-Key")); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
 				return
 			}
 			w.WriteHeader(http.StatusOK)
@@ -204,6 +459,76 @@ func StartMockProductService(t *testing.T, port string) *MockProductService {
 		}
 	})
 
+	validator := validation.New()
+	mux.HandleFunc("/reservations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireReservationRole(w, r) {
+			return
+		}
+		// Unknown fields are rejected, so the order service's payload cannot
+		// drift from the product service's request type unnoticed
+		var req mockReservationRequest
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validator.ValidateStruct(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items := make(map[uint]int, len(req.Items))
+		for _, item := range req.Items {
+			items[item.ProductID] += item.Quantity
+		}
+		mock.mu.Lock()
+		delay := mock.reserveDelay
+		mock.mu.Unlock()
+		time.Sleep(delay)
+
+		reservation, created, err := mock.CreateReservation(items,
+			time.Duration(req.TTLSeconds)*time.Second, r.Header.Get("Idempotency-Key"))
+		if err != nil {
+			status := http.StatusConflict
+			if err.Error() == "product not found" {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(reservation)
+	})
+	mux.HandleFunc("/reservations/", func(w http.ResponseWriter, r *http.Request) {
+		// "/reservations/{id}/confirm" or "/reservations/{id}/release"
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/reservations/"), "/")
+		id, err := strconv.ParseUint(parts[0], 10, 32)
+		if r.Method != http.MethodPost || len(parts) != 2 || err != nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if !requireReservationRole(w, r) {
+			return
+		}
+
+		ok, err := mock.CloseReservation(uint(id), parts[1])
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case !ok:
+			http.Error(w, "reservation is no longer held", http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
 	server := &http.Server{Addr: ":" + port, Handler: mux}
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -216,27 +541,72 @@ func StartMockProductService(t *testing.T, port string) *MockProductService {
 	return mock
 }
 
+// WaitForProductQuantity waits until the outbox dispatcher has brought the
+// mock product's stock to want
+func WaitForProductQuantity(t *testing.T, mock *MockProductService, productID uint, want int) {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		product, err := mock.GetProductByID(productID)
+		return err == nil && product.Quantity == want
+	}, 5*time.Second, 50*time.Millisecond, "product %d quantity never reached %d", productID, want)
+}
+
+// requireReservationRole rejects a reservation request, like the product
+// service, unless its token has the service or admin role. It reports whether
+// the request may go on.
+func requireReservationRole(w http.ResponseWriter, r *http.Request) bool {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		http.Error(w, "Authorization header required", http.StatusUnauthorized)
+		return false
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(*jwt.Token) (interface{}, error) { return []byte(testJWTSecret()), nil })
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return false
+	}
+	if role, _ := claims["role"].(string); role != "service" && role != "admin" {
+		http.Error(w, "Reservations require the service or admin role", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // GenerateTestJWT generates a signed JWT token for testing.
 // It reads JWT_SECRET from the environment (falls back to "test-secret-key")
 // so the token is accepted by the auth middleware.
 func GenerateTestJWT(userID string) string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "test-secret-key"
-	}
+	return GenerateTestJWTWithRole(userID, "user")
+}
+
+// GenerateTestJWTWithRole generates a signed JWT token carrying the given role
+// claim, e.g. "admin" for endpoints that manage other users' orders.
+func GenerateTestJWTWithRole(userID, role string) string {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID,
+		"role":    role,
 		"exp":     time.Now().Add(24 * time.Hour).Unix(),
 	})
-	tokenString, err := token.SignedString([]byte(secret))
+	tokenString, err := token.SignedString([]byte(testJWTSecret()))
 	if err != nil {
 		panic(fmt.Sprintf("failed to generate test JWT: %v", err))
 	}
 	return tokenString
 }
 
+// testJWTSecret returns JWT_SECRET, falling back to "test-secret-key" like the
+// test configuration
+func testJWTSecret() string {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return secret
+	}
+	return "test-secret-key"
+}
+
 // CreateTestOrderRequest creates a test order request
-func CreateTestOrderRequest(productIDs []string, quantities []int) *models.OrderRequest {
+func CreateTestOrderRequest(productIDs []uint, quantities []int) *models.OrderRequest {
 	if len(productIDs) != len(quantities) {
 		panic("productIDs and quantities must have the same length")
 	}
@@ -269,6 +639,85 @@ func MakeOrderRequest(t *testing.T, baseURL string, authToken string, orderReq *
 	return client.Do(req)
 }
 
+// MakeOrderRequestWithKey makes an HTTP request to create an order with the
+// given Idempotency-Key header
+func MakeOrderRequestWithKey(t *testing.T, baseURL, authToken, idempotencyKey string, orderReq *models.OrderRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(orderReq)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", baseURL+"/api/v1/order", bytes.NewBuffer(jsonData))
+	assert.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+authToken)
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
+
+// MakeOrderActionRequest makes an HTTP request to change an order's status,
+// e.g. action "cancel" for POST /api/v1/order/{id}/cancel
+func MakeOrderActionRequest(t *testing.T, baseURL, authToken, orderID, action string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/order/%s/%s", baseURL, orderID, action), nil)
+	assert.NoError(t, err)
+
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
+
+// MakePaymentRequest makes an HTTP request to pay for an order with the given
+// payment method, e.g. one of the fake provider's outcomes
+func MakePaymentRequest(t *testing.T, baseURL, authToken, orderID, paymentMethod string) (*http.Response, error) {
+	jsonData, err := json.Marshal(models.PaymentRequest{PaymentMethod: paymentMethod})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/order/%s/pay", baseURL, orderID), bytes.NewBuffer(jsonData))
+	assert.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
+
+// MakeWebhookRequest delivers a payment webhook with the given signature
+func MakeWebhookRequest(t *testing.T, baseURL string, payload []byte, signature string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", baseURL+"/api/v1/payments/webhook", bytes.NewBuffer(payload))
+	assert.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(clients.PaymentSignatureHeader, signature)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
+
+// MakeCartRequest makes an HTTP request to a cart endpoint, e.g. method "POST"
+// and path "/items" for POST /api/v1/cart/items. A nil body sends no body.
+func MakeCartRequest(t *testing.T, baseURL, authToken, method, path string, body interface{}) (*http.Response, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		assert.NoError(t, err)
+		reader = bytes.NewReader(jsonData)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, baseURL+"/api/v1/cart"+path, reader)
+	assert.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	return client.Do(req)
+}
+
 // AssertOrderResponse validates order response
 func AssertOrderResponse(t *testing.T, resp *http.Response, expectedUserID string, expectedItemCount int) {
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)